@@ -0,0 +1,222 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+const maxAbuseScore = 100
+
+// Overwrite ratios are only meaningful once a user has placed this many pixels
+const minPlacementsForOverwriteRatio = 10
+
+func abuseSignalsKey(room, userID string) string {
+	return fmt.Sprintf("/%s/abuse/%s", room, userID)
+}
+
+func abuseReportKey(room, userID, reporter string) string {
+	return fmt.Sprintf("/%s/reports/%s/%s", room, userID, reporter)
+}
+
+func loadAbuseSignals(room, userID string) AbuseSignals {
+	signals := AbuseSignals{UserID: userID}
+	db, dbErr := getModerationDB()
+	if dbErr != 0 {
+		return signals
+	}
+	data, err := db.Get(abuseSignalsKey(room, userID))
+	if err != nil || len(data) == 0 {
+		return signals
+	}
+	if err := json.Unmarshal(data, &signals); err != nil {
+		logError("loadAbuseSignals", room, "failed to unmarshal signals for user %s: %v", userID, err)
+	}
+	return signals
+}
+
+// Apply update to the user's signals, save them and act on the new score
+func updateAbuseSignal(room, userID string, update func(*AbuseSignals)) {
+	if userID == "" || userID == "unknown" {
+		return
+	}
+	db, dbErr := getModerationDB()
+	if dbErr != 0 {
+		return
+	}
+	signals := loadAbuseSignals(room, userID)
+	update(&signals)
+	if err := putJSON(db, abuseSignalsKey(room, userID), signals); err != nil {
+		logError("updateAbuseSignal", room, "failed for user %s: %v", userID, err)
+		return
+	}
+	enforceAbuseThreshold(room, scoreAbuse(signals))
+}
+
+func recordRateLimitHit(room, userID string) {
+	updateAbuseSignal(room, userID, func(signals *AbuseSignals) {
+		signals.RateLimitHits++
+	})
+}
+
+// Count each author's placements and how many painted over someone else's pixel
+func updateAbuseSignals(room string, changes []PixelChange) {
+	placements := make(map[string]int64)
+	overwrites := make(map[string]int64)
+	for _, change := range changes {
+		userID := change.Pixel.UserID
+		placements[userID]++
+		if change.HadPrevious && change.Previous.UserID != "" && change.Previous.UserID != userID {
+			overwrites[userID]++
+		}
+	}
+	for userID, count := range placements {
+		updateAbuseSignal(room, userID, func(signals *AbuseSignals) {
+			signals.Placements += count
+			signals.Overwrites += overwrites[userID]
+		})
+	}
+}
+
+// Score the signals: rate-limit hits, overwrite ratio and reports add up to 30
+// points each and accounts younger than a week add up to 10
+func scoreAbuse(signals AbuseSignals) AbuseScore {
+	score := AbuseScore{AbuseSignals: signals, Components: make(map[string]int)}
+	score.Components["rateLimitHits"] = int(signals.RateLimitHits * 2)
+	if signals.Placements >= minPlacementsForOverwriteRatio {
+		score.Components["overwriteRatio"] = int(signals.Overwrites * 30 / signals.Placements)
+	}
+	score.Components["reports"] = int(signals.Reports * 10)
+	for name, value := range score.Components {
+		if value > 30 {
+			score.Components[name] = 30
+		}
+	}
+	if firstSeen := loadUserStats(signals.UserID).FirstSeen; firstSeen > 0 {
+		age := time.Since(time.UnixMilli(firstSeen))
+		score.AccountAgeHours = int64(age / time.Hour)
+		switch {
+		case age < 24*time.Hour:
+			score.Components["accountAge"] = 10
+		case age < 7*24*time.Hour:
+			score.Components["accountAge"] = 5
+		}
+	} else {
+		score.Components["accountAge"] = 10
+	}
+	for _, value := range score.Components {
+		score.Score += value
+	}
+	return score
+}
+
+// Restrict the user when the room has an abuse threshold and the score reaches it
+func enforceAbuseThreshold(room string, score AbuseScore) {
+	moderation := loadRoomSettings(room).Moderation
+	if moderation.AbuseScoreThreshold <= 0 || moderation.AbuseAction == "" || score.Score < moderation.AbuseScoreThreshold {
+		return
+	}
+	duration := moderation.MuteDurationMinutes
+	if moderation.AbuseAction == SanctionBan {
+		duration = moderation.BanDurationMinutes
+	}
+	if _, active := loadSanction(room, score.UserID, moderation.AbuseAction); active {
+		return
+	}
+	logInfo("enforceAbuseThreshold", room, "applying %s to user %s with score %d", moderation.AbuseAction, score.UserID, score.Score)
+	applySanction(room, Sanction{
+		UserID:    score.UserID,
+		Kind:      moderation.AbuseAction,
+		Reason:    fmt.Sprintf("automatic %s at abuse score %d", moderation.AbuseAction, score.Score),
+		ExpiresAt: sanctionExpiry(duration),
+	})
+}
+
+//export reportUser
+func reportUser(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	userID, _ := h.Query().Get("userId")
+	reporter, _ := h.Query().Get("reporterId")
+	if userID == "" || reporter == "" {
+		return handleHTTPError(h, fmt.Errorf("userId and reporterId parameters required"), 400)
+	}
+	if userID == reporter {
+		return handleHTTPError(h, fmt.Errorf("users cannot report themselves"), 400)
+	}
+	reason, _ := h.Query().Get("reason")
+	db, dbErr := getModerationDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	// Each reporter counts once per user
+	key := abuseReportKey(room, userID, reporter)
+	if data, err := db.Get(key); err == nil && len(data) > 0 {
+		return sendJSONResponse(h, map[string]interface{}{"reported": false, "duplicate": true})
+	}
+	if err := putJSON(db, key, map[string]interface{}{"reason": reason, "createdAt": time.Now().UnixMilli()}); err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	updateAbuseSignal(room, userID, func(signals *AbuseSignals) {
+		signals.Reports++
+	})
+	return sendJSONResponse(h, map[string]interface{}{"reported": true})
+}
+
+//export getAbuseScores
+func getAbuseScores(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if userID, _ := h.Query().Get("userId"); userID != "" {
+		return sendJSONResponse(h, scoreAbuse(loadAbuseSignals(room, userID)))
+	}
+	db, dbErr := getModerationDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	minScore := getIntParam(h, "minScore", 0)
+	prefix := fmt.Sprintf("/%s/abuse/", room)
+	keys, _ := db.List(prefix)
+	scores := make([]AbuseScore, 0, len(keys))
+	for _, key := range keys {
+		score := scoreAbuse(loadAbuseSignals(room, strings.TrimPrefix(key, prefix)))
+		if score.Score >= minScore {
+			scores = append(scores, score)
+		}
+	}
+	// Most suspicious first
+	sort.Slice(scores, func(i, j int) bool {
+		return scores[i].Score > scores[j].Score
+	})
+	return sendJSONResponse(h, scores)
+}
@@ -0,0 +1,156 @@
+package lib
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+	http "github.com/taubyte/go-sdk/http/event"
+)
+
+// Admin tokens live next to room metadata; the shared secret has no room
+func adminTokenKey(room string) string {
+	if room == "" {
+		return globalKeyPrefix + "admin/global"
+	}
+	return globalKeyPrefix + "admin/rooms/" + room
+}
+
+func loadAdminToken(room string) (AdminToken, bool) {
+	var token AdminToken
+	db, dbErr := getRoomsDB()
+	if dbErr != 0 {
+		return token, false
+	}
+	data, err := db.Get(adminTokenKey(room))
+	if err != nil || len(data) == 0 {
+		return token, false
+	}
+	if err := json.Unmarshal(data, &token); err != nil {
+		logError("loadAdminToken", room, "failed to unmarshal token: %v", err)
+		return token, false
+	}
+	return token, true
+}
+
+func deleteAdminToken(room string) {
+	if db, dbErr := getRoomsDB(); dbErr == 0 {
+		db.Delete(adminTokenKey(room))
+	}
+}
+
+// Config database key holding the deployment bootstrap secret. Operators seed
+// it when deploying; it is never served by getConfig and only unlocks the
+// first shared admin token.
+const bootstrapSecretKey = globalKeyPrefix + "bootstrap-secret"
+
+// Whether the request carries the deployment bootstrap secret in
+// X-Bootstrap-Secret. Fails closed when no secret was provisioned.
+func hasBootstrapSecret(h http.Event) bool {
+	provided, err := h.Headers().Get("X-Bootstrap-Secret")
+	if err != nil || provided == "" {
+		return false
+	}
+	db, dbErr := getConfigDB()
+	if dbErr != 0 {
+		return false
+	}
+	secret, err := db.Get(bootstrapSecretKey)
+	if err != nil || len(secret) == 0 {
+		return false
+	}
+	return subtle.ConstantTimeCompare(secret, []byte(provided)) == 1
+}
+
+// Read a bearer token from the Authorization header
+func requestAdminToken(h http.Event) string {
+	auth, err := h.Headers().Get("Authorization")
+	if err != nil || !strings.HasPrefix(auth, "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(auth[len("Bearer "):])
+}
+
+// Whether the raw token matches the stored admin token for the scope
+func adminTokenMatches(room, token string) bool {
+	stored, found := loadAdminToken(room)
+	if !found {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(stored.Hash), []byte(sessionTokenHash(token))) == 1
+}
+
+// Whether the request carries the shared admin secret or the room's admin token
+func hasAdminToken(h http.Event, room string) bool {
+	token := requestAdminToken(h)
+	if token == "" {
+		return false
+	}
+	return adminTokenMatches("", token) || (room != "" && adminTokenMatches(room, token))
+}
+
+// Refuse the request unless it carries the shared admin secret or the admin
+// token of the room named in the query. Responds 401 without a token and 403
+// with a wrong one.
+func requireAdmin(h http.Event) uint32 {
+	token := requestAdminToken(h)
+	if token == "" {
+		h.Headers().Set("WWW-Authenticate", "Bearer")
+		return handleHTTPError(h, fmt.Errorf("admin token required"), 401)
+	}
+	if adminTokenMatches("", token) {
+		return 0
+	}
+	if room, _ := h.Query().Get("room"); room != "" && adminTokenMatches(room, token) {
+		return 0
+	}
+	return handleHTTPError(h, fmt.Errorf("admin token not valid for this request"), 403)
+}
+
+//export provisionAdminToken
+func provisionAdminToken(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	// Without a room this issues the shared secret. The very first one needs
+	// the deployment bootstrap secret; after that only an admin can rotate it.
+	room, _ := h.Query().Get("room")
+	if room != "" {
+		if code := requireRoom(h, room); code != 0 {
+			return code
+		}
+	}
+	if _, found := loadAdminToken(""); found || room != "" {
+		if code := requireAdmin(h); code != 0 {
+			return code
+		}
+	} else if !hasBootstrapSecret(h) {
+		return handleHTTPError(h, fmt.Errorf("bootstrap secret required to claim the first admin token"), 401)
+	}
+	token, err := newSessionToken()
+	if err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	db, dbErr := getRoomsDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	stored := AdminToken{Room: room, Hash: sessionTokenHash(token), IssuedAt: time.Now().UnixMilli()}
+	if err := putJSON(db, adminTokenKey(room), stored); err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	logInfo("provisionAdminToken", room, "provisioned admin token for scope %q", room)
+	return sendJSONResponse(h, map[string]interface{}{
+		"token":    token,
+		"room":     room,
+		"issuedAt": stored.IssuedAt,
+	})
+}
@@ -0,0 +1,67 @@
+package lib
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+// Seconds since each pixel last changed; -1 marks pixels never painted or painted before timestamps were stored
+func buildAgeGrid(room string, now int64) ([][]int64, uint32) {
+	pixels, dbErr := loadRoomPixels(room)
+	if dbErr != 0 {
+		return nil, dbErr
+	}
+	width, height := roomSize(room)
+	ages := make([][]int64, height)
+	for y := range ages {
+		ages[y] = make([]int64, width)
+		for x := range ages[y] {
+			ages[y][x] = -1
+		}
+	}
+	for _, pixel := range pixels {
+		if pixel.Timestamp > 0 && pixel.Timestamp <= now && pixel.Y < height && pixel.X < width {
+			ages[pixel.Y][pixel.X] = (now - pixel.Timestamp) / 1000
+		}
+	}
+	return ages, 0
+}
+
+//export getAgeMap
+func getAgeMap(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	if _, code := checkAnonymousRead(h, room); code != 0 {
+		return code
+	}
+	setMaintenanceBanner(h, room)
+	if isShardedRoom(room) {
+		return handleHTTPError(h, fmt.Errorf("room %s is sharded and too large for a whole-canvas age map", room), 413)
+	}
+	now := time.Now().UnixMilli()
+	ages, dbErr := buildAgeGrid(room, now)
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	return sendJSONResponse(h, map[string]interface{}{
+		"width":      len(ages[0]),
+		"height":     len(ages),
+		"serverTime": now,
+		"ages":       ages,
+	})
+}
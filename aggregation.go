@@ -0,0 +1,119 @@
+package lib
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultAggregationWindow = 50 * time.Millisecond
+	maxAggregationWindow     = time.Second
+)
+
+type pendingBatch struct {
+	batch  PixelBatch
+	result chan uint32
+}
+
+// Batches of a room collected while its window is open
+type aggregationWindow struct {
+	pending []*pendingBatch
+}
+
+var (
+	aggregationMutex sync.Mutex
+	openWindows      = make(map[string]*aggregationWindow)
+	// Held while a room's window is validated and saved, so windows commit in order
+	roomCommitLocks = make(map[string]*sync.Mutex)
+)
+
+func aggregationWindowDuration() time.Duration {
+	window := loadGlobalConfig().PixelAggregationWindowMs
+	switch {
+	case window < 0:
+		return 0
+	case window == 0:
+		return defaultAggregationWindow
+	}
+	return time.Duration(window) * time.Millisecond
+}
+
+func roomCommitLock(room string) *sync.Mutex {
+	aggregationMutex.Lock()
+	defer aggregationMutex.Unlock()
+	lock, ok := roomCommitLocks[room]
+	if !ok {
+		lock = &sync.Mutex{}
+		roomCommitLocks[room] = lock
+	}
+	return lock
+}
+
+// Apply a batch through the room's aggregation window. The first batch opens
+// the window and, once it closes, commits every batch that joined meanwhile;
+// the others wait for their result.
+func aggregatePixelBatch(batch PixelBatch) uint32 {
+	window := aggregationWindowDuration()
+	if window <= 0 {
+		return applyPixelBatch(batch)
+	}
+	pending := &pendingBatch{batch: batch, result: make(chan uint32, 1)}
+	aggregationMutex.Lock()
+	if open, ok := openWindows[batch.Room]; ok {
+		open.pending = append(open.pending, pending)
+		aggregationMutex.Unlock()
+		return <-pending.result
+	}
+	open := &aggregationWindow{pending: []*pendingBatch{pending}}
+	openWindows[batch.Room] = open
+	aggregationMutex.Unlock()
+
+	time.Sleep(window)
+	aggregationMutex.Lock()
+	delete(openWindows, batch.Room)
+	aggregationMutex.Unlock()
+	commitAggregationWindow(batch.Room, open.pending)
+	return <-pending.result
+}
+
+// Validate the window's batches in arrival order and save them in as few
+// commits as possible. A user's second batch starts a new commit so the
+// cooldown and rate limit see their earlier pixels.
+func commitAggregationWindow(room string, pending []*pendingBatch) {
+	lock := roomCommitLock(room)
+	lock.Lock()
+	defer lock.Unlock()
+	if ensureRoomSchema(room) != 0 {
+		for _, waiting := range pending {
+			waiting.result <- 1
+		}
+		return
+	}
+	logDebug("commitAggregationWindow", room, "merging %d batches", len(pending))
+	var segment []*preparedBatch
+	var waiting []*pendingBatch
+	users := make(map[string]bool)
+	flush := func() {
+		if len(segment) > 0 {
+			for i, code := range commitPixelBatches(room, segment) {
+				waiting[i].result <- code
+			}
+		}
+		segment, waiting = nil, nil
+		users = make(map[string]bool)
+	}
+	for _, next := range pending {
+		if users[next.batch.UserID] {
+			flush()
+		}
+		prepared := preparePixelBatch(next.batch)
+		if prepared == nil {
+			next.result <- 0
+			continue
+		}
+		users[next.batch.UserID] = true
+		segment = append(segment, prepared)
+		waiting = append(waiting, next)
+	}
+	flush()
+}
@@ -0,0 +1,145 @@
+package lib
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+// Coordinate references in chat: "(34,56)" or "#34,56"
+var anchorPattern = regexp.MustCompile(`\(\s*(\d{1,4})\s*,\s*(\d{1,4})\s*\)|#(\d{1,4}),(\d{1,4})\b`)
+
+const (
+	maxAnchorsPerMessage = 10
+	// Mentions are counted per square region of this many cells a side
+	anchorRegionSize = 16
+)
+
+func anchorRegionKey(room string, rx, ry int) string {
+	return fmt.Sprintf("/%s/anchors/%d:%d", room, rx, ry)
+}
+
+// Coordinates referenced by the message that fall on the room's canvas
+func parseAnchors(room, text string) []CoordinateAnchor {
+	width, height := roomSize(room)
+	anchors := make([]CoordinateAnchor, 0)
+	for _, match := range anchorPattern.FindAllStringSubmatchIndex(text, -1) {
+		groups := 2
+		if match[2] < 0 {
+			groups = 6
+		}
+		x, _ := strconv.Atoi(text[match[groups]:match[groups+1]])
+		y, _ := strconv.Atoi(text[match[groups+2]:match[groups+3]])
+		if x >= width || y >= height {
+			continue
+		}
+		anchors = append(anchors, CoordinateAnchor{X: x, Y: y, Text: text[match[0]:match[1]], Offset: match[0]})
+		if len(anchors) == maxAnchorsPerMessage {
+			break
+		}
+	}
+	return anchors
+}
+
+// Count the message once against each region its anchors point into
+func recordAnchorMentions(room string, anchors []CoordinateAnchor) {
+	if len(anchors) == 0 {
+		return
+	}
+	db, dbErr := getStatsDB()
+	if dbErr != 0 {
+		return
+	}
+	seen := make(map[[2]int]bool)
+	for _, anchor := range anchors {
+		region := [2]int{anchor.X / anchorRegionSize, anchor.Y / anchorRegionSize}
+		if seen[region] {
+			continue
+		}
+		seen[region] = true
+		key := anchorRegionKey(room, region[0], region[1])
+		if err := writeCounter(db, key, readCounter(db, key)+1); err != nil {
+			logError("recordAnchorMentions", room, "failed: %v", err)
+		}
+	}
+}
+
+func clearAnchorMentions(room string) {
+	db, dbErr := getStatsDB()
+	if dbErr != 0 {
+		return
+	}
+	keys, _ := db.List(fmt.Sprintf("/%s/anchors/", room))
+	for _, key := range keys {
+		db.Delete(key)
+	}
+}
+
+// Regions ranked by how many chat messages referenced them, most discussed first
+func discussedRegions(room string, limit int) []DiscussedRegion {
+	regions := make([]DiscussedRegion, 0)
+	db, dbErr := getStatsDB()
+	if dbErr != 0 {
+		return regions
+	}
+	prefix := fmt.Sprintf("/%s/anchors/", room)
+	keys, _ := db.List(prefix)
+	for _, key := range keys {
+		var rx, ry int
+		if _, err := fmt.Sscanf(strings.TrimPrefix(key, prefix), "%d:%d", &rx, &ry); err != nil {
+			continue
+		}
+		regions = append(regions, DiscussedRegion{
+			Region:   Region{X: rx * anchorRegionSize, Y: ry * anchorRegionSize, Width: anchorRegionSize, Height: anchorRegionSize},
+			Mentions: readCounter(db, key),
+		})
+	}
+	sort.Slice(regions, func(i, j int) bool {
+		if regions[i].Mentions != regions[j].Mentions {
+			return regions[i].Mentions > regions[j].Mentions
+		}
+		if regions[i].Y != regions[j].Y {
+			return regions[i].Y < regions[j].Y
+		}
+		return regions[i].X < regions[j].X
+	})
+	if len(regions) > limit {
+		regions = regions[:limit]
+	}
+	return regions
+}
+
+//export getDiscussedRegions
+func getDiscussedRegions(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	if _, code := checkAnonymousRead(h, room); code != 0 {
+		return code
+	}
+	limit := getIntParam(h, "limit", defaultLeaderboardLimit)
+	if limit < 1 || limit > maxLeaderboardLimit {
+		return handleHTTPError(h, fmt.Errorf("limit must be between 1 and %d", maxLeaderboardLimit), 400)
+	}
+	return sendJSONResponse(h, map[string]interface{}{
+		"room":       room,
+		"regionSize": anchorRegionSize,
+		"regions":    discussedRegions(room, limit),
+	})
+}
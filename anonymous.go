@@ -0,0 +1,102 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	http "github.com/taubyte/go-sdk/http/event"
+)
+
+// Reads without an API key are limited per client IP over this window
+const anonymousReadWindow = time.Minute
+
+// Used when GlobalConfig.AnonymousReadsPerMinute is unset
+const defaultAnonymousReadsPerMinute = 30
+
+const anonymousUsagePrefix = globalKeyPrefix + "anonymous/"
+
+type anonymousUsage struct {
+	WindowStart int64 `json:"windowStart"`
+	WindowCount int64 `json:"windowCount"`
+}
+
+// Client address as reported by the gateway
+func clientIP(h http.Event) string {
+	if forwarded, err := h.Headers().Get("X-Forwarded-For"); err == nil && forwarded != "" {
+		ip, _, _ := strings.Cut(forwarded, ",")
+		return strings.TrimSpace(ip)
+	}
+	if ip, err := h.Headers().Get("X-Real-IP"); err == nil && ip != "" {
+		return ip
+	}
+	return "unknown"
+}
+
+// Count an anonymous read against the caller's IP; false once the window's allowance is used
+func recordAnonymousRead(ip string) bool {
+	limit := loadGlobalConfig().AnonymousReadsPerMinute
+	if limit == 0 {
+		limit = defaultAnonymousReadsPerMinute
+	}
+	if limit < 0 {
+		return true
+	}
+	db, dbErr := getKeyUsageDB()
+	if dbErr != 0 {
+		return true
+	}
+	var usage anonymousUsage
+	if data, err := db.Get(anonymousUsagePrefix + ip); err == nil && len(data) > 0 {
+		json.Unmarshal(data, &usage)
+	}
+	now := time.Now().UnixMilli()
+	if now-usage.WindowStart >= anonymousReadWindow.Milliseconds() {
+		usage = anonymousUsage{WindowStart: now}
+	}
+	if usage.WindowCount >= limit {
+		return false
+	}
+	usage.WindowCount++
+	if err := putJSON(db, anonymousUsagePrefix+ip, usage); err != nil {
+		logError("recordAnonymousRead", "", "failed to save usage for %s: %v", ip, err)
+	}
+	return true
+}
+
+// Gate a read endpoint for callers without a valid credential: private rooms are
+// refused and public ones are rate limited per IP. Returns whether the caller is anonymous.
+func checkAnonymousRead(h http.Event, room string) (bool, uint32) {
+	if requestAuthenticated(h, room) {
+		return false, 0
+	}
+	if loadRoomSettings(room).Private {
+		return true, handleHTTPError(h, fmt.Errorf("room %s requires an API key", room), 401)
+	}
+	if !recordAnonymousRead(clientIP(h)) {
+		h.Headers().Set("Retry-After", fmt.Sprintf("%d", int(anonymousReadWindow.Seconds())))
+		return true, handleHTTPError(h, fmt.Errorf("anonymous read limit exceeded"), 429)
+	}
+	return true, 0
+}
+
+// Hide who wrote each message from anonymous readers
+func redactMessages(messages []ChatMessage) {
+	for i := range messages {
+		messages[i].UserID, messages[i].Username = "", ""
+		if messages[i].Parent != nil {
+			messages[i].Parent.UserID, messages[i].Parent.Username = "", ""
+		}
+	}
+}
+
+// Copies of the pixels without placer identity, for rooms that anonymize contributors
+func anonymizePixels(pixels []Pixel) []Pixel {
+	anonymized := make([]Pixel, len(pixels))
+	for i, pixel := range pixels {
+		pixel.UserID, pixel.Username = "", ""
+		anonymized[i] = pixel
+	}
+	return anonymized
+}
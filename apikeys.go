@@ -0,0 +1,134 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+	http "github.com/taubyte/go-sdk/http/event"
+)
+
+// Provisioned keys are indexed by the full hash of the raw key
+const apiKeyPrefix = globalKeyPrefix + "api-keys/"
+
+func loadAPIKey(hash string) (APIKey, bool) {
+	var key APIKey
+	db, dbErr := getKeyUsageDB()
+	if dbErr != 0 {
+		return key, false
+	}
+	data, err := db.Get(apiKeyPrefix + hash)
+	if err != nil || len(data) == 0 {
+		return key, false
+	}
+	if err := json.Unmarshal(data, &key); err != nil {
+		logError("loadAPIKey", "", "failed to unmarshal key: %v", err)
+		return key, false
+	}
+	return key, true
+}
+
+// Whether the raw key was provisioned and has not been revoked
+func validAPIKey(apiKey string) bool {
+	if apiKey == "" {
+		return false
+	}
+	key, found := loadAPIKey(sessionTokenHash(apiKey))
+	return found && key.RevokedAt == 0
+}
+
+// Whether the request carries a credential for the room: a provisioned API key,
+// the shared or room admin token, or a live session token for the room
+func requestAuthenticated(h http.Event, room string) bool {
+	if validAPIKey(requestAPIKey(h)) {
+		return true
+	}
+	if hasAdminToken(h, room) {
+		return true
+	}
+	if token := requestSessionToken(h); room != "" && token != "" {
+		if _, err := validateSessionToken(room, token); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+//export provisionAPIKey
+func provisionAPIKey(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	raw, err := newSessionToken()
+	if err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	db, dbErr := getKeyUsageDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	label, _ := h.Query().Get("label")
+	key := APIKey{
+		KeyID:    apiKeyID(raw),
+		Label:    label,
+		Hash:     sessionTokenHash(raw),
+		IssuedAt: time.Now().UnixMilli(),
+	}
+	if err := putJSON(db, apiKeyPrefix+key.Hash, key); err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	logInfo("provisionAPIKey", "", "provisioned API key %s", key.KeyID)
+	return sendJSONResponse(h, struct {
+		Key string `json:"apiKey"`
+		APIKey
+	}{raw, key})
+}
+
+//export revokeAPIKey
+func revokeAPIKey(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	keyID, _ := h.Query().Get("keyId")
+	if keyID == "" {
+		return handleHTTPError(h, fmt.Errorf("keyId parameter required"), 400)
+	}
+	db, dbErr := getKeyUsageDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	keys, _ := db.List(apiKeyPrefix)
+	for _, stored := range keys {
+		key, found := loadAPIKey(strings.TrimPrefix(stored, apiKeyPrefix))
+		if !found || key.KeyID != keyID {
+			continue
+		}
+		if key.RevokedAt == 0 {
+			key.RevokedAt = time.Now().UnixMilli()
+			if err := putJSON(db, stored, key); err != nil {
+				return handleHTTPError(h, err, 500)
+			}
+		}
+		logInfo("revokeAPIKey", "", "revoked API key %s", keyID)
+		return sendJSONResponse(h, key)
+	}
+	return handleHTTPError(h, fmt.Errorf("API key %s not found", keyID), 404)
+}
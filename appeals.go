@@ -0,0 +1,194 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+func appealSeqKey(room string) string {
+	return fmt.Sprintf("/%s/appeals-seq", room)
+}
+
+func appealPrefix(room string) string {
+	return fmt.Sprintf("/%s/appeals/", room)
+}
+
+func appealKey(room string, id int64) string {
+	return fmt.Sprintf("%s%012d", appealPrefix(room), id)
+}
+
+func loadAppeals(room string) []Appeal {
+	appeals := make([]Appeal, 0)
+	db, dbErr := getModerationDB()
+	if dbErr != 0 {
+		return appeals
+	}
+	keys, _ := db.List(appealPrefix(room))
+	sort.Strings(keys)
+	for _, key := range keys {
+		data, err := db.Get(key)
+		if err != nil {
+			continue
+		}
+		var appeal Appeal
+		if json.Unmarshal(data, &appeal) == nil {
+			appeals = append(appeals, appeal)
+		}
+	}
+	return appeals
+}
+
+func loadAppeal(room string, id int64) (Appeal, bool) {
+	var appeal Appeal
+	db, dbErr := getModerationDB()
+	if dbErr != 0 {
+		return appeal, false
+	}
+	data, err := db.Get(appealKey(room, id))
+	if err != nil || len(data) == 0 {
+		return appeal, false
+	}
+	return appeal, json.Unmarshal(data, &appeal) == nil
+}
+
+//export appealAction
+func appealAction(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	userID, kind, err := getSanctionParams(h)
+	if err != nil {
+		return handleHTTPError(h, err, 400)
+	}
+	message, err := h.Query().Get("message")
+	if err != nil || message == "" {
+		return handleHTTPError(h, fmt.Errorf("message parameter required"), 400)
+	}
+	if _, active := loadSanction(room, userID, kind); !active {
+		return handleHTTPError(h, fmt.Errorf("user %s has no active %s to appeal", userID, kind), 404)
+	}
+	for _, appeal := range loadAppeals(room) {
+		if appeal.UserID == userID && appeal.Kind == kind && appeal.State == AppealPending {
+			return handleHTTPError(h, fmt.Errorf("an appeal for this %s is already pending", kind), 409)
+		}
+	}
+
+	db, dbErr := getModerationDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	appeal := Appeal{
+		ID:        readCounter(db, appealSeqKey(room)) + 1,
+		Room:      room,
+		UserID:    userID,
+		Kind:      kind,
+		Message:   message,
+		State:     AppealPending,
+		CreatedAt: time.Now().UnixMilli(),
+	}
+	if err := writeCounter(db, appealSeqKey(room), appeal.ID); err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	if err := putJSON(db, appealKey(room, appeal.ID), appeal); err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	return sendJSONResponse(h, appeal)
+}
+
+//export getAppeals
+func getAppeals(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	state, _ := h.Query().Get("state")
+	appeals := make([]Appeal, 0)
+	for _, appeal := range loadAppeals(room) {
+		if state == "" || appeal.State == state {
+			appeals = append(appeals, appeal)
+		}
+	}
+	return sendJSONResponse(h, appeals)
+}
+
+//export reviewAppeal
+func reviewAppeal(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	appeal, found := loadAppeal(room, int64(getIntParam(h, "id", 0)))
+	if !found {
+		return handleHTTPError(h, fmt.Errorf("appeal not found"), 404)
+	}
+	if appeal.State != AppealPending {
+		return handleHTTPError(h, fmt.Errorf("appeal %d was already %s", appeal.ID, appeal.State), 409)
+	}
+	decision, _ := h.Query().Get("decision")
+	switch decision {
+	case "accept":
+		appeal.State = AppealAccepted
+	case "reject":
+		appeal.State = AppealRejected
+	default:
+		return handleHTTPError(h, fmt.Errorf("decision must be 'accept' or 'reject'"), 400)
+	}
+	appeal.Reviewer, _ = h.Query().Get("reviewer")
+	appeal.ReviewedAt = time.Now().UnixMilli()
+
+	db, dbErr := getModerationDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	if err := putJSON(db, appealKey(room, appeal.ID), appeal); err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	if appeal.State == AppealAccepted {
+		if _, active := loadSanction(room, appeal.UserID, appeal.Kind); active {
+			removeSanction(room, appeal.UserID, appeal.Kind, "appeal accepted")
+		}
+	} else {
+		notifyUser(appeal.UserID, Notification{
+			Type:    "appealRejected",
+			Room:    room,
+			Message: localizedMessage(room, "appealRejected", appeal.Kind),
+			Data:    appeal,
+		})
+	}
+	return sendJSONResponse(h, appeal)
+}
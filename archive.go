@@ -0,0 +1,415 @@
+package lib
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/taubyte/go-sdk/database"
+	"github.com/taubyte/go-sdk/event"
+	"github.com/taubyte/go-sdk/http/client"
+)
+
+// Rooms must be idle this long before they can be archived, unless overridden
+const defaultArchiveMinIdleDays = 30
+
+func archiveRecordKey(room string) string {
+	return fmt.Sprintf("/%s", room)
+}
+
+func loadArchiveRecord(room string) (ArchiveRecord, bool) {
+	var record ArchiveRecord
+	db, dbErr := getArchiveDB()
+	if dbErr != 0 {
+		return record, false
+	}
+	data, err := db.Get(archiveRecordKey(room))
+	if err != nil || len(data) == 0 {
+		return record, false
+	}
+	return record, json.Unmarshal(data, &record) == nil
+}
+
+// Archived rooms are frozen until rehydrated
+func isArchivedRoom(room string) bool {
+	_, archived := loadArchiveRecord(room)
+	return archived
+}
+
+func archiveBlobURL(endpoint, room string) string {
+	return fmt.Sprintf("%s/%s.json.gz", strings.TrimRight(endpoint, "/"), url.PathEscape(room))
+}
+
+func blobChecksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Send a request to the archive storage endpoint and return the response body
+func archiveStorageRequest(config GlobalConfig, method, blobURL string, body []byte) ([]byte, error) {
+	httpClient, err := client.New()
+	if err != nil {
+		return nil, err
+	}
+	headers := map[string][]string{"Content-Type": {"application/gzip"}}
+	if config.ArchiveAuthToken != "" {
+		headers["Authorization"] = []string{"Bearer " + config.ArchiveAuthToken}
+	}
+	options := []client.HttpRequestOption{client.Method(method), client.Headers(headers)}
+	if body != nil {
+		options = append(options, client.Body(body))
+	}
+	request, err := httpClient.Request(blobURL, options...)
+	if err != nil {
+		return nil, err
+	}
+	response, err := request.Do()
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body().Close()
+	return io.ReadAll(response.Body())
+}
+
+// Timestamp of the room's most recent placement or chat message
+func roomLastActivity(room string) int64 {
+	var last int64
+	if db, dbErr := getHistoryDB(); dbErr == 0 {
+		if data, err := db.Get(historyLogKey(room, readCounter(db, historySeqKey(room)))); err == nil {
+			var record PlacementRecord
+			if json.Unmarshal(data, &record) == nil {
+				last = record.Timestamp
+			}
+		}
+	}
+	for _, message := range loadRoomMessages(room) {
+		if message.Timestamp > last {
+			last = message.Timestamp
+		}
+	}
+	return last
+}
+
+func loadRoomMessages(room string) []ChatMessage {
+	messages := make([]ChatMessage, 0)
+	db, dbErr := getChatDB()
+	if dbErr != 0 {
+		return messages
+	}
+	keys, _ := db.List(fmt.Sprintf("/%s/", room))
+	for _, key := range keys {
+		data, err := db.Get(key)
+		if err != nil {
+			continue
+		}
+		var message ChatMessage
+		if json.Unmarshal(data, &message) == nil {
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
+
+func loadRoomHistory(room string) []PlacementRecord {
+	records := make([]PlacementRecord, 0)
+	db, dbErr := getHistoryDB()
+	if dbErr != 0 {
+		return records
+	}
+	keys, _ := db.List(fmt.Sprintf("/%s/log/", room))
+	sort.Strings(keys)
+	for _, key := range keys {
+		data, err := db.Get(key)
+		if err != nil {
+			continue
+		}
+		var record PlacementRecord
+		if json.Unmarshal(data, &record) == nil {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+func compressArchive(archive RoomArchive) ([]byte, error) {
+	data, err := json.Marshal(archive)
+	if err != nil {
+		return nil, err
+	}
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func decompressArchive(blob []byte) (RoomArchive, error) {
+	var archive RoomArchive
+	reader, err := gzip.NewReader(bytes.NewReader(blob))
+	if err != nil {
+		return archive, err
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return archive, err
+	}
+	return archive, json.Unmarshal(data, &archive)
+}
+
+// Remove the room's canvas, chat and history from hot storage
+func pruneHotStorage(room string) {
+	prefix := fmt.Sprintf("/%s/", room)
+	for _, open := range []func() (database.Database, uint32){getCanvasDB, getChatDB, getHistoryDB} {
+		db, dbErr := open()
+		if dbErr != 0 {
+			continue
+		}
+		keys, _ := db.List(prefix)
+		for _, key := range keys {
+			db.Delete(key)
+		}
+	}
+	deleteRoomChunks(room)
+	clearTranslations(room)
+	clearChatSeqIndex(room)
+	clearReactions(room)
+	resetStorageUsage(room, NamespaceCanvas)
+	resetStorageUsage(room, NamespaceChat)
+	resetStorageUsage(room, NamespaceHistory)
+	invalidateCanvasChecksum(room)
+}
+
+// Upload the room to cold storage, verify the upload, then prune hot storage
+func archiveRoomData(room string, config GlobalConfig) (ArchiveRecord, error) {
+	record := ArchiveRecord{Room: room, ArchivedAt: time.Now().UnixMilli()}
+	pixels, dbErr := loadRoomPixels(room)
+	if dbErr != 0 {
+		return record, fmt.Errorf("failed to load canvas")
+	}
+	archive := RoomArchive{
+		Version:    roomArchiveVersion,
+		Room:       room,
+		ArchivedAt: record.ArchivedAt,
+		Layout:     loadRoomLayout(room),
+		Pixels:     pixels,
+		Messages:   loadRoomMessages(room),
+		History:    loadRoomHistory(room),
+	}
+	blob, err := compressArchive(archive)
+	if err != nil {
+		return record, fmt.Errorf("failed to compress archive: %v", err)
+	}
+	record.URL = archiveBlobURL(config.ArchiveEndpoint, room)
+	record.Checksum = blobChecksum(blob)
+	record.Bytes = int64(len(blob))
+	record.Pixels = len(archive.Pixels)
+	record.Messages = len(archive.Messages)
+	record.HistoryEntries = len(archive.History)
+
+	if _, err := archiveStorageRequest(config, "PUT", record.URL, blob); err != nil {
+		return record, fmt.Errorf("failed to upload archive: %v", err)
+	}
+	// Read the blob back before deleting anything
+	stored, err := archiveStorageRequest(config, "GET", record.URL, nil)
+	if err != nil {
+		return record, fmt.Errorf("failed to verify archive: %v", err)
+	}
+	if blobChecksum(stored) != record.Checksum {
+		return record, fmt.Errorf("archive verification failed: checksum mismatch")
+	}
+
+	db, dbErr := getArchiveDB()
+	if dbErr != 0 {
+		return record, fmt.Errorf("archive database connection failed")
+	}
+	if err := putJSON(db, archiveRecordKey(room), record); err != nil {
+		return record, fmt.Errorf("failed to save archive record: %v", err)
+	}
+	pruneHotStorage(room)
+	return record, nil
+}
+
+// Restore an archived room's canvas, chat and history into hot storage
+func rehydrateRoomData(room string, record ArchiveRecord, config GlobalConfig) (RoomArchive, error) {
+	blob, err := archiveStorageRequest(config, "GET", record.URL, nil)
+	if err != nil {
+		return RoomArchive{}, fmt.Errorf("failed to download archive: %v", err)
+	}
+	if blobChecksum(blob) != record.Checksum {
+		return RoomArchive{}, fmt.Errorf("archive checksum mismatch")
+	}
+	archive, err := decompressArchive(blob)
+	if err != nil {
+		return archive, fmt.Errorf("failed to decode archive: %v", err)
+	}
+
+	if archive.Layout == LayoutChunked && setRoomLayout(room, LayoutChunked) != 0 {
+		return archive, fmt.Errorf("failed to restore room layout")
+	}
+	if err := restoreArchiveData(room, archive); err != nil {
+		return archive, err
+	}
+
+	archiveDB, dbErr := getArchiveDB()
+	if dbErr != 0 {
+		return archive, fmt.Errorf("archive database connection failed")
+	}
+	if err := archiveDB.Delete(archiveRecordKey(room)); err != nil {
+		return archive, fmt.Errorf("failed to clear archive record: %v", err)
+	}
+	return archive, nil
+}
+
+// Write an archive's canvas, chat and history into the room's hot storage
+func restoreArchiveData(room string, archive RoomArchive) error {
+	if changes, dbErr := savePixels(room, archive.Pixels, true); dbErr != 0 || len(changes) < len(archive.Pixels) {
+		return fmt.Errorf("failed to restore canvas")
+	}
+	invalidateCanvasChecksum(room)
+
+	chatDB, dbErr := getChatDB()
+	if dbErr != 0 {
+		return fmt.Errorf("chat database connection failed")
+	}
+	var chatKeys, chatBytes, lastSeq int64
+	for _, message := range archive.Messages {
+		data, err := json.Marshal(message)
+		if err != nil {
+			continue
+		}
+		if err := chatDB.Put(chatMessageKey(room, message), data); err != nil {
+			return fmt.Errorf("failed to restore message %s: %v", message.ID, err)
+		}
+		indexChatSeq(chatDB, room, message)
+		if message.Seq > lastSeq {
+			lastSeq = message.Seq
+		}
+		chatKeys++
+		chatBytes += int64(len(data))
+	}
+	recordStorageUsage(room, NamespaceChat, chatKeys, chatBytes)
+	if statsDB, dbErr := getStatsDB(); dbErr == 0 && lastSeq > readCounter(statsDB, chatSeqKey(room)) {
+		writeCounter(statsDB, chatSeqKey(room), lastSeq)
+	}
+
+	historyDB, dbErr := getHistoryDB()
+	if dbErr != 0 {
+		return fmt.Errorf("history database connection failed")
+	}
+	var historyKeys, historyBytes, first, last int64
+	for _, entry := range archive.History {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			continue
+		}
+		if err := historyDB.Put(historyLogKey(room, entry.Seq), data); err != nil {
+			return fmt.Errorf("failed to restore history record %d: %v", entry.Seq, err)
+		}
+		historyDB.Put(fmt.Sprintf("%s%012d", historyUserPrefix(room, entry.UserID), entry.Seq), data)
+		historyKeys += 2
+		historyBytes += 2 * int64(len(data))
+		if first == 0 || entry.Seq < first {
+			first = entry.Seq
+		}
+		if entry.Seq > last {
+			last = entry.Seq
+		}
+	}
+	if last > 0 {
+		writeCounter(historyDB, historySeqKey(room), last)
+		writeCounter(historyDB, historyFirstKey(room), first)
+	}
+	recordStorageUsage(room, NamespaceHistory, historyKeys, historyBytes)
+	return nil
+}
+
+//export archiveRoom
+func archiveRoom(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := rejectDuringMaintenance(h, room); code != 0 {
+		return code
+	}
+	config := loadGlobalConfig()
+	if config.ArchiveEndpoint == "" {
+		return handleHTTPError(h, fmt.Errorf("no archive endpoint configured"), 503)
+	}
+	if isArchivedRoom(room) {
+		return handleHTTPError(h, fmt.Errorf("room %s is already archived", room), 409)
+	}
+	minIdleDays := getIntParam(h, "minIdleDays", defaultArchiveMinIdleDays)
+	idleSince := time.Now().Add(-time.Duration(minIdleDays) * 24 * time.Hour).UnixMilli()
+	if lastActivity := roomLastActivity(room); lastActivity > idleSince {
+		return handleHTTPError(h, fmt.Errorf("room %s was active within the last %d days", room, minIdleDays), 409)
+	}
+
+	record, err := archiveRoomData(room, config)
+	if err != nil {
+		logError("archiveRoom", room, "failed: %v", err)
+		return handleHTTPError(h, err, 502)
+	}
+	logInfo("archiveRoom", room, "archived (%d bytes)", record.Bytes)
+	publishLifecycleEvent(room, LifecycleArchived, record)
+	return sendJSONResponse(h, record)
+}
+
+//export rehydrateRoom
+func rehydrateRoom(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	record, archived := loadArchiveRecord(room)
+	if !archived {
+		return handleHTTPError(h, fmt.Errorf("room %s is not archived", room), 404)
+	}
+	archive, err := rehydrateRoomData(room, record, loadGlobalConfig())
+	if err != nil {
+		logError("rehydrateRoom", room, "failed: %v", err)
+		return handleHTTPError(h, err, 502)
+	}
+	summary := map[string]interface{}{
+		"room":           room,
+		"pixels":         len(archive.Pixels),
+		"messages":       len(archive.Messages),
+		"historyEntries": len(archive.History),
+	}
+	publishLifecycleEvent(room, LifecycleRehydrated, summary)
+	return sendJSONResponse(h, summary)
+}
@@ -0,0 +1,184 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+// Current pixel owners inside the region, ranked by pixel count
+func regionContributors(pixels []Pixel, region Region) []Contributor {
+	byUser := make(map[string]*Contributor)
+	for _, pixel := range pixels {
+		if !region.Contains(pixel.X, pixel.Y) {
+			continue
+		}
+		contributor, ok := byUser[pixel.UserID]
+		if !ok {
+			contributor = &Contributor{UserID: pixel.UserID}
+			byUser[pixel.UserID] = contributor
+		}
+		contributor.Username = pixel.Username
+		contributor.Pixels++
+	}
+	contributors := make([]Contributor, 0, len(byUser))
+	for _, contributor := range byUser {
+		contributors = append(contributors, *contributor)
+	}
+	sort.Slice(contributors, func(i, j int) bool {
+		if contributors[i].Pixels == contributors[j].Pixels {
+			return contributors[i].UserID < contributors[j].UserID
+		}
+		return contributors[i].Pixels > contributors[j].Pixels
+	})
+	usernameResolver{}.contributors(contributors)
+	return contributors
+}
+
+//export whoDrewRegion
+func whoDrewRegion(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	if _, code := checkAnonymousRead(h, room); code != 0 {
+		return code
+	}
+	setMaintenanceBanner(h, room)
+	region, err := getRegionParams(h, room)
+	if err != nil {
+		return handleHTTPError(h, err, 400)
+	}
+	pixels, dbErr := loadRoomPixels(room)
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	contributors := regionContributors(pixels, region)
+	var painted int64
+	for _, contributor := range contributors {
+		painted += contributor.Pixels
+	}
+	if loadRoomSettings(room).AnonymizeContributors {
+		contributors = make([]Contributor, 0)
+	}
+	return sendJSONResponse(h, map[string]interface{}{
+		"region":        region,
+		"paintedPixels": painted,
+		"contributors":  contributors,
+	})
+}
+
+// Rank everyone in the placement history by pixels placed
+func roomCredits(history []PlacementRecord) []Credit {
+	byUser := make(map[string]*Credit)
+	for _, record := range history {
+		credit, ok := byUser[record.UserID]
+		if !ok {
+			credit = &Credit{Contributor: Contributor{UserID: record.UserID}, FirstContribution: record.Timestamp}
+			byUser[record.UserID] = credit
+		}
+		credit.Username = record.Username
+		credit.Pixels++
+		if record.Timestamp < credit.FirstContribution {
+			credit.FirstContribution = record.Timestamp
+		}
+		if record.Timestamp > credit.LastContribution {
+			credit.LastContribution = record.Timestamp
+		}
+	}
+	credits := make([]Credit, 0, len(byUser))
+	for _, credit := range byUser {
+		credits = append(credits, *credit)
+	}
+	sort.Slice(credits, func(i, j int) bool {
+		if credits[i].Pixels == credits[j].Pixels {
+			return credits[i].UserID < credits[j].UserID
+		}
+		return credits[i].Pixels > credits[j].Pixels
+	})
+	names := usernameResolver{}
+	for i := range credits {
+		credits[i].Rank = i + 1
+		credits[i].Username = names.name(credits[i].UserID, credits[i].Username)
+	}
+	return credits
+}
+
+func encodeCreditsCSV(credits []Credit) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+	writer.Write([]string{"rank", "userId", "username", "pixels", "firstContribution", "lastContribution"})
+	for _, credit := range credits {
+		writer.Write([]string{
+			strconv.Itoa(credit.Rank),
+			credit.UserID,
+			credit.Username,
+			strconv.FormatInt(credit.Pixels, 10),
+			time.UnixMilli(credit.FirstContribution).UTC().Format(time.RFC3339),
+			time.UnixMilli(credit.LastContribution).UTC().Format(time.RFC3339),
+		})
+	}
+	writer.Flush()
+	return buffer.Bytes(), writer.Error()
+}
+
+//export exportCredits
+func exportCredits(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	if _, code := checkAnonymousRead(h, room); code != 0 {
+		return code
+	}
+	format, _ := h.Query().Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		return handleHTTPError(h, fmt.Errorf("format must be json or csv"), 400)
+	}
+	credits := roomCredits(loadRoomHistory(room))
+	if loadRoomSettings(room).AnonymizeContributors {
+		credits = make([]Credit, 0)
+	}
+	if format == "csv" {
+		data, err := encodeCreditsCSV(credits)
+		if err != nil {
+			return handleHTTPError(h, err, 500)
+		}
+		h.Headers().Set("Content-Type", "text/csv")
+		h.Headers().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s-credits.csv\"", room))
+		h.Write(data)
+		h.Return(200)
+		return 0
+	}
+	return sendJSONResponse(h, map[string]interface{}{
+		"room":    room,
+		"credits": credits,
+	})
+}
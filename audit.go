@@ -0,0 +1,205 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+	http "github.com/taubyte/go-sdk/http/event"
+)
+
+// Used when the GlobalConfig destructive limits are unset
+const (
+	defaultDestructiveCooldown   = time.Minute
+	defaultDestructiveDailyLimit = 10
+)
+
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 500
+)
+
+// Audit entries live outside the room's prefix so they outlive deleteRoom
+func auditPrefix(room string) string {
+	return fmt.Sprintf(globalKeyPrefix+"audit/%s/", room)
+}
+
+func auditSeqKey(room string) string {
+	return fmt.Sprintf(globalKeyPrefix+"audit-seq/%s", room)
+}
+
+// Callers without an API key are limited by IP instead
+func destructiveCaller(h http.Event) string {
+	if keyID := apiKeyID(requestAPIKey(h)); keyID != "" {
+		return keyID
+	}
+	return "ip:" + clientIP(h)
+}
+
+// Seconds until the caller may run another destructive action, zero when allowed
+func destructiveWait(caller string, config GlobalConfig, now time.Time) (int64, error) {
+	db, dbErr := getKeyUsageDB()
+	if dbErr != 0 {
+		return 0, fmt.Errorf("database connection failed")
+	}
+	cooldown := defaultDestructiveCooldown
+	if config.DestructiveCooldownSeconds != 0 {
+		cooldown = time.Duration(config.DestructiveCooldownSeconds) * time.Second
+	}
+	if cooldown > 0 {
+		last := readCounter(db, fmt.Sprintf(globalKeyPrefix+"destructive/%s/last", caller))
+		if wait := time.UnixMilli(last).Add(cooldown).Sub(now); wait > 0 {
+			return int64(wait/time.Second) + 1, nil
+		}
+	}
+	limit := config.DestructiveDailyLimit
+	if limit == 0 {
+		limit = defaultDestructiveDailyLimit
+	}
+	if limit > 0 && readCounter(db, fmt.Sprintf(globalKeyPrefix+"destructive/%s/%s", caller, now.UTC().Format("2006-01-02"))) >= limit {
+		midnight := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+		return int64(midnight.Sub(now)/time.Second) + 1, nil
+	}
+	return 0, nil
+}
+
+func recordDestructiveUse(caller string, now time.Time) {
+	db, dbErr := getKeyUsageDB()
+	if dbErr != 0 {
+		return
+	}
+	dayKey := fmt.Sprintf(globalKeyPrefix+"destructive/%s/%s", caller, now.UTC().Format("2006-01-02"))
+	writeCounter(db, dayKey, readCounter(db, dayKey)+1)
+	writeCounter(db, fmt.Sprintf(globalKeyPrefix+"destructive/%s/last", caller), now.UnixMilli())
+}
+
+func auditEntryKey(room string, seq int64) string {
+	return fmt.Sprintf("%s%012d", auditPrefix(room), seq)
+}
+
+// Store the entry under the room's next audit sequence and return that sequence
+func appendAuditEntry(entry AuditEntry) (int64, error) {
+	db, dbErr := getModerationDB()
+	if dbErr != 0 {
+		return 0, fmt.Errorf("database connection failed")
+	}
+	entry.Seq = readCounter(db, auditSeqKey(entry.Room)) + 1
+	if err := writeCounter(db, auditSeqKey(entry.Room), entry.Seq); err != nil {
+		return 0, err
+	}
+	return entry.Seq, putJSON(db, auditEntryKey(entry.Room, entry.Seq), entry)
+}
+
+// Record how an audited action ended; a nil err marks it succeeded. A zero
+// seq means the action was not audited and is ignored.
+func completeAudit(room string, seq int64, err error) {
+	if seq == 0 {
+		return
+	}
+	db, dbErr := getModerationDB()
+	if dbErr != 0 {
+		return
+	}
+	key := auditEntryKey(room, seq)
+	data, getErr := db.Get(key)
+	var entry AuditEntry
+	if getErr != nil || json.Unmarshal(data, &entry) != nil {
+		logError("completeAudit", room, "audit entry %d not found", seq)
+		return
+	}
+	entry.Status = AuditSucceeded
+	if err != nil {
+		entry.Status = AuditFailed
+		entry.Error = err.Error()
+	}
+	entry.CompletedAt = time.Now().UnixMilli()
+	if putErr := putJSON(db, key, entry); putErr != nil {
+		logError("completeAudit", room, "failed to record outcome of entry %d: %v", seq, putErr)
+	}
+}
+
+// Mark the audited action failed and respond with the error
+func failAudited(h http.Event, room string, seq int64, err error, code int) uint32 {
+	completeAudit(room, seq, err)
+	return handleHTTPError(h, err, code)
+}
+
+// Gate a destructive endpoint: enforce the caller's cooldown and daily limit,
+// then write a pending audit entry whose sequence is returned so the caller
+// can record the outcome with completeAudit. The action is refused when it
+// cannot be audited.
+func guardDestructive(h http.Event, room, action, details string) (int64, uint32) {
+	now := time.Now()
+	caller := destructiveCaller(h)
+	wait, err := destructiveWait(caller, loadGlobalConfig(), now)
+	if err != nil {
+		return 0, handleHTTPError(h, err, 500)
+	}
+	if wait > 0 {
+		h.Headers().Set("Retry-After", fmt.Sprintf("%d", wait))
+		return 0, handleHTTPError(h, fmt.Errorf("%s is rate limited for %d more seconds", action, wait), 429)
+	}
+	entry := AuditEntry{
+		Room:      room,
+		Action:    action,
+		KeyID:     apiKeyID(requestAPIKey(h)),
+		IP:        clientIP(h),
+		Details:   details,
+		CreatedAt: now.UnixMilli(),
+		Status:    AuditPending,
+	}
+	seq, err := appendAuditEntry(entry)
+	if err != nil {
+		logError("guardDestructive", room, "failed to audit %s: %v", action, err)
+		return 0, handleHTTPError(h, fmt.Errorf("failed to write audit entry"), 500)
+	}
+	recordDestructiveUse(caller, now)
+	return seq, 0
+}
+
+//export getAuditLog
+func getAuditLog(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	limit := getIntParam(h, "limit", defaultAuditLimit)
+	if limit <= 0 || limit > maxAuditLimit {
+		limit = defaultAuditLimit
+	}
+	db, dbErr := getModerationDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	keys, _ := db.List(auditPrefix(room))
+	// Newest first
+	sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+	entries := make([]AuditEntry, 0, limit)
+	for _, key := range keys {
+		if len(entries) == limit {
+			break
+		}
+		data, err := db.Get(key)
+		if err != nil {
+			continue
+		}
+		var entry AuditEntry
+		if json.Unmarshal(data, &entry) == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return sendJSONResponse(h, entries)
+}
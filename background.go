@@ -0,0 +1,124 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+// Color of unset pixels in rooms without a configured default
+const defaultCanvasColor = "#ffffff"
+
+func backgroundKey(room string) string {
+	return fmt.Sprintf("/%s/background", room)
+}
+
+func roomDefaultColor(room string) string {
+	if color := loadRoomSettings(room).DefaultColor; color != "" {
+		return color
+	}
+	return defaultCanvasColor
+}
+
+func loadBackground(room string) (BackgroundLayer, bool) {
+	var background BackgroundLayer
+	db, dbErr := getSettingsDB()
+	if dbErr != 0 {
+		return background, false
+	}
+	data, err := db.Get(backgroundKey(room))
+	if err != nil || len(data) == 0 {
+		return background, false
+	}
+	if err := json.Unmarshal(data, &background); err != nil {
+		logError("loadBackground", room, "failed to unmarshal background: %v", err)
+		return background, false
+	}
+	return background, true
+}
+
+// Canvas grid of what unset pixels look like: the background layer over the
+// generative fill or the default color
+func newBaseCanvas(room string) [][]string {
+	width, height := roomSize(room)
+	return newBaseRegion(room, Region{Width: width, Height: height})
+}
+
+// Background colors of the cells inside the region
+func newBaseRegion(room string, region Region) [][]string {
+	defaultColor := roomDefaultColor(room)
+	fill := roomFill(room, loadRoomSettings(room))
+	background, hasBackground := loadBackground(room)
+	canvas := make([][]string, region.Height)
+	for row := range canvas {
+		canvas[row] = make([]string, region.Width)
+		y := region.Y + row
+		for col := range canvas[row] {
+			x := region.X + col
+			canvas[row][col] = defaultColor
+			if fill != nil {
+				canvas[row][col] = fill(x, y)
+			}
+			if hasBackground && y < len(background.Grid) && x < len(background.Grid[y]) && background.Grid[y][x] != "" {
+				canvas[row][col] = background.Grid[y][x]
+			}
+		}
+	}
+	return canvas
+}
+
+//export setBackground
+func setBackground(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := rejectDuringMaintenance(h, room); code != 0 {
+		return code
+	}
+	var background BackgroundLayer
+	if err := readJSONBody(h, &background); err != nil {
+		return handleHTTPError(h, err, 400)
+	}
+	width, height := roomSize(room)
+	if len(background.Grid) > height {
+		return handleHTTPError(h, fmt.Errorf("background must fit inside the %dx%d canvas", width, height), 400)
+	}
+	for y, row := range background.Grid {
+		if len(row) > width {
+			return handleHTTPError(h, fmt.Errorf("background must fit inside the %dx%d canvas", width, height), 400)
+		}
+		for x, color := range row {
+			if color != "" && !isValidHexColor(color) {
+				return handleHTTPError(h, fmt.Errorf("invalid background color: %s", color), 400)
+			}
+			background.Grid[y][x] = strings.ToLower(color)
+		}
+	}
+	db, dbErr := getSettingsDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	// An empty grid removes the layer
+	if len(background.Grid) == 0 {
+		db.Delete(backgroundKey(room))
+	} else if err := putJSON(db, backgroundKey(room), background); err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	invalidateCanvasChecksum(room)
+	publishLifecycleEvent(room, LifecycleSettingsChanged, map[string]bool{"background": len(background.Grid) > 0})
+	return sendJSONResponse(h, background)
+}
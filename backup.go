@@ -0,0 +1,329 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+	"github.com/taubyte/go-sdk/http/client"
+)
+
+// Current RoomArchive format; version 2 added metadata, settings and stats
+const roomArchiveVersion = 2
+
+// Largest archive importRoom reads
+const maxRoomImportBytes = 32 << 20
+
+var gzipSignature = []byte{0x1f, 0x8b}
+
+// Collect everything stored for the room into one archive
+func buildRoomExport(room string) (RoomArchive, error) {
+	pixels, dbErr := loadRoomPixels(room)
+	if dbErr != 0 {
+		return RoomArchive{}, fmt.Errorf("failed to load canvas")
+	}
+	archive := RoomArchive{
+		Version:    roomArchiveVersion,
+		Room:       room,
+		ArchivedAt: time.Now().UnixMilli(),
+		Layout:     loadRoomLayout(room),
+		Pixels:     pixels,
+		Messages:   loadRoomMessages(room),
+		History:    loadRoomHistory(room),
+	}
+	if metadata, found := loadRoomMetadata(room); found {
+		archive.Metadata = &metadata
+	}
+	settings := loadRoomSettings(room)
+	archive.Settings = &settings
+	stats := loadRoomStats(room)
+	archive.Stats = &stats
+	return archive, nil
+}
+
+// Parse an uploaded archive, gzip-compressed or plain JSON
+func decodeRoomImport(body []byte) (RoomArchive, error) {
+	var archive RoomArchive
+	var err error
+	if bytes.HasPrefix(body, gzipSignature) {
+		archive, err = decompressArchive(body)
+	} else {
+		err = json.Unmarshal(body, &archive)
+	}
+	if err != nil {
+		return archive, fmt.Errorf("invalid room archive: %v", err)
+	}
+	if archive.Version > roomArchiveVersion {
+		return archive, fmt.Errorf("archive version %d is newer than the supported version %d", archive.Version, roomArchiveVersion)
+	}
+	return archive, nil
+}
+
+//export exportRoom
+func exportRoom(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	if isArchivedRoom(room) {
+		return handleHTTPError(h, fmt.Errorf("room %s is archived; rehydrate it before exporting", room), 409)
+	}
+	format, _ := h.Query().Get("format")
+	if format != "" && format != "json" && format != "gzip" {
+		return handleHTTPError(h, fmt.Errorf("format must be json or gzip"), 400)
+	}
+	if ensureRoomSchema(room) != 0 {
+		return handleHTTPError(h, fmt.Errorf("room migration failed"), 500)
+	}
+	archive, err := buildRoomExport(room)
+	if err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	logInfo("exportRoom", room, "exported (%d pixels, %d messages)", len(archive.Pixels), len(archive.Messages))
+	if format != "gzip" {
+		h.Headers().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.json\"", room))
+		return sendJSONResponse(h, archive)
+	}
+	blob, err := compressArchive(archive)
+	if err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	h.Headers().Set("Content-Type", "application/gzip")
+	h.Headers().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.json.gz\"", room))
+	h.Write(blob)
+	h.Return(200)
+	return 0
+}
+
+//export importRoom
+func importRoom(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	body, err := io.ReadAll(io.LimitReader(h.Body(), maxRoomImportBytes+1))
+	if err != nil {
+		return handleHTTPError(h, fmt.Errorf("failed to read request body: %v", err), 400)
+	}
+	if len(body) > maxRoomImportBytes {
+		return handleHTTPError(h, fmt.Errorf("archive must be at most %d bytes", maxRoomImportBytes), 413)
+	}
+	archive, err := decodeRoomImport(body)
+	if err != nil {
+		return handleHTTPError(h, err, 400)
+	}
+	// The archive can be restored under a different name
+	room, _ := h.Query().Get("room")
+	if room == "" {
+		room = archive.Room
+	}
+	if !validRoomID(room) {
+		return handleHTTPError(h, fmt.Errorf("room must be 1-64 letters, digits, '-' or '_' and not a reserved name"), 400)
+	}
+	if code := rejectDuringMaintenance(h, room); code != 0 {
+		return code
+	}
+	// Only overwriting an existing room is audited
+	var audit int64
+	if roomExists(room) {
+		if overwrite, _ := h.Query().Get("overwrite"); overwrite != "true" {
+			return handleHTTPError(h, fmt.Errorf("room %s already exists; pass overwrite=true to replace it", room), 409)
+		}
+		seq, code := guardDestructive(h, room, "importRoom", fmt.Sprintf("overwrite from %s", archive.Room))
+		if code != 0 {
+			return code
+		}
+		audit = seq
+		deleteRoomData(room)
+	}
+
+	metadata := RoomMetadata{Room: room, Name: room, Width: CanvasWidth, Height: CanvasHeight, Visibility: VisibilityPublic}
+	if archive.Metadata != nil {
+		metadata = *archive.Metadata
+		metadata.Room = room
+	}
+	metadata.CreatedAt = time.Now().UnixMilli()
+	if saveRoomMetadata(metadata) != 0 {
+		return failAudited(h, room, audit, fmt.Errorf("failed to save room"), 500)
+	}
+	if archive.Settings != nil && saveRoomSettings(room, *archive.Settings) != 0 {
+		return failAudited(h, room, audit, fmt.Errorf("failed to restore settings"), 500)
+	}
+	if ensureRoomSchema(room) != 0 {
+		return failAudited(h, room, audit, fmt.Errorf("room migration failed"), 500)
+	}
+	if err := restoreArchiveData(room, archive); err != nil {
+		logError("importRoom", room, "failed: %v", err)
+		return failAudited(h, room, audit, err, 500)
+	}
+	completeAudit(room, audit, nil)
+	// Counters derived from the canvas are recomputed rather than trusted
+	if err := rebuildDerivedCounters(room); err != nil {
+		logError("importRoom", room, "failed to rebuild counters: %v", err)
+	}
+	if archive.Stats != nil {
+		if db, dbErr := getStatsDB(); dbErr == 0 {
+			putJSON(db, roomStatsKey(room), archive.Stats)
+			for _, cell := range archive.Stats.MostEdited {
+				writeCounter(db, coordinateEditsKey(room, cell.X, cell.Y), cell.Edits)
+			}
+		}
+	} else if err := rebuildRoomStats(room); err != nil {
+		logError("importRoom", room, "failed to rebuild stats: %v", err)
+	}
+	summary := map[string]interface{}{
+		"room":           room,
+		"source":         archive.Room,
+		"version":        archive.Version,
+		"pixels":         len(archive.Pixels),
+		"messages":       len(archive.Messages),
+		"historyEntries": len(archive.History),
+	}
+	logInfo("importRoom", room, "restored %s", archive.Room)
+	publishLifecycleEvent(room, LifecycleRestored, summary)
+	return sendJSONResponse(h, summary)
+}
+
+type pushRoomRequest struct {
+	// Full URL of the other deployment's importRoom endpoint
+	TargetURL string `json:"targetUrl"`
+	// Admin token of the other deployment, sent as a bearer token
+	Token      string `json:"token"`
+	TargetRoom string `json:"targetRoom"`
+	Overwrite  bool   `json:"overwrite"`
+}
+
+// POST a compressed archive to a remote importRoom endpoint and return its summary
+func pushArchive(request pushRoomRequest, room string, blob []byte) (map[string]interface{}, error) {
+	target, err := url.Parse(request.TargetURL)
+	if err != nil || (target.Scheme != "https" && target.Scheme != "http") || target.Host == "" {
+		return nil, fmt.Errorf("targetUrl must be an http or https URL")
+	}
+	query := target.Query()
+	query.Set("room", room)
+	if request.Overwrite {
+		query.Set("overwrite", "true")
+	}
+	target.RawQuery = query.Encode()
+	httpClient, err := client.New()
+	if err != nil {
+		return nil, err
+	}
+	pushRequest, err := httpClient.Request(target.String(),
+		client.Method("POST"),
+		client.Headers(map[string][]string{
+			"Content-Type":  {"application/gzip"},
+			"Authorization": {"Bearer " + request.Token},
+		}),
+		client.Body(blob),
+	)
+	if err != nil {
+		return nil, err
+	}
+	response, err := pushRequest.Do()
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body().Close()
+	body, err := io.ReadAll(response.Body())
+	if err != nil {
+		return nil, err
+	}
+	// importRoom answers with a JSON summary; its errors are plain text
+	var summary map[string]interface{}
+	if json.Unmarshal(body, &summary) != nil || summary["room"] == nil {
+		return nil, fmt.Errorf("target rejected the archive: %s", bytes.TrimSpace(body))
+	}
+	return summary, nil
+}
+
+//export pushRoom
+func pushRoom(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	if isArchivedRoom(room) {
+		return handleHTTPError(h, fmt.Errorf("room %s is archived; rehydrate it before pushing", room), 409)
+	}
+	var request pushRoomRequest
+	if err := readJSONBody(h, &request); err != nil {
+		return handleHTTPError(h, err, 400)
+	}
+	if request.TargetURL == "" || request.Token == "" {
+		return handleHTTPError(h, fmt.Errorf("targetUrl and token are required"), 400)
+	}
+	targetRoom := request.TargetRoom
+	if targetRoom == "" {
+		targetRoom = room
+	}
+	if !validRoomID(targetRoom) {
+		return handleHTTPError(h, fmt.Errorf("targetRoom must be 1-64 letters, digits, '-' or '_' and not a reserved name"), 400)
+	}
+	if ensureRoomSchema(room) != 0 {
+		return handleHTTPError(h, fmt.Errorf("room migration failed"), 500)
+	}
+	archive, err := buildRoomExport(room)
+	if err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	blob, err := compressArchive(archive)
+	if err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	if len(blob) > maxRoomImportBytes {
+		return handleHTTPError(h, fmt.Errorf("archive of %d bytes exceeds the import limit of %d", len(blob), maxRoomImportBytes), 413)
+	}
+	summary, err := pushArchive(request, targetRoom, blob)
+	if err != nil {
+		logError("pushRoom", room, "push to %s failed: %v", request.TargetURL, err)
+		return handleHTTPError(h, err, 502)
+	}
+	logInfo("pushRoom", room, "pushed to %s as %s (%d bytes)", request.TargetURL, targetRoom, len(blob))
+	return sendJSONResponse(h, map[string]interface{}{
+		"room":       room,
+		"targetUrl":  request.TargetURL,
+		"targetRoom": targetRoom,
+		"bytes":      len(blob),
+		"target":     summary,
+	})
+}
@@ -0,0 +1,126 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+const maxBannerLength = 280
+
+// Index of rooms with a banner, kept in the config database for the expiry job
+const bannerIndexPrefix = globalKeyPrefix + "banners/"
+
+// Expired banners are cleared and announced by this job even when nobody reads them
+func init() {
+	registerJob(ScheduledJob{
+		Name:     "bannerExpiry",
+		Interval: time.Minute,
+		Run:      expireBanners,
+	})
+}
+
+func bannerKey(room string) string {
+	return fmt.Sprintf("/%s/banner", room)
+}
+
+func clearBanner(room string) {
+	if db, dbErr := getSettingsDB(); dbErr == 0 {
+		db.Delete(bannerKey(room))
+	}
+	if db, dbErr := getConfigDB(); dbErr == 0 {
+		db.Delete(bannerIndexPrefix + room)
+	}
+	publishLifecycleEvent(room, LifecycleBanner, nil)
+}
+
+// The room's banner, or nil when none is set; an expired banner is cleared on read
+func activeBanner(room string) *Banner {
+	db, dbErr := getSettingsDB()
+	if dbErr != 0 {
+		return nil
+	}
+	data, err := db.Get(bannerKey(room))
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	var banner Banner
+	if err := json.Unmarshal(data, &banner); err != nil {
+		logError("activeBanner", room, "failed to unmarshal banner: %v", err)
+		return nil
+	}
+	if banner.ExpiresAt > 0 && banner.ExpiresAt <= time.Now().UnixMilli() {
+		clearBanner(room)
+		return nil
+	}
+	return &banner
+}
+
+func expireBanners(now time.Time) error {
+	db, dbErr := getConfigDB()
+	if dbErr != 0 {
+		return fmt.Errorf("config database connection failed")
+	}
+	keys, _ := db.List(bannerIndexPrefix)
+	for _, key := range keys {
+		if len(key) > len(bannerIndexPrefix) {
+			activeBanner(key[len(bannerIndexPrefix):])
+		}
+	}
+	return nil
+}
+
+//export setBanner
+func setBanner(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	var banner Banner
+	if err := readJSONBody(h, &banner); err != nil {
+		return handleHTTPError(h, err, 400)
+	}
+	// An empty message removes the banner
+	if banner.Message == "" {
+		clearBanner(room)
+		return sendJSONResponse(h, map[string]interface{}{"room": room, "banner": nil})
+	}
+	if len(banner.Message) > maxBannerLength {
+		return handleHTTPError(h, fmt.Errorf("message must be at most %d characters", maxBannerLength), 400)
+	}
+	now := time.Now().UnixMilli()
+	if banner.ExpiresAt != 0 && banner.ExpiresAt <= now {
+		return handleHTTPError(h, fmt.Errorf("expiresAt must be in the future"), 400)
+	}
+	// A countdown banner goes away when the countdown ends unless told otherwise
+	if banner.ExpiresAt == 0 && banner.CountdownTo > now {
+		banner.ExpiresAt = banner.CountdownTo
+	}
+	banner.SetAt = now
+
+	db, dbErr := getSettingsDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	if err := putJSON(db, bannerKey(room), banner); err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	if configDB, dbErr := getConfigDB(); dbErr == 0 {
+		configDB.Put(bannerIndexPrefix+room, []byte("1"))
+	}
+	publishLifecycleEvent(room, LifecycleBanner, banner)
+	return sendJSONResponse(h, map[string]interface{}{"room": room, "banner": banner})
+}
@@ -0,0 +1,62 @@
+package lib
+
+// Read a little-endian uint32 at offset
+func readBinaryUint32(data []byte, offset int) (uint32, bool) {
+	if offset < 0 || offset+4 > len(data) {
+		return 0, false
+	}
+	return uint32(data[offset]) | uint32(data[offset+1])<<8 | uint32(data[offset+2])<<16 | uint32(data[offset+3])<<24, true
+}
+
+// Read a uint32 length-prefixed string at offset, returning the offset after it
+func readBinaryString(data []byte, offset int) (string, int, bool) {
+	length, ok := readBinaryUint32(data, offset)
+	if !ok {
+		return "", offset, false
+	}
+	offset += 4
+	if int(length) < 0 || offset+int(length) > len(data) {
+		return "", offset, false
+	}
+	return string(data[offset : offset+int(length)]), offset + int(length), true
+}
+
+func appendBinaryUint32(data []byte, value uint32) []byte {
+	return append(data, byte(value), byte(value>>8), byte(value>>16), byte(value>>24))
+}
+
+func appendBinaryUint16(data []byte, value uint16) []byte {
+	return append(data, byte(value), byte(value>>8))
+}
+
+// Version byte leading the binary canvas format
+const canvasBinaryVersion = 1
+
+// Encode a color grid as: version byte, uint32 width, uint32 height, uint32
+// palette size, 3 RGB bytes per palette entry, then row-major runs of uint16
+// palette index and uint16 length. All integers are little-endian.
+func encodeCanvasBinary(grid [][]string) []byte {
+	snapshot := CanvasSnapshot{Grid: grid}
+	compactSnapshot(&snapshot)
+	data := make([]byte, 0, 13+3*len(snapshot.Palette)+2*len(snapshot.Runs))
+	data = append(data, canvasBinaryVersion)
+	data = appendBinaryUint32(data, uint32(snapshot.Width))
+	data = appendBinaryUint32(data, uint32(snapshot.Height))
+	data = appendBinaryUint32(data, uint32(len(snapshot.Palette)))
+	for _, value := range snapshot.Palette {
+		c := parseHexColor(value)
+		data = append(data, c.R, c.G, c.B)
+	}
+	for i := 0; i+1 < len(snapshot.Runs); i += 2 {
+		// Runs longer than a uint16 are split
+		for length := snapshot.Runs[i+1]; length > 0; length -= 0xffff {
+			chunk := length
+			if chunk > 0xffff {
+				chunk = 0xffff
+			}
+			data = appendBinaryUint16(data, uint16(snapshot.Runs[i]))
+			data = appendBinaryUint16(data, uint16(chunk))
+		}
+	}
+	return data
+}
@@ -0,0 +1,404 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+const maxBookmarkNameLength = 64
+
+func bookmarkSeqKey(room string) string {
+	return fmt.Sprintf("/%s/bookmarks-seq", room)
+}
+
+func bookmarkPrefix(room string) string {
+	return fmt.Sprintf("/%s/bookmarks/", room)
+}
+
+func bookmarkKey(room string, id int64) string {
+	return fmt.Sprintf("%s%012d", bookmarkPrefix(room), id)
+}
+
+func loadBookmarks(room string) []Bookmark {
+	bookmarks := make([]Bookmark, 0)
+	db, dbErr := getHistoryDB()
+	if dbErr != 0 {
+		return bookmarks
+	}
+	keys, _ := db.List(bookmarkPrefix(room))
+	sort.Strings(keys)
+	for _, key := range keys {
+		data, err := db.Get(key)
+		if err != nil {
+			continue
+		}
+		var bookmark Bookmark
+		if json.Unmarshal(data, &bookmark) == nil {
+			bookmarks = append(bookmarks, bookmark)
+		}
+	}
+	return bookmarks
+}
+
+func loadBookmark(room string, id int64) (Bookmark, bool) {
+	var bookmark Bookmark
+	db, dbErr := getHistoryDB()
+	if dbErr != 0 {
+		return bookmark, false
+	}
+	data, err := db.Get(bookmarkKey(room, id))
+	if err != nil || len(data) == 0 {
+		return bookmark, false
+	}
+	return bookmark, json.Unmarshal(data, &bookmark) == nil
+}
+
+func loadPlacementRecord(room string, seq int64) (PlacementRecord, bool) {
+	var record PlacementRecord
+	db, dbErr := getHistoryDB()
+	if dbErr != 0 {
+		return record, false
+	}
+	data, err := db.Get(historyLogKey(room, seq))
+	if err != nil || len(data) == 0 {
+		return record, false
+	}
+	return record, json.Unmarshal(data, &record) == nil
+}
+
+// Last retained placement sequence at or before the timestamp
+func seqAtTimestamp(room string, timestamp int64) int64 {
+	db, dbErr := getHistoryDB()
+	if dbErr != 0 {
+		return 0
+	}
+	first := readCounter(db, historyFirstKey(room))
+	for seq := readCounter(db, historySeqKey(room)); seq >= first && seq > 0; seq-- {
+		if record, ok := loadPlacementRecord(room, seq); ok && record.Timestamp <= timestamp {
+			return seq
+		}
+	}
+	return 0
+}
+
+// Rebuild the canvas as it was at the bookmark
+func canvasAtBookmark(bookmark Bookmark) ([][]string, error) {
+	grid, err := canvasAtSeq(bookmark.Room, bookmark.Seq, bookmark.Timestamp)
+	if err != nil {
+		return nil, fmt.Errorf("history before bookmark %d is no longer retained", bookmark.ID)
+	}
+	return grid, nil
+}
+
+// Rebuild the canvas as it was at the placement sequence (taken at timestamp):
+// start from the latest checkpoint or frame before it and replay the placement log
+func canvasAtSeq(room string, target, timestamp int64) ([][]string, error) {
+	grid := newBaseCanvas(room)
+	var since int64
+	checkpoint, hasCheckpoint := latestCheckpoint(room, target)
+	if hasCheckpoint {
+		grid = checkpoint.Grid
+	} else if timestamps := snapshotTimestamps(room, 0, timestamp+1); len(timestamps) > 0 {
+		if snapshot, ok := loadSnapshot(room, timestamps[len(timestamps)-1]); ok {
+			grid, since = snapshot.Grid, snapshot.Timestamp
+		}
+	}
+	db, dbErr := getHistoryDB()
+	if dbErr != 0 {
+		return nil, fmt.Errorf("history database connection failed")
+	}
+	// Trimmed placements are only safe to skip when the frame already covers them
+	first := readCounter(db, historyFirstKey(room))
+	if hasCheckpoint {
+		// Only the placements after the checkpoint are replayed, and none may be missing
+		if first > checkpoint.Seq+1 {
+			return nil, fmt.Errorf("history before %d is no longer retained", timestamp)
+		}
+		first = checkpoint.Seq + 1
+	} else if first > 1 {
+		if record, ok := loadPlacementRecord(room, first); since == 0 || !ok || record.Timestamp > since {
+			return nil, fmt.Errorf("history before %d is no longer retained", timestamp)
+		}
+	} else {
+		first = 1
+	}
+	for seq := first; seq <= target; seq++ {
+		record, ok := loadPlacementRecord(room, seq)
+		if !ok || record.Timestamp <= since {
+			continue
+		}
+		if record.Y >= 0 && record.Y < len(grid) && record.X >= 0 && record.X < len(grid[record.Y]) {
+			grid[record.Y][record.X] = record.Color
+		}
+	}
+	return grid, nil
+}
+
+// Resolve the bookmark named by a query parameter
+func getBookmarkParam(room string, value string) (Bookmark, error) {
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return Bookmark{}, fmt.Errorf("invalid bookmark id %q", value)
+	}
+	bookmark, found := loadBookmark(room, id)
+	if !found {
+		return Bookmark{}, fmt.Errorf("bookmark %d not found", id)
+	}
+	return bookmark, nil
+}
+
+//export addBookmark
+func addBookmark(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	name, err := h.Query().Get("name")
+	if err != nil || name == "" || len(name) > maxBookmarkNameLength {
+		return handleHTTPError(h, fmt.Errorf("name parameter required (max %d characters)", maxBookmarkNameLength), 400)
+	}
+	db, dbErr := getHistoryDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	now := time.Now().UnixMilli()
+	current := readCounter(db, historySeqKey(room))
+	bookmark := Bookmark{Room: room, Name: name, Seq: current, Timestamp: now, CreatedAt: now}
+	bookmark.CreatedBy, _ = h.Query().Get("userId")
+
+	// A sequence pins the bookmark exactly; a timestamp resolves to the last placement before it
+	if seq := int64(getIntParam(h, "seq", -1)); seq >= 0 {
+		if seq > current {
+			return handleHTTPError(h, fmt.Errorf("sequence %d is ahead of the room (at %d)", seq, current), 400)
+		}
+		bookmark.Seq = seq
+		if record, ok := loadPlacementRecord(room, seq); ok {
+			bookmark.Timestamp = record.Timestamp
+		} else if seq < current {
+			return handleHTTPError(h, fmt.Errorf("placement %d is no longer retained", seq), 404)
+		}
+	} else if timestamp := int64(getIntParam(h, "timestamp", 0)); timestamp > 0 {
+		if timestamp > now {
+			return handleHTTPError(h, fmt.Errorf("timestamp is in the future"), 400)
+		}
+		bookmark.Timestamp = timestamp
+		bookmark.Seq = seqAtTimestamp(room, timestamp)
+	}
+
+	bookmark.ID = readCounter(db, bookmarkSeqKey(room)) + 1
+	if err := writeCounter(db, bookmarkSeqKey(room), bookmark.ID); err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	if err := putJSON(db, bookmarkKey(room, bookmark.ID), bookmark); err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	publishRoomEvent(room, "events", "bookmarkAdded", bookmark)
+	return sendJSONResponse(h, bookmark)
+}
+
+//export getBookmarks
+func getBookmarks(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	if _, code := checkAnonymousRead(h, room); code != 0 {
+		return code
+	}
+	setMaintenanceBanner(h, room)
+	return sendJSONResponse(h, loadBookmarks(room))
+}
+
+//export deleteBookmark
+func deleteBookmark(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	id, _ := h.Query().Get("id")
+	bookmark, err := getBookmarkParam(room, id)
+	if err != nil {
+		return handleHTTPError(h, err, 404)
+	}
+	db, dbErr := getHistoryDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	if err := db.Delete(bookmarkKey(room, bookmark.ID)); err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	return sendJSONResponse(h, bookmark)
+}
+
+//export diffBookmark
+func diffBookmark(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	if _, code := checkAnonymousRead(h, room); code != 0 {
+		return code
+	}
+	setMaintenanceBanner(h, room)
+	id, _ := h.Query().Get("id")
+	bookmark, err := getBookmarkParam(room, id)
+	if err != nil {
+		return handleHTTPError(h, err, 404)
+	}
+	before, err := canvasAtBookmark(bookmark)
+	if err != nil {
+		return handleHTTPError(h, err, 410)
+	}
+
+	// Diff against another bookmark when given, else against the current canvas
+	var after [][]string
+	response := map[string]interface{}{"room": room, "from": bookmark}
+	if against, _ := h.Query().Get("against"); against != "" {
+		target, err := getBookmarkParam(room, against)
+		if err != nil {
+			return handleHTTPError(h, err, 404)
+		}
+		if after, err = canvasAtBookmark(target); err != nil {
+			return handleHTTPError(h, err, 410)
+		}
+		response["to"] = target
+	} else {
+		var dbErr uint32
+		if after, dbErr = loadCanvasGrid(room); dbErr != 0 {
+			return handleHTTPError(h, fmt.Errorf("failed to load canvas"), 500)
+		}
+		response["to"] = "current"
+	}
+
+	cells := make([]map[string]interface{}, 0)
+	for y := range after {
+		for x := range after[y] {
+			if before[y][x] != after[y][x] {
+				cells = append(cells, map[string]interface{}{"x": x, "y": y, "from": before[y][x], "to": after[y][x]})
+			}
+		}
+	}
+	response["changedPixels"], response["bounds"] = diffGrids(before, after)
+	response["cells"] = cells
+	return sendJSONResponse(h, response)
+}
+
+//export restoreBookmark
+func restoreBookmark(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := rejectDuringMaintenance(h, room); code != 0 {
+		return code
+	}
+	id, _ := h.Query().Get("id")
+	bookmark, err := getBookmarkParam(room, id)
+	if err != nil {
+		return handleHTTPError(h, err, 404)
+	}
+	target, err := canvasAtBookmark(bookmark)
+	if err != nil {
+		return handleHTTPError(h, err, 410)
+	}
+	current, dbErr := loadCanvasGrid(room)
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("failed to load canvas"), 500)
+	}
+
+	userID, _ := h.Query().Get("userId")
+	if userID == "" {
+		userID = "system"
+	}
+	now := time.Now().UnixMilli()
+	pixels := make([]Pixel, 0)
+	for y := range target {
+		for x := range target[y] {
+			if target[y][x] != current[y][x] {
+				pixels = append(pixels, Pixel{X: x, Y: y, Color: target[y][x], UserID: userID, Username: userID, Timestamp: now})
+			}
+		}
+	}
+	// dryRun=true only reports how many cells would be repainted
+	dryRun, _ := h.Query().Get("dryRun")
+	if dryRun != "true" && len(pixels) > 0 {
+		audit, code := guardDestructive(h, room, "restoreBookmark", fmt.Sprintf("bookmark %d, %d pixels", bookmark.ID, len(pixels)))
+		if code != 0 {
+			return code
+		}
+		changes, dbErr := savePixels(room, pixels, true)
+		if dbErr != 0 {
+			return failAudited(h, room, audit, fmt.Errorf("failed to restore canvas"), 500)
+		}
+		completeAudit(room, audit, nil)
+		afterPixelsSaved(room, changes)
+		publishLifecycleEvent(room, LifecycleRestored, bookmark)
+		logInfo("restoreBookmark", room, "restored to bookmark %d (%d pixels)", bookmark.ID, len(changes))
+	}
+	return sendJSONResponse(h, map[string]interface{}{
+		"room":     room,
+		"bookmark": bookmark,
+		"dryRun":   dryRun == "true",
+		"restored": len(pixels),
+	})
+}
@@ -0,0 +1,90 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/taubyte/go-sdk/database"
+)
+
+// Deadline for a handler's work; the zero value never runs out
+type executionBudget struct {
+	deadline time.Time
+}
+
+// Budget configured for the handler in HandlerBudgetsMs, unlimited when unset
+func newExecutionBudget(handler string) executionBudget {
+	ms := loadGlobalConfig().HandlerBudgetsMs[handler]
+	if ms <= 0 {
+		return executionBudget{}
+	}
+	return executionBudget{deadline: time.Now().Add(time.Duration(ms) * time.Millisecond)}
+}
+
+func (b executionBudget) exceeded() bool {
+	return !b.deadline.IsZero() && time.Now().After(b.deadline)
+}
+
+// Load the room's pixels key by key in sorted order, starting after cursor.
+// Once the budget runs out the pixels read so far are returned together with
+// the cursor to resume from; the cursor is empty when every key was read.
+func loadRoomPixelsBudgeted(room, cursor string, budget executionBudget) ([]Pixel, string, uint32) {
+	chunked := isChunkedRoom(room)
+	var db database.Database
+	var dbErr uint32
+	if chunked {
+		db, dbErr = getChunksDB()
+	} else {
+		db, dbErr = getCanvasDB()
+	}
+	if dbErr != 0 {
+		return nil, "", dbErr
+	}
+	prefix := fmt.Sprintf("/%s/", room)
+	keys, err := db.List(prefix)
+	if err != nil {
+		logError("loadRoomPixelsBudgeted", room, "failed to list keys: %v", err)
+		return nil, "", 1
+	}
+	sort.Strings(keys)
+	width, height := roomSize(room)
+	pixels := make([]Pixel, 0)
+	for i, key := range keys {
+		coords := strings.TrimPrefix(key, prefix)
+		if coords == "" || (cursor != "" && coords <= cursor) {
+			continue
+		}
+		var a, b int
+		if n, err := fmt.Sscanf(coords, "%d:%d", &a, &b); n != 2 || err != nil {
+			continue
+		}
+		if chunked {
+			if chunk, ok := loadChunk(db, room, a, b); ok {
+				for j, cell := range chunk.Cells {
+					if cell == nil {
+						continue
+					}
+					pixel := *cell
+					pixel.X = a*chunkSize + j%chunkSize
+					pixel.Y = b*chunkSize + j/chunkSize
+					if pixel.X < width && pixel.Y < height {
+						pixels = append(pixels, pixel)
+					}
+				}
+			}
+		} else if a >= 0 && a < width && b >= 0 && b < height {
+			var pixel Pixel
+			if data, err := db.Get(key); err == nil && json.Unmarshal(data, &pixel) == nil {
+				pixel.X, pixel.Y = a, b
+				pixels = append(pixels, pixel)
+			}
+		}
+		if i < len(keys)-1 && budget.exceeded() {
+			return pixels, coords, 0
+		}
+	}
+	return pixels, "", 0
+}
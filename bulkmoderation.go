@@ -0,0 +1,233 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+// Operations accepted in one bulkModerate request
+const maxBulkOperations = 200
+
+// Everything a batch will change, worked out before any of it is applied
+type moderationPlan struct {
+	sanctions   []Sanction
+	messageIDs  []string
+	messageKeys []string
+	pixels      []Pixel
+	counts      map[string]int
+}
+
+// Check every operation and resolve what it changes, so a single bad
+// operation rejects the whole batch before anything is written
+func planModeration(room, moderator string, operations []ModerationOperation) (moderationPlan, error) {
+	plan := moderationPlan{counts: make(map[string]int)}
+	db, dbErr := getChatDB()
+	if dbErr != 0 {
+		return plan, fmt.Errorf("database connection failed")
+	}
+	width, height := roomSize(room)
+	artworks := loadArtworks(room)
+	var current [][]string
+	targets := make(map[int64][][]string)
+	repaint := make(map[[2]int]string)
+	seenMessages := make(map[string]bool)
+	now := time.Now().UnixMilli()
+	for i, operation := range operations {
+		switch operation.Type {
+		case SanctionBan, SanctionMute:
+			if operation.UserID == "" || operation.Reason == "" {
+				return plan, fmt.Errorf("operation %d: %s needs userId and reason", i, operation.Type)
+			}
+			plan.sanctions = append(plan.sanctions, Sanction{
+				UserID:    operation.UserID,
+				Kind:      operation.Type,
+				Reason:    operation.Reason,
+				Moderator: moderator,
+				ExpiresAt: sanctionExpiry(operation.DurationMinutes),
+			})
+		case OperationDeleteMessage:
+			if operation.MessageID == "" {
+				return plan, fmt.Errorf("operation %d: deleteMessage needs messageId", i)
+			}
+			if seenMessages[operation.MessageID] {
+				continue
+			}
+			key, found := findChatMessageKey(db, room, operation.MessageID)
+			if !found {
+				return plan, fmt.Errorf("operation %d: message %s not found", i, operation.MessageID)
+			}
+			seenMessages[operation.MessageID] = true
+			plan.messageIDs = append(plan.messageIDs, operation.MessageID)
+			plan.messageKeys = append(plan.messageKeys, key)
+		case OperationRevertRegion:
+			region := operation.Region
+			if region.X < 0 || region.Y < 0 || region.Width <= 0 || region.Height <= 0 ||
+				region.X+region.Width > width || region.Y+region.Height > height {
+				return plan, fmt.Errorf("operation %d: region must be inside the %dx%d canvas", i, width, height)
+			}
+			// Finished artworks are locked against every writer, moderators included
+			if overlapsArtwork(artworks, region) {
+				return plan, fmt.Errorf("operation %d: region overlaps a finished artwork", i)
+			}
+			if operation.Before <= 0 || operation.Before > now {
+				return plan, fmt.Errorf("operation %d: revertRegion needs a past before timestamp", i)
+			}
+			if current == nil {
+				var dbErr uint32
+				if current, dbErr = loadCanvasGrid(room); dbErr != 0 {
+					return plan, fmt.Errorf("failed to load canvas")
+				}
+			}
+			// Regions reverted to the same moment share one reconstruction
+			target, ok := targets[operation.Before]
+			if !ok {
+				var err error
+				if target, err = canvasAtSeq(room, seqAtTimestamp(room, operation.Before), operation.Before); err != nil {
+					return plan, fmt.Errorf("operation %d: %v", i, err)
+				}
+				targets[operation.Before] = target
+			}
+			for y := region.Y; y < region.Y+region.Height; y++ {
+				for x := region.X; x < region.X+region.Width; x++ {
+					if target[y][x] != current[y][x] {
+						repaint[[2]int{x, y}] = target[y][x]
+					}
+				}
+			}
+		default:
+			return plan, fmt.Errorf("operation %d: unknown type %q", i, operation.Type)
+		}
+		plan.counts[operation.Type]++
+	}
+	for cell, color := range repaint {
+		plan.pixels = append(plan.pixels, Pixel{X: cell[0], Y: cell[1], Color: color, UserID: "system", Username: "system", Timestamp: now})
+	}
+	// Map order is random; keep the saved batch stable
+	sort.Slice(plan.pixels, func(i, j int) bool {
+		if plan.pixels[i].Y != plan.pixels[j].Y {
+			return plan.pixels[i].Y < plan.pixels[j].Y
+		}
+		return plan.pixels[i].X < plan.pixels[j].X
+	})
+	return plan, nil
+}
+
+// One-line summary of the batch for its audit entry
+func (plan moderationPlan) summary(moderator string) string {
+	types := make([]string, 0, len(plan.counts))
+	for operationType := range plan.counts {
+		types = append(types, operationType)
+	}
+	sort.Strings(types)
+	parts := make([]string, 0, len(types))
+	for _, operationType := range types {
+		parts = append(parts, fmt.Sprintf("%d %s", plan.counts[operationType], operationType))
+	}
+	details := fmt.Sprintf("%s, %d pixels", strings.Join(parts, ", "), len(plan.pixels))
+	if moderator != "" {
+		details = fmt.Sprintf("by %s: %s", moderator, details)
+	}
+	return details
+}
+
+//export bulkModerate
+func bulkModerate(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	if code := rejectDuringMaintenance(h, room); code != 0 {
+		return code
+	}
+	var operations []ModerationOperation
+	if err := readJSONBody(h, &operations); err != nil {
+		return handleHTTPError(h, err, 400)
+	}
+	if len(operations) == 0 || len(operations) > maxBulkOperations {
+		return handleHTTPError(h, fmt.Errorf("between 1 and %d operations required", maxBulkOperations), 400)
+	}
+	if ensureRoomSchema(room) != 0 {
+		return handleHTTPError(h, fmt.Errorf("room migration failed"), 500)
+	}
+	moderator, _ := h.Query().Get("moderator")
+	plan, err := planModeration(room, moderator, operations)
+	if err != nil {
+		return handleHTTPError(h, err, 400)
+	}
+	response := map[string]interface{}{
+		"room":            room,
+		"operations":      plan.counts,
+		"sanctions":       len(plan.sanctions),
+		"deletedMessages": len(plan.messageKeys),
+		"revertedPixels":  len(plan.pixels),
+	}
+	// dryRun=true only reports what the batch would do
+	if dryRun, _ := h.Query().Get("dryRun"); dryRun == "true" {
+		response["dryRun"] = true
+		return sendJSONResponse(h, response)
+	}
+	// The whole batch is one destructive action with one audit entry
+	audit, code := guardDestructive(h, room, "bulkModerate", plan.summary(moderator))
+	if code != 0 {
+		return code
+	}
+	if len(plan.pixels) > 0 {
+		changes, dbErr := savePixels(room, plan.pixels, true)
+		if dbErr != 0 {
+			return failAudited(h, room, audit, fmt.Errorf("failed to revert regions"), 500)
+		}
+		afterPixelsSaved(room, changes)
+		broadcastPixelBatch(PixelBatch{Room: room, UserID: "system", Pixels: plan.pixels}, changes, false)
+	}
+	db, dbErr := getChatDB()
+	if dbErr != 0 {
+		return failAudited(h, room, audit, fmt.Errorf("database connection failed"), 500)
+	}
+	failed := make([]string, 0)
+	for i, key := range plan.messageKeys {
+		if _, err := removeChatMessage(db, room, key); err != nil {
+			logError("bulkModerate", room, "failed to delete message %s: %v", plan.messageIDs[i], err)
+			failed = append(failed, fmt.Sprintf("%s %s", OperationDeleteMessage, plan.messageIDs[i]))
+		}
+	}
+	for _, sanction := range plan.sanctions {
+		if applySanction(room, sanction) != 0 {
+			failed = append(failed, fmt.Sprintf("%s %s", sanction.Kind, sanction.UserID))
+		}
+	}
+	// Operations already applied stay applied; the caller gets a failure status
+	// listing what did not go through so it can retry just those
+	if len(failed) > 0 {
+		response["failed"] = failed
+		err := fmt.Errorf("%d operations failed: %s", len(failed), strings.Join(failed, ", "))
+		completeAudit(room, audit, err)
+		logError("bulkModerate", room, "partially applied batch: %v", err)
+		h.Headers().Set("Content-Type", "application/json")
+		data, _ := json.Marshal(response)
+		h.Write(data)
+		h.Return(500)
+		return 1
+	}
+	completeAudit(room, audit, nil)
+	logInfo("bulkModerate", room, "applied batch: %s", plan.summary(moderator))
+	return sendJSONResponse(h, response)
+}
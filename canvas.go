@@ -1,75 +1,156 @@
 package lib
 
 import (
-	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/taubyte/go-sdk/database"
 	"github.com/taubyte/go-sdk/event"
+	http "github.com/taubyte/go-sdk/http/event"
 )
 
 //export getCanvas
 func getCanvas(e event.Event) uint32 {
-	fmt.Printf("[DEBUG] getCanvas called\n")
+	logDebug("getCanvas", "", "called")
 	h, err := e.HTTP()
 	if err != nil {
-		fmt.Printf("[ERROR] getCanvas HTTP error: %v\n", err)
+		logError("getCanvas", "", "HTTP error: %v", err)
 		return 1
 	}
 	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
 	room, code := getRoomParamRequired(h)
 	if code != 0 {
-		fmt.Printf("[ERROR] getCanvas room param error: %d\n", code)
+		logError("getCanvas", "", "room param error: %d", code)
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
 		return code
 	}
-	fmt.Printf("[DEBUG] getCanvas room: %s\n", room)
-	db, dbErr := getCanvasDB()
+	if _, code := checkAnonymousRead(h, room); code != 0 {
+		return code
+	}
+	setMaintenanceBanner(h, room)
+	logDebug("getCanvas", room, "loading canvas")
+	if isShardedRoom(room) {
+		return handleHTTPError(h, fmt.Errorf("room %s is sharded; load it through getShardManifest and getShard", room), 413)
+	}
+	remap, err := getColorRemapParam(h)
+	if err != nil {
+		return handleHTTPError(h, err, 404)
+	}
+	if ensureRoomSchema(room) != 0 {
+		return handleHTTPError(h, fmt.Errorf("room migration failed"), 500)
+	}
+	// A cursor resumes a load cut short by the handler's execution budget and
+	// returns only the remaining pixels, to be painted over the partial canvas
+	cursor, _ := h.Query().Get("cursor")
+	pixels, next, dbErr := loadRoomPixelsBudgeted(room, cursor, newExecutionBudget("getCanvas"))
 	if dbErr != 0 {
-		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+		return handleHTTPError(h, fmt.Errorf("failed to load canvas"), 500)
 	}
-	canvas := make([][]string, CanvasHeight)
-	for y := range canvas {
-		canvas[y] = make([]string, CanvasWidth)
-		for x := range canvas[y] {
-			canvas[y][x] = "#ffffff"
-		}
+	if next != "" {
+		logInfo("getCanvas", room, "execution budget exceeded, returning partial canvas with cursor %s", next)
 	}
-	keys, err := db.List(fmt.Sprintf("/%s/", room))
-	fmt.Printf("[DEBUG] getCanvas found %d keys for room %s\n", len(keys), room)
-	if err == nil {
-		for _, key := range keys {
-			if len(key) > len(fmt.Sprintf("/%s/", room)) {
-				coordPart := key[len(fmt.Sprintf("/%s/", room)):]
-				var x, y int
-				if n, err := fmt.Sscanf(coordPart, "%d:%d", &x, &y); n == 2 && err == nil {
-					fmt.Printf("[DEBUG] getCanvas processing pixel at (%d,%d)\n", x, y)
-					// Validate coordinates before accessing canvas
-					if x >= 0 && x < CanvasWidth && y >= 0 && y < CanvasHeight {
-						pixelData, err := db.Get(key)
-						if err == nil {
-							var pixel Pixel
-							if json.Unmarshal(pixelData, &pixel) == nil {
-								canvas[y][x] = pixel.Color
-								fmt.Printf("[DEBUG] getCanvas set pixel (%d,%d) to color %s\n", x, y, pixel.Color)
-							} else {
-								fmt.Printf("[ERROR] getCanvas failed to unmarshal pixel data for (%d,%d)\n", x, y)
-							}
-						} else {
-							fmt.Printf("[ERROR] getCanvas failed to get pixel data for (%d,%d): %v\n", x, y, err)
-						}
-					} else {
-						fmt.Printf("[ERROR] getCanvas invalid coordinates (%d,%d) - bounds: [0,%d) x [0,%d)\n", x, y, CanvasWidth, CanvasHeight)
-					}
-				} else {
-					fmt.Printf("[ERROR] getCanvas failed to parse coordinates from key: %s\n", key)
-				}
+	if cursor != "" {
+		cells := make([]CanvasCell, 0, len(pixels))
+		for _, pixel := range pixels {
+			color := pixel.Color
+			if mapped, ok := remap[strings.ToLower(color)]; ok {
+				color = mapped
 			}
+			cells = append(cells, CanvasCell{X: pixel.X, Y: pixel.Y, Color: color})
 		}
-	} else {
-		fmt.Printf("[ERROR] getCanvas failed to list keys: %v\n", err)
+		return sendJSONResponse(h, map[string]interface{}{
+			"room":    room,
+			"pixels":  cells,
+			"cursor":  next,
+			"partial": next != "",
+		})
+	}
+	canvas := newBaseCanvas(room)
+	for _, pixel := range pixels {
+		canvas[pixel.Y][pixel.X] = pixel.Color
+	}
+	if next != "" {
+		h.Headers().Set("X-Partial-Result", "true")
+		h.Headers().Set("X-Continuation-Cursor", next)
+	}
+	logDebug("getCanvas", room, "returning canvas data with %d pixels", len(pixels))
+	return sendCanvasResponse(h, remapCanvas(canvas, remap))
+}
+
+//export getCanvasRegion
+func getCanvasRegion(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
 	}
-	fmt.Printf("[DEBUG] getCanvas returning canvas data\n")
-	return sendJSONResponse(h, canvas)
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	if _, code := checkAnonymousRead(h, room); code != 0 {
+		return code
+	}
+	setMaintenanceBanner(h, room)
+	remap, err := getColorRemapParam(h)
+	if err != nil {
+		return handleHTTPError(h, err, 404)
+	}
+	width, height := roomSize(room)
+	region := Region{
+		X:      getIntParam(h, "x", -1),
+		Y:      getIntParam(h, "y", -1),
+		Width:  getIntParam(h, "width", 0),
+		Height: getIntParam(h, "height", 0),
+	}
+	if region.X < 0 || region.Y < 0 || region.Width <= 0 || region.Height <= 0 ||
+		region.X+region.Width > width || region.Y+region.Height > height {
+		return handleHTTPError(h, fmt.Errorf("region must be inside the %dx%d canvas (x, y, width and height parameters)", width, height), 400)
+	}
+	// A viewport is never bigger than a whole unsharded canvas
+	if region.Width*region.Height > maxCanvasDimension*maxCanvasDimension {
+		return handleHTTPError(h, fmt.Errorf("region may cover at most %d pixels", maxCanvasDimension*maxCanvasDimension), 413)
+	}
+	if ensureRoomSchema(room) != 0 {
+		return handleHTTPError(h, fmt.Errorf("room migration failed"), 500)
+	}
+	grid, dbErr := loadRegionGrid(room, region)
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("failed to load canvas region"), 500)
+	}
+	recordRegionRequest(room, region)
+	return sendCanvasResponse(h, remapCanvas(grid, remap))
+}
+
+// Clients opt into the compact encoding with format=binary or an octet-stream Accept header
+func wantsBinaryCanvas(h http.Event) bool {
+	if format, _ := h.Query().Get("format"); format != "" {
+		return format == "binary"
+	}
+	accept, _ := h.Headers().Get("Accept")
+	return strings.Contains(accept, "application/octet-stream")
+}
+
+// Send the grid as JSON, or palette-indexed runs when the client asked for binary
+func sendCanvasResponse(h http.Event, canvas [][]string) uint32 {
+	if !wantsBinaryCanvas(h) {
+		return sendJSONResponse(h, canvas)
+	}
+	h.Headers().Set("Content-Type", "application/octet-stream")
+	h.Write(encodeCanvasBinary(canvas))
+	h.Return(200)
+	return 0
 }
 
 //export clearData
@@ -79,7 +160,19 @@ func clearData(e event.Event) uint32 {
 		return 1
 	}
 	setCORSHeaders(h)
-	room := getRoomParam(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParam(h)
+	if code != 0 {
+		return code
+	}
+	if code := rejectDuringMaintenance(h, room); code != 0 {
+		return code
+	}
 	dataType, err := h.Query().Get("type")
 	if err != nil {
 		h.Write([]byte("type parameter required (canvas or chat)"))
@@ -99,20 +192,167 @@ func clearData(e event.Event) uint32 {
 		h.Return(400)
 		return 1
 	}
+	audit, code := guardDestructive(h, room, "clearData", dataType)
+	if code != 0 {
+		return code
+	}
 	db, err := database.New(dbPath)
 	if err != nil {
-		h.Write([]byte(err.Error()))
-		h.Return(500)
-		return 1
+		return failAudited(h, room, audit, err, 500)
 	}
 	keys, err := db.List(fmt.Sprintf("/%s/", room))
-	if err == nil && len(keys) > 0 {
-		for _, key := range keys {
-			db.Delete(key)
+	if err != nil {
+		return failAudited(h, room, audit, fmt.Errorf("failed to list keys: %v", err), 500)
+	}
+	failed := 0
+	for _, key := range keys {
+		if db.Delete(key) != nil {
+			failed++
 		}
 	}
+	if failed > 0 {
+		return failAudited(h, room, audit, fmt.Errorf("failed to delete %d of %d keys", failed, len(keys)), 500)
+	}
+	if dataType == "canvas" {
+		deleteRoomChunks(room)
+		reseedRoom(room)
+		clearSignatures(room)
+		// Counters describing the canvas as it stands start over with it
+		resetColorCounts(room)
+		resetTeamScores(room)
+		resetZones(room)
+		resetTemplateProgress(room)
+		resetStorageUsage(room, NamespaceCanvas)
+		invalidateCanvasChecksum(room)
+	} else {
+		resetStorageUsage(room, NamespaceChat)
+		clearTranslations(room)
+		clearChatSeqIndex(room)
+		clearReactions(room)
+		clearAnchorMentions(room)
+	}
+	completeAudit(room, audit, nil)
+	publishLifecycleEvent(room, LifecycleCleared, map[string]string{"type": dataType})
 	h.Write([]byte(successMsg))
 	h.Return(200)
 	return 0
 }
 
+const (
+	maxBulkCanvasRooms = 20
+	// Each preview cell summarizes a previewScale x previewScale block
+	previewScale = 4
+)
+
+// Downsample a canvas to one cell per block, keeping each block's most common color
+func previewGrid(canvas [][]string) [][]string {
+	rows := (len(canvas) + previewScale - 1) / previewScale
+	preview := make([][]string, rows)
+	for py := range preview {
+		cols := (len(canvas[0]) + previewScale - 1) / previewScale
+		preview[py] = make([]string, cols)
+		for px := range preview[py] {
+			counts := make(map[string]int)
+			best := ""
+			for y := py * previewScale; y < (py+1)*previewScale && y < len(canvas); y++ {
+				for x := px * previewScale; x < (px+1)*previewScale && x < len(canvas[y]); x++ {
+					color := canvas[y][x]
+					counts[color]++
+					if best == "" || counts[color] > counts[best] || (counts[color] == counts[best] && color < best) {
+						best = color
+					}
+				}
+			}
+			preview[py][px] = best
+		}
+	}
+	return preview
+}
+
+//export getCanvases
+func getCanvases(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	roomsParam, err := h.Query().Get("rooms")
+	if err != nil || roomsParam == "" {
+		return handleHTTPError(h, fmt.Errorf("rooms parameter required"), 400)
+	}
+	rooms := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, room := range strings.Split(roomsParam, ",") {
+		room = strings.TrimSpace(room)
+		if room != "" && !seen[room] {
+			seen[room] = true
+			rooms = append(rooms, room)
+		}
+	}
+	if len(rooms) > maxBulkCanvasRooms {
+		return handleHTTPError(h, fmt.Errorf("at most %d rooms per request", maxBulkCanvasRooms), 400)
+	}
+	preview, _ := h.Query().Get("preview")
+	remap, err := getColorRemapParam(h)
+	if err != nil {
+		return handleHTTPError(h, err, 404)
+	}
+
+	// Callers without a deployment-wide credential pay for one read; room-scoped
+	// credentials only unlock their own room
+	anonymous := !requestAuthenticated(h, "")
+	if anonymous && !recordAnonymousRead(clientIP(h)) {
+		h.Headers().Set("Retry-After", fmt.Sprintf("%d", int(anonymousReadWindow.Seconds())))
+		return handleHTTPError(h, fmt.Errorf("anonymous read limit exceeded"), 429)
+	}
+
+	canvases := make(map[string]interface{}, len(rooms))
+	locales := make(map[string]string, len(rooms))
+	custom := make(map[string]map[string]string, len(rooms))
+	for _, room := range rooms {
+		if !roomExists(room) {
+			canvases[room] = map[string]string{"error": "room not found"}
+			continue
+		}
+		settings := loadRoomSettings(room)
+		if anonymous && settings.Private && !requestAuthenticated(h, room) {
+			canvases[room] = map[string]string{"error": "room requires an API key"}
+			continue
+		}
+		locales[room] = roomLocale(room)
+		if len(settings.Custom) > 0 {
+			custom[room] = settings.Custom
+		}
+		if isArchivedRoom(room) {
+			canvases[room] = map[string]bool{"archived": true}
+			continue
+		}
+		if isShardedRoom(room) {
+			canvases[room] = map[string]string{"error": "room is sharded; load it through getShardManifest and getShard"}
+			continue
+		}
+		if ensureRoomSchema(room) != 0 {
+			canvases[room] = map[string]string{"error": "room migration failed"}
+			continue
+		}
+		canvas, dbErr := loadCanvasGrid(room)
+		if dbErr != 0 {
+			canvases[room] = map[string]string{"error": "failed to load canvas"}
+			continue
+		}
+		remapCanvas(canvas, remap)
+		if preview == "true" {
+			canvas = previewGrid(canvas)
+		}
+		canvases[room] = canvas
+	}
+	return sendJSONResponse(h, map[string]interface{}{
+		"preview":  preview == "true",
+		"canvases": canvases,
+		"locales":  locales,
+		"custom":   custom,
+	})
+}
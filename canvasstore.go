@@ -0,0 +1,401 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/taubyte/go-sdk/database"
+)
+
+// Width and height of a canvas chunk in pixels
+const chunkSize = 16
+
+// Held around every write to a room's canvas and around layout migration.
+// Chunks are rewritten whole, so concurrent writers of a room would otherwise
+// drop each other's pixels. Aggregation windows take roomCommitLock first.
+var (
+	roomWriteLocks = make(map[string]*sync.Mutex)
+	writeLockMutex sync.Mutex
+)
+
+func roomWriteLock(room string) *sync.Mutex {
+	writeLockMutex.Lock()
+	defer writeLockMutex.Unlock()
+	lock, ok := roomWriteLocks[room]
+	if !ok {
+		lock = &sync.Mutex{}
+		roomWriteLocks[room] = lock
+	}
+	return lock
+}
+
+func roomLayoutKey(room string) string {
+	return fmt.Sprintf("/%s/layout", room)
+}
+
+func chunkKey(room string, cx, cy int) string {
+	return fmt.Sprintf("/%s/%d:%d", room, cx, cy)
+}
+
+func chunkCellIndex(x, y int) int {
+	return (y%chunkSize)*chunkSize + x%chunkSize
+}
+
+func loadRoomLayout(room string) string {
+	db, dbErr := getSchemaDB()
+	if dbErr != 0 {
+		return LayoutLegacy
+	}
+	data, err := db.Get(roomLayoutKey(room))
+	if err != nil || len(data) == 0 {
+		return LayoutLegacy
+	}
+	return string(data)
+}
+
+func setRoomLayout(room, layout string) uint32 {
+	db, dbErr := getSchemaDB()
+	if dbErr != 0 {
+		return dbErr
+	}
+	if err := db.Put(roomLayoutKey(room), []byte(layout)); err != nil {
+		logError("setRoomLayout", room, "failed: %v", err)
+		return 1
+	}
+	return 0
+}
+
+func isChunkedRoom(room string) bool {
+	return loadRoomLayout(room) == LayoutChunked
+}
+
+func newCanvasChunk() CanvasChunk {
+	return CanvasChunk{Cells: make([]*Pixel, chunkSize*chunkSize)}
+}
+
+func loadChunk(db database.Database, room string, cx, cy int) (CanvasChunk, bool) {
+	chunk := newCanvasChunk()
+	data, err := db.Get(chunkKey(room, cx, cy))
+	if err != nil || len(data) == 0 {
+		return chunk, false
+	}
+	if err := json.Unmarshal(data, &chunk); err != nil || len(chunk.Cells) != chunkSize*chunkSize {
+		logError("loadChunk", room, "invalid chunk %d:%d", cx, cy)
+		return newCanvasChunk(), false
+	}
+	return chunk, true
+}
+
+// Load every stored pixel of the room that lies inside the canvas bounds
+func loadRoomPixels(room string) ([]Pixel, uint32) {
+	if isChunkedRoom(room) {
+		return loadChunkedPixels(room)
+	}
+	return loadLegacyPixels(room)
+}
+
+// Build the room's full color grid, unset pixels showing the room background
+func loadCanvasGrid(room string) ([][]string, uint32) {
+	pixels, dbErr := loadRoomPixels(room)
+	if dbErr != 0 {
+		return nil, dbErr
+	}
+	canvas := newBaseCanvas(room)
+	for _, pixel := range pixels {
+		canvas[pixel.Y][pixel.X] = pixel.Color
+	}
+	return canvas, 0
+}
+
+// Build the color grid of a region, reading only the chunks it overlaps
+func loadRegionGrid(room string, region Region) ([][]string, uint32) {
+	grid := newBaseRegion(room, region)
+	dbErr := forEachRegionPixel(room, region, func(pixel Pixel) {
+		grid[pixel.Y-region.Y][pixel.X-region.X] = pixel.Color
+	})
+	if dbErr != 0 {
+		return nil, dbErr
+	}
+	return grid, 0
+}
+
+// Call fn with every stored pixel inside the region, reading only the chunks
+// it overlaps
+func forEachRegionPixel(room string, region Region, fn func(Pixel)) uint32 {
+	visit := func(pixel Pixel) {
+		if region.Contains(pixel.X, pixel.Y) {
+			fn(pixel)
+		}
+	}
+	if !isChunkedRoom(room) {
+		pixels, dbErr := loadLegacyPixels(room)
+		if dbErr != 0 {
+			return dbErr
+		}
+		for _, pixel := range pixels {
+			visit(pixel)
+		}
+		return 0
+	}
+	db, dbErr := getChunksDB()
+	if dbErr != 0 {
+		return dbErr
+	}
+	for cy := region.Y / chunkSize; cy <= (region.Y+region.Height-1)/chunkSize; cy++ {
+		for cx := region.X / chunkSize; cx <= (region.X+region.Width-1)/chunkSize; cx++ {
+			chunk, ok := loadChunk(db, room, cx, cy)
+			if !ok {
+				continue
+			}
+			for i, cell := range chunk.Cells {
+				if cell != nil {
+					pixel := *cell
+					pixel.X = cx*chunkSize + i%chunkSize
+					pixel.Y = cy*chunkSize + i/chunkSize
+					visit(pixel)
+				}
+			}
+		}
+	}
+	return 0
+}
+
+// Load pixels stored in chunk blobs
+func loadChunkedPixels(room string) ([]Pixel, uint32) {
+	db, dbErr := getChunksDB()
+	if dbErr != 0 {
+		return nil, dbErr
+	}
+	prefix := fmt.Sprintf("/%s/", room)
+	keys, err := db.List(prefix)
+	if err != nil {
+		logError("loadChunkedPixels", room, "failed to list keys: %v", err)
+		return nil, 1
+	}
+	width, height := roomSize(room)
+	pixels := make([]Pixel, 0)
+	for _, key := range keys {
+		if len(key) <= len(prefix) {
+			continue
+		}
+		var cx, cy int
+		if n, err := fmt.Sscanf(key[len(prefix):], "%d:%d", &cx, &cy); n != 2 || err != nil {
+			continue
+		}
+		chunk, ok := loadChunk(db, room, cx, cy)
+		if !ok {
+			continue
+		}
+		for i, cell := range chunk.Cells {
+			if cell == nil {
+				continue
+			}
+			pixel := *cell
+			pixel.X = cx*chunkSize + i%chunkSize
+			pixel.Y = cy*chunkSize + i/chunkSize
+			if pixel.X < width && pixel.Y < height {
+				pixels = append(pixels, pixel)
+			}
+		}
+	}
+	return pixels, 0
+}
+
+// Load pixels stored with the original one-key-per-pixel layout
+func loadLegacyPixels(room string) ([]Pixel, uint32) {
+	db, dbErr := getCanvasDB()
+	if dbErr != 0 {
+		return nil, dbErr
+	}
+	prefix := fmt.Sprintf("/%s/", room)
+	keys, err := db.List(prefix)
+	if err != nil {
+		logError("loadLegacyPixels", room, "failed to list keys: %v", err)
+		return nil, 1
+	}
+	width, height := roomSize(room)
+	pixels := make([]Pixel, 0, len(keys))
+	for _, key := range keys {
+		if len(key) <= len(prefix) {
+			continue
+		}
+		var x, y int
+		if n, err := fmt.Sscanf(key[len(prefix):], "%d:%d", &x, &y); n != 2 || err != nil {
+			continue
+		}
+		if x < 0 || x >= width || y < 0 || y >= height {
+			continue
+		}
+		pixelData, err := db.Get(key)
+		if err != nil {
+			continue
+		}
+		var pixel Pixel
+		if json.Unmarshal(pixelData, &pixel) == nil {
+			pixel.X, pixel.Y = x, y
+			pixels = append(pixels, pixel)
+		}
+	}
+	return pixels, 0
+}
+
+// Load a single stored pixel
+func loadPixel(room string, x, y int) (Pixel, bool) {
+	var pixel Pixel
+	if isChunkedRoom(room) {
+		db, dbErr := getChunksDB()
+		if dbErr != 0 {
+			return pixel, false
+		}
+		chunk, ok := loadChunk(db, room, x/chunkSize, y/chunkSize)
+		if !ok || chunk.Cells[chunkCellIndex(x, y)] == nil {
+			return pixel, false
+		}
+		return *chunk.Cells[chunkCellIndex(x, y)], true
+	}
+	db, dbErr := getCanvasDB()
+	if dbErr != 0 {
+		return pixel, false
+	}
+	data, err := db.Get(fmt.Sprintf("/%s/%d:%d", room, x, y))
+	if err != nil || len(data) == 0 {
+		return pixel, false
+	}
+	return pixel, json.Unmarshal(data, &pixel) == nil
+}
+
+// Persist validated pixels in the room's layout and return the changes that were written
+func savePixels(room string, pixels []Pixel, synchronous bool) ([]PixelChange, uint32) {
+	lock := roomWriteLock(room)
+	lock.Lock()
+	defer lock.Unlock()
+	if isChunkedRoom(room) {
+		return saveChunkedPixels(room, pixels, synchronous)
+	}
+
+	db, dbErr := getCanvasDB()
+	if dbErr != 0 {
+		return nil, dbErr
+	}
+	queue := newWriteQueue(synchronous)
+	pending := make([]PixelChange, 0, len(pixels))
+	sizes := make([][2]int64, 0, len(pixels))
+	for _, pixel := range pixels {
+		pixelData, err := json.Marshal(pixel)
+		if err != nil {
+			logError("savePixels", room, "Failed to marshal pixel (%d,%d): %v", pixel.X, pixel.Y, err)
+			continue
+		}
+
+		key := fmt.Sprintf("/%s/%d:%d", room, pixel.X, pixel.Y)
+		var previous Pixel
+		previousData, getErr := db.Get(key)
+		hadPrevious := getErr == nil && len(previousData) > 0 && json.Unmarshal(previousData, &previous) == nil
+		queue.Put(db, key, pixelData)
+		pending = append(pending, PixelChange{Pixel: pixel, Previous: previous, HadPrevious: hadPrevious})
+		sizes = append(sizes, [2]int64{int64(len(previousData)), int64(len(pixelData))})
+	}
+
+	changes := make([]PixelChange, 0, len(pending))
+	var newKeys, byteDelta int64
+	for i, err := range queue.Flush(writeFlushTimeout) {
+		if err != nil {
+			logError("savePixels", room, "Failed to save pixel (%d,%d) to database: %v", pending[i].Pixel.X, pending[i].Pixel.Y, err)
+		} else {
+			changes = append(changes, pending[i])
+			if !pending[i].HadPrevious {
+				newKeys++
+			}
+			byteDelta += sizes[i][1] - sizes[i][0]
+		}
+	}
+	recordStorageUsage(room, NamespaceCanvas, newKeys, byteDelta)
+	return changes, 0
+}
+
+// Read-modify-write every chunk touched by the batch, one write per chunk
+func saveChunkedPixels(room string, pixels []Pixel, synchronous bool) ([]PixelChange, uint32) {
+	db, dbErr := getChunksDB()
+	if dbErr != 0 {
+		return nil, dbErr
+	}
+	type chunkUpdate struct {
+		cx, cy       int
+		chunk        CanvasChunk
+		existed      bool
+		previousSize int64
+		size         int64
+		changes      []PixelChange
+	}
+	updates := make(map[[2]int]*chunkUpdate)
+	order := make([][2]int, 0)
+	for _, pixel := range pixels {
+		id := [2]int{pixel.X / chunkSize, pixel.Y / chunkSize}
+		update, ok := updates[id]
+		if !ok {
+			chunk, existed := loadChunk(db, room, id[0], id[1])
+			update = &chunkUpdate{cx: id[0], cy: id[1], chunk: chunk, existed: existed}
+			if existed {
+				if data, err := json.Marshal(chunk); err == nil {
+					update.previousSize = int64(len(data))
+				}
+			}
+			updates[id] = update
+			order = append(order, id)
+		}
+		index := chunkCellIndex(pixel.X, pixel.Y)
+		change := PixelChange{Pixel: pixel}
+		if previous := update.chunk.Cells[index]; previous != nil {
+			change.Previous = *previous
+			change.HadPrevious = true
+		}
+		stored := pixel
+		update.chunk.Cells[index] = &stored
+		update.changes = append(update.changes, change)
+	}
+
+	queue := newWriteQueue(synchronous)
+	queued := make([]*chunkUpdate, 0, len(order))
+	for _, id := range order {
+		update := updates[id]
+		data, err := json.Marshal(update.chunk)
+		if err != nil {
+			logError("saveChunkedPixels", room, "Failed to marshal chunk %d:%d: %v", update.cx, update.cy, err)
+			continue
+		}
+		update.size = int64(len(data))
+		queue.Put(db, chunkKey(room, update.cx, update.cy), data)
+		queued = append(queued, update)
+	}
+
+	changes := make([]PixelChange, 0, len(pixels))
+	var newKeys, byteDelta int64
+	for i, err := range queue.Flush(writeFlushTimeout) {
+		if err != nil {
+			logError("saveChunkedPixels", room, "Failed to save chunk %d:%d to database: %v", queued[i].cx, queued[i].cy, err)
+		} else {
+			changes = append(changes, queued[i].changes...)
+			if !queued[i].existed {
+				newKeys++
+			}
+			byteDelta += queued[i].size - queued[i].previousSize
+		}
+	}
+	recordStorageUsage(room, NamespaceCanvas, newKeys, byteDelta)
+	return changes, 0
+}
+
+func deleteRoomChunks(room string) {
+	db, dbErr := getChunksDB()
+	if dbErr != 0 {
+		return
+	}
+	keys, err := db.List(fmt.Sprintf("/%s/", room))
+	if err != nil {
+		return
+	}
+	for _, key := range keys {
+		db.Delete(key)
+	}
+}
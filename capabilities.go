@@ -0,0 +1,89 @@
+package lib
+
+import (
+	"github.com/taubyte/go-sdk/event"
+)
+
+// Version of the pubsub payload layouts described by getCapabilities
+const protocolVersion = 2
+
+type Capabilities struct {
+	ProtocolVersions     []int               `json:"protocolVersions"`
+	PayloadFormats       map[string][]string `json:"payloadFormats"`
+	MaxBatchSize         int                 `json:"maxBatchSize"`
+	CanvasWidth          int                 `json:"canvasWidth"`
+	CanvasHeight         int                 `json:"canvasHeight"`
+	CooldownMs           int64               `json:"cooldownMs"`
+	PixelsPerInterval    int                 `json:"pixelsPerInterval"`
+	RateIntervalMs       int64               `json:"rateIntervalMs"`
+	OverwriteTaxMs       int64               `json:"overwriteTaxMs,omitempty"`
+	OverwriteTaxWindowMs int64               `json:"overwriteTaxWindowMs,omitempty"`
+	Locale               string              `json:"locale"`
+	Features             map[string]bool     `json:"features"`
+	Banner               *Banner             `json:"banner,omitempty"`
+	Custom               map[string]string   `json:"custom,omitempty"`
+	Palette              []string            `json:"palette,omitempty"`
+	PaletteMode          string              `json:"paletteMode,omitempty"`
+	// Set while the room's writes are held in memory after repeated database failures
+	Degraded bool `json:"degraded,omitempty"`
+}
+
+func roomCapabilities(room string) Capabilities {
+	settings := loadRoomSettings(room)
+	width, height := roomSize(room)
+	_, hasTemplate := loadTemplate(room)
+	return Capabilities{
+		ProtocolVersions: []int{1, protocolVersion},
+		PayloadFormats: map[string][]string{
+			"pixels":    {"binary", "json", "envelope"},
+			"chat":      {"binary", "json", "envelope"},
+			"cursor":    {"binary"},
+			"ephemeral": {"json"},
+			"reactions": {"json"},
+			"signature": {"json"},
+			"canvas":    {"json", "binary"},
+		},
+		MaxBatchSize:         maxPixelBatchSize,
+		CanvasWidth:          width,
+		CanvasHeight:         height,
+		CooldownMs:           settings.CooldownMs,
+		PixelsPerInterval:    settings.PixelsPerInterval,
+		RateIntervalMs:       settings.RateIntervalMs,
+		OverwriteTaxMs:       settings.OverwriteTaxMs,
+		OverwriteTaxWindowMs: settings.OverwriteTaxWindowMs,
+		Locale:               roomLocale(room),
+		Features: map[string]bool{
+			"teams":     settings.TeamMode,
+			"zones":     settings.TeamMode && len(loadZones(room)) > 0,
+			"templates": hasTemplate,
+			"reactions": true,
+			"decay":     false,
+			"broadcast": true,
+			"shards":    true,
+			"signature": settings.Mode == RoomModeSignature,
+		},
+		Banner:      activeBanner(room),
+		Custom:      settings.Custom,
+		Palette:     settings.Palette,
+		PaletteMode: settings.PaletteMode,
+		Degraded:    isDegradedRoom(room),
+	}
+}
+
+//export getCapabilities
+func getCapabilities(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	setMaintenanceBanner(h, room)
+	return sendJSONResponse(h, roomCapabilities(room))
+}
@@ -4,56 +4,390 @@ import (
 	"encoding/json"
 	"fmt"
 	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/taubyte/go-sdk/database"
 	"github.com/taubyte/go-sdk/event"
+	http "github.com/taubyte/go-sdk/http/event"
 )
 
+// Chat keys lead with the zero-padded message timestamp so listings sort chronologically
+func chatMessageKey(room string, message ChatMessage) string {
+	timestamp := message.Timestamp
+	if timestamp < 0 {
+		timestamp = 0
+	}
+	return fmt.Sprintf("/%s/%013d-%s", room, timestamp, message.ID)
+}
+
+// Timestamp encoded in a chat key; false for keys in the legacy /<room>/<id> form
+func chatKeyTimestamp(room, key string) (int64, bool) {
+	suffix := strings.TrimPrefix(key, fmt.Sprintf("/%s/", room))
+	if len(suffix) < 14 || suffix[13] != '-' {
+		return 0, false
+	}
+	timestamp, err := strconv.ParseInt(suffix[:13], 10, 64)
+	return timestamp, err == nil
+}
+
+// The room's message keys, oldest first
+func sortedChatKeys(db database.Database, room string) []string {
+	keys, err := db.List(fmt.Sprintf("/%s/", room))
+	if err != nil {
+		logError("sortedChatKeys", room, "failed to list keys: %v", err)
+		return nil
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Message ID encoded in a timestamp-prefixed chat key
+func chatKeyID(room, key string) string {
+	return key[len(room)+16:]
+}
+
+// The room's timestamp-prefixed message keys, oldest first; legacy keys are
+// only left once the room's schema migration failed
+func timestampedChatKeys(db database.Database, room string) []string {
+	keys := make([]string, 0)
+	for _, key := range sortedChatKeys(db, room) {
+		if _, ok := chatKeyTimestamp(room, key); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Read the messages under keys and prepare them for a response: threads and
+// reactions, current usernames, the translation asked for with lang, and
+// redaction for anonymous readers. Shared by every chat listing endpoint.
+func loadChatMessages(h http.Event, db database.Database, room string, keys []string, anonymous bool) ([]ChatMessage, uint32) {
+	lang, _ := h.Query().Get("lang")
+	if lang != "" && !isValidLocale(lang) {
+		return nil, handleHTTPError(h, fmt.Errorf("lang must be a language code like 'fr'"), 400)
+	}
+	messages := make([]ChatMessage, 0, len(keys))
+	for _, key := range keys {
+		messageData, err := db.Get(key)
+		if err != nil {
+			logError("loadChatMessages", room, "failed to get message data for key: %s, error: %v", key, err)
+			continue
+		}
+		var message ChatMessage
+		if json.Unmarshal(messageData, &message) != nil {
+			logError("loadChatMessages", room, "failed to unmarshal message data for key: %s", key)
+			continue
+		}
+		messages = append(messages, message)
+	}
+	attachThreads(db, room, messages)
+	usernameResolver{}.messages(messages)
+	if lang != "" {
+		translateMessages(room, messages, localeLanguage(lang))
+	}
+	if anonymous {
+		redactMessages(messages)
+	}
+	return messages, 0
+}
+
+// Schema migration moving messages stored under /<room>/<id> to timestamp-prefixed keys
+func migrateChatKeys(room string) error {
+	db, dbErr := getChatDB()
+	if dbErr != 0 {
+		return fmt.Errorf("chat database connection failed")
+	}
+	keys, _ := db.List(fmt.Sprintf("/%s/", room))
+	for _, key := range keys {
+		if _, ok := chatKeyTimestamp(room, key); ok {
+			continue
+		}
+		data, err := db.Get(key)
+		if err != nil {
+			continue
+		}
+		var message ChatMessage
+		if json.Unmarshal(data, &message) != nil || message.ID == "" {
+			continue
+		}
+		newKey := chatMessageKey(room, message)
+		if err := db.Put(newKey, data); err != nil {
+			return fmt.Errorf("failed to move message %s: %v", message.ID, err)
+		}
+		if message.Seq > 0 {
+			db.Put(chatSeqIndexKey(room, message.Seq), []byte(newKey))
+		}
+		db.Delete(key)
+	}
+	return nil
+}
+
 //export getMessages
 func getMessages(e event.Event) uint32 {
-	fmt.Printf("[DEBUG] getMessages called\n")
+	logDebug("getMessages", "", "called")
 	h, err := e.HTTP()
 	if err != nil {
-		fmt.Printf("[ERROR] getMessages HTTP error: %v\n", err)
+		logError("getMessages", "", "HTTP error: %v", err)
 		return 1
 	}
 	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
 	room, code := getRoomParamRequired(h)
 	if code != 0 {
-		fmt.Printf("[ERROR] getMessages room param error: %d\n", code)
+		logError("getMessages", "", "room param error: %d", code)
 		return code
 	}
-	fmt.Printf("[DEBUG] getMessages room: %s\n", room)
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	anonymous, code := checkAnonymousRead(h, room)
+	if code != 0 {
+		return code
+	}
+	setMaintenanceBanner(h, room)
+	logDebug("getMessages", room, "loading messages")
+	if ensureRoomSchema(room) != 0 {
+		return handleHTTPError(h, fmt.Errorf("room migration failed"), 500)
+	}
 	db, dbErr := getChatDB()
 	if dbErr != 0 {
 		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
 	}
-	var messages []ChatMessage
-	keys, err := db.List(fmt.Sprintf("/%s/", room))
-	fmt.Printf("[DEBUG] getMessages found %d keys for room %s\n", len(keys), room)
-	if err == nil {
-		for _, key := range keys {
-			if len(key) > len(fmt.Sprintf("/%s/", room)) {
-				messageData, err := db.Get(key)
-				if err == nil {
-					var message ChatMessage
-					if json.Unmarshal(messageData, &message) == nil {
-						messages = append(messages, message)
-						fmt.Printf("[DEBUG] getMessages loaded message %s from %s\n", message.ID, message.Username)
-					} else {
-						fmt.Printf("[ERROR] getMessages failed to unmarshal message data for key: %s\n", key)
-					}
-				} else {
-					fmt.Printf("[ERROR] getMessages failed to get message data for key: %s, error: %v\n", key, err)
-				}
-			}
-		}
-	} else {
-		fmt.Printf("[ERROR] getMessages failed to list keys: %v\n", err)
-	}
-	sort.Slice(messages, func(i, j int) bool {
-		return messages[i].Timestamp < messages[j].Timestamp
-	})
-	fmt.Printf("[DEBUG] getMessages returning %d messages\n", len(messages))
+	// since and before are exclusive timestamp bounds; with a limit, since pages
+	// forward from the oldest match and otherwise the newest matches are kept.
+	// Without any of them every message is returned, as before.
+	since := int64(getIntParam(h, "since", 0))
+	before := int64(getIntParam(h, "before", 0))
+	limit := getIntParam(h, "limit", 0)
+	if limit < 0 || limit > maxMessagesLimit {
+		return handleHTTPError(h, fmt.Errorf("limit must be between 1 and %d", maxMessagesLimit), 400)
+	}
+	keys := make([]string, 0)
+	for _, key := range timestampedChatKeys(db, room) {
+		timestamp, _ := chatKeyTimestamp(room, key)
+		if (since > 0 && timestamp <= since) || (before > 0 && timestamp >= before) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	hasMore := limit > 0 && len(keys) > limit
+	if hasMore {
+		if since > 0 {
+			keys = keys[:limit]
+		} else {
+			keys = keys[len(keys)-limit:]
+		}
+	}
+	logDebug("getMessages", room, "reading %d keys", len(keys))
+	messages, code := loadChatMessages(h, db, room, keys, anonymous)
+	if code != 0 {
+		return code
+	}
+	if hasMore {
+		h.Headers().Set("X-Has-More", "true")
+	}
+	logDebug("getMessages", room, "returning %d messages", len(messages))
 	return sendJSONResponse(h, messages)
 }
 
+const (
+	defaultMessagesLimit = 50
+	maxMessagesLimit     = 200
+)
+
+// Cursors identify a message by timestamp and ID so pages stay stable as messages arrive
+func messageCursor(message ChatMessage) string {
+	return fmt.Sprintf("%d:%s", message.Timestamp, message.ID)
+}
+
+func messageBefore(a, b ChatMessage) bool {
+	if a.Timestamp != b.Timestamp {
+		return a.Timestamp < b.Timestamp
+	}
+	return a.ID < b.ID
+}
+
+//export getMessagesV2
+func getMessagesV2(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	anonymous, code := checkAnonymousRead(h, room)
+	if code != 0 {
+		return code
+	}
+	setMaintenanceBanner(h, room)
+	limit := getIntParam(h, "limit", defaultMessagesLimit)
+	if limit <= 0 || limit > maxMessagesLimit {
+		limit = defaultMessagesLimit
+	}
+	var cursor ChatMessage
+	hasCursor := false
+	if value, err := h.Query().Get("cursor"); err == nil && value != "" {
+		separator := strings.Index(value, ":")
+		if separator < 0 {
+			return handleHTTPError(h, fmt.Errorf("invalid cursor"), 400)
+		}
+		timestamp, err := strconv.ParseInt(value[:separator], 10, 64)
+		if err != nil {
+			return handleHTTPError(h, fmt.Errorf("invalid cursor"), 400)
+		}
+		cursor = ChatMessage{Timestamp: timestamp, ID: value[separator+1:]}
+		hasCursor = true
+	}
+
+	if ensureRoomSchema(room) != 0 {
+		return handleHTTPError(h, fmt.Errorf("room migration failed"), 500)
+	}
+	db, dbErr := getChatDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	// Keys sort by timestamp then ID, the same order messageBefore uses
+	keys := timestampedChatKeys(db, room)
+	keyMessage := func(key string) ChatMessage {
+		timestamp, _ := chatKeyTimestamp(room, key)
+		return ChatMessage{Timestamp: timestamp, ID: chatKeyID(room, key)}
+	}
+	// Pages walk backwards from the newest message; each page is returned oldest first
+	end := len(keys)
+	if hasCursor {
+		end = sort.Search(len(keys), func(i int) bool {
+			return !messageBefore(keyMessage(keys[i]), cursor)
+		})
+	}
+	start := end - limit
+	if start < 0 {
+		start = 0
+	}
+	page, code := loadChatMessages(h, db, room, keys[start:end], anonymous)
+	if code != 0 {
+		return code
+	}
+	nextCursor := ""
+	if start > 0 {
+		nextCursor = messageCursor(keyMessage(keys[start]))
+	}
+	return sendJSONResponse(h, map[string]interface{}{
+		"messages":   page,
+		"total":      len(keys),
+		"nextCursor": nextCursor,
+		"room":       room,
+		"serverTime": time.Now().UnixMilli(),
+	})
+}
+
+const (
+	defaultMessagesPerRoom = 20
+	maxBulkMessageRooms    = 20
+)
+
+// The room's newest messages, oldest first, reading only the keys returned
+func loadRecentMessages(room string, limit int) []ChatMessage {
+	messages := make([]ChatMessage, 0, limit)
+	db, dbErr := getChatDB()
+	if dbErr != 0 {
+		return messages
+	}
+	keys := sortedChatKeys(db, room)
+	if len(keys) > limit {
+		keys = keys[len(keys)-limit:]
+	}
+	for _, key := range keys {
+		data, err := db.Get(key)
+		if err != nil {
+			continue
+		}
+		var message ChatMessage
+		if json.Unmarshal(data, &message) == nil {
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
+
+//export getRecentMessagesMulti
+func getRecentMessagesMulti(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	roomsParam, err := h.Query().Get("rooms")
+	if err != nil || roomsParam == "" {
+		return handleHTTPError(h, fmt.Errorf("rooms parameter required"), 400)
+	}
+	rooms := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, room := range strings.Split(roomsParam, ",") {
+		room = strings.TrimSpace(room)
+		if room != "" && !seen[room] {
+			seen[room] = true
+			rooms = append(rooms, room)
+		}
+	}
+	if len(rooms) > maxBulkMessageRooms {
+		return handleHTTPError(h, fmt.Errorf("at most %d rooms per request", maxBulkMessageRooms), 400)
+	}
+	limit := getIntParam(h, "limitPerRoom", defaultMessagesPerRoom)
+	if limit <= 0 || limit > maxMessagesLimit {
+		return handleHTTPError(h, fmt.Errorf("limitPerRoom must be between 1 and %d", maxMessagesLimit), 400)
+	}
+	// Callers without a deployment-wide credential pay for one read; room-scoped
+	// credentials only unlock their own room
+	anonymous := !requestAuthenticated(h, "")
+	if anonymous && !recordAnonymousRead(clientIP(h)) {
+		h.Headers().Set("Retry-After", fmt.Sprintf("%d", int(anonymousReadWindow.Seconds())))
+		return handleHTTPError(h, fmt.Errorf("anonymous read limit exceeded"), 429)
+	}
+
+	results := make(map[string]interface{}, len(rooms))
+	for _, room := range rooms {
+		if !roomExists(room) {
+			results[room] = map[string]string{"error": "room not found"}
+			continue
+		}
+		roomAnonymous := anonymous && !requestAuthenticated(h, room)
+		if roomAnonymous && loadRoomSettings(room).Private {
+			results[room] = map[string]string{"error": "room requires an API key"}
+			continue
+		}
+		if isArchivedRoom(room) {
+			results[room] = map[string]bool{"archived": true}
+			continue
+		}
+		if ensureRoomSchema(room) != 0 {
+			results[room] = map[string]string{"error": "room migration failed"}
+			continue
+		}
+		messages := loadRecentMessages(room, limit)
+		usernameResolver{}.messages(messages)
+		if roomAnonymous {
+			redactMessages(messages)
+		}
+		results[room] = messages
+	}
+	return sendJSONResponse(h, map[string]interface{}{
+		"rooms":      results,
+		"serverTime": time.Now().UnixMilli(),
+	})
+}
@@ -0,0 +1,61 @@
+package lib
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMigrateChatKeys(t *testing.T) {
+	mockDatabases(t)
+	db, dbErr := getChatDB()
+	if dbErr != 0 {
+		t.Fatal("getChatDB failed")
+	}
+	legacy := ChatMessage{ID: "msg-1", UserID: "user-1", Message: "hello", Timestamp: 1700000000000, Seq: 3}
+	legacyData, _ := json.Marshal(legacy)
+	db.Put("/lobby/msg-1", legacyData)
+
+	current := ChatMessage{ID: "msg-2", UserID: "user-1", Message: "hi", Timestamp: 1700000000500}
+	currentKey := chatMessageKey("lobby", current)
+	currentData, _ := json.Marshal(current)
+	db.Put(currentKey, currentData)
+
+	// Unreadable entries and other rooms are left alone
+	db.Put("/lobby/broken", []byte("{"))
+	db.Put("/lobby-2/msg-3", legacyData)
+
+	if err := migrateChatKeys("lobby"); err != nil {
+		t.Fatalf("migrateChatKeys: %v", err)
+	}
+
+	movedKey := chatMessageKey("lobby", legacy)
+	if data, err := db.Get(movedKey); err != nil || string(data) != string(legacyData) {
+		t.Errorf("message not moved to %s: %q, %v", movedKey, data, err)
+	}
+	if _, err := db.Get("/lobby/msg-1"); err == nil {
+		t.Error("legacy key still present")
+	}
+	if index, err := db.Get(chatSeqIndexKey("lobby", legacy.Seq)); err != nil || string(index) != movedKey {
+		t.Errorf("seq index points to %q, want %s", index, movedKey)
+	}
+	if data, err := db.Get(currentKey); err != nil || string(data) != string(currentData) {
+		t.Errorf("timestamped message changed: %q, %v", data, err)
+	}
+	if _, err := db.Get("/lobby/broken"); err != nil {
+		t.Error("unreadable entry removed")
+	}
+	if _, err := db.Get("/lobby-2/msg-3"); err != nil {
+		t.Error("other room's message moved")
+	}
+	if keys := timestampedChatKeys(db, "lobby"); len(keys) != 2 || keys[0] != movedKey || keys[1] != currentKey {
+		t.Errorf("got keys %v", keys)
+	}
+
+	// Running it again finds nothing left to move
+	if err := migrateChatKeys("lobby"); err != nil {
+		t.Fatalf("second migrateChatKeys: %v", err)
+	}
+	if keys, _ := db.List("/lobby/"); len(keys) != 3 {
+		t.Errorf("got %d keys after a second run, want 3", len(keys))
+	}
+}
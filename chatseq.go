@@ -0,0 +1,161 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/taubyte/go-sdk/database"
+	"github.com/taubyte/go-sdk/event"
+)
+
+const (
+	defaultReplayLimit = 100
+	maxReplayLimit     = 500
+)
+
+func chatSeqKey(room string) string {
+	return fmt.Sprintf("/%s/chat-seq", room)
+}
+
+// The index lives outside the room's message prefix so message listings stay unchanged
+func chatSeqIndexPrefix(room string) string {
+	return fmt.Sprintf(globalKeyPrefix+"chat-seq/%s/", room)
+}
+
+func chatSeqIndexKey(room string, seq int64) string {
+	return fmt.Sprintf("%s%012d", chatSeqIndexPrefix(room), seq)
+}
+
+// Sequence for a message about to be stored; a message that is already stored
+// (a recovered intent) keeps its sequence so replays never see it twice
+func assignChatSeq(chatDB database.Database, room, key string) int64 {
+	if data, err := chatDB.Get(key); err == nil && len(data) > 0 {
+		var existing ChatMessage
+		if json.Unmarshal(data, &existing) == nil && existing.Seq > 0 {
+			return existing.Seq
+		}
+	}
+	db, dbErr := getStatsDB()
+	if dbErr != 0 {
+		return 0
+	}
+	seq := readCounter(db, chatSeqKey(room)) + 1
+	if err := writeCounter(db, chatSeqKey(room), seq); err != nil {
+		logError("assignChatSeq", room, "failed: %v", err)
+		return 0
+	}
+	return seq
+}
+
+func indexChatSeq(chatDB database.Database, room string, chatMessage ChatMessage) {
+	if chatMessage.Seq == 0 {
+		return
+	}
+	if err := chatDB.Put(chatSeqIndexKey(room, chatMessage.Seq), []byte(chatMessageKey(room, chatMessage))); err != nil {
+		logError("indexChatSeq", room, "failed for message %s: %v", chatMessage.ID, err)
+	}
+}
+
+func clearChatSeqIndex(room string) {
+	db, dbErr := getChatDB()
+	if dbErr != 0 {
+		return
+	}
+	keys, _ := db.List(chatSeqIndexPrefix(room))
+	for _, key := range keys {
+		db.Delete(key)
+	}
+}
+
+//export getMessagesSinceSeq
+func getMessagesSinceSeq(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	anonymous, code := checkAnonymousRead(h, room)
+	if code != 0 {
+		return code
+	}
+	since := int64(getIntParam(h, "seq", 0))
+	if since < 0 {
+		return handleHTTPError(h, fmt.Errorf("seq must not be negative"), 400)
+	}
+	limit := getIntParam(h, "limit", defaultReplayLimit)
+	if limit <= 0 || limit > maxReplayLimit {
+		limit = defaultReplayLimit
+	}
+	db, dbErr := getChatDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	latest := int64(0)
+	if statsDB, dbErr := getStatsDB(); dbErr == 0 {
+		latest = readCounter(statsDB, chatSeqKey(room))
+	}
+
+	prefix := chatSeqIndexPrefix(room)
+	keys, _ := db.List(prefix)
+	sort.Strings(keys)
+	messages := make([]ChatMessage, 0)
+	// Reset tells the client that messages after its sequence are gone
+	// (quota pruning) and it should reload the page instead of replaying
+	reset := false
+	expected := since + 1
+	for _, key := range keys {
+		seq, err := strconv.ParseInt(key[len(prefix):], 10, 64)
+		if err != nil || seq <= since {
+			continue
+		}
+		if len(messages) == limit {
+			break
+		}
+		if seq != expected {
+			reset = true
+		}
+		expected = seq + 1
+		messageKey, err := db.Get(key)
+		if err != nil {
+			reset = true
+			continue
+		}
+		data, err := db.Get(string(messageKey))
+		var message ChatMessage
+		if err != nil || json.Unmarshal(data, &message) != nil {
+			reset = true
+			continue
+		}
+		messages = append(messages, message)
+	}
+	usernameResolver{}.messages(messages)
+	if anonymous {
+		redactMessages(messages)
+	}
+	nextSeq := since
+	if len(messages) > 0 {
+		nextSeq = messages[len(messages)-1].Seq
+	}
+	return sendJSONResponse(h, map[string]interface{}{
+		"room":       room,
+		"messages":   messages,
+		"nextSeq":    nextSeq,
+		"latestSeq":  latest,
+		"hasMore":    nextSeq < latest,
+		"reset":      reset,
+		"serverTime": time.Now().UnixMilli(),
+	})
+}
@@ -0,0 +1,236 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+// Placements between checkpoints for rooms whose tier sets no interval
+const defaultCheckpointEvery = 1000
+
+func checkpointPrefix(room string) string {
+	return fmt.Sprintf("/%s/checkpoints/", room)
+}
+
+func checkpointKey(room string, seq int64) string {
+	return fmt.Sprintf("%s%012d", checkpointPrefix(room), seq)
+}
+
+// Sequences of the room's checkpoints, oldest first
+func checkpointSeqs(room string) []int64 {
+	seqs := make([]int64, 0)
+	db, dbErr := getHistoryDB()
+	if dbErr != 0 {
+		return seqs
+	}
+	prefix := checkpointPrefix(room)
+	keys, _ := db.List(prefix)
+	for _, key := range keys {
+		if seq, err := strconv.ParseInt(key[len(prefix):], 10, 64); err == nil {
+			seqs = append(seqs, seq)
+		}
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	return seqs
+}
+
+func loadCheckpoint(room string, seq int64) (HistoryCheckpoint, bool) {
+	var checkpoint HistoryCheckpoint
+	db, dbErr := getHistoryDB()
+	if dbErr != 0 {
+		return checkpoint, false
+	}
+	data, err := db.Get(checkpointKey(room, seq))
+	if err != nil || len(data) == 0 {
+		return checkpoint, false
+	}
+	if json.Unmarshal(data, &checkpoint) != nil {
+		return checkpoint, false
+	}
+	expandSnapshot(&checkpoint.CanvasSnapshot)
+	return checkpoint, true
+}
+
+// Latest checkpoint at or before the placement sequence
+func latestCheckpoint(room string, target int64) (HistoryCheckpoint, bool) {
+	seqs := checkpointSeqs(room)
+	for i := len(seqs) - 1; i >= 0; i-- {
+		if seqs[i] <= target {
+			return loadCheckpoint(room, seqs[i])
+		}
+	}
+	return HistoryCheckpoint{}, false
+}
+
+// Fold the log into a new checkpoint once enough placements followed the last
+// one, then drop placements older than the tier's recent window that a
+// checkpoint already covers. Replays never start further back than the
+// latest checkpoint before them.
+func checkpointHistory(room string, now time.Time) {
+	db, dbErr := getHistoryDB()
+	if dbErr != 0 {
+		return
+	}
+	retention := roomRetention(room)
+	every := retention.CheckpointEvery
+	if every <= 0 {
+		every = defaultCheckpointEvery
+	}
+	seq := readCounter(db, historySeqKey(room))
+	seqs := checkpointSeqs(room)
+	last := int64(0)
+	if len(seqs) > 0 {
+		last = seqs[len(seqs)-1]
+	}
+	if seq-last >= every {
+		if record, ok := loadPlacementRecord(room, seq); ok {
+			grid, err := canvasAtSeq(room, seq, record.Timestamp)
+			if err != nil {
+				logDebug("checkpointHistory", room, "cannot checkpoint seq %d: %v", seq, err)
+			} else {
+				checkpoint := HistoryCheckpoint{Seq: seq, CanvasSnapshot: CanvasSnapshot{Room: room, Timestamp: record.Timestamp, Grid: grid}}
+				compactSnapshot(&checkpoint.CanvasSnapshot)
+				if err := putJSON(db, checkpointKey(room, seq), checkpoint); err != nil {
+					logError("checkpointHistory", room, "failed to save checkpoint %d: %v", seq, err)
+				} else {
+					seqs = append(seqs, seq)
+				}
+			}
+		}
+	}
+	if retention.RecentHistoryHours <= 0 {
+		return
+	}
+	// The newest checkpoint taken before the window keeps replays into it exact
+	cutoff := now.Add(-time.Duration(retention.RecentHistoryHours) * time.Hour).UnixMilli()
+	fold := int64(0)
+	for _, checkpointSeq := range seqs {
+		if record, ok := loadPlacementRecord(room, checkpointSeq); ok && record.Timestamp >= cutoff {
+			break
+		}
+		fold = checkpointSeq
+	}
+	if fold == 0 {
+		return
+	}
+	first := readCounter(db, historyFirstKey(room))
+	if first == 0 {
+		first = 1
+	}
+	removed := int64(0)
+	if fold >= first {
+		removed = deleteHistoryRange(db, room, first, fold)
+	}
+	for _, checkpointSeq := range seqs {
+		if checkpointSeq < fold {
+			db.Delete(checkpointKey(room, checkpointSeq))
+		}
+	}
+	logDebug("checkpointHistory", room, "folded placements up to %d, pruned %d history keys", fold, removed)
+}
+
+// Placement records after the sequence, oldest first
+func loadPlacementsAfter(room string, since int64, limit int) []PlacementRecord {
+	records := make([]PlacementRecord, 0)
+	db, dbErr := getHistoryDB()
+	if dbErr != 0 {
+		return records
+	}
+	seq := readCounter(db, historySeqKey(room))
+	for current := since + 1; current <= seq && len(records) < limit; current++ {
+		if record, ok := loadPlacementRecord(room, current); ok {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+//export getUpdatesSince
+func getUpdatesSince(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	anonymous, code := checkAnonymousRead(h, room)
+	if code != 0 {
+		return code
+	}
+	setMaintenanceBanner(h, room)
+	since := int64(getIntParam(h, "seq", 0))
+	if since < 0 {
+		return handleHTTPError(h, fmt.Errorf("seq must not be negative"), 400)
+	}
+	limit := getIntParam(h, "limit", defaultReplayLimit)
+	if limit <= 0 || limit > maxReplayLimit {
+		limit = defaultReplayLimit
+	}
+	remap, err := getColorRemapParam(h)
+	if err != nil {
+		return handleHTTPError(h, err, 404)
+	}
+	db, dbErr := getHistoryDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	latest := readCounter(db, historySeqKey(room))
+	first := readCounter(db, historyFirstKey(room))
+	response := map[string]interface{}{
+		"room":       room,
+		"latestSeq":  latest,
+		"reset":      false,
+		"serverTime": time.Now().UnixMilli(),
+	}
+	// Placements after the client's sequence were folded away: it resets to
+	// the checkpoint and replays the tail from there
+	if first > since+1 {
+		checkpoint, ok := latestCheckpoint(room, first-1)
+		if !ok || checkpoint.Seq+1 < first {
+			return handleHTTPError(h, fmt.Errorf("placements after %d are no longer retained; reload the canvas", since), 410)
+		}
+		response["reset"] = true
+		response["checkpoint"] = map[string]interface{}{
+			"seq":       checkpoint.Seq,
+			"timestamp": checkpoint.Timestamp,
+			"canvas":    remapCanvas(checkpoint.Grid, remap),
+		}
+		since = checkpoint.Seq
+	}
+	placements := loadPlacementsAfter(room, since, limit)
+	hide := anonymous || loadRoomSettings(room).AnonymizeContributors
+	names := usernameResolver{}
+	for i := range placements {
+		if hide {
+			placements[i].UserID, placements[i].Username = "", ""
+		} else {
+			placements[i].Username = names.name(placements[i].UserID, placements[i].Username)
+		}
+		if mapped, ok := remap[strings.ToLower(placements[i].Color)]; ok {
+			placements[i].Color = mapped
+		}
+	}
+	nextSeq := since
+	if len(placements) > 0 {
+		nextSeq = placements[len(placements)-1].Seq
+	}
+	response["placements"] = placements
+	response["nextSeq"] = nextSeq
+	response["hasMore"] = nextSeq < latest
+	return sendJSONResponse(h, response)
+}
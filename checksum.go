@@ -0,0 +1,226 @@
+package lib
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+// The canvas checksum is the XOR of FNV-1a 64 hashes of "x,y,#rrggbb" for every
+// cell of the rendered grid (as returned by getCanvas), so it can be updated one
+// cell at a time and reproduced by clients from their local state.
+const checksumAlgorithm = "xor-fnv1a64"
+
+func canvasChecksumKey(room string) string {
+	return fmt.Sprintf("/%s/checksum", room)
+}
+
+func cellHash(x, y int, color string) uint64 {
+	hash := fnv.New64a()
+	fmt.Fprintf(hash, "%d,%d,%s", x, y, strings.ToLower(color))
+	return hash.Sum64()
+}
+
+func gridChecksum(grid [][]string) uint64 {
+	var checksum uint64
+	for y := range grid {
+		for x, color := range grid[y] {
+			checksum ^= cellHash(x, y, color)
+		}
+	}
+	return checksum
+}
+
+func loadCanvasChecksum(room string) (uint64, bool) {
+	db, dbErr := getStatsDB()
+	if dbErr != 0 {
+		return 0, false
+	}
+	data, err := db.Get(canvasChecksumKey(room))
+	if err != nil || len(data) == 0 {
+		return 0, false
+	}
+	checksum, err := strconv.ParseUint(string(data), 16, 64)
+	return checksum, err == nil
+}
+
+func saveCanvasChecksum(room string, checksum uint64) {
+	db, dbErr := getStatsDB()
+	if dbErr != 0 {
+		return
+	}
+	if err := db.Put(canvasChecksumKey(room), []byte(strconv.FormatUint(checksum, 16))); err != nil {
+		logError("saveCanvasChecksum", room, "failed: %v", err)
+	}
+}
+
+// Drop the stored checksum after a change that is not tracked cell by cell;
+// it is recomputed from the canvas on the next request
+func invalidateCanvasChecksum(room string) {
+	if db, dbErr := getStatsDB(); dbErr == 0 {
+		db.Delete(canvasChecksumKey(room))
+	}
+}
+
+// Fold a saved batch into the stored checksum
+func updateCanvasChecksum(room string, changes []PixelChange) {
+	checksum, ok := loadCanvasChecksum(room)
+	if !ok {
+		return
+	}
+	var base [][]string
+	for _, change := range changes {
+		previous := change.Previous.Color
+		if !change.HadPrevious {
+			if base == nil {
+				base = newBaseCanvas(room)
+			}
+			previous = base[change.Pixel.Y][change.Pixel.X]
+		}
+		checksum ^= cellHash(change.Pixel.X, change.Pixel.Y, previous)
+		checksum ^= cellHash(change.Pixel.X, change.Pixel.Y, change.Pixel.Color)
+	}
+	saveCanvasChecksum(room, checksum)
+}
+
+// Stored checksum, computed from the canvas when missing
+func roomCanvasChecksum(room string) (uint64, uint32) {
+	if checksum, ok := loadCanvasChecksum(room); ok {
+		return checksum, 0
+	}
+	grid, dbErr := loadCanvasGrid(room)
+	if dbErr != 0 {
+		return 0, dbErr
+	}
+	checksum := gridChecksum(grid)
+	saveCanvasChecksum(room, checksum)
+	return checksum, 0
+}
+
+//export getCanvasChecksum
+func getCanvasChecksum(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	if _, code := checkAnonymousRead(h, room); code != 0 {
+		return code
+	}
+	setMaintenanceBanner(h, room)
+	if ensureRoomSchema(room) != 0 {
+		return handleHTTPError(h, fmt.Errorf("room migration failed"), 500)
+	}
+	checksum, dbErr := roomCanvasChecksum(room)
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("failed to load canvas"), 500)
+	}
+	return sendJSONResponse(h, map[string]interface{}{
+		"room":       room,
+		"checksum":   fmt.Sprintf("%016x", checksum),
+		"algorithm":  checksumAlgorithm,
+		"serverTime": time.Now().UnixMilli(),
+	})
+}
+
+// Tiles used by the drift resync protocol match the storage chunks
+const resyncTileSize = chunkSize
+
+// ResyncTile is a divergent square of the canvas returned to a drifting client
+type ResyncTile struct {
+	X    int        `json:"x"`
+	Y    int        `json:"y"`
+	Hash string     `json:"hash"`
+	Grid [][]string `json:"grid"`
+}
+
+// Checksum of one tile, computed like the canvas checksum over the tile's cells
+func tileChecksum(grid [][]string, tx, ty int) (uint64, [][]string) {
+	var checksum uint64
+	tile := make([][]string, 0, resyncTileSize)
+	for y := ty * resyncTileSize; y < (ty+1)*resyncTileSize && y < len(grid); y++ {
+		row := make([]string, 0, resyncTileSize)
+		for x := tx * resyncTileSize; x < (tx+1)*resyncTileSize && x < len(grid[y]); x++ {
+			checksum ^= cellHash(x, y, grid[y][x])
+			row = append(row, grid[y][x])
+		}
+		tile = append(tile, row)
+	}
+	return checksum, tile
+}
+
+//export resyncCanvas
+func resyncCanvas(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	if _, code := checkAnonymousRead(h, room); code != 0 {
+		return code
+	}
+	setMaintenanceBanner(h, room)
+	// Tile hashes keyed by "tx:ty"; tiles the client omits are always returned
+	var request struct {
+		Tiles map[string]string `json:"tiles"`
+	}
+	if err := readJSONBody(h, &request); err != nil {
+		return handleHTTPError(h, err, 400)
+	}
+	if isShardedRoom(room) {
+		return handleHTTPError(h, fmt.Errorf("room %s is sharded; load it through getShardManifest and getShard", room), 413)
+	}
+	if ensureRoomSchema(room) != 0 {
+		return handleHTTPError(h, fmt.Errorf("room migration failed"), 500)
+	}
+	grid, dbErr := loadCanvasGrid(room)
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("failed to load canvas"), 500)
+	}
+	tiles := make([]ResyncTile, 0)
+	width, height := roomSize(room)
+	tilesX := (width + resyncTileSize - 1) / resyncTileSize
+	tilesY := (height + resyncTileSize - 1) / resyncTileSize
+	for ty := 0; ty < tilesY; ty++ {
+		for tx := 0; tx < tilesX; tx++ {
+			checksum, tile := tileChecksum(grid, tx, ty)
+			hash := fmt.Sprintf("%016x", checksum)
+			if clientHash, ok := request.Tiles[fmt.Sprintf("%d:%d", tx, ty)]; ok && strings.EqualFold(clientHash, hash) {
+				continue
+			}
+			tiles = append(tiles, ResyncTile{X: tx, Y: ty, Hash: hash, Grid: tile})
+		}
+	}
+	return sendJSONResponse(h, map[string]interface{}{
+		"room":       room,
+		"checksum":   fmt.Sprintf("%016x", gridChecksum(grid)),
+		"algorithm":  checksumAlgorithm,
+		"tileSize":   resyncTileSize,
+		"tiles":      tiles,
+		"serverTime": time.Now().UnixMilli(),
+	})
+}
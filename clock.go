@@ -0,0 +1,47 @@
+package lib
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+//export ping
+func ping(e event.Event) uint32 {
+	received := time.Now().UnixMilli()
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	h.Headers().Set("Cache-Control", "no-store")
+	var clientTime int64
+	if value, err := h.Query().Get("t"); err == nil {
+		clientTime, _ = strconv.ParseInt(value, 10, 64)
+	}
+	return sendJSONResponse(h, map[string]int64{
+		"clientTime":  clientTime,
+		"serverTime":  received,
+		"serverReply": time.Now().UnixMilli(),
+	})
+}
+
+//export getServerTime
+func getServerTime(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	h.Headers().Set("Cache-Control", "no-store")
+	return sendJSONResponse(h, map[string]int64{
+		"serverTime": time.Now().UnixMilli(),
+	})
+}
@@ -0,0 +1,370 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Largest number of pixels accepted in one batch
+const maxPixelBatchSize = 4096
+
+// PixelBatch is a decoded pixel update payload
+type PixelBatch struct {
+	BatchID string
+	Room    string
+	UserID  string
+	Pixels  []Pixel
+	APIKey  string
+	// Session token issued by issueSessionToken, checked for revocation
+	SessionToken string
+	// Client-chosen sender identifier echoed in the authoritative rebroadcast
+	SourceID string
+}
+
+// Enveloped payloads start with envelopeMagic, the protocol version and the
+// message type, followed by a body in the JSON or binary layout of that type
+const (
+	envelopeMagic      = 0xb7
+	envelopeHeaderSize = 3
+)
+
+// Message types carried in the envelope header
+const (
+	MessageTypePixels byte = 1
+	MessageTypeChat   byte = 2
+)
+
+// Split an enveloped payload into its type and body. Payloads without the
+// envelope are returned unchanged so older clients keep working.
+func openEnvelope(data []byte) (byte, []byte, bool, error) {
+	if len(data) < envelopeHeaderSize || data[0] != envelopeMagic {
+		return 0, data, false, nil
+	}
+	if version := int(data[1]); version != protocolVersion {
+		return 0, nil, true, fmt.Errorf("unsupported protocol version %d", version)
+	}
+	return data[2], data[envelopeHeaderSize:], true, nil
+}
+
+// Body of a payload that must be of the given type when enveloped
+func envelopeBody(data []byte, messageType byte) ([]byte, error) {
+	kind, body, enveloped, err := openEnvelope(data)
+	if err != nil {
+		return nil, err
+	}
+	if enveloped && kind != messageType {
+		return nil, fmt.Errorf("unexpected message type %d", kind)
+	}
+	return body, nil
+}
+
+func sealEnvelope(messageType byte, body []byte) []byte {
+	return append([]byte{envelopeMagic, protocolVersion, messageType}, body...)
+}
+
+// Payloads starting with a JSON object are decoded by the JSON codecs,
+// everything else by the binary layouts
+func isJSONPayload(data []byte) bool {
+	trimmed := bytes.TrimLeft(data, " \t\r\n")
+	return len(trimmed) > 0 && trimmed[0] == '{' && json.Valid(trimmed)
+}
+
+// Decode a pixel batch in whichever format the client sent
+func decodePixelBatch(data []byte) (PixelBatch, error) {
+	data, err := envelopeBody(data, MessageTypePixels)
+	if err != nil {
+		return PixelBatch{}, err
+	}
+	var batch PixelBatch
+	if isJSONPayload(data) {
+		batch, err = decodeJSONPixelBatch(data)
+	} else {
+		batch, err = decodeBinaryPixelBatch(data)
+	}
+	if err == nil && batch.Room == "" {
+		batch.Room, err = fallbackRoom()
+	}
+	return batch, err
+}
+
+// Decode a chat message in whichever format the client sent, with its room and
+// the session token it carries
+func decodeChatMessage(data []byte) (ChatMessage, string, string, error) {
+	data, err := envelopeBody(data, MessageTypeChat)
+	if err != nil {
+		return ChatMessage{}, "", "", err
+	}
+	var chatMessage ChatMessage
+	var room, sessionToken string
+	if isJSONPayload(data) {
+		chatMessage, room, sessionToken, err = decodeJSONChatMessage(data)
+	} else {
+		chatMessage, room, sessionToken, err = decodeBinaryChatMessage(data)
+	}
+	if err == nil && room == "" {
+		room, err = fallbackRoom()
+	}
+	return chatMessage, room, sessionToken, err
+}
+
+// Decode the binary pixel batch layout
+func decodeBinaryPixelBatch(data []byte) (PixelBatch, error) {
+	batch := PixelBatch{UserID: "unknown"}
+	if len(data) < 4 {
+		return batch, fmt.Errorf("insufficient binary data: %d bytes", len(data))
+	}
+
+	// Read batch ID length and content (first 4 bytes, little-endian)
+	batchIdLength := int(uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16 | uint32(data[3])<<24)
+	offset := 4
+	if offset+batchIdLength > len(data) {
+		return batch, fmt.Errorf("invalid batch ID length: %d", batchIdLength)
+	}
+	batch.BatchID = string(data[offset : offset+batchIdLength])
+	offset += batchIdLength
+
+	// Read pixel count (next 4 bytes, little-endian)
+	if offset+4 > len(data) {
+		return batch, fmt.Errorf("insufficient data for pixel count")
+	}
+	pixelCount := int(uint32(data[offset]) | uint32(data[offset+1])<<8 | uint32(data[offset+2])<<16 | uint32(data[offset+3])<<24)
+	offset += 4
+	logDebug("decodeBinaryPixelBatch", "", "received binary data with %d pixels", pixelCount)
+	if pixelCount > maxPixelBatchSize {
+		return batch, fmt.Errorf("batch of %d pixels exceeds the maximum of %d", pixelCount, maxPixelBatchSize)
+	}
+
+	if pixelCount > 0 && pixelCount <= (len(data)-offset)/8 {
+		batch.Pixels = make([]Pixel, 0, pixelCount)
+	}
+	for i := 0; i < pixelCount && offset+8 <= len(data); i++ {
+		// Read x (2 bytes, little-endian)
+		x := int(uint16(data[offset]) | uint16(data[offset+1])<<8)
+		offset += 2
+
+		// Read y (2 bytes, little-endian)
+		y := int(uint16(data[offset]) | uint16(data[offset+1])<<8)
+		offset += 2
+
+		// Read color (4 bytes, little-endian)
+		colorValue := uint32(data[offset]) | uint32(data[offset+1])<<8 | uint32(data[offset+2])<<16 | uint32(data[offset+3])<<24
+		offset += 4
+
+		// Convert to hex color string (ensure 6 digits)
+		color := fmt.Sprintf("#%06x", colorValue&0xFFFFFF)
+
+		batch.Pixels = append(batch.Pixels, Pixel{
+			X:        x,
+			Y:        y,
+			Color:    color,
+			UserID:   "unknown",
+			Username: "unknown",
+		})
+	}
+
+	// Optional trailer: room, userId, username, API key, session token and source ID
+	// as length-prefixed strings. Older clients end the payload early and keep the defaults.
+	if value, next, ok := readBinaryString(data, offset); ok {
+		offset = next
+		if value != "" {
+			batch.Room = value
+		}
+		userID, next, okUser := readBinaryString(data, offset)
+		username, next, okName := readBinaryString(data, next)
+		if okUser && okName && userID != "" {
+			batch.UserID = userID
+			for i := range batch.Pixels {
+				batch.Pixels[i].UserID = userID
+				batch.Pixels[i].Username = username
+			}
+		}
+		if apiKey, next, ok := readBinaryString(data, next); ok && okName {
+			batch.APIKey = apiKey
+			if token, next, ok := readBinaryString(data, next); ok {
+				batch.SessionToken = token
+				batch.SourceID, _, _ = readBinaryString(data, next)
+			}
+		}
+	}
+	return batch, nil
+}
+
+// jsonPixelBatch is the JSON form of a pixel batch
+type jsonPixelBatch struct {
+	BatchID      string      `json:"batchId"`
+	Room         string      `json:"room"`
+	UserID       string      `json:"userId"`
+	Username     string      `json:"username"`
+	APIKey       string      `json:"apiKey"`
+	SessionToken string      `json:"sessionToken"`
+	SourceID     string      `json:"sourceId"`
+	Pixels       []jsonPixel `json:"pixels"`
+}
+
+type jsonPixel struct {
+	X     int    `json:"x"`
+	Y     int    `json:"y"`
+	Color string `json:"color"`
+}
+
+func decodeJSONPixelBatch(data []byte) (PixelBatch, error) {
+	var batch PixelBatch
+	var payload jsonPixelBatch
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return batch, fmt.Errorf("invalid JSON pixel batch: %v", err)
+	}
+	if len(payload.Pixels) > maxPixelBatchSize {
+		return batch, fmt.Errorf("batch of %d pixels exceeds the maximum of %d", len(payload.Pixels), maxPixelBatchSize)
+	}
+	batch.BatchID = payload.BatchID
+	batch.APIKey = payload.APIKey
+	batch.SessionToken = payload.SessionToken
+	batch.SourceID = payload.SourceID
+	if payload.Room != "" {
+		batch.Room = payload.Room
+	}
+	userID, username := payload.UserID, payload.Username
+	if userID == "" {
+		userID, username = "unknown", "unknown"
+	}
+	batch.UserID = userID
+	batch.Pixels = make([]Pixel, 0, len(payload.Pixels))
+	for _, pixel := range payload.Pixels {
+		batch.Pixels = append(batch.Pixels, Pixel{
+			X:        pixel.X,
+			Y:        pixel.Y,
+			Color:    strings.ToLower(pixel.Color),
+			UserID:   userID,
+			Username: username,
+		})
+	}
+	return batch, nil
+}
+
+// Decode the binary chat message layout
+func decodeBinaryChatMessage(data []byte) (ChatMessage, string, string, error) {
+	var chatMessage ChatMessage
+	var room, sessionToken string
+
+	// Parse binary data
+	offset := 0
+	if len(data) < 4 {
+		return chatMessage, room, "", fmt.Errorf("insufficient binary data: %d bytes", len(data))
+	}
+
+	// Read messageId length and content
+	messageIdLength := int(uint32(data[offset]) | uint32(data[offset+1])<<8 | uint32(data[offset+2])<<16 | uint32(data[offset+3])<<24)
+	offset += 4
+	if offset+messageIdLength > len(data) {
+		return chatMessage, room, "", fmt.Errorf("invalid messageId length: %d", messageIdLength)
+	}
+	chatMessage.ID = string(data[offset : offset+messageIdLength])
+	offset += messageIdLength
+
+	// Read userId length and content
+	if offset+4 > len(data) {
+		return chatMessage, room, "", fmt.Errorf("insufficient data for userId length")
+	}
+	userIdLength := int(uint32(data[offset]) | uint32(data[offset+1])<<8 | uint32(data[offset+2])<<16 | uint32(data[offset+3])<<24)
+	offset += 4
+	if offset+userIdLength > len(data) {
+		return chatMessage, room, "", fmt.Errorf("invalid userId length: %d", userIdLength)
+	}
+	chatMessage.UserID = string(data[offset : offset+userIdLength])
+	offset += userIdLength
+
+	// Read username length and content
+	if offset+4 > len(data) {
+		return chatMessage, room, "", fmt.Errorf("insufficient data for username length")
+	}
+	usernameLength := int(uint32(data[offset]) | uint32(data[offset+1])<<8 | uint32(data[offset+2])<<16 | uint32(data[offset+3])<<24)
+	offset += 4
+	if offset+usernameLength > len(data) {
+		return chatMessage, room, "", fmt.Errorf("invalid username length: %d", usernameLength)
+	}
+	chatMessage.Username = string(data[offset : offset+usernameLength])
+	offset += usernameLength
+
+	// Read message length and content
+	if offset+4 > len(data) {
+		return chatMessage, room, "", fmt.Errorf("insufficient data for message length")
+	}
+	messageLength := int(uint32(data[offset]) | uint32(data[offset+1])<<8 | uint32(data[offset+2])<<16 | uint32(data[offset+3])<<24)
+	offset += 4
+	if offset+messageLength > len(data) {
+		return chatMessage, room, "", fmt.Errorf("invalid message length: %d", messageLength)
+	}
+	chatMessage.Message = string(data[offset : offset+messageLength])
+	offset += messageLength
+
+	// Read timestamp
+	if offset+4 > len(data) {
+		return chatMessage, room, "", fmt.Errorf("insufficient data for timestamp")
+	}
+	chatMessage.Timestamp = int64(uint32(data[offset]) | uint32(data[offset+1])<<8 | uint32(data[offset+2])<<16 | uint32(data[offset+3])<<24)
+	offset += 4
+
+	// Optional trailer: session token, room and replyTo, as length-prefixed strings
+	if token, next, ok := readBinaryString(data, offset); ok {
+		sessionToken = token
+		if value, next, ok := readBinaryString(data, next); ok {
+			room = value
+			if replyTo, _, ok := readBinaryString(data, next); ok {
+				chatMessage.ReplyTo = replyTo
+			}
+		}
+	}
+	return chatMessage, room, sessionToken, nil
+}
+
+func decodeJSONChatMessage(data []byte) (ChatMessage, string, string, error) {
+	var payload struct {
+		ChatMessage
+		Room         string `json:"room"`
+		SessionToken string `json:"sessionToken"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return payload.ChatMessage, "", "", fmt.Errorf("invalid JSON chat message: %v", err)
+	}
+	if payload.ID == "" {
+		return payload.ChatMessage, "", "", fmt.Errorf("messageId is required")
+	}
+	return payload.ChatMessage, payload.Room, payload.SessionToken, nil
+}
+
+func appendBinaryString(data []byte, value string) []byte {
+	return append(appendBinaryUint32(data, uint32(len(value))), value...)
+}
+
+// Encode a pixel batch as an enveloped binary payload, including the full trailer
+func encodePixelBatch(batch PixelBatch) []byte {
+	body := appendBinaryString(nil, batch.BatchID)
+	body = appendBinaryUint32(body, uint32(len(batch.Pixels)))
+	username := ""
+	for _, pixel := range batch.Pixels {
+		body = appendBinaryUint16(body, uint16(pixel.X))
+		body = appendBinaryUint16(body, uint16(pixel.Y))
+		c := parseHexColor(pixel.Color)
+		body = appendBinaryUint32(body, uint32(c.R)<<16|uint32(c.G)<<8|uint32(c.B))
+		username = pixel.Username
+	}
+	for _, value := range []string{batch.Room, batch.UserID, username, batch.APIKey, batch.SessionToken, batch.SourceID} {
+		body = appendBinaryString(body, value)
+	}
+	return sealEnvelope(MessageTypePixels, body)
+}
+
+// Encode a chat message as an enveloped binary payload
+func encodeChatMessage(room string, chatMessage ChatMessage, sessionToken string) []byte {
+	var body []byte
+	for _, value := range []string{chatMessage.ID, chatMessage.UserID, chatMessage.Username, chatMessage.Message} {
+		body = appendBinaryString(body, value)
+	}
+	body = appendBinaryUint32(body, uint32(chatMessage.Timestamp))
+	body = appendBinaryString(body, sessionToken)
+	body = appendBinaryString(body, room)
+	body = appendBinaryString(body, chatMessage.ReplyTo)
+	return sealEnvelope(MessageTypeChat, body)
+}
@@ -0,0 +1,140 @@
+package lib
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testPixelBatch() PixelBatch {
+	return PixelBatch{
+		BatchID: "batch-1",
+		Room:    "lobby",
+		UserID:  "user-1",
+		Pixels: []Pixel{
+			{X: 0, Y: 0, Color: "#ff0000", UserID: "user-1", Username: "alice"},
+			{X: 12, Y: 345, Color: "#00ff7f", UserID: "user-1", Username: "alice"},
+			{X: 65535, Y: 1, Color: "#0000ff", UserID: "user-1", Username: "alice"},
+		},
+		APIKey:       "key-1",
+		SessionToken: "token-1",
+		SourceID:     "tab-1",
+	}
+}
+
+func TestPixelBatchRoundTrip(t *testing.T) {
+	batch := testPixelBatch()
+	decoded, err := decodePixelBatch(encodePixelBatch(batch))
+	if err != nil {
+		t.Fatalf("decodePixelBatch: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, batch) {
+		t.Errorf("round trip mismatch:\n got %+v\nwant %+v", decoded, batch)
+	}
+}
+
+func TestPixelBatchTruncatedTrailer(t *testing.T) {
+	batch := testPixelBatch()
+	encoded := encodePixelBatch(batch)
+	// Bytes taken by a length-prefixed trailer string
+	field := func(value string) int { return 4 + len(value) }
+
+	tests := []struct {
+		name string
+		// Bytes cut from the end of the encoded payload
+		cut  int
+		want func(*PixelBatch)
+	}{
+		{
+			name: "source ID cut",
+			cut:  1,
+			want: func(b *PixelBatch) { b.SourceID = "" },
+		},
+		{
+			name: "session token cut",
+			cut:  field(batch.SourceID) + 1,
+			want: func(b *PixelBatch) { b.SessionToken, b.SourceID = "", "" },
+		},
+		{
+			name: "API key cut",
+			cut:  field(batch.SourceID) + field(batch.SessionToken) + 1,
+			want: func(b *PixelBatch) { b.APIKey, b.SessionToken, b.SourceID = "", "", "" },
+		},
+		{
+			// Without a username the userId is ignored and the pixels keep the defaults
+			name: "username cut",
+			cut:  field(batch.SourceID) + field(batch.SessionToken) + field(batch.APIKey) + 1,
+			want: func(b *PixelBatch) {
+				b.UserID, b.APIKey, b.SessionToken, b.SourceID = "unknown", "", "", ""
+				for i := range b.Pixels {
+					b.Pixels[i].UserID, b.Pixels[i].Username = "unknown", "unknown"
+				}
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			want := testPixelBatch()
+			test.want(&want)
+			decoded, err := decodePixelBatch(encoded[:len(encoded)-test.cut])
+			if err != nil {
+				t.Fatalf("decodePixelBatch: %v", err)
+			}
+			if !reflect.DeepEqual(decoded, want) {
+				t.Errorf("got %+v\nwant %+v", decoded, want)
+			}
+		})
+	}
+}
+
+func TestPixelBatchWithoutTrailerUsesFallbackRoom(t *testing.T) {
+	mockDatabases(t)
+	batch := testPixelBatch()
+	encoded := encodePixelBatch(batch)
+	// Header, batch ID, pixel count and the pixels; everything after is trailer
+	body := envelopeHeaderSize + 4 + len(batch.BatchID) + 4 + 8*len(batch.Pixels)
+	decoded, err := decodePixelBatch(encoded[:body])
+	if err != nil {
+		t.Fatalf("decodePixelBatch: %v", err)
+	}
+	room, err := fallbackRoom()
+	if err != nil {
+		t.Fatalf("fallbackRoom: %v", err)
+	}
+	if decoded.Room != room || decoded.UserID != "unknown" || len(decoded.Pixels) != len(batch.Pixels) {
+		t.Errorf("got room %q user %q with %d pixels", decoded.Room, decoded.UserID, len(decoded.Pixels))
+	}
+}
+
+// A payload cut inside the pixels keeps the complete ones and the trailer defaults
+func TestPixelBatchTruncatedPixels(t *testing.T) {
+	mockDatabases(t)
+	batch := testPixelBatch()
+	encoded := encodePixelBatch(batch)
+	body := envelopeHeaderSize + 4 + len(batch.BatchID) + 4
+	decoded, err := decodePixelBatch(encoded[:body+8+3])
+	if err != nil {
+		t.Fatalf("decodePixelBatch: %v", err)
+	}
+	if len(decoded.Pixels) != 1 || decoded.Pixels[0].Color != batch.Pixels[0].Color || decoded.UserID != "unknown" {
+		t.Errorf("got %+v", decoded)
+	}
+}
+
+func TestChatMessageRoundTripCarriesSessionToken(t *testing.T) {
+	message := ChatMessage{ID: "msg-1", UserID: "user-1", Username: "alice", Message: "hello", Timestamp: 1234, ReplyTo: "msg-0"}
+	decoded, room, token, err := decodeChatMessage(encodeChatMessage("lobby", message, "token-1"))
+	if err != nil {
+		t.Fatalf("decodeChatMessage: %v", err)
+	}
+	if room != "lobby" || token != "token-1" {
+		t.Errorf("got room %q token %q", room, token)
+	}
+	if !reflect.DeepEqual(decoded, message) {
+		t.Errorf("got %+v\nwant %+v", decoded, message)
+	}
+
+	json := []byte(`{"messageId":"msg-2","userId":"user-1","message":"hi","room":"lobby","sessionToken":"token-2"}`)
+	if _, _, token, err := decodeChatMessage(json); err != nil || token != "token-2" {
+		t.Errorf("JSON message: token %q, err %v", token, err)
+	}
+}
@@ -0,0 +1,122 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/taubyte/go-sdk/event"
+	http "github.com/taubyte/go-sdk/http/event"
+)
+
+const colorRemapPrefix = globalKeyPrefix + "palettes/"
+
+func loadColorRemap(name string) (ColorRemap, bool) {
+	var remap ColorRemap
+	db, dbErr := getConfigDB()
+	if dbErr != 0 {
+		return remap, false
+	}
+	data, err := db.Get(colorRemapPrefix + name)
+	if err != nil || len(data) == 0 {
+		return remap, false
+	}
+	if err := json.Unmarshal(data, &remap); err != nil {
+		logError("loadColorRemap", "", "failed to unmarshal palette %s: %v", name, err)
+		return remap, false
+	}
+	return remap, true
+}
+
+// Read the optional colorblind parameter; returns nil when no remap was requested
+func getColorRemapParam(h http.Event) (map[string]string, error) {
+	name, err := h.Query().Get("colorblind")
+	if err != nil || name == "" {
+		return nil, nil
+	}
+	remap, ok := loadColorRemap(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown color-blind palette: %s", name)
+	}
+	return remap.Mapping, nil
+}
+
+// Replace mapped colors in place; colors without a mapping are kept
+func remapCanvas(canvas [][]string, mapping map[string]string) [][]string {
+	if len(mapping) == 0 {
+		return canvas
+	}
+	for y := range canvas {
+		for x, color := range canvas[y] {
+			if mapped, ok := mapping[strings.ToLower(color)]; ok {
+				canvas[y][x] = mapped
+			}
+		}
+	}
+	return canvas
+}
+
+//export setColorRemap
+func setColorRemap(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	var remap ColorRemap
+	if err := readJSONBody(h, &remap); err != nil {
+		return handleHTTPError(h, err, 400)
+	}
+	if remap.Name == "" || strings.Contains(remap.Name, "/") {
+		return handleHTTPError(h, fmt.Errorf("palette name required"), 400)
+	}
+	mapping := make(map[string]string, len(remap.Mapping))
+	for from, to := range remap.Mapping {
+		if !isValidHexColor(from) || !isValidHexColor(to) {
+			return handleHTTPError(h, fmt.Errorf("invalid mapping %s -> %s", from, to), 400)
+		}
+		mapping[strings.ToLower(from)] = strings.ToLower(to)
+	}
+	remap.Mapping = mapping
+	db, dbErr := getConfigDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	// An empty mapping deletes the palette
+	if len(mapping) == 0 {
+		db.Delete(colorRemapPrefix + remap.Name)
+	} else if err := putJSON(db, colorRemapPrefix+remap.Name, remap); err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	return sendJSONResponse(h, remap)
+}
+
+//export getColorRemaps
+func getColorRemaps(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	db, dbErr := getConfigDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	keys, _ := db.List(colorRemapPrefix)
+	remaps := make([]ColorRemap, 0, len(keys))
+	for _, key := range keys {
+		if remap, ok := loadColorRemap(strings.TrimPrefix(key, colorRemapPrefix)); ok {
+			remaps = append(remaps, remap)
+		}
+	}
+	return sendJSONResponse(h, remaps)
+}
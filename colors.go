@@ -0,0 +1,122 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+const (
+	defaultTopColorsLimit = 10
+	maxTopColorsLimit     = 100
+)
+
+type ColorCount struct {
+	Color string `json:"color"`
+	Count int64  `json:"count"`
+}
+
+func colorCountsKey(room string) string {
+	return fmt.Sprintf("/%s/colors", room)
+}
+
+func loadColorCounts(room string) (map[string]int64, uint32) {
+	counts := make(map[string]int64)
+	db, dbErr := getStatsDB()
+	if dbErr != 0 {
+		return counts, dbErr
+	}
+	data, err := db.Get(colorCountsKey(room))
+	if err != nil || len(data) == 0 {
+		return counts, 0
+	}
+	if err := json.Unmarshal(data, &counts); err != nil {
+		logError("loadColorCounts", room, "failed to unmarshal counters: %v", err)
+	}
+	return counts, 0
+}
+
+// Apply per-color deltas from a pixel batch to the room's color counters
+func updateColorCounts(room string, deltas map[string]int64) uint32 {
+	if len(deltas) == 0 {
+		return 0
+	}
+	counts, dbErr := loadColorCounts(room)
+	if dbErr != 0 {
+		return dbErr
+	}
+	for color, delta := range deltas {
+		counts[color] += delta
+		if counts[color] <= 0 {
+			delete(counts, color)
+		}
+	}
+	data, err := json.Marshal(counts)
+	if err != nil {
+		logError("updateColorCounts", room, "failed to marshal counters: %v", err)
+		return 1
+	}
+	db, dbErr := getStatsDB()
+	if dbErr != 0 {
+		return dbErr
+	}
+	if err := db.Put(colorCountsKey(room), data); err != nil {
+		logError("updateColorCounts", room, "failed to save counters: %v", err)
+		return 1
+	}
+	return 0
+}
+
+// Drop the room's color counters once its canvas is cleared
+func resetColorCounts(room string) {
+	if db, dbErr := getStatsDB(); dbErr == 0 {
+		db.Delete(colorCountsKey(room))
+	}
+}
+
+//export getTopColors
+func getTopColors(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	if _, code := checkAnonymousRead(h, room); code != 0 {
+		return code
+	}
+	setMaintenanceBanner(h, room)
+	limit := getIntParam(h, "limit", defaultTopColorsLimit)
+	if limit <= 0 || limit > maxTopColorsLimit {
+		limit = defaultTopColorsLimit
+	}
+	counts, dbErr := loadColorCounts(room)
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	colors := make([]ColorCount, 0, len(counts))
+	for color, count := range counts {
+		colors = append(colors, ColorCount{Color: color, Count: count})
+	}
+	sort.Slice(colors, func(i, j int) bool {
+		if colors[i].Count == colors[j].Count {
+			return colors[i].Color < colors[j].Color
+		}
+		return colors[i].Count > colors[j].Count
+	})
+	if len(colors) > limit {
+		colors = colors[:limit]
+	}
+	return sendJSONResponse(h, colors)
+}
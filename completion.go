@@ -0,0 +1,168 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+func artworkPrefix(room string) string {
+	return fmt.Sprintf("/%s/artworks/", room)
+}
+
+func artworkSeqKey(room string) string {
+	return fmt.Sprintf("/%s/artworks-seq", room)
+}
+
+// Finished artworks of the room, oldest first
+func loadArtworks(room string) []Artwork {
+	artworks := make([]Artwork, 0)
+	db, dbErr := getSettingsDB()
+	if dbErr != 0 {
+		return artworks
+	}
+	keys, _ := db.List(artworkPrefix(room))
+	sort.Strings(keys)
+	for _, key := range keys {
+		data, err := db.Get(key)
+		if err != nil {
+			continue
+		}
+		var artwork Artwork
+		if json.Unmarshal(data, &artwork) == nil {
+			artworks = append(artworks, artwork)
+		}
+	}
+	return artworks
+}
+
+func validateFinishedRegions(ctx *PlacementContext) error {
+	artworks := loadArtworks(ctx.Room)
+	for i, pixel := range ctx.Pixels {
+		for _, artwork := range artworks {
+			if artwork.Region.Contains(pixel.X, pixel.Y) {
+				ctx.reject(i, "region finished")
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func overlapsArtwork(artworks []Artwork, region Region) bool {
+	for _, artwork := range artworks {
+		if artwork.Region.Overlaps(region) {
+			return true
+		}
+	}
+	return false
+}
+
+// Credit everyone who placed inside the region, ranked by placements
+func artworkCredits(room string, region Region) ([]Contributor, int64) {
+	history := loadRoomHistory(room)
+	placements := make([]Pixel, len(history))
+	for i, record := range history {
+		placements[i] = Pixel{X: record.X, Y: record.Y, UserID: record.UserID, Username: record.Username}
+	}
+	credits := regionContributors(placements, region)
+	var total int64
+	for _, credit := range credits {
+		total += credit.Pixels
+	}
+	return credits, total
+}
+
+//export finishArtwork
+func finishArtwork(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	// Without region parameters the whole canvas is finished
+	width, height := roomSize(room)
+	region := Region{Width: width, Height: height}
+	if x, _ := h.Query().Get("x"); x != "" {
+		if region, err = getRegionParams(h, room); err != nil {
+			return handleHTTPError(h, err, 400)
+		}
+	}
+	for _, artwork := range loadArtworks(room) {
+		if overlapsArtwork([]Artwork{artwork}, region) {
+			return handleHTTPError(h, fmt.Errorf("region overlaps finished artwork %d", artwork.ID), 409)
+		}
+	}
+	db, dbErr := getSettingsDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+
+	now := time.Now()
+	artwork := Artwork{
+		ID:         readCounter(db, artworkSeqKey(room)) + 1,
+		Room:       room,
+		Region:     region,
+		FinishedAt: now.UnixMilli(),
+	}
+	artwork.Title, _ = h.Query().Get("title")
+	artwork.FinishedBy, _ = h.Query().Get("userId")
+	artwork.Credits, artwork.Placements = artworkCredits(room, region)
+	if loadRoomSettings(room).AnonymizeContributors {
+		artwork.Credits = make([]Contributor, 0)
+	}
+	snapshot, dbErr := captureSnapshot(room, now)
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("failed to capture final snapshot"), 500)
+	}
+	artwork.SnapshotAt = snapshot.Timestamp
+
+	if err := writeCounter(db, artworkSeqKey(room), artwork.ID); err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	if err := putJSON(db, fmt.Sprintf("%s%012d", artworkPrefix(room), artwork.ID), artwork); err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	publishLifecycleEvent(room, LifecycleArtworkFinished, artwork)
+	logInfo("finishArtwork", room, "finished artwork %d with %d contributors", artwork.ID, len(artwork.Credits))
+	return sendJSONResponse(h, artwork)
+}
+
+//export getArtworks
+func getArtworks(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	if _, code := checkAnonymousRead(h, room); code != 0 {
+		return code
+	}
+	return sendJSONResponse(h, loadArtworks(room))
+}
@@ -0,0 +1,110 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+const globalConfigKey = globalKeyPrefix + "global"
+
+func loadGlobalConfig() GlobalConfig {
+	var config GlobalConfig
+	db, dbErr := getConfigDB()
+	if dbErr != 0 {
+		return config
+	}
+	data, err := db.Get(globalConfigKey)
+	if err != nil || len(data) == 0 {
+		return config
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		logError("loadGlobalConfig", "", "failed to unmarshal config: %v", err)
+	}
+	return config
+}
+
+func saveGlobalConfig(config GlobalConfig) uint32 {
+	db, dbErr := getConfigDB()
+	if dbErr != 0 {
+		return dbErr
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return 1
+	}
+	if err := db.Put(globalConfigKey, data); err != nil {
+		logError("saveGlobalConfig", "", "failed to save config: %v", err)
+		return 1
+	}
+	return 0
+}
+
+//export getConfig
+func getConfig(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	return sendJSONResponse(h, loadGlobalConfig())
+}
+
+//export setConfig
+func setConfig(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	// Fields missing from the body keep their stored values
+	config := loadGlobalConfig()
+	if err := readJSONBody(h, &config); err != nil {
+		return handleHTTPError(h, err, 400)
+	}
+	switch config.LinkAction {
+	case "", LinkActionReject, LinkActionFlag:
+	default:
+		return handleHTTPError(h, fmt.Errorf("linkAction must be '%s' or '%s'", LinkActionReject, LinkActionFlag), 400)
+	}
+	switch config.DefaultRoomMode {
+	case "", DefaultRoomAllow, DefaultRoomDeny:
+	case DefaultRoomMap:
+		if !validRoomID(config.DefaultRoomTarget) {
+			return handleHTTPError(h, fmt.Errorf("defaultRoomTarget must be a valid room name when defaultRoomMode is '%s'", DefaultRoomMap), 400)
+		}
+	default:
+		return handleHTTPError(h, fmt.Errorf("defaultRoomMode must be '%s', '%s' or '%s'", DefaultRoomAllow, DefaultRoomDeny, DefaultRoomMap), 400)
+	}
+	if config.PixelAggregationWindowMs > maxAggregationWindow.Milliseconds() {
+		return handleHTTPError(h, fmt.Errorf("pixelAggregationWindowMs must be at most %d", maxAggregationWindow.Milliseconds()), 400)
+	}
+	if err := validateRetentionTiers(config); err != nil {
+		return handleHTTPError(h, err, 400)
+	}
+	if _, ok := parseLogLevel(config.LogLevel); config.LogLevel != "" && !ok {
+		return handleHTTPError(h, fmt.Errorf("logLevel must be 'debug', 'info' or 'error'"), 400)
+	}
+	for handler, ms := range config.HandlerBudgetsMs {
+		if ms < 0 {
+			return handleHTTPError(h, fmt.Errorf("handlerBudgetsMs for %s must not be negative", handler), 400)
+		}
+	}
+	if saveGlobalConfig(config) != 0 {
+		return handleHTTPError(h, fmt.Errorf("failed to save config"), 500)
+	}
+	return sendJSONResponse(h, config)
+}
@@ -0,0 +1,90 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+// Minimum time between two rebroadcast cursor updates from the same user
+const cursorThrottleInterval = 50 * time.Millisecond
+
+// Throttling state is only kept in memory
+var (
+	lastCursorBroadcast = make(map[string]int64)
+	cursorMutex         sync.Mutex
+)
+
+// Decode a cursor update: x and y as little-endian uint16, then room, userId
+// and username as length-prefixed strings
+func decodeCursorMove(data []byte) (string, CursorPosition, error) {
+	var cursor CursorPosition
+	if len(data) < 4 {
+		return "", cursor, fmt.Errorf("insufficient binary data: %d bytes", len(data))
+	}
+	cursor.X = int(uint16(data[0]) | uint16(data[1])<<8)
+	cursor.Y = int(uint16(data[2]) | uint16(data[3])<<8)
+	room, offset, ok := readBinaryString(data, 4)
+	if !ok || room == "" {
+		return "", cursor, fmt.Errorf("invalid room")
+	}
+	userID, offset, ok := readBinaryString(data, offset)
+	if !ok || userID == "" || strings.Contains(userID, "/") {
+		return "", cursor, fmt.Errorf("invalid userId")
+	}
+	username, _, ok := readBinaryString(data, offset)
+	if !ok {
+		return "", cursor, fmt.Errorf("invalid username")
+	}
+	cursor.UserID = userID
+	cursor.Username = username
+	return room, cursor, nil
+}
+
+// Whether enough time passed since the user's last rebroadcast cursor
+func allowCursorBroadcast(room, userID string, now int64) bool {
+	cursorMutex.Lock()
+	defer cursorMutex.Unlock()
+	key := room + "/" + userID
+	if now-lastCursorBroadcast[key] < cursorThrottleInterval.Milliseconds() {
+		return false
+	}
+	lastCursorBroadcast[key] = now
+	return true
+}
+
+//export onCursorMove
+func onCursorMove(e event.Event) uint32 {
+	channel, err := e.PubSub()
+	if err != nil {
+		return 1
+	}
+	data, err := channel.Data()
+	if err != nil {
+		return 1
+	}
+	room, cursor, err := decodeCursorMove(data)
+	if err != nil {
+		logError("onCursorMove", "", "%v", err)
+		return 1
+	}
+	if !inRoomBounds(room, cursor.X, cursor.Y) {
+		return 0
+	}
+	if !allowCursorBroadcast(room, cursor.UserID, time.Now().UnixMilli()) {
+		return 0
+	}
+	if value, err := json.Marshal(map[string]int{"x": cursor.X, "y": cursor.Y}); err == nil {
+		storeEphemeralState(room, EphemeralState{
+			UserID:   cursor.UserID,
+			Username: cursor.Username,
+			Kind:     "cursor",
+			Value:    value,
+		})
+	}
+	return publishRoomEvent(room, "cursors", "cursor", cursor)
+}
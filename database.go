@@ -1,7 +1,8 @@
 package lib
 
 import (
-	"fmt"
+	"encoding/json"
+	"strconv"
 	"sync"
 
 	"github.com/taubyte/go-sdk/database"
@@ -13,6 +14,8 @@ var (
 	chatDB   database.Database
 	dbMutex  sync.RWMutex
 	dbInit   bool
+
+	pooledDBs = make(map[string]database.Database)
 )
 
 func openDatabase(path string) (database.Database, uint32) {
@@ -29,28 +32,29 @@ func initDatabases() uint32 {
 	defer dbMutex.Unlock()
 
 	if dbInit {
-		fmt.Printf("[DEBUG] Database already initialized\n")
+		logDebug("initDatabases", "", "Database already initialized")
 		return 0 // Already initialized
 	}
 
-	fmt.Printf("[DEBUG] Initializing database connections\n")
+	logDebug("initDatabases", "", "Initializing database connections")
 	var err error
 	canvasDB, err = database.New("/canvas")
 	if err != nil {
-		fmt.Printf("[ERROR] Failed to create canvas database: %v\n", err)
+		logError("initDatabases", "", "Failed to create canvas database: %v", err)
 		return 1
 	}
-	fmt.Printf("[DEBUG] Canvas database connection created\n")
+	logDebug("initDatabases", "", "Canvas database connection created")
 
 	chatDB, err = database.New("/chat")
 	if err != nil {
-		fmt.Printf("[ERROR] Failed to create chat database: %v\n", err)
+		logError("initDatabases", "", "Failed to create chat database: %v", err)
 		return 1
 	}
-	fmt.Printf("[DEBUG] Chat database connection created\n")
+	logDebug("initDatabases", "", "Chat database connection created")
+	migrateGlobalKeys("/chat", chatDB)
 
 	dbInit = true
-	fmt.Printf("[DEBUG] Database initialization completed\n")
+	logDebug("initDatabases", "", "Database initialization completed")
 	return 0
 }
 
@@ -76,3 +80,164 @@ func getChatDB() (database.Database, uint32) {
 	return chatDB, 0
 }
 
+// Get a pooled connection for any other database path, opened on first use
+func getDB(path string) (database.Database, uint32) {
+	dbMutex.RLock()
+	db, ok := pooledDBs[path]
+	dbMutex.RUnlock()
+	if ok {
+		return db, 0
+	}
+
+	dbMutex.Lock()
+	defer dbMutex.Unlock()
+	if db, ok = pooledDBs[path]; ok {
+		return db, 0
+	}
+
+	logDebug("getDB", "", "Opening pooled database %s", path)
+	db, err := database.New(path)
+	if err != nil {
+		logError("getDB", "", "Failed to create database %s: %v", path, err)
+		return db, 1
+	}
+	migrateGlobalKeys(path, db)
+	pooledDBs[path] = db
+	return db, 0
+}
+
+// Get stats database connection
+func getStatsDB() (database.Database, uint32) {
+	return getDB("/stats")
+}
+
+// Get history database connection
+func getHistoryDB() (database.Database, uint32) {
+	return getDB("/history")
+}
+
+// Get room settings database connection
+func getSettingsDB() (database.Database, uint32) {
+	return getDB("/settings")
+}
+
+// Get teams database connection
+func getTeamsDB() (database.Database, uint32) {
+	return getDB("/teams")
+}
+
+// Get templates database connection
+func getTemplatesDB() (database.Database, uint32) {
+	return getDB("/templates")
+}
+
+// Get global config database connection
+func getConfigDB() (database.Database, uint32) {
+	return getDB("/config")
+}
+
+// Get intent log database connection
+func getIntentsDB() (database.Database, uint32) {
+	return getDB("/intents")
+}
+
+// Read a decimal counter stored under key, treating missing values as zero
+func readCounter(db database.Database, key string) int64 {
+	data, err := db.Get(key)
+	if err != nil || len(data) == 0 {
+		return 0
+	}
+	value, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return value
+}
+
+func writeCounter(db database.Database, key string, value int64) error {
+	return db.Put(key, []byte(strconv.FormatInt(value, 10)))
+}
+
+// Get schema version database connection
+func getSchemaDB() (database.Database, uint32) {
+	return getDB("/schema")
+}
+
+// Marshal v as JSON and store it under key
+func putJSON(db database.Database, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return db.Put(key, data)
+}
+
+// Get canvas chunks database connection
+func getChunksDB() (database.Database, uint32) {
+	return getDB("/canvas-chunks")
+}
+
+// Get ephemeral state database connection
+func getEphemeralDB() (database.Database, uint32) {
+	return getDB("/ephemeral")
+}
+
+// Get API key usage database connection
+func getKeyUsageDB() (database.Database, uint32) {
+	return getDB("/keyusage")
+}
+
+// Get cold-storage archive records database connection
+func getArchiveDB() (database.Database, uint32) {
+	return getDB("/archive")
+}
+
+// Get replication sequence database connection
+func getReplicationDB() (database.Database, uint32) {
+	return getDB("/replication")
+}
+
+// Get moderation database connection
+func getModerationDB() (database.Database, uint32) {
+	return getDB("/moderation")
+}
+
+// Get user notification inbox database connection
+func getNotificationsDB() (database.Database, uint32) {
+	return getDB("/notifications")
+}
+
+// Get canvas snapshot history database connection
+func getSnapshotsDB() (database.Database, uint32) {
+	return getDB("/canvas-history")
+}
+
+// Get room registry database connection
+func getRoomsDB() (database.Database, uint32) {
+	return getDB("/rooms")
+}
+
+// Get chat translation cache database connection
+func getTranslationsDB() (database.Database, uint32) {
+	return getDB("/translations")
+}
+
+// Get session token database connection
+func getSessionsDB() (database.Database, uint32) {
+	return getDB("/sessions")
+}
+
+// Get placement cooldown and rate limit database connection
+func getRateLimitDB() (database.Database, uint32) {
+	return getDB("/ratelimit")
+}
+
+// Get presence heartbeat database connection
+func getPresenceDB() (database.Database, uint32) {
+	return getDB("/presence")
+}
+
+// Get registered username database connection
+func getUsernamesDB() (database.Database, uint32) {
+	return getDB("/usernames")
+}
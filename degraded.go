@@ -0,0 +1,190 @@
+package lib
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// Consecutive failed writes that switch a room into degraded mode
+	degradedFailureThreshold = 3
+	// How often a degraded room probes the database for recovery
+	degradedProbeInterval = 5 * time.Second
+	// Payloads held in memory per degraded room; newer ones are dropped beyond this
+	maxDegradedQueue = 10000
+)
+
+const degradedProbeKey = globalKeyPrefix + "probe"
+
+// degradedRoom tracks write failures of a room and the payloads held back while it is degraded
+type degradedRoom struct {
+	failures  int
+	degraded  bool
+	since     int64
+	lastProbe time.Time
+	flushing  bool
+	queue     []Intent
+}
+
+var (
+	degradedRooms = make(map[string]*degradedRoom)
+	degradedMutex sync.Mutex
+)
+
+// Queued payloads are retried by this job even when the room goes quiet
+func init() {
+	registerJob(ScheduledJob{
+		Name:     "degradedFlush",
+		Interval: time.Minute,
+		Run: func(now time.Time) error {
+			degradedMutex.Lock()
+			rooms := make([]string, 0, len(degradedRooms))
+			for room, state := range degradedRooms {
+				if state.degraded || len(state.queue) > 0 {
+					rooms = append(rooms, room)
+				}
+			}
+			degradedMutex.Unlock()
+			for _, room := range rooms {
+				recoverDegradedRoom(room)
+			}
+			return nil
+		},
+	})
+}
+
+func isDegradedRoom(room string) bool {
+	degradedMutex.Lock()
+	defer degradedMutex.Unlock()
+	state, ok := degradedRooms[room]
+	return ok && state.degraded
+}
+
+// Count a failed write; the room turns degraded once failures repeat
+func recordWriteFailure(room string) {
+	degradedMutex.Lock()
+	state, ok := degradedRooms[room]
+	if !ok {
+		state = &degradedRoom{}
+		degradedRooms[room] = state
+	}
+	state.failures++
+	entered := !state.degraded && state.failures >= degradedFailureThreshold
+	if entered {
+		state.degraded = true
+		state.since = time.Now().UnixMilli()
+		state.lastProbe = time.Now()
+	}
+	degradedMutex.Unlock()
+	if entered {
+		logError("recordWriteFailure", room, "entering degraded mode after %d failed writes", degradedFailureThreshold)
+		publishRoomEvent(room, "system", "degraded", map[string]interface{}{"degraded": true})
+	}
+}
+
+func recordWriteSuccess(room string) {
+	degradedMutex.Lock()
+	defer degradedMutex.Unlock()
+	if state, ok := degradedRooms[room]; ok && !state.degraded && len(state.queue) == 0 {
+		delete(degradedRooms, room)
+	}
+}
+
+// Hold a payload in memory until the database is back
+func queueDegradedIntent(kind, room string, payload []byte, receivedAt time.Time) bool {
+	degradedMutex.Lock()
+	defer degradedMutex.Unlock()
+	state, ok := degradedRooms[room]
+	if !ok {
+		state = &degradedRoom{}
+		degradedRooms[room] = state
+	}
+	if len(state.queue) >= maxDegradedQueue {
+		logError("queueDegradedIntent", room, "queue full, dropping %s payload", kind)
+		return false
+	}
+	state.queue = append(state.queue, Intent{Kind: kind, Room: room, Payload: payload, Timestamp: receivedAt.UnixMilli()})
+	return true
+}
+
+// Whether writes to the room may go to the database. A degraded room probes
+// the database at most every degradedProbeInterval and, once a write succeeds,
+// replays its queue in order before leaving degraded mode.
+func recoverDegradedRoom(room string) bool {
+	degradedMutex.Lock()
+	state, ok := degradedRooms[room]
+	if !ok || (!state.degraded && len(state.queue) == 0) {
+		degradedMutex.Unlock()
+		return true
+	}
+	if state.flushing || time.Since(state.lastProbe) < degradedProbeInterval {
+		degradedMutex.Unlock()
+		return false
+	}
+	state.lastProbe = time.Now()
+	state.flushing = true
+	queue := state.queue
+	state.queue = nil
+	degradedMutex.Unlock()
+
+	flushed := 0
+	available := probeDatabase()
+	if available {
+		for _, intent := range queue {
+			if replayIntent(intent) != 0 {
+				break
+			}
+			replicateIntent(intent.Kind, intent.Room, intent.Payload)
+			flushed++
+		}
+	}
+
+	degradedMutex.Lock()
+	state.flushing = false
+	// Payloads queued during the flush wait behind the ones that failed
+	state.queue = append(queue[flushed:], state.queue...)
+	recovered := available && len(state.queue) == 0
+	if recovered {
+		delete(degradedRooms, room)
+	}
+	degradedMutex.Unlock()
+
+	if flushed > 0 {
+		logInfo("recoverDegradedRoom", room, "flushed %d queued payloads", flushed)
+	}
+	if recovered {
+		publishRoomEvent(room, "system", "degraded", map[string]interface{}{"degraded": false, "flushed": flushed})
+	}
+	return recovered
+}
+
+// Whether a write to the database goes through
+func probeDatabase() bool {
+	db, dbErr := getIntentsDB()
+	if dbErr != 0 {
+		return false
+	}
+	if err := writeCounter(db, degradedProbeKey, time.Now().UnixMilli()); err != nil {
+		return false
+	}
+	db.Delete(degradedProbeKey)
+	return true
+}
+
+// Validate a batch against what can still be read and broadcast it live,
+// holding the payload in memory until it can be saved
+func applyDegradedPixelBatch(batch PixelBatch, data []byte) uint32 {
+	prepared := preparePixelBatch(batch)
+	if prepared == nil {
+		return 0
+	}
+	if !queueDegradedIntent(IntentPixels, batch.Room, data, time.Now()) {
+		return 1
+	}
+	changes := make([]PixelChange, len(prepared.valid))
+	for i, pixel := range prepared.valid {
+		changes[i] = PixelChange{Pixel: pixel}
+	}
+	broadcastPixelBatch(batch, changes, prepared.anonymized)
+	return 0
+}
@@ -0,0 +1,167 @@
+package lib
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+const digestPreviewScale = 4
+
+// The digest job runs hourly; rooms already digested for the day are skipped
+func init() {
+	registerJob(ScheduledJob{
+		Name:     "dailyDigest",
+		Interval: time.Hour,
+		Run:      runDailyDigest,
+	})
+}
+
+func digestKey(room, day string) string {
+	return fmt.Sprintf(globalKeyPrefix+"digests/%s/%s", day, room)
+}
+
+// Count differing cells and the rectangle that bounds them
+func diffGrids(before, after [][]string) (int, Region) {
+	changed := 0
+	minX, minY, maxX, maxY := -1, -1, -1, -1
+	for y := range after {
+		for x := range after[y] {
+			if y < len(before) && x < len(before[y]) && before[y][x] == after[y][x] {
+				continue
+			}
+			changed++
+			if minX < 0 || x < minX {
+				minX = x
+			}
+			if minY < 0 || y < minY {
+				minY = y
+			}
+			if x > maxX {
+				maxX = x
+			}
+			if y > maxY {
+				maxY = y
+			}
+		}
+	}
+	if changed == 0 {
+		return 0, Region{}
+	}
+	return changed, Region{X: minX, Y: minY, Width: maxX - minX + 1, Height: maxY - minY + 1}
+}
+
+// Place two grids next to each other with a one-cell black divider
+func sideBySide(left, right [][]string) [][]string {
+	rows := len(left)
+	if len(right) > rows {
+		rows = len(right)
+	}
+	combined := make([][]string, rows)
+	for y := range combined {
+		row := make([]string, 0, len(left[0])+len(right[0])+1)
+		if y < len(left) {
+			row = append(row, left[y]...)
+		}
+		row = append(row, "#000000")
+		if y < len(right) {
+			row = append(row, right[y]...)
+		}
+		combined[y] = row
+	}
+	return combined
+}
+
+// Compare the first and last frames captured on the given UTC day
+func buildDigest(room string, dayStart time.Time) (CanvasDigest, bool) {
+	digest := CanvasDigest{Room: room, Day: dayStart.Format(dayLayout)}
+	timestamps := snapshotTimestamps(room, dayStart.UnixMilli(), dayStart.AddDate(0, 0, 1).UnixMilli())
+	if len(timestamps) < 2 {
+		return digest, false
+	}
+	first, okFirst := loadSnapshot(room, timestamps[0])
+	last, okLast := loadSnapshot(room, timestamps[len(timestamps)-1])
+	if !okFirst || !okLast {
+		return digest, false
+	}
+	digest.From, digest.To = first.Timestamp, last.Timestamp
+	digest.ChangedPixels, digest.Bounds = diffGrids(first.Grid, last.Grid)
+	preview, err := renderGridPNG(sideBySide(first.Grid, last.Grid), digestPreviewScale)
+	if err != nil {
+		logError("buildDigest", room, "failed to render preview: %v", err)
+	} else {
+		digest.PreviewPNG = base64.StdEncoding.EncodeToString(preview)
+	}
+	return digest, true
+}
+
+// Build, store and announce the digest of the previous UTC day for every room painted that day
+func runDailyDigest(now time.Time) error {
+	today := now.UTC().Truncate(24 * time.Hour)
+	dayStart := today.AddDate(0, 0, -1)
+	db, dbErr := getSnapshotsDB()
+	if dbErr != 0 {
+		return fmt.Errorf("snapshot database connection failed")
+	}
+	day := dayStart.Format(dayLayout)
+	for _, room := range activeRooms(day) {
+		if data, err := db.Get(digestKey(room, day)); err == nil && len(data) > 0 {
+			continue
+		}
+		digest, ok := buildDigest(room, dayStart)
+		if !ok {
+			continue
+		}
+		if err := putJSON(db, digestKey(room, digest.Day), digest); err != nil {
+			logError("runDailyDigest", room, "failed to save digest: %v", err)
+		}
+		publishRoomEvent(room, "system", "dailyDigest", digest)
+		if err := postWebhook("dailyDigest", digest); err != nil {
+			logError("runDailyDigest", room, "%v", err)
+		}
+	}
+	return nil
+}
+
+//export getDigest
+func getDigest(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	if _, code := checkAnonymousRead(h, room); code != 0 {
+		return code
+	}
+	setMaintenanceBanner(h, room)
+	day, err := h.Query().Get("day")
+	if err != nil || day == "" {
+		day = time.Now().UTC().AddDate(0, 0, -1).Format(dayLayout)
+	}
+	db, dbErr := getSnapshotsDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	data, err := db.Get(digestKey(room, day))
+	if err != nil || len(data) == 0 {
+		return handleHTTPError(h, fmt.Errorf("no digest for room %s on %s", room, day), 404)
+	}
+	var digest CanvasDigest
+	if err := json.Unmarshal(data, &digest); err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	return sendJSONResponse(h, digest)
+}
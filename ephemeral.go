@@ -0,0 +1,147 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+const (
+	ephemeralStateTTL      = 30 * time.Second
+	maxEphemeralValueBytes = 1024
+)
+
+var ephemeralKinds = map[string]bool{
+	"cursor":    true,
+	"selection": true,
+	"tool":      true,
+}
+
+type ephemeralStateMessage struct {
+	Room     string          `json:"room"`
+	UserID   string          `json:"userId"`
+	Username string          `json:"username"`
+	Kind     string          `json:"kind"`
+	Value    json.RawMessage `json:"value"`
+}
+
+func ephemeralKey(room, userID, kind string) string {
+	return fmt.Sprintf("/%s/%s/%s", room, userID, kind)
+}
+
+// Store state that expires after ephemeralStateTTL unless refreshed
+func storeEphemeralState(room string, state EphemeralState) uint32 {
+	db, dbErr := getEphemeralDB()
+	if dbErr != 0 {
+		return dbErr
+	}
+	now := time.Now().UnixMilli()
+	state.UpdatedAt = now
+	state.ExpiresAt = now + ephemeralStateTTL.Milliseconds()
+	if err := putJSON(db, ephemeralKey(room, state.UserID, state.Kind), state); err != nil {
+		logError("storeEphemeralState", room, "failed: %v", err)
+		return 1
+	}
+	return 0
+}
+
+// Live states of the room; expired entries are deleted as they are found
+func loadEphemeralStates(room string) []EphemeralState {
+	states := make([]EphemeralState, 0)
+	db, dbErr := getEphemeralDB()
+	if dbErr != 0 {
+		return states
+	}
+	keys, err := db.List(fmt.Sprintf("/%s/", room))
+	if err != nil {
+		return states
+	}
+	now := time.Now().UnixMilli()
+	for _, key := range keys {
+		data, err := db.Get(key)
+		if err != nil {
+			continue
+		}
+		var state EphemeralState
+		if json.Unmarshal(data, &state) != nil || state.ExpiresAt <= now {
+			db.Delete(key)
+			continue
+		}
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		if states[i].UserID == states[j].UserID {
+			return states[i].Kind < states[j].Kind
+		}
+		return states[i].UserID < states[j].UserID
+	})
+	return states
+}
+
+//export onEphemeralState
+func onEphemeralState(e event.Event) uint32 {
+	channel, err := e.PubSub()
+	if err != nil {
+		return 1
+	}
+	data, err := channel.Data()
+	if err != nil {
+		return 1
+	}
+	var message ephemeralStateMessage
+	if err := json.Unmarshal(data, &message); err != nil {
+		logError("onEphemeralState", "", "invalid JSON: %v", err)
+		return 1
+	}
+	if message.Room == "" || message.UserID == "" || strings.Contains(message.UserID, "/") {
+		logError("onEphemeralState", "", "room and userId required")
+		return 1
+	}
+	if !ephemeralKinds[message.Kind] {
+		logError("onEphemeralState", "", "unsupported kind: %s", message.Kind)
+		return 1
+	}
+	if len(message.Value) == 0 || len(message.Value) > maxEphemeralValueBytes {
+		logError("onEphemeralState", "", "value must be between 1 and %d bytes", maxEphemeralValueBytes)
+		return 1
+	}
+	if message.Kind == "cursor" && !allowCursorBroadcast(message.Room, message.UserID, time.Now().UnixMilli()) {
+		return 0
+	}
+	state := EphemeralState{
+		UserID:   message.UserID,
+		Username: message.Username,
+		Kind:     message.Kind,
+		Value:    message.Value,
+	}
+	storeEphemeralState(message.Room, state)
+	return publishRoomEvent(message.Room, "ephemeral", message.Kind, state)
+}
+
+//export getEphemeralState
+func getEphemeralState(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	if _, code := checkAnonymousRead(h, room); code != 0 {
+		return code
+	}
+	setMaintenanceBanner(h, room)
+	return sendJSONResponse(h, loadEphemeralStates(room))
+}
@@ -0,0 +1,136 @@
+package lib
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Second fill color when a room configures only one
+const defaultFillColor = "#dddddd"
+
+// Spacing of the lattice that noise fills interpolate between
+const noiseLattice = 8
+
+// Random seed stored with a room at creation and reset; generative fills derive from it
+func newRoomSeed() int64 {
+	var buf [8]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(buf[:]) >> 1)
+}
+
+// Store a fresh seed for the room, e.g. after its canvas is cleared
+func reseedRoom(room string) {
+	metadata, found := loadRoomMetadata(room)
+	if !found {
+		return
+	}
+	metadata.Seed = newRoomSeed()
+	saveRoomMetadata(metadata)
+}
+
+// Deterministic 64-bit hash of the seed and a pair of coordinates
+func seedHash(seed int64, a, b int) uint64 {
+	z := uint64(seed) ^ uint64(a)*0x9e3779b97f4a7c15 ^ uint64(b)*0xc2b2ae3d27d4eb4f
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+func unitHash(seed int64, a, b int) float64 {
+	return float64(seedHash(seed, a, b)>>11) / float64(1<<53)
+}
+
+// Mix two colors, t running from 0 (first) to 1 (second)
+func blendColors(first, second string, t float64) string {
+	a, b := parseHexColor(first), parseHexColor(second)
+	mix := func(x, y uint8) uint8 {
+		return uint8(math.Round(float64(x) + (float64(y)-float64(x))*t))
+	}
+	return fmt.Sprintf("#%02x%02x%02x", mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B))
+}
+
+func validateBackgroundFill(settings RoomSettings) error {
+	switch settings.BackgroundFill {
+	case "", FillNoise, FillGradient, FillCheckerboard:
+	default:
+		return fmt.Errorf("backgroundFill must be '%s', '%s' or '%s'", FillNoise, FillGradient, FillCheckerboard)
+	}
+	if len(settings.BackgroundFillColors) > 2 {
+		return fmt.Errorf("backgroundFillColors takes at most 2 colors")
+	}
+	for _, color := range settings.BackgroundFillColors {
+		if !isValidHexColor(color) {
+			return fmt.Errorf("backgroundFillColors must be #rrggbb colors")
+		}
+	}
+	return nil
+}
+
+func fillChanged(previous, settings RoomSettings) bool {
+	if previous.BackgroundFill != settings.BackgroundFill || len(previous.BackgroundFillColors) != len(settings.BackgroundFillColors) {
+		return true
+	}
+	for i, color := range settings.BackgroundFillColors {
+		if previous.BackgroundFillColors[i] != color {
+			return true
+		}
+	}
+	return false
+}
+
+// Color function of the room's generative fill, or nil when it has none. The
+// same seed and settings always produce the same colors.
+func roomFill(room string, settings RoomSettings) func(x, y int) string {
+	if settings.BackgroundFill == "" {
+		return nil
+	}
+	first, second := roomDefaultColor(room), defaultFillColor
+	if len(settings.BackgroundFillColors) > 0 {
+		first = settings.BackgroundFillColors[0]
+	}
+	if len(settings.BackgroundFillColors) > 1 {
+		second = settings.BackgroundFillColors[1]
+	}
+	metadata, _ := loadRoomMetadata(room)
+	seed := metadata.Seed
+	width, height := roomSize(room)
+	switch settings.BackgroundFill {
+	case FillNoise:
+		// Value noise: random lattice points smoothed bilinearly
+		return func(x, y int) string {
+			lx, ly := x/noiseLattice, y/noiseLattice
+			fx := float64(x%noiseLattice) / noiseLattice
+			fy := float64(y%noiseLattice) / noiseLattice
+			top := unitHash(seed, lx, ly)*(1-fx) + unitHash(seed, lx+1, ly)*fx
+			bottom := unitHash(seed, lx, ly+1)*(1-fx) + unitHash(seed, lx+1, ly+1)*fx
+			return blendColors(first, second, top*(1-fy)+bottom*fy)
+		}
+	case FillGradient:
+		// The seed picks the direction
+		angle := float64(seedHash(seed, 0, 0)%360) * math.Pi / 180
+		dx, dy := math.Cos(angle), math.Sin(angle)
+		span := math.Abs(dx)*float64(width-1) + math.Abs(dy)*float64(height-1)
+		origin := math.Min(0, dx*float64(width-1)) + math.Min(0, dy*float64(height-1))
+		return func(x, y int) string {
+			if span == 0 {
+				return first
+			}
+			return blendColors(first, second, (dx*float64(x)+dy*float64(y)-origin)/span)
+		}
+	case FillCheckerboard:
+		// The seed picks a square size of 4, 8 or 16 and the board's offset
+		size := 4 << (seedHash(seed, 0, 0) % 3)
+		offset := int(seedHash(seed, 1, 0) % uint64(size))
+		return func(x, y int) string {
+			if ((x+offset)/size+(y+offset)/size)%2 == 0 {
+				return first
+			}
+			return second
+		}
+	}
+	return nil
+}
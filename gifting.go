@@ -0,0 +1,213 @@
+package lib
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+func dailyUsageKey(room, day, userID string) string {
+	return fmt.Sprintf("/%s/pixel-quota/%s/%s/used", room, day, userID)
+}
+
+// Pixels granted on top of the daily quota, claimed from the room pool
+func dailyBonusKey(room, day, userID string) string {
+	return fmt.Sprintf("/%s/pixel-quota/%s/%s/bonus", room, day, userID)
+}
+
+func pixelPoolKey(room string) string {
+	return fmt.Sprintf("/%s/pixel-pool", room)
+}
+
+// Pixels the user can still place today, or -1 when the room has no daily quota
+func remainingDailyPixels(room, userID string, now time.Time) int64 {
+	quota := loadRoomSettings(room).DailyPixelQuota
+	if quota <= 0 {
+		return -1
+	}
+	db, dbErr := getStatsDB()
+	if dbErr != 0 {
+		return -1
+	}
+	day := now.UTC().Format(dayLayout)
+	remaining := quota + readCounter(db, dailyBonusKey(room, day, userID)) - readCounter(db, dailyUsageKey(room, day, userID))
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+func validateDailyQuota(ctx *PlacementContext) error {
+	remaining := remainingDailyPixels(ctx.Room, ctx.UserID, time.UnixMilli(ctx.Now))
+	if remaining < 0 {
+		return nil
+	}
+	for i := range ctx.Pixels {
+		if ctx.Verdicts[i] != "" {
+			continue
+		}
+		if remaining == 0 {
+			ctx.reject(i, "daily quota exhausted")
+			continue
+		}
+		remaining--
+	}
+	return nil
+}
+
+// Count saved pixels against each author's daily quota
+func recordDailyUsage(room string, changes []PixelChange) {
+	if loadRoomSettings(room).DailyPixelQuota <= 0 {
+		return
+	}
+	db, dbErr := getStatsDB()
+	if dbErr != 0 {
+		return
+	}
+	counts := make(map[string]int64)
+	for _, change := range changes {
+		counts[change.Pixel.UserID]++
+	}
+	day := time.Now().UTC().Format(dayLayout)
+	for userID, count := range counts {
+		key := dailyUsageKey(room, day, userID)
+		if err := writeCounter(db, key, readCounter(db, key)+count); err != nil {
+			logError("recordDailyUsage", room, "failed for user %s: %v", userID, err)
+		}
+	}
+}
+
+// Check the userId and amount shared by the pool endpoints
+func validatePoolRequest(room string, userID string, amount int) error {
+	if loadRoomSettings(room).DailyPixelQuota <= 0 {
+		return fmt.Errorf("room %s has no daily pixel quota", room)
+	}
+	if userID == "" {
+		return fmt.Errorf("userId parameter required")
+	}
+	if amount <= 0 {
+		return fmt.Errorf("amount must be a positive number of pixels")
+	}
+	return nil
+}
+
+func poolResponse(room, userID string, pool int64) map[string]interface{} {
+	return map[string]interface{}{
+		"room":      room,
+		"userId":    userID,
+		"pool":      pool,
+		"remaining": remainingDailyPixels(room, userID, time.Now()),
+	}
+}
+
+//export donatePixels
+func donatePixels(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	userID, _ := h.Query().Get("userId")
+	amount := getIntParam(h, "amount", 0)
+	if err := validatePoolRequest(room, userID, amount); err != nil {
+		return handleHTTPError(h, err, 400)
+	}
+	if code := requireSelfOrAdmin(h, room, userID); code != 0 {
+		return code
+	}
+	now := time.Now()
+	if remaining := remainingDailyPixels(room, userID, now); remaining < int64(amount) {
+		return handleHTTPError(h, fmt.Errorf("only %d pixels left in today's quota", remaining), 409)
+	}
+	db, dbErr := getStatsDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	// Donated pixels count as used for the donor today
+	usageKey := dailyUsageKey(room, now.UTC().Format(dayLayout), userID)
+	if err := writeCounter(db, usageKey, readCounter(db, usageKey)+int64(amount)); err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	pool := readCounter(db, pixelPoolKey(room)) + int64(amount)
+	if err := writeCounter(db, pixelPoolKey(room), pool); err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	publishRoomEvent(room, "events", "poolDonation", map[string]interface{}{"userId": userID, "amount": amount, "pool": pool})
+	return sendJSONResponse(h, poolResponse(room, userID, pool))
+}
+
+//export getPixelPool
+func getPixelPool(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	db, dbErr := getStatsDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	userID, _ := h.Query().Get("userId")
+	return sendJSONResponse(h, poolResponse(room, userID, readCounter(db, pixelPoolKey(room))))
+}
+
+//export claimPoolPixels
+func claimPoolPixels(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := rejectDuringMaintenance(h, room); code != 0 {
+		return code
+	}
+	userID, _ := h.Query().Get("userId")
+	amount := getIntParam(h, "amount", 0)
+	if err := validatePoolRequest(room, userID, amount); err != nil {
+		return handleHTTPError(h, err, 400)
+	}
+	if code := requireSelfOrAdmin(h, room, userID); code != 0 {
+		return code
+	}
+	db, dbErr := getStatsDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	pool := readCounter(db, pixelPoolKey(room))
+	if pool < int64(amount) {
+		return handleHTTPError(h, fmt.Errorf("the pool only holds %d pixels", pool), 409)
+	}
+	pool -= int64(amount)
+	if err := writeCounter(db, pixelPoolKey(room), pool); err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	// Claimed pixels extend the user's quota for the rest of the day
+	bonusKey := dailyBonusKey(room, time.Now().UTC().Format(dayLayout), userID)
+	if err := writeCounter(db, bonusKey, readCounter(db, bonusKey)+int64(amount)); err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	publishRoomEvent(room, "events", "poolClaim", map[string]interface{}{"userId": userID, "amount": amount, "pool": pool})
+	return sendJSONResponse(h, poolResponse(room, userID, pool))
+}
@@ -0,0 +1,132 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+// How often the stats.json feed is rebuilt; it is cached by clients for as long
+const globalStatsInterval = time.Minute
+
+const globalStatsKey = globalKeyPrefix + "global-stats"
+
+func init() {
+	registerJob(ScheduledJob{
+		Name:     "globalStats",
+		Interval: globalStatsInterval,
+		Run:      refreshGlobalStats,
+	})
+}
+
+func dailyCounterKey(day, name string) string {
+	return fmt.Sprintf(globalKeyPrefix+"daily/%s/%s", day, name)
+}
+
+func dailyUsersPrefix(day string) string {
+	return fmt.Sprintf(globalKeyPrefix+"daily/%s/users/", day)
+}
+
+// Count activity towards today's deployment-wide totals and mark the users active
+func recordGlobalActivity(counter string, count int64, userIDs map[string]bool) {
+	db, dbErr := getStatsDB()
+	if dbErr != 0 {
+		return
+	}
+	day := time.Now().UTC().Format(dayLayout)
+	key := dailyCounterKey(day, counter)
+	if err := writeCounter(db, key, readCounter(db, key)+count); err != nil {
+		logError("recordGlobalActivity", "", "failed to save %s: %v", counter, err)
+	}
+	for userID := range userIDs {
+		if userID != "" && userID != "unknown" {
+			db.Put(dailyUsersPrefix(day)+userID, []byte("1"))
+		}
+	}
+}
+
+func recordGlobalPixels(changes []PixelChange) {
+	users := make(map[string]bool)
+	for _, change := range changes {
+		users[change.Pixel.UserID] = true
+	}
+	recordGlobalActivity("pixels", int64(len(changes)), users)
+}
+
+// Aggregate the deployment-wide numbers behind stats.json
+func buildGlobalStats(now time.Time) (GlobalStats, error) {
+	stats := GlobalStats{Day: now.UTC().Format(dayLayout), GeneratedAt: now.UnixMilli()}
+	roomsDB, dbErr := getRoomsDB()
+	if dbErr != 0 {
+		return stats, fmt.Errorf("rooms database connection failed")
+	}
+	rooms, _ := roomsDB.List(roomMetaPrefix)
+	stats.TotalRooms = len(rooms)
+	db, dbErr := getStatsDB()
+	if dbErr != 0 {
+		return stats, fmt.Errorf("stats database connection failed")
+	}
+	stats.PixelsToday = readCounter(db, dailyCounterKey(stats.Day, "pixels"))
+	stats.MessagesToday = readCounter(db, dailyCounterKey(stats.Day, "messages"))
+	users, _ := db.List(dailyUsersPrefix(stats.Day))
+	stats.ActiveUsersToday = len(users)
+	stats.ActiveRoomsToday = len(activeRooms(stats.Day))
+	for _, key := range rooms {
+		stats.OnlineUsers += len(loadOnlineUsers(key[len(roomMetaPrefix):]))
+	}
+	return stats, nil
+}
+
+func refreshGlobalStats(now time.Time) error {
+	_, err := saveGlobalStats(now)
+	return err
+}
+
+func saveGlobalStats(now time.Time) (GlobalStats, error) {
+	stats, err := buildGlobalStats(now)
+	if err != nil {
+		return stats, err
+	}
+	db, dbErr := getStatsDB()
+	if dbErr != 0 {
+		return stats, fmt.Errorf("stats database connection failed")
+	}
+	return stats, putJSON(db, globalStatsKey, stats)
+}
+
+// The stored feed, rebuilt first when the scheduler has not refreshed it in time
+func loadGlobalStats(now time.Time) (GlobalStats, error) {
+	var stats GlobalStats
+	if db, dbErr := getStatsDB(); dbErr == 0 {
+		if data, err := db.Get(globalStatsKey); err == nil && json.Unmarshal(data, &stats) == nil &&
+			now.UnixMilli()-stats.GeneratedAt < globalStatsInterval.Milliseconds() {
+			return stats, nil
+		}
+	}
+	return saveGlobalStats(now)
+}
+
+//export getGlobalStats
+func getGlobalStats(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	now := time.Now()
+	stats, err := loadGlobalStats(now)
+	if err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	maxAge := (stats.GeneratedAt + globalStatsInterval.Milliseconds() - now.UnixMilli()) / 1000
+	if maxAge < 0 {
+		maxAge = 0
+	}
+	h.Headers().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", maxAge))
+	return sendJSONResponse(h, stats)
+}
@@ -2,7 +2,10 @@ module function
 
 go 1.19
 
-require github.com/taubyte/go-sdk v0.3.9
+require (
+	github.com/taubyte/go-sdk v0.3.9
+	github.com/taubyte/go-sdk-symbols v0.2.7
+)
 
 require (
 	github.com/ipfs/go-cid v0.0.7 // indirect
@@ -15,7 +18,6 @@ require (
 	github.com/multiformats/go-multibase v0.0.3 // indirect
 	github.com/multiformats/go-multihash v0.0.15 // indirect
 	github.com/multiformats/go-varint v0.0.6 // indirect
-	github.com/taubyte/go-sdk-symbols v0.2.7 // indirect
 	golang.org/x/crypto v0.1.0 // indirect
 	golang.org/x/sys v0.1.0 // indirect
 )
@@ -0,0 +1,159 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+const (
+	defaultPlacementsLimit = 50
+	maxPlacementsLimit     = 200
+)
+
+func historySeqKey(room string) string {
+	return fmt.Sprintf("/%s/seq", room)
+}
+
+// Oldest sequence still retained in the log
+func historyFirstKey(room string) string {
+	return fmt.Sprintf("/%s/first", room)
+}
+
+func historyLogKey(room string, seq int64) string {
+	return fmt.Sprintf("/%s/log/%012d", room, seq)
+}
+
+func historyUserPrefix(room, userID string) string {
+	return fmt.Sprintf("/%s/users/%s/", room, userID)
+}
+
+// Append saved pixels to the room's placement log and per-user index
+func appendPlacementHistory(room string, changes []PixelChange) uint32 {
+	if len(changes) == 0 {
+		return 0
+	}
+	db, dbErr := getHistoryDB()
+	if dbErr != 0 {
+		logError("appendPlacementHistory", room, "database connection failed")
+		return dbErr
+	}
+	seq := readCounter(db, historySeqKey(room))
+	var storedKeys, storedBytes int64
+	for _, change := range changes {
+		pixel := change.Pixel
+		seq++
+		record := PlacementRecord{
+			Seq:       seq,
+			X:         pixel.X,
+			Y:         pixel.Y,
+			Color:     pixel.Color,
+			UserID:    pixel.UserID,
+			Username:  pixel.Username,
+			Timestamp: pixel.Timestamp,
+		}
+		recordData, err := json.Marshal(record)
+		if err != nil {
+			logError("appendPlacementHistory", room, "failed to marshal record %d: %v", seq, err)
+			continue
+		}
+		if err := db.Put(historyLogKey(room, seq), recordData); err != nil {
+			logError("appendPlacementHistory", room, "failed to save record %d: %v", seq, err)
+			continue
+		}
+		userKey := fmt.Sprintf("%s%012d", historyUserPrefix(room, pixel.UserID), seq)
+		storedKeys++
+		storedBytes += int64(len(recordData))
+		if err := db.Put(userKey, recordData); err != nil {
+			logError("appendPlacementHistory", room, "failed to index record %d for user %s: %v", seq, pixel.UserID, err)
+		} else {
+			storedKeys++
+			storedBytes += int64(len(recordData))
+		}
+	}
+	recordStorageUsage(room, NamespaceHistory, storedKeys, storedBytes)
+	if err := writeCounter(db, historySeqKey(room), seq); err != nil {
+		logError("appendPlacementHistory", room, "failed to save sequence: %v", err)
+		return 1
+	}
+	enforceHistoryQuota(room)
+	return 0
+}
+
+//export getUserPlacements
+func getUserPlacements(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	// Anonymized rooms keep identities in the log for moderators only
+	if loadRoomSettings(room).AnonymizeContributors {
+		if code := requireAdmin(h); code != 0 {
+			return code
+		}
+	}
+	setMaintenanceBanner(h, room)
+	userID, err := h.Query().Get("userId")
+	if err != nil || userID == "" {
+		return handleHTTPError(h, fmt.Errorf("userId parameter required"), 400)
+	}
+	limit := getIntParam(h, "limit", defaultPlacementsLimit)
+	if limit <= 0 || limit > maxPlacementsLimit {
+		limit = defaultPlacementsLimit
+	}
+	cursor := int64(getIntParam(h, "cursor", 0))
+
+	db, dbErr := getHistoryDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	prefix := historyUserPrefix(room, userID)
+	keys, err := db.List(prefix)
+	if err != nil {
+		logError("getUserPlacements", room, "failed to list keys: %v", err)
+		keys = nil
+	}
+	// Keys are zero-padded sequences, so descending key order is newest first
+	sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+
+	placements := make([]PlacementRecord, 0, limit)
+	var nextCursor int64
+	for _, key := range keys {
+		if len(key) <= len(prefix) {
+			continue
+		}
+		seq, err := strconv.ParseInt(key[len(prefix):], 10, 64)
+		if err != nil || (cursor > 0 && seq >= cursor) {
+			continue
+		}
+		if len(placements) == limit {
+			nextCursor = placements[len(placements)-1].Seq
+			break
+		}
+		recordData, err := db.Get(key)
+		if err != nil {
+			logError("getUserPlacements", room, "failed to get record for key: %s, error: %v", key, err)
+			continue
+		}
+		var record PlacementRecord
+		if json.Unmarshal(recordData, &record) == nil {
+			placements = append(placements, record)
+		}
+	}
+
+	return sendJSONResponse(h, map[string]interface{}{
+		"placements": placements,
+		"nextCursor": nextCursor,
+	})
+}
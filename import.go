@@ -0,0 +1,151 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"io"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+// Largest request body importCanvas reads
+const maxImportBytes = 1 << 20
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// Decode a PNG into a color grid; fully transparent pixels stay empty
+func decodePNGGrid(data []byte) ([][]string, error) {
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid PNG: %v", err)
+	}
+	bounds := img.Bounds()
+	if bounds.Dx() > maxCanvasDimension || bounds.Dy() > maxCanvasDimension {
+		return nil, fmt.Errorf("image must be at most %dx%d", maxCanvasDimension, maxCanvasDimension)
+	}
+	grid := make([][]string, bounds.Dy())
+	for y := range grid {
+		grid[y] = make([]string, bounds.Dx())
+		for x := range grid[y] {
+			r, g, b, a := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			if a == 0 {
+				continue
+			}
+			grid[y][x] = fmt.Sprintf("#%02x%02x%02x", r>>8, g>>8, b>>8)
+		}
+	}
+	return grid, nil
+}
+
+// Parse an import body: a PNG, or a JSON grid of #rrggbb colors where empty
+// strings leave the cell untouched
+func decodeImportGrid(body []byte) ([][]string, error) {
+	if bytes.HasPrefix(body, pngSignature) {
+		return decodePNGGrid(body)
+	}
+	var grid [][]string
+	if err := json.Unmarshal(body, &grid); err != nil {
+		return nil, fmt.Errorf("body must be a PNG or a JSON color grid: %v", err)
+	}
+	if len(grid) > maxCanvasDimension {
+		return nil, fmt.Errorf("grid must be at most %dx%d", maxCanvasDimension, maxCanvasDimension)
+	}
+	for y, row := range grid {
+		if len(row) > maxCanvasDimension {
+			return nil, fmt.Errorf("grid must be at most %dx%d", maxCanvasDimension, maxCanvasDimension)
+		}
+		for x, color := range row {
+			if color != "" && !isValidHexColor(color) {
+				return nil, fmt.Errorf("invalid color %q at %d,%d", color, x, y)
+			}
+		}
+	}
+	return grid, nil
+}
+
+//export importCanvas
+func importCanvas(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	if code := rejectDuringMaintenance(h, room); code != 0 {
+		return code
+	}
+	if isArchivedRoom(room) {
+		return handleHTTPError(h, fmt.Errorf("room %s is archived", room), 409)
+	}
+	userID, _ := h.Query().Get("userId")
+	if userID == "" {
+		return handleHTTPError(h, fmt.Errorf("userId parameter required"), 400)
+	}
+	username, _ := h.Query().Get("username")
+	if username == "" {
+		username = userID
+	}
+	body, err := io.ReadAll(io.LimitReader(h.Body(), maxImportBytes+1))
+	if err != nil {
+		return handleHTTPError(h, fmt.Errorf("failed to read request body: %v", err), 400)
+	}
+	if len(body) > maxImportBytes {
+		return handleHTTPError(h, fmt.Errorf("body must be at most %d bytes", maxImportBytes), 413)
+	}
+	grid, err := decodeImportGrid(body)
+	if err != nil {
+		return handleHTTPError(h, err, 400)
+	}
+	offsetX, offsetY := getIntParam(h, "x", 0), getIntParam(h, "y", 0)
+	now := time.Now().UnixMilli()
+	var pixels []Pixel
+	for y, row := range grid {
+		for x, color := range row {
+			if color == "" {
+				continue
+			}
+			if !inRoomBounds(room, offsetX+x, offsetY+y) {
+				width, height := roomSize(room)
+				return handleHTTPError(h, fmt.Errorf("import at %d,%d does not fit the %dx%d canvas", offsetX, offsetY, width, height), 400)
+			}
+			pixels = append(pixels, Pixel{X: offsetX + x, Y: offsetY + y, Color: color, UserID: userID, Username: username, Timestamp: now})
+		}
+	}
+	if len(pixels) > 0 {
+		audit, code := guardDestructive(h, room, "importCanvas", fmt.Sprintf("%d pixels at %d,%d", len(pixels), offsetX, offsetY))
+		if code != 0 {
+			return code
+		}
+		if ensureRoomSchema(room) != 0 {
+			return failAudited(h, room, audit, fmt.Errorf("room migration failed"), 500)
+		}
+		changes, dbErr := savePixels(room, pixels, true)
+		if dbErr != 0 {
+			return failAudited(h, room, audit, fmt.Errorf("failed to save imported pixels"), 500)
+		}
+		completeAudit(room, audit, nil)
+		afterPixelsSaved(room, changes)
+		broadcastPixelBatch(PixelBatch{Room: room, UserID: userID, Pixels: pixels}, changes, false)
+		logInfo("importCanvas", room, "imported %d pixels for user %s", len(changes), userID)
+	}
+	return sendJSONResponse(h, map[string]interface{}{
+		"room":     room,
+		"userId":   userID,
+		"imported": len(pixels),
+	})
+}
@@ -0,0 +1,149 @@
+package lib
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+const intentPendingPrefix = globalKeyPrefix + "pending/"
+
+func intentKey(id string) string {
+	return intentPendingPrefix + id
+}
+
+// Intent IDs start with the zero-padded accept time so keys list in order; the
+// random suffix keeps concurrent handlers from sharing a key without a counter
+func newIntentID(room string, now time.Time) (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%013d-%s-%s", now.UnixMilli(), room, hex.EncodeToString(buf)), nil
+}
+
+// Log a raw payload before applying it, stamped with the time the server
+// received it; returns its ID and whether it was logged
+func appendIntent(kind, room string, payload []byte, receivedAt time.Time) (string, bool) {
+	db, dbErr := getIntentsDB()
+	if dbErr != 0 {
+		logError("appendIntent", room, "database connection failed")
+		return "", false
+	}
+	id, err := newIntentID(room, receivedAt)
+	if err != nil {
+		logError("appendIntent", room, "failed to generate intent ID: %v", err)
+		return "", false
+	}
+	data, err := json.Marshal(Intent{
+		ID:        id,
+		Kind:      kind,
+		Room:      room,
+		Payload:   payload,
+		Timestamp: receivedAt.UnixMilli(),
+	})
+	if err != nil {
+		return "", false
+	}
+	if err := db.Put(intentKey(id), data); err != nil {
+		logError("appendIntent", room, "failed to save intent %s: %v", id, err)
+		return "", false
+	}
+	return id, true
+}
+
+// Mark an intent as applied by removing its key from the pending log
+func completeIntent(key string) {
+	db, dbErr := getIntentsDB()
+	if dbErr != 0 {
+		return
+	}
+	if err := db.Delete(key); err != nil {
+		logError("completeIntent", "", "failed to delete intent %s: %v", key, err)
+	}
+}
+
+// Decode and apply a logged intent again
+func replayIntent(intent Intent) uint32 {
+	switch intent.Kind {
+	case IntentPixels:
+		batch, err := decodePixelBatch(intent.Payload)
+		if err != nil {
+			logError("replayIntent", "", "failed to decode pixel intent %s: %v", intent.ID, err)
+			return 1
+		}
+		return applyPixelBatch(batch)
+	case IntentChat:
+		chatMessage, room, _, err := decodeChatMessage(intent.Payload)
+		if err != nil {
+			logError("replayIntent", "", "failed to decode chat intent %s: %v", intent.ID, err)
+			return 1
+		}
+		// Replays keep the receipt time so the message lands under its original key
+		receivedAt := intent.Timestamp
+		if receivedAt <= 0 {
+			receivedAt = time.Now().UnixMilli()
+		}
+		return applyChatMessage(room, chatMessage, receivedAt)
+	}
+	logError("replayIntent", "", "unknown intent kind %s", intent.Kind)
+	return 1
+}
+
+//export recoverIntents
+func recoverIntents(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	db, dbErr := getIntentsDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	keys, err := db.List(intentPendingPrefix)
+	if err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	// Keys lead with the zero-padded accept time, so they replay in the order
+	// they were accepted; intents logged before IDs were timestamps sort first
+	sort.Strings(keys)
+
+	replayed, failed := 0, 0
+	for _, key := range keys {
+		data, err := db.Get(key)
+		if err != nil {
+			failed++
+			continue
+		}
+		var intent Intent
+		if err := json.Unmarshal(data, &intent); err != nil {
+			logError("recoverIntents", "", "failed to unmarshal intent %s: %v", key, err)
+			failed++
+			continue
+		}
+		if replayIntent(intent) != 0 {
+			failed++
+			continue
+		}
+		replicateIntent(intent.Kind, intent.Room, intent.Payload)
+		completeIntent(key)
+		replayed++
+	}
+	return sendJSONResponse(h, map[string]int{
+		"pending":  len(keys),
+		"replayed": replayed,
+		"failed":   failed,
+	})
+}
@@ -0,0 +1,173 @@
+package lib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+	http "github.com/taubyte/go-sdk/http/event"
+)
+
+// Length of the fixed window used for per-key quotas
+const keyQuotaWindow = time.Hour
+
+const keyUsagePrefix = globalKeyPrefix + "keys/"
+
+// Derive a stable identifier for an API key so raw secrets are never stored
+func apiKeyID(apiKey string) string {
+	if apiKey == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Read the caller's API key from X-API-Key or a bearer Authorization header
+func requestAPIKey(h http.Event) string {
+	if apiKey, err := h.Headers().Get("X-API-Key"); err == nil && apiKey != "" {
+		return apiKey
+	}
+	auth, err := h.Headers().Get("Authorization")
+	if err != nil {
+		return ""
+	}
+	if strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(auth[len("Bearer "):])
+	}
+	return ""
+}
+
+func loadKeyUsage(keyID string) (KeyUsage, bool) {
+	usage := KeyUsage{KeyID: keyID}
+	db, dbErr := getKeyUsageDB()
+	if dbErr != 0 {
+		return usage, false
+	}
+	data, err := db.Get(keyUsagePrefix + keyID)
+	if err != nil || len(data) == 0 {
+		return usage, false
+	}
+	if err := json.Unmarshal(data, &usage); err != nil {
+		logError("loadKeyUsage", "", "failed to unmarshal usage for key %s: %v", keyID, err)
+		return KeyUsage{KeyID: keyID}, false
+	}
+	return usage, true
+}
+
+// Hourly request and event allowance for a key; 0 means unlimited
+func keyQuota(config GlobalConfig, keyID string) int64 {
+	if quota, ok := config.KeyQuotas[keyID]; ok {
+		return quota
+	}
+	return config.KeyQuotaPerHour
+}
+
+// Count one request or event against a key. Returns false once the key has
+// used up its quota for the current window.
+func recordKeyUsage(keyID, endpoint string, isEvent bool) bool {
+	if keyID == "" {
+		return true
+	}
+	db, dbErr := getKeyUsageDB()
+	if dbErr != 0 {
+		return true
+	}
+	usage, _ := loadKeyUsage(keyID)
+	now := time.Now().UnixMilli()
+	if usage.FirstSeen == 0 {
+		usage.FirstSeen = now
+	}
+	if now-usage.WindowStart >= keyQuotaWindow.Milliseconds() {
+		usage.WindowStart = now
+		usage.WindowCount = 0
+	}
+	quota := keyQuota(loadGlobalConfig(), keyID)
+	if quota > 0 && usage.WindowCount >= quota {
+		return false
+	}
+	usage.LastSeen = now
+	usage.WindowCount++
+	if isEvent {
+		usage.Events++
+	} else {
+		usage.Requests++
+	}
+	if usage.Endpoints == nil {
+		usage.Endpoints = make(map[string]int64)
+	}
+	usage.Endpoints[endpoint]++
+	if err := putJSON(db, keyUsagePrefix+keyID, usage); err != nil {
+		logError("recordKeyUsage", "", "failed to save usage for key %s: %v", keyID, err)
+	}
+	return true
+}
+
+// Attribute an HTTP request to the caller's API key, rejecting it with 429
+// when the key is over quota. Requests without a key are not tracked.
+func trackKeyUsage(h http.Event) uint32 {
+	keyID := apiKeyID(requestAPIKey(h))
+	if keyID == "" {
+		return 0
+	}
+	endpoint, err := h.Path()
+	if err != nil {
+		endpoint = "unknown"
+	}
+	if !recordKeyUsage(keyID, endpoint, false) {
+		return handleHTTPError(h, fmt.Errorf("API key quota exceeded"), 429)
+	}
+	return 0
+}
+
+// Attribute a pubsub event to the API key carried in its payload
+func trackKeyEvent(apiKey, eventType string) bool {
+	return recordKeyUsage(apiKeyID(apiKey), eventType, true)
+}
+
+//export getKeyUsage
+func getKeyUsage(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	if keyID, err := h.Query().Get("keyId"); err == nil && keyID != "" {
+		usage, found := loadKeyUsage(keyID)
+		if !found {
+			return handleHTTPError(h, fmt.Errorf("no usage recorded for key %s", keyID), 404)
+		}
+		return sendJSONResponse(h, usage)
+	}
+
+	db, dbErr := getKeyUsageDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	keys, err := db.List(keyUsagePrefix)
+	if err != nil {
+		logError("getKeyUsage", "", "failed to list keys: %v", err)
+		keys = nil
+	}
+	usages := make([]KeyUsage, 0, len(keys))
+	for _, key := range keys {
+		if usage, found := loadKeyUsage(strings.TrimPrefix(key, keyUsagePrefix)); found {
+			usages = append(usages, usage)
+		}
+	}
+	// Busiest integrations first
+	sort.Slice(usages, func(i, j int) bool {
+		return usages[i].Requests+usages[i].Events > usages[j].Requests+usages[j].Events
+	})
+	return sendJSONResponse(h, usages)
+}
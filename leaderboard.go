@@ -0,0 +1,185 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+// Leaderboard periods; all is the room's lifetime total from RoomStats
+const (
+	PeriodDay   = "day"
+	PeriodWeek  = "week"
+	PeriodMonth = "month"
+	PeriodAll   = "all"
+)
+
+// Contributors archived as winners when a period ends
+const periodWinnerCount = 3
+
+// Bucket naming the calendar period (UTC) a time falls in
+var periodBuckets = map[string]func(time.Time) string{
+	PeriodDay: func(t time.Time) string {
+		return t.UTC().Format(dayLayout)
+	},
+	PeriodWeek: func(t time.Time) string {
+		year, week := t.UTC().ISOWeek()
+		return fmt.Sprintf("%04d-W%02d", year, week)
+	},
+	PeriodMonth: func(t time.Time) string {
+		return t.UTC().Format("2006-01")
+	},
+}
+
+// periodBoard holds the per-user counts of the period's current bucket
+type periodBoard struct {
+	Bucket string                 `json:"bucket"`
+	Users  map[string]Contributor `json:"users"`
+}
+
+func periodBoardKey(room, period string) string {
+	return fmt.Sprintf("/%s/period/%s", room, period)
+}
+
+func periodWinnersPrefix(room, period string) string {
+	return fmt.Sprintf("/%s/winners/%s/", room, period)
+}
+
+// Load the period's board for the bucket containing now. A board left over
+// from an earlier bucket has its winners archived and is started afresh.
+func loadPeriodBoard(room, period string, now time.Time) periodBoard {
+	bucket := periodBuckets[period](now)
+	board := periodBoard{Bucket: bucket, Users: make(map[string]Contributor)}
+	db, dbErr := getStatsDB()
+	if dbErr != 0 {
+		return board
+	}
+	data, err := db.Get(periodBoardKey(room, period))
+	if err != nil || len(data) == 0 {
+		return board
+	}
+	var stored periodBoard
+	if err := json.Unmarshal(data, &stored); err != nil {
+		logError("loadPeriodBoard", room, "failed to unmarshal %s board: %v", period, err)
+		return board
+	}
+	if stored.Bucket == bucket {
+		if stored.Users == nil {
+			stored.Users = make(map[string]Contributor)
+		}
+		return stored
+	}
+	archivePeriodWinners(room, period, stored, now)
+	db.Delete(periodBoardKey(room, period))
+	return board
+}
+
+func archivePeriodWinners(room, period string, board periodBoard, now time.Time) {
+	if len(board.Users) == 0 {
+		return
+	}
+	db, dbErr := getStatsDB()
+	if dbErr != 0 {
+		return
+	}
+	winners := PeriodWinners{
+		Period:     period,
+		Bucket:     board.Bucket,
+		Winners:    roomLeaderboard(board.Users, periodWinnerCount),
+		ArchivedAt: now.UnixMilli(),
+	}
+	if err := putJSON(db, periodWinnersPrefix(room, period)+board.Bucket, winners); err != nil {
+		logError("archivePeriodWinners", room, "failed for %s %s: %v", period, board.Bucket, err)
+		return
+	}
+	logInfo("archivePeriodWinners", room, "archived %s winners for %s", period, board.Bucket)
+}
+
+func loadPeriodCounts(room, period string, now time.Time) map[string]Contributor {
+	return loadPeriodBoard(room, period, now).Users
+}
+
+// Count saved placements towards the day, week and month boards
+func updatePeriodLeaderboards(room string, changes []PixelChange) {
+	db, dbErr := getStatsDB()
+	if dbErr != 0 {
+		return
+	}
+	now := time.Now()
+	for period := range periodBuckets {
+		board := loadPeriodBoard(room, period, now)
+		for _, change := range changes {
+			user := board.Users[change.Pixel.UserID]
+			user.UserID = change.Pixel.UserID
+			user.Username = change.Pixel.Username
+			user.Pixels++
+			board.Users[change.Pixel.UserID] = user
+		}
+		if err := putJSON(db, periodBoardKey(room, period), board); err != nil {
+			logError("updatePeriodLeaderboards", room, "failed to save %s board: %v", period, err)
+		}
+	}
+}
+
+//export getPastWinners
+func getPastWinners(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	if _, code := checkAnonymousRead(h, room); code != 0 {
+		return code
+	}
+	period, _ := h.Query().Get("period")
+	if _, ok := periodBuckets[period]; !ok {
+		return handleHTTPError(h, fmt.Errorf("period must be day, week or month"), 400)
+	}
+	limit := getIntParam(h, "limit", defaultLeaderboardLimit)
+	if limit <= 0 || limit > maxLeaderboardLimit {
+		limit = defaultLeaderboardLimit
+	}
+	db, dbErr := getStatsDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	// Archive a period that ended without any placement since
+	loadPeriodBoard(room, period, time.Now())
+	keys, _ := db.List(periodWinnersPrefix(room, period))
+	// Newest period first
+	sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+	if len(keys) > limit {
+		keys = keys[:limit]
+	}
+	anonymize := loadRoomSettings(room).AnonymizeContributors
+	results := make([]PeriodWinners, 0, len(keys))
+	for _, key := range keys {
+		data, err := db.Get(key)
+		if err != nil {
+			continue
+		}
+		var winners PeriodWinners
+		if json.Unmarshal(data, &winners) != nil {
+			continue
+		}
+		if anonymize {
+			winners.Winners = make([]Contributor, 0)
+		}
+		usernameResolver{}.contributors(winners.Winners)
+		results = append(results, winners)
+	}
+	return sendJSONResponse(h, results)
+}
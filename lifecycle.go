@@ -0,0 +1,33 @@
+package lib
+
+// Room lifecycle events published on the room's system channel
+const (
+	LifecycleCreated         = "roomCreated"
+	LifecycleCleared         = "roomCleared"
+	LifecycleFrozen          = "roomFrozen"
+	LifecycleUnfrozen        = "roomUnfrozen"
+	LifecycleArchived        = "roomArchived"
+	LifecycleRehydrated      = "roomRehydrated"
+	LifecycleSettingsChanged = "settingsChanged"
+	LifecycleRestored        = "roomRestored"
+	LifecycleDeleted         = "roomDeleted"
+	LifecycleBanner          = "bannerChanged"
+	LifecycleArtworkFinished = "artworkFinished"
+)
+
+// Notify connected clients of a change to the room itself
+func publishLifecycleEvent(room, eventType string, data interface{}) {
+	if publishRoomEvent(room, "system", eventType, data) != 0 {
+		logError("publishLifecycleEvent", room, "failed to publish %s", eventType)
+	}
+}
+
+// Publish settingsChanged plus freeze transitions when maintenance was toggled
+func publishSettingsChanged(room string, previous, settings RoomSettings) {
+	publishLifecycleEvent(room, LifecycleSettingsChanged, settings)
+	if !previous.Maintenance && settings.Maintenance {
+		publishLifecycleEvent(room, LifecycleFrozen, map[string]string{"message": settings.MaintenanceMessage})
+	} else if previous.Maintenance && !settings.Maintenance {
+		publishLifecycleEvent(room, LifecycleUnfrozen, nil)
+	}
+}
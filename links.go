@@ -0,0 +1,180 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/taubyte/go-sdk/event"
+	"github.com/taubyte/go-sdk/http/client"
+)
+
+// Links with a scheme, a www. prefix, or a bare name.tld with an optional path
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://[^\s<>"]+|www\.[^\s<>"]+|[a-z0-9-]+(?:\.[a-z0-9-]+)*\.[a-z]{2,24}(?:/[^\s<>"]*)?)`)
+
+func flaggedMessagePrefix(room string) string {
+	return fmt.Sprintf("/%s/flagged/", room)
+}
+
+func linkReputationKey(domain string) string {
+	return fmt.Sprintf(globalKeyPrefix+"link-reputation/%s", domain)
+}
+
+// Lowercased host names of the links in a message, without a leading www.
+func extractLinkDomains(text string) []string {
+	seen := make(map[string]bool)
+	domains := make([]string, 0)
+	for _, link := range linkPattern.FindAllString(text, -1) {
+		if !strings.Contains(link, "://") {
+			link = "http://" + link
+		}
+		parsed, err := url.Parse(link)
+		if err != nil || parsed.Hostname() == "" {
+			continue
+		}
+		domain := strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www.")
+		if !seen[domain] {
+			seen[domain] = true
+			domains = append(domains, domain)
+		}
+	}
+	return domains
+}
+
+// A blocked entry also covers its subdomains
+func isBlockedDomain(domain string, blocklist []string) bool {
+	for _, blocked := range blocklist {
+		blocked = strings.TrimPrefix(strings.ToLower(blocked), "www.")
+		if domain == blocked || strings.HasSuffix(domain, "."+blocked) {
+			return true
+		}
+	}
+	return false
+}
+
+// Ask the reputation service about a domain; it answers {"malicious": bool}.
+// Verdicts are cached in the config database.
+func isMaliciousDomain(config GlobalConfig, domain string) bool {
+	db, dbErr := getConfigDB()
+	if dbErr != 0 {
+		return false
+	}
+	if data, err := db.Get(linkReputationKey(domain)); err == nil && len(data) > 0 {
+		return string(data) == "malicious"
+	}
+	body, _ := json.Marshal(map[string]string{"domain": domain})
+	httpClient, err := client.New()
+	if err != nil {
+		return false
+	}
+	request, err := httpClient.Request(config.LinkReputationURL,
+		client.Method("POST"),
+		client.Headers(map[string][]string{"Content-Type": {"application/json"}}),
+		client.Body(body),
+	)
+	if err != nil {
+		return false
+	}
+	response, err := request.Do()
+	if err != nil {
+		logError("isMaliciousDomain", "", "lookup for %s failed: %v", domain, err)
+		return false
+	}
+	defer response.Body().Close()
+	data, err := io.ReadAll(response.Body())
+	if err != nil {
+		return false
+	}
+	var verdict struct {
+		Malicious bool `json:"malicious"`
+	}
+	if err := json.Unmarshal(data, &verdict); err != nil {
+		logError("isMaliciousDomain", "", "unexpected response for %s: %s", domain, data)
+		return false
+	}
+	cached := "clean"
+	if verdict.Malicious {
+		cached = "malicious"
+	}
+	db.Put(linkReputationKey(domain), []byte(cached))
+	return verdict.Malicious
+}
+
+// Domains in the message that are blocklisted or reported as malicious
+func disallowedLinks(config GlobalConfig, message string) []string {
+	disallowed := make([]string, 0)
+	if len(config.BlockedDomains) == 0 && config.LinkReputationURL == "" {
+		return disallowed
+	}
+	for _, domain := range extractLinkDomains(message) {
+		if isBlockedDomain(domain, config.BlockedDomains) ||
+			(config.LinkReputationURL != "" && isMaliciousDomain(config, domain)) {
+			disallowed = append(disallowed, domain)
+		}
+	}
+	return disallowed
+}
+
+// Apply the link policy to an incoming message; false means the message is dropped
+func screenChatLinks(room string, chatMessage *ChatMessage) bool {
+	config := loadGlobalConfig()
+	domains := disallowedLinks(config, chatMessage.Message)
+	if len(domains) == 0 {
+		return true
+	}
+	if config.LinkAction == LinkActionFlag {
+		chatMessage.Flagged = true
+		if db, dbErr := getModerationDB(); dbErr == 0 {
+			if err := putJSON(db, flaggedMessagePrefix(room)+chatMessage.ID, map[string]interface{}{
+				"message": chatMessage,
+				"domains": domains,
+			}); err != nil {
+				logError("screenChatLinks", room, "failed to record flagged message %s: %v", chatMessage.ID, err)
+			}
+		}
+		return true
+	}
+	publishRoomEvent(room, "acks", "chatRejected", map[string]interface{}{
+		"messageId": chatMessage.ID,
+		"userId":    chatMessage.UserID,
+		"reason":    "disallowed link",
+		"domains":   domains,
+	})
+	return false
+}
+
+//export getFlaggedMessages
+func getFlaggedMessages(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	db, dbErr := getModerationDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	keys, _ := db.List(flaggedMessagePrefix(room))
+	sort.Strings(keys)
+	flagged := make([]json.RawMessage, 0, len(keys))
+	for _, key := range keys {
+		if data, err := db.Get(key); err == nil && json.Valid(data) {
+			flagged = append(flagged, data)
+		}
+	}
+	return sendJSONResponse(h, flagged)
+}
@@ -0,0 +1,184 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+// Rooms without a locale use English word lists and templates
+const defaultLocale = "en"
+
+// Language subtag with an optional region or script, e.g. "fr", "pt-BR", "zh-Hant"
+var localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z]{2,4})?$`)
+
+// System message templates by language, formatted with fmt.Sprintf
+var systemMessageTemplates = map[string]map[string]string{
+	"en": {
+		"maintenance":     defaultMaintenanceMessage,
+		"appealRejected":  "your appeal against the %s was rejected",
+		"streakMilestone": "%d-day placement streak",
+	},
+	"fr": {
+		"maintenance":     "Pixollab est en maintenance, les écritures sont temporairement désactivées",
+		"appealRejected":  "votre appel contre la sanction (%s) a été rejeté",
+		"streakMilestone": "série de %d jours de placement",
+	},
+	"es": {
+		"maintenance":     "Pixollab está en mantenimiento, las escrituras están desactivadas temporalmente",
+		"appealRejected":  "tu apelación contra la sanción (%s) fue rechazada",
+		"streakMilestone": "racha de %d días colocando píxeles",
+	},
+	"de": {
+		"maintenance":     "Pixollab wird gewartet, Schreibzugriffe sind vorübergehend deaktiviert",
+		"appealRejected":  "dein Einspruch gegen die Sanktion (%s) wurde abgelehnt",
+		"streakMilestone": "%d-Tage-Platzierungsserie",
+	},
+}
+
+func isValidLocale(locale string) bool {
+	return localePattern.MatchString(locale)
+}
+
+func roomLocale(room string) string {
+	if locale := loadRoomSettings(room).Locale; locale != "" {
+		return locale
+	}
+	return defaultLocale
+}
+
+// Language part of a locale: "pt-BR" -> "pt"
+func localeLanguage(locale string) string {
+	language, _, _ := strings.Cut(locale, "-")
+	return strings.ToLower(language)
+}
+
+// Render a system message in the room's language, falling back to English
+func localizedMessage(room, key string, args ...interface{}) string {
+	template, ok := systemMessageTemplates[localeLanguage(roomLocale(room))][key]
+	if !ok {
+		template = systemMessageTemplates[defaultLocale][key]
+	}
+	if len(args) == 0 {
+		return template
+	}
+	return fmt.Sprintf(template, args...)
+}
+
+func wordListKey(language string) string {
+	return fmt.Sprintf(globalKeyPrefix+"wordlists/%s", language)
+}
+
+// A room's own word list, replacing the list of its language
+func roomWordListKey(room string) string {
+	return fmt.Sprintf(globalKeyPrefix+"wordlists/rooms/%s", room)
+}
+
+func loadWordList(language string) []string {
+	words, _ := loadWordListKey(wordListKey(language))
+	return words
+}
+
+func loadWordListKey(key string) ([]string, bool) {
+	words := make([]string, 0)
+	db, dbErr := getConfigDB()
+	if dbErr != 0 {
+		return words, false
+	}
+	data, err := db.Get(key)
+	if err != nil || len(data) == 0 {
+		return words, false
+	}
+	if err := json.Unmarshal(data, &words); err != nil {
+		logError("loadWordList", "", "failed to unmarshal list %s: %v", key, err)
+		return words, false
+	}
+	return words, true
+}
+
+// Profanity list for the room's language, or the English list when it has none
+func roomWordList(room string) []string {
+	if words, ok := loadWordListKey(roomWordListKey(room)); ok {
+		return words
+	}
+	language := localeLanguage(roomLocale(room))
+	if words := loadWordList(language); len(words) > 0 || language == defaultLocale {
+		return words
+	}
+	return loadWordList(defaultLocale)
+}
+
+// Replace listed words (whole words, case-insensitive) with asterisks
+func maskProfanity(text string, words []string) string {
+	if len(words) == 0 {
+		return text
+	}
+	blocked := make(map[string]bool, len(words))
+	for _, word := range words {
+		blocked[strings.ToLower(word)] = true
+	}
+	runes := []rune(text)
+	for start := 0; start < len(runes); {
+		if !unicode.IsLetter(runes[start]) && !unicode.IsDigit(runes[start]) {
+			start++
+			continue
+		}
+		end := start
+		for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end])) {
+			end++
+		}
+		if blocked[strings.ToLower(string(runes[start:end]))] {
+			for i := start; i < end; i++ {
+				runes[i] = '*'
+			}
+		}
+		start = end
+	}
+	return string(runes)
+}
+
+//export setWordList
+func setWordList(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	var words []string
+	if err := readJSONBody(h, &words); err != nil {
+		return handleHTTPError(h, err, 400)
+	}
+	db, dbErr := getConfigDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	// With a room the list applies to that room only, whatever its language
+	if room, _ := h.Query().Get("room"); room != "" {
+		if code := requireRoom(h, room); code != 0 {
+			return code
+		}
+		if err := putJSON(db, roomWordListKey(room), words); err != nil {
+			return handleHTTPError(h, err, 500)
+		}
+		return sendJSONResponse(h, map[string]interface{}{"room": room, "words": len(words)})
+	}
+	language, err := h.Query().Get("lang")
+	if err != nil || !isValidLocale(language) {
+		return handleHTTPError(h, fmt.Errorf("lang parameter must be a language code like 'en'"), 400)
+	}
+	language = localeLanguage(language)
+	if err := putJSON(db, wordListKey(language), words); err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	return sendJSONResponse(h, map[string]interface{}{"lang": language, "words": len(words)})
+}
@@ -0,0 +1,136 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/taubyte/go-sdk/database"
+	"github.com/taubyte/go-sdk/event"
+)
+
+// Log levels, from most to least verbose
+const (
+	LogDebug = iota
+	LogInfo
+	LogError
+)
+
+var logLevelNames = map[int]string{LogDebug: "DEBUG", LogInfo: "INFO", LogError: "ERROR"}
+
+// How often an instance re-reads the level set through setLogLevel
+const logLevelRefresh = 30 * time.Second
+
+var (
+	logMutex       sync.Mutex
+	logLevel       = LogInfo
+	logLevelLoaded time.Time
+)
+
+func parseLogLevel(name string) (int, bool) {
+	for level, levelName := range logLevelNames {
+		if strings.EqualFold(name, levelName) {
+			return level, true
+		}
+	}
+	return LogInfo, false
+}
+
+// Read the configured level straight from the config database. The pooled
+// getters log, so going through them here could recurse.
+func storedLogLevel() (int, bool) {
+	db, err := database.New("/config")
+	if err != nil {
+		return LogInfo, false
+	}
+	data, err := db.Get(globalConfigKey)
+	if err != nil || len(data) == 0 {
+		return LogInfo, false
+	}
+	var config struct {
+		LogLevel string `json:"logLevel"`
+	}
+	if json.Unmarshal(data, &config) != nil || config.LogLevel == "" {
+		return LogInfo, false
+	}
+	return parseLogLevel(config.LogLevel)
+}
+
+func currentLogLevel() int {
+	logMutex.Lock()
+	refresh := time.Since(logLevelLoaded) >= logLevelRefresh
+	if refresh {
+		logLevelLoaded = time.Now()
+	}
+	level := logLevel
+	logMutex.Unlock()
+	if refresh {
+		if stored, ok := storedLogLevel(); ok {
+			logMutex.Lock()
+			logLevel = stored
+			logMutex.Unlock()
+			level = stored
+		}
+	}
+	return level
+}
+
+// Write one key=value log line if the level is enabled
+func logAt(level int, handler, room, format string, args ...interface{}) {
+	if level < currentLogLevel() {
+		return
+	}
+	var line strings.Builder
+	fmt.Fprintf(&line, "level=%s handler=%s", logLevelNames[level], handler)
+	if room != "" {
+		fmt.Fprintf(&line, " room=%q", room)
+	}
+	fmt.Fprintf(&line, " msg=%q\n", fmt.Sprintf(format, args...))
+	fmt.Print(line.String())
+}
+
+func logDebug(handler, room, format string, args ...interface{}) {
+	logAt(LogDebug, handler, room, format, args...)
+}
+
+func logInfo(handler, room, format string, args ...interface{}) {
+	logAt(LogInfo, handler, room, format, args...)
+}
+
+func logError(handler, room, format string, args ...interface{}) {
+	logAt(LogError, handler, room, format, args...)
+}
+
+//export setLogLevel
+func setLogLevel(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	name, _ := h.Query().Get("level")
+	level, ok := parseLogLevel(name)
+	if !ok {
+		return handleHTTPError(h, fmt.Errorf("level must be debug, info or error"), 400)
+	}
+	// Stored in the config so every instance picks it up on its next refresh
+	config := loadGlobalConfig()
+	config.LogLevel = logLevelNames[level]
+	if saveGlobalConfig(config) != 0 {
+		return handleHTTPError(h, fmt.Errorf("failed to save config"), 500)
+	}
+	logMutex.Lock()
+	logLevel = level
+	logLevelLoaded = time.Now()
+	logMutex.Unlock()
+	logInfo("setLogLevel", "", "log level set to %s", config.LogLevel)
+	return sendJSONResponse(h, map[string]string{"level": config.LogLevel})
+}
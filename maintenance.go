@@ -0,0 +1,104 @@
+package lib
+
+import (
+	"encoding/json"
+	"sync"
+
+	http "github.com/taubyte/go-sdk/http/event"
+)
+
+const defaultMaintenanceMessage = "Pixollab is undergoing maintenance, writes are temporarily disabled"
+
+// Maintenance banner for the room; global maintenance takes precedence over the room flag
+func maintenanceStatus(room string) (string, bool) {
+	if config := loadGlobalConfig(); config.Maintenance {
+		if config.MaintenanceMessage != "" {
+			return config.MaintenanceMessage, true
+		}
+		return defaultMaintenanceMessage, true
+	}
+	if settings := loadRoomSettings(room); settings.Maintenance {
+		if settings.MaintenanceMessage != "" {
+			return settings.MaintenanceMessage, true
+		}
+		return localizedMessage(room, "maintenance"), true
+	}
+	return "", false
+}
+
+// Reject a write request with 503 while maintenance is active
+func rejectDuringMaintenance(h http.Event, room string) uint32 {
+	message, active := maintenanceStatus(room)
+	if !active {
+		return 0
+	}
+	logDebug("rejectDuringMaintenance", room, "rejecting write during maintenance")
+	body, _ := json.Marshal(map[string]string{"error": "maintenance", "message": message})
+	h.Headers().Set("Content-Type", "application/json")
+	h.Headers().Set("Retry-After", "60")
+	h.Write(body)
+	h.Return(503)
+	return 1
+}
+
+// Fields setMaintenanceBanner queued for the request's JSON response
+var (
+	responseNotices = make(map[http.Event]map[string]interface{})
+	noticesMutex    sync.Mutex
+)
+
+// Attach the maintenance banner, and the degraded flag, to read responses: as
+// headers, and as maintenanceBanner and degraded fields of JSON object bodies
+func setMaintenanceBanner(h http.Event, room string) {
+	notice := make(map[string]interface{})
+	if message, active := maintenanceStatus(room); active {
+		h.Headers().Set("X-Maintenance-Banner", message)
+		notice["maintenanceBanner"] = message
+	}
+	if isDegradedRoom(room) {
+		h.Headers().Set("X-Degraded", "true")
+		notice["degraded"] = true
+	}
+	noticesMutex.Lock()
+	defer noticesMutex.Unlock()
+	if len(notice) == 0 {
+		delete(responseNotices, h)
+		return
+	}
+	responseNotices[h] = notice
+}
+
+// Remove and return the fields queued for the request's response
+func takeResponseNotice(h http.Event) map[string]interface{} {
+	noticesMutex.Lock()
+	defer noticesMutex.Unlock()
+	notice := responseNotices[h]
+	delete(responseNotices, h)
+	return notice
+}
+
+// Merge queued notice fields into a JSON object body; other bodies, such as
+// arrays, keep their shape and only carry the headers
+func withResponseNotice(h http.Event, body []byte) []byte {
+	notice := takeResponseNotice(h)
+	if len(notice) == 0 || len(body) == 0 || body[0] != '{' {
+		return body
+	}
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) != nil {
+		return body
+	}
+	for name, value := range notice {
+		if _, taken := fields[name]; taken {
+			continue
+		}
+		if encoded, err := json.Marshal(value); err == nil {
+			fields[name] = encoded
+		}
+	}
+	merged, err := json.Marshal(fields)
+	if err != nil {
+		return body
+	}
+	return merged
+}
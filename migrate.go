@@ -0,0 +1,176 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+func migrationStatusKey(room string) string {
+	return fmt.Sprintf("/%s/migration", room)
+}
+
+func saveMigrationStatus(status *MigrationStatus) {
+	status.UpdatedAt = time.Now().UnixMilli()
+	db, dbErr := getSchemaDB()
+	if dbErr != 0 {
+		return
+	}
+	if err := putJSON(db, migrationStatusKey(status.Room), status); err != nil {
+		logError("saveMigrationStatus", status.Room, "failed: %v", err)
+	}
+}
+
+func loadMigrationStatus(room string) (MigrationStatus, bool) {
+	var status MigrationStatus
+	db, dbErr := getSchemaDB()
+	if dbErr != 0 {
+		return status, false
+	}
+	data, err := db.Get(migrationStatusKey(room))
+	if err != nil || len(data) == 0 {
+		return status, false
+	}
+	return status, json.Unmarshal(data, &status) == nil
+}
+
+func failMigration(status *MigrationStatus, err error) error {
+	status.State = "failed"
+	status.Error = err.Error()
+	saveMigrationStatus(status)
+	return err
+}
+
+// Fold legacy per-pixel keys into chunk blobs, verify them, then switch the room layout
+// and remove the legacy keys. Progress is persisted after every step. Pixel writes
+// wait on the room's write lock for the whole copy-and-flip, so none land in
+// legacy keys after they were read.
+func migrateRoomToChunks(room string) (MigrationStatus, error) {
+	lock := roomWriteLock(room)
+	lock.Lock()
+	defer lock.Unlock()
+	status := MigrationStatus{Room: room, To: LayoutChunked, State: "running"}
+	if isChunkedRoom(room) {
+		// Another migration finished while this one waited for the lock
+		if previous, ok := loadMigrationStatus(room); ok {
+			return previous, nil
+		}
+		status.State = "completed"
+		return status, nil
+	}
+	saveMigrationStatus(&status)
+
+	pixels, dbErr := loadLegacyPixels(room)
+	if dbErr != 0 {
+		return status, failMigration(&status, fmt.Errorf("failed to load legacy pixels"))
+	}
+	status.Pixels = len(pixels)
+
+	chunks := make(map[[2]int]CanvasChunk)
+	for _, pixel := range pixels {
+		id := [2]int{pixel.X / chunkSize, pixel.Y / chunkSize}
+		chunk, ok := chunks[id]
+		if !ok {
+			chunk = newCanvasChunk()
+			chunks[id] = chunk
+		}
+		stored := pixel
+		chunk.Cells[chunkCellIndex(pixel.X, pixel.Y)] = &stored
+	}
+	status.TotalChunks = len(chunks)
+	saveMigrationStatus(&status)
+
+	chunksDB, dbErr := getChunksDB()
+	if dbErr != 0 {
+		return status, failMigration(&status, fmt.Errorf("chunks database connection failed"))
+	}
+	for id, chunk := range chunks {
+		if err := putJSON(chunksDB, chunkKey(room, id[0], id[1]), chunk); err != nil {
+			return status, failMigration(&status, fmt.Errorf("failed to write chunk %d:%d: %v", id[0], id[1], err))
+		}
+		status.ChunksWritten++
+	}
+	saveMigrationStatus(&status)
+
+	// Read every chunk back and compare colors before touching the legacy keys
+	for id, expected := range chunks {
+		stored, ok := loadChunk(chunksDB, room, id[0], id[1])
+		if !ok {
+			return status, failMigration(&status, fmt.Errorf("chunk %d:%d missing after write", id[0], id[1]))
+		}
+		for i, cell := range expected.Cells {
+			if (cell == nil) != (stored.Cells[i] == nil) || (cell != nil && cell.Color != stored.Cells[i].Color) {
+				return status, failMigration(&status, fmt.Errorf("chunk %d:%d cell %d does not match legacy data", id[0], id[1], i))
+			}
+		}
+		status.ChunksVerified++
+	}
+	saveMigrationStatus(&status)
+
+	if setRoomLayout(room, LayoutChunked) != 0 {
+		return status, failMigration(&status, fmt.Errorf("failed to switch room layout"))
+	}
+
+	canvasDB, dbErr := getCanvasDB()
+	if dbErr == 0 {
+		for _, pixel := range pixels {
+			if canvasDB.Delete(fmt.Sprintf("/%s/%d:%d", room, pixel.X, pixel.Y)) == nil {
+				status.LegacyKeysDeleted++
+			}
+		}
+	}
+	status.State = "completed"
+	saveMigrationStatus(&status)
+	return status, nil
+}
+
+// Schema migration that moves every room onto chunk storage; new rooms start
+// chunked and legacy rooms have their per-pixel keys folded in once
+func migrateLegacyLayout(room string) error {
+	if isChunkedRoom(room) {
+		return nil
+	}
+	_, err := migrateRoomToChunks(room)
+	return err
+}
+
+//export migrateRoom
+func migrateRoom(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	to, err := h.Query().Get("to")
+	if err != nil || to != LayoutChunked {
+		return handleHTTPError(h, fmt.Errorf("to parameter must be '%s'", LayoutChunked), 400)
+	}
+	if isChunkedRoom(room) {
+		return handleHTTPError(h, fmt.Errorf("room %s already uses the %s layout", room, LayoutChunked), 409)
+	}
+	status, err := migrateRoomToChunks(room)
+	if err != nil {
+		logError("migrateRoom", room, "failed: %v", err)
+		h.Headers().Set("Content-Type", "application/json")
+		data, _ := json.Marshal(status)
+		h.Write(data)
+		h.Return(500)
+		return 1
+	}
+	return sendJSONResponse(h, status)
+}
@@ -0,0 +1,164 @@
+package lib
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/taubyte/go-sdk/database"
+)
+
+func putLegacyPixel(t *testing.T, room string, pixel Pixel) {
+	t.Helper()
+	db, dbErr := getCanvasDB()
+	if dbErr != 0 {
+		t.Fatal("getCanvasDB failed")
+	}
+	if err := putJSON(db, fmt.Sprintf("/%s/%d:%d", room, pixel.X, pixel.Y), pixel); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func sortPixels(pixels []Pixel) {
+	sort.Slice(pixels, func(i, j int) bool {
+		if pixels[i].Y != pixels[j].Y {
+			return pixels[i].Y < pixels[j].Y
+		}
+		return pixels[i].X < pixels[j].X
+	})
+}
+
+func TestMigrateRoomToChunks(t *testing.T) {
+	stores := mockDatabases(t)
+	saveRoomMetadata(RoomMetadata{Room: "legacy", Width: 40, Height: 20, Visibility: VisibilityPublic})
+	pixels := []Pixel{
+		{X: 0, Y: 0, Color: "#ff0000", UserID: "user-1", Username: "alice", Timestamp: 1},
+		{X: 15, Y: 15, Color: "#00ff00", UserID: "user-2", Username: "bob", Timestamp: 2},
+		{X: 16, Y: 0, Color: "#0000ff", UserID: "user-1", Username: "alice", Timestamp: 3},
+		{X: 39, Y: 19, Color: "#123456", UserID: "user-2", Username: "bob", Timestamp: 4},
+	}
+	for _, pixel := range pixels {
+		putLegacyPixel(t, "legacy", pixel)
+	}
+	// Outside the room bounds, so neither migrated nor deleted
+	putLegacyPixel(t, "legacy", Pixel{X: 50, Y: 0, Color: "#ffffff"})
+
+	status, err := migrateRoomToChunks("legacy")
+	if err != nil {
+		t.Fatalf("migrateRoomToChunks: %v", err)
+	}
+	if status.State != "completed" || status.Pixels != 4 || status.TotalChunks != 3 ||
+		status.ChunksWritten != 3 || status.ChunksVerified != 3 || status.LegacyKeysDeleted != 4 {
+		t.Errorf("got status %+v", status)
+	}
+	if saved, ok := loadMigrationStatus("legacy"); !ok || saved.State != "completed" {
+		t.Errorf("saved status %+v", saved)
+	}
+	if !isChunkedRoom("legacy") {
+		t.Error("room layout not switched")
+	}
+
+	if keys := stores["/canvas"]; len(keys) != 1 {
+		t.Errorf("legacy keys left: %v", keys)
+	}
+	if _, ok := stores["/canvas-chunks"][chunkKey("legacy", 1, 0)]; !ok {
+		t.Error("chunk 1:0 not written")
+	}
+
+	migrated, dbErr := loadRoomPixels("legacy")
+	if dbErr != 0 {
+		t.Fatal("loadRoomPixels failed")
+	}
+	sortPixels(migrated)
+	sortPixels(pixels)
+	if len(migrated) != len(pixels) {
+		t.Fatalf("got %d pixels, want %d", len(migrated), len(pixels))
+	}
+	for i := range pixels {
+		if migrated[i] != pixels[i] {
+			t.Errorf("pixel %d: got %+v, want %+v", i, migrated[i], pixels[i])
+		}
+	}
+}
+
+func TestMigrateLegacyLayoutSkipsChunkedRooms(t *testing.T) {
+	stores := mockDatabases(t)
+	saveRoomMetadata(RoomMetadata{Room: "chunked", Width: 10, Height: 10, Visibility: VisibilityPublic})
+	setRoomLayout("chunked", LayoutChunked)
+	putLegacyPixel(t, "chunked", Pixel{X: 1, Y: 1, Color: "#ff0000"})
+
+	if err := migrateLegacyLayout("chunked"); err != nil {
+		t.Fatalf("migrateLegacyLayout: %v", err)
+	}
+	if _, ok := loadMigrationStatus("chunked"); ok {
+		t.Error("migration ran on a chunked room")
+	}
+	if len(stores["/canvas"]) != 1 {
+		t.Error("legacy keys of a chunked room were touched")
+	}
+}
+
+func TestMigrateEmptyLegacyRoom(t *testing.T) {
+	mockDatabases(t)
+	saveRoomMetadata(RoomMetadata{Room: "empty", Width: 10, Height: 10, Visibility: VisibilityPublic})
+	if err := migrateLegacyLayout("empty"); err != nil {
+		t.Fatalf("migrateLegacyLayout: %v", err)
+	}
+	if !isChunkedRoom("empty") {
+		t.Error("empty room not switched to the chunked layout")
+	}
+}
+
+func TestLegacyRoomMetadataBackfill(t *testing.T) {
+	mockDatabases(t)
+	if saveRoomSchemaVersion("old", 5) != 0 {
+		t.Fatal("saveRoomSchemaVersion failed")
+	}
+	if !roomExists("old") {
+		t.Fatal("room with a schema record not found")
+	}
+	if _, found := loadRoomMetadata("old"); found {
+		t.Fatal("roomExists wrote metadata")
+	}
+	if ensureRoomSchema("old") != 0 {
+		t.Fatal("ensureRoomSchema failed")
+	}
+	metadata, found := loadRoomMetadata("old")
+	if !found || metadata.Width != CanvasWidth || metadata.Visibility != VisibilityPublic {
+		t.Errorf("got metadata %+v, found %v", metadata, found)
+	}
+	if roomExists("never-created") {
+		t.Error("unknown room reported as existing")
+	}
+}
+
+func TestMigrateGlobalKeys(t *testing.T) {
+	stores := mockDatabases(t)
+	// Written straight to the store, as a deployment from before the namespace left them
+	db, err := database.New("/config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Put("/global", []byte(`{"maintenance":true}`))
+	db.Put("/palettes/deuteranopia", []byte(`{}`))
+	db.Put("/global-room/settings", []byte("room data"))
+
+	if !loadGlobalConfig().Maintenance {
+		t.Error("global config not found after the move")
+	}
+	config := stores["/config"]
+	for _, key := range []string{"/global", "/palettes/deuteranopia"} {
+		if _, ok := config[key]; ok {
+			t.Errorf("legacy key %s left behind", key)
+		}
+	}
+	if _, ok := config[colorRemapPrefix+"deuteranopia"]; !ok {
+		t.Error("palette not moved under the namespace")
+	}
+	if _, ok := config["/global-room/settings"]; !ok {
+		t.Error("room key moved")
+	}
+	if _, ok := config[globalNamespaceMarker]; !ok {
+		t.Error("database not marked as migrated")
+	}
+}
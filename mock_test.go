@@ -0,0 +1,134 @@
+package lib
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"unsafe"
+
+	databaseSym "github.com/taubyte/go-sdk-symbols/database"
+	"github.com/taubyte/go-sdk/database"
+	"github.com/taubyte/go-sdk/errno"
+	"github.com/taubyte/go-sdk/utils/codec"
+)
+
+// In-memory stand-in for the node's databases, keyed by database path then key
+type fakeDatabases map[string]map[string][]byte
+
+// Route every database call to fresh in-memory stores and drop the pooled
+// connections and per-room caches left by earlier tests
+func mockDatabases(t *testing.T) fakeDatabases {
+	t.Helper()
+	stores := make(fakeDatabases)
+	var paths []string
+	store := func(id uint32) (map[string][]byte, bool) {
+		if id == 0 || int(id) > len(paths) {
+			return nil, false
+		}
+		return stores[paths[id-1]], true
+	}
+	listKeys := func(id uint32, prefix string) ([]byte, errno.Error) {
+		data, ok := store(id)
+		if !ok {
+			return nil, errno.ErrorDatabaseNotFound
+		}
+		keys := make([]string, 0)
+		for key := range data {
+			if strings.HasPrefix(key, prefix) {
+				keys = append(keys, key)
+			}
+		}
+		// The node reports no keys as a zero size rather than an encoded empty list
+		if len(keys) == 0 {
+			return nil, 0
+		}
+		sort.Strings(keys)
+		var encoded []byte
+		if err := codec.Convert(keys).To(&encoded); err != nil {
+			return nil, errno.ErrorByteConversionFailed
+		}
+		return encoded, 0
+	}
+
+	databaseSym.NewDatabase = func(name string, databaseId *uint32) errno.Error {
+		for i, path := range paths {
+			if path == name {
+				*databaseId = uint32(i + 1)
+				return 0
+			}
+		}
+		paths = append(paths, name)
+		stores[name] = make(map[string][]byte)
+		*databaseId = uint32(len(paths))
+		return 0
+	}
+	databaseSym.DatabaseGetSize = func(databaseId uint32, key string, size *uint32) errno.Error {
+		data, ok := store(databaseId)
+		if !ok {
+			return errno.ErrorDatabaseNotFound
+		}
+		value, found := data[key]
+		if !found {
+			return errno.ErrorDatabaseKeyNotFound
+		}
+		*size = uint32(len(value))
+		return 0
+	}
+	databaseSym.DatabaseGet = func(databaseId uint32, key string, buf *byte) errno.Error {
+		data, ok := store(databaseId)
+		if !ok {
+			return errno.ErrorDatabaseNotFound
+		}
+		value := data[key]
+		copy(unsafe.Slice(buf, len(value)), value)
+		return 0
+	}
+	databaseSym.DatabasePut = func(databaseId uint32, key string, buf *byte, size uint32) errno.Error {
+		data, ok := store(databaseId)
+		if !ok {
+			return errno.ErrorDatabaseNotFound
+		}
+		value := make([]byte, size)
+		if size > 0 {
+			copy(value, unsafe.Slice(buf, size))
+		}
+		data[key] = value
+		return 0
+	}
+	databaseSym.DatabaseDelete = func(databaseId uint32, key string) errno.Error {
+		data, ok := store(databaseId)
+		if !ok {
+			return errno.ErrorDatabaseNotFound
+		}
+		delete(data, key)
+		return 0
+	}
+	databaseSym.DatabaseListSize = func(databaseId uint32, prefix string, size *uint32) errno.Error {
+		encoded, err := listKeys(databaseId, prefix)
+		if err != 0 {
+			return err
+		}
+		*size = uint32(len(encoded))
+		return 0
+	}
+	databaseSym.DatabaseList = func(databaseId uint32, prefix string, buf *byte) errno.Error {
+		encoded, err := listKeys(databaseId, prefix)
+		if err != 0 {
+			return err
+		}
+		copy(unsafe.Slice(buf, len(encoded)), encoded)
+		return 0
+	}
+	databaseSym.DatabaseClose = func(databaseId uint32) errno.Error {
+		return 0
+	}
+
+	dbMutex.Lock()
+	dbInit = false
+	pooledDBs = make(map[string]database.Database)
+	dbMutex.Unlock()
+	migrationMutex.Lock()
+	migratedRooms = make(map[string]bool)
+	migrationMutex.Unlock()
+	return stores
+}
@@ -0,0 +1,523 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/taubyte/go-sdk/database"
+	"github.com/taubyte/go-sdk/event"
+	http "github.com/taubyte/go-sdk/http/event"
+)
+
+func warningPrefix(room, userID string) string {
+	return fmt.Sprintf("/%s/warnings/%s/", room, userID)
+}
+
+func warningSeqKey(room string) string {
+	return fmt.Sprintf("/%s/warnings-seq", room)
+}
+
+func sanctionKey(room, userID, kind string) string {
+	return fmt.Sprintf("/%s/sanctions/%s/%s", room, userID, kind)
+}
+
+func loadWarnings(room, userID string) []Warning {
+	warnings := make([]Warning, 0)
+	db, dbErr := getModerationDB()
+	if dbErr != 0 {
+		return warnings
+	}
+	keys, _ := db.List(warningPrefix(room, userID))
+	sort.Strings(keys)
+	for _, key := range keys {
+		data, err := db.Get(key)
+		if err != nil {
+			continue
+		}
+		var warning Warning
+		if json.Unmarshal(data, &warning) == nil {
+			warnings = append(warnings, warning)
+		}
+	}
+	return warnings
+}
+
+func loadSanction(room, userID, kind string) (Sanction, bool) {
+	var sanction Sanction
+	db, dbErr := getModerationDB()
+	if dbErr != 0 {
+		return sanction, false
+	}
+	data, err := db.Get(sanctionKey(room, userID, kind))
+	if err != nil || len(data) == 0 {
+		return sanction, false
+	}
+	if json.Unmarshal(data, &sanction) != nil {
+		return sanction, false
+	}
+	// Expired sanctions are lifted the first time they are looked up
+	if sanction.ExpiresAt > 0 && time.Now().UnixMilli() >= sanction.ExpiresAt {
+		removeSanction(room, userID, kind, "expired")
+		return sanction, false
+	}
+	return sanction, true
+}
+
+// Sanction end time for a duration in minutes; zero means permanent
+func sanctionExpiry(minutes int) int64 {
+	if minutes <= 0 {
+		return 0
+	}
+	return time.Now().Add(time.Duration(minutes) * time.Minute).UnixMilli()
+}
+
+func isBanned(room, userID string) bool {
+	_, banned := loadSanction(room, userID, SanctionBan)
+	return banned
+}
+
+// Muted users cannot chat; banned users are muted too
+func isMuted(room, userID string) bool {
+	if _, muted := loadSanction(room, userID, SanctionMute); muted {
+		return true
+	}
+	return isBanned(room, userID)
+}
+
+// Record a sanction, tell the user and announce it in the room
+func applySanction(room string, sanction Sanction) uint32 {
+	db, dbErr := getModerationDB()
+	if dbErr != 0 {
+		return dbErr
+	}
+	sanction.CreatedAt = time.Now().UnixMilli()
+	if err := putJSON(db, sanctionKey(room, sanction.UserID, sanction.Kind), sanction); err != nil {
+		logError("applySanction", room, "failed to save %s for user %s: %v", sanction.Kind, sanction.UserID, err)
+		return 1
+	}
+	notifyUser(sanction.UserID, Notification{
+		Type:    sanction.Kind,
+		Room:    room,
+		Message: sanction.Reason,
+		Data:    sanction,
+	})
+	eventType := "userMuted"
+	if sanction.Kind == SanctionBan {
+		eventType = "userBanned"
+	}
+	publishRoomEvent(room, "events", eventType, map[string]string{"userId": sanction.UserID})
+	return 0
+}
+
+// Lift a sanction, tell the user and announce it in the room
+func removeSanction(room, userID, kind, reason string) uint32 {
+	db, dbErr := getModerationDB()
+	if dbErr != 0 {
+		return dbErr
+	}
+	if err := db.Delete(sanctionKey(room, userID, kind)); err != nil {
+		logError("removeSanction", "", "failed to delete %s for user %s: %v", kind, userID, err)
+		return 1
+	}
+	notifyUser(userID, Notification{
+		Type:    "sanctionLifted",
+		Room:    room,
+		Message: reason,
+		Data:    map[string]string{"kind": kind},
+	})
+	eventType := "userUnmuted"
+	if kind == SanctionBan {
+		eventType = "userUnbanned"
+	}
+	publishRoomEvent(room, "events", eventType, map[string]string{"userId": userID})
+	return 0
+}
+
+// Pick the sanction a warning count escalates to, if it is not already in place
+func warningEscalation(room, userID string, warnings int) string {
+	thresholds := loadRoomSettings(room).Moderation
+	if thresholds.BanAfterWarnings > 0 && warnings >= thresholds.BanAfterWarnings {
+		if !isBanned(room, userID) {
+			return SanctionBan
+		}
+		return ""
+	}
+	if thresholds.MuteAfterWarnings > 0 && warnings >= thresholds.MuteAfterWarnings {
+		if _, muted := loadSanction(room, userID, SanctionMute); !muted {
+			return SanctionMute
+		}
+	}
+	return ""
+}
+
+//export warnUser
+func warnUser(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	userID, err := h.Query().Get("userId")
+	if err != nil || userID == "" {
+		return handleHTTPError(h, fmt.Errorf("userId parameter required"), 400)
+	}
+	reason, err := h.Query().Get("reason")
+	if err != nil || reason == "" {
+		return handleHTTPError(h, fmt.Errorf("reason parameter required"), 400)
+	}
+	moderator, _ := h.Query().Get("moderator")
+
+	db, dbErr := getModerationDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	warning := Warning{
+		Seq:       readCounter(db, warningSeqKey(room)) + 1,
+		UserID:    userID,
+		Reason:    reason,
+		Moderator: moderator,
+		CreatedAt: time.Now().UnixMilli(),
+	}
+	if err := writeCounter(db, warningSeqKey(room), warning.Seq); err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	if err := putJSON(db, fmt.Sprintf("%s%012d", warningPrefix(room, userID), warning.Seq), warning); err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	notifyUser(userID, Notification{
+		Type:    "warning",
+		Room:    room,
+		Message: reason,
+		Data:    warning,
+	})
+
+	count := len(loadWarnings(room, userID))
+	escalation := warningEscalation(room, userID, count)
+	if escalation != "" {
+		thresholds := loadRoomSettings(room).Moderation
+		duration := thresholds.MuteDurationMinutes
+		if escalation == SanctionBan {
+			duration = thresholds.BanDurationMinutes
+		}
+		sanction := Sanction{
+			UserID:    userID,
+			Kind:      escalation,
+			Reason:    fmt.Sprintf("automatic %s after %d warnings", escalation, count),
+			Moderator: moderator,
+			ExpiresAt: sanctionExpiry(duration),
+		}
+		if applySanction(room, sanction) != 0 {
+			return handleHTTPError(h, fmt.Errorf("failed to apply %s", escalation), 500)
+		}
+	}
+	return sendJSONResponse(h, map[string]interface{}{
+		"warning":    warning,
+		"warnings":   count,
+		"escalation": escalation,
+	})
+}
+
+//export getWarnings
+func getWarnings(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	userID, err := h.Query().Get("userId")
+	if err != nil || userID == "" {
+		return handleHTTPError(h, fmt.Errorf("userId parameter required"), 400)
+	}
+	sanctions := make([]Sanction, 0, 2)
+	for _, kind := range []string{SanctionMute, SanctionBan} {
+		if sanction, ok := loadSanction(room, userID, kind); ok {
+			sanctions = append(sanctions, sanction)
+		}
+	}
+	return sendJSONResponse(h, map[string]interface{}{
+		"warnings":  loadWarnings(room, userID),
+		"sanctions": sanctions,
+	})
+}
+
+// Read the userId and kind parameters shared by the sanction endpoints
+func getSanctionParams(h http.Event) (string, string, error) {
+	userID, err := h.Query().Get("userId")
+	if err != nil || userID == "" {
+		return "", "", fmt.Errorf("userId parameter required")
+	}
+	kind, err := h.Query().Get("kind")
+	if err != nil || (kind != SanctionMute && kind != SanctionBan) {
+		return "", "", fmt.Errorf("kind must be '%s' or '%s'", SanctionMute, SanctionBan)
+	}
+	return userID, kind, nil
+}
+
+//export sanctionUser
+func sanctionUser(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	userID, kind, err := getSanctionParams(h)
+	if err != nil {
+		return handleHTTPError(h, err, 400)
+	}
+	return issueSanction(h, room, userID, kind)
+}
+
+//export banUser
+func banUser(e event.Event) uint32 {
+	return sanctionShortcut(e, SanctionBan)
+}
+
+//export muteUser
+func muteUser(e event.Event) uint32 {
+	return sanctionShortcut(e, SanctionMute)
+}
+
+// banUser and muteUser are sanctionUser with the kind fixed
+func sanctionShortcut(e event.Event, kind string) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	userID, err := h.Query().Get("userId")
+	if err != nil || userID == "" {
+		return handleHTTPError(h, fmt.Errorf("userId parameter required"), 400)
+	}
+	return issueSanction(h, room, userID, kind)
+}
+
+// Apply a sanction described by the reason, moderator and durationMinutes parameters
+func issueSanction(h http.Event, room, userID, kind string) uint32 {
+	reason, err := h.Query().Get("reason")
+	if err != nil || reason == "" {
+		return handleHTTPError(h, fmt.Errorf("reason parameter required"), 400)
+	}
+	moderator, _ := h.Query().Get("moderator")
+	sanction := Sanction{
+		UserID:    userID,
+		Kind:      kind,
+		Reason:    reason,
+		Moderator: moderator,
+		ExpiresAt: sanctionExpiry(getIntParam(h, "durationMinutes", 0)),
+	}
+	if applySanction(room, sanction) != 0 {
+		return handleHTTPError(h, fmt.Errorf("failed to apply %s", kind), 500)
+	}
+	sanction, _ = loadSanction(room, userID, kind)
+	return sendJSONResponse(h, sanction)
+}
+
+//export liftSanction
+func liftSanction(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	userID, kind, err := getSanctionParams(h)
+	if err != nil {
+		return handleHTTPError(h, err, 400)
+	}
+	if _, active := loadSanction(room, userID, kind); !active {
+		return handleHTTPError(h, fmt.Errorf("user %s has no active %s", userID, kind), 404)
+	}
+	if removeSanction(room, userID, kind, "lifted by a moderator") != 0 {
+		return handleHTTPError(h, fmt.Errorf("failed to lift %s", kind), 500)
+	}
+	return sendJSONResponse(h, map[string]string{"userId": userID, "kind": kind, "state": "lifted"})
+}
+
+// Find the stored key of a chat message by id, in either key layout
+func findChatMessageKey(db database.Database, room, messageID string) (string, bool) {
+	legacy := fmt.Sprintf("/%s/%s", room, messageID)
+	if data, err := db.Get(legacy); err == nil && len(data) > 0 {
+		return legacy, true
+	}
+	for _, key := range sortedChatKeys(db, room) {
+		if strings.HasSuffix(key, "-"+messageID) {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// Delete a stored message with its sequence index, reactions and translations,
+// and announce the deletion
+func removeChatMessage(db database.Database, room, key string) (ChatMessage, error) {
+	var message ChatMessage
+	data, err := db.Get(key)
+	if err != nil {
+		return message, err
+	}
+	json.Unmarshal(data, &message)
+	if err := db.Delete(key); err != nil {
+		return message, err
+	}
+	if message.Seq > 0 {
+		db.Delete(chatSeqIndexKey(room, message.Seq))
+	}
+	recordStorageUsage(room, NamespaceChat, -1, -int64(len(data)))
+	clearMessageReactions(db, room, message.ID)
+	// Cached translations of the message go with it
+	if translationsDB, dbErr := getTranslationsDB(); dbErr == 0 {
+		keys, _ := translationsDB.List(fmt.Sprintf("/%s/%s/", room, message.ID))
+		for _, translationKey := range keys {
+			translationsDB.Delete(translationKey)
+		}
+	}
+	publishRoomEvent(room, "events", "messageDeleted", map[string]string{"messageId": message.ID, "userId": message.UserID})
+	return message, nil
+}
+
+//export deleteMessage
+func deleteMessage(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	messageID, err := h.Query().Get("messageId")
+	if err != nil || messageID == "" {
+		return handleHTTPError(h, fmt.Errorf("messageId parameter required"), 400)
+	}
+	if ensureRoomSchema(room) != 0 {
+		return handleHTTPError(h, fmt.Errorf("room migration failed"), 500)
+	}
+	db, dbErr := getChatDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	key, found := findChatMessageKey(db, room, messageID)
+	if !found {
+		return handleHTTPError(h, fmt.Errorf("message %s not found", messageID), 404)
+	}
+	if _, err := removeChatMessage(db, room, key); err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	logInfo("deleteMessage", room, "deleted message %s", messageID)
+	return sendJSONResponse(h, map[string]interface{}{"room": room, "messageId": messageID, "deleted": true})
+}
+
+//export erasePixelsByUser
+func erasePixelsByUser(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	userID, err := h.Query().Get("userId")
+	if err != nil || userID == "" {
+		return handleHTTPError(h, fmt.Errorf("userId parameter required"), 400)
+	}
+	if ensureRoomSchema(room) != 0 {
+		return handleHTTPError(h, fmt.Errorf("room migration failed"), 500)
+	}
+	stored, dbErr := loadRoomPixels(room)
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("failed to load canvas"), 500)
+	}
+	// Only cells the user still owns are reset; pixels painted over since stay
+	now := time.Now().UnixMilli()
+	var pixels []Pixel
+	for _, pixel := range stored {
+		if pixel.UserID == userID {
+			pixels = append(pixels, Pixel{X: pixel.X, Y: pixel.Y, Color: "#ffffff", UserID: "system", Username: "system", Timestamp: now})
+		}
+	}
+	if len(pixels) > 0 {
+		audit, code := guardDestructive(h, room, "erasePixelsByUser", fmt.Sprintf("user %s, %d pixels", userID, len(pixels)))
+		if code != 0 {
+			return code
+		}
+		changes, dbErr := savePixels(room, pixels, true)
+		if dbErr != 0 {
+			return failAudited(h, room, audit, fmt.Errorf("failed to erase pixels"), 500)
+		}
+		completeAudit(room, audit, nil)
+		afterPixelsSaved(room, changes)
+		broadcastPixelBatch(PixelBatch{Room: room, UserID: "system", Pixels: pixels}, changes, false)
+		logInfo("erasePixelsByUser", room, "erased %d pixels by user %s", len(changes), userID)
+	}
+	return sendJSONResponse(h, map[string]interface{}{"room": room, "userId": userID, "erased": len(pixels)})
+}
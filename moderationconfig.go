@@ -0,0 +1,148 @@
+package lib
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+// Current ModerationConfig format
+const moderationConfigVersion = 1
+
+// Collect the room's moderation setup into one portable document
+func buildModerationConfig(room string) ModerationConfig {
+	config := ModerationConfig{
+		Version:       moderationConfigVersion,
+		Room:          room,
+		ExportedAt:    time.Now().UnixMilli(),
+		WordList:      roomWordList(room),
+		Rules:         loadRoomSettings(room).Moderation,
+		LockedRegions: make([]LockedRegion, 0),
+	}
+	for _, artwork := range loadArtworks(room) {
+		config.LockedRegions = append(config.LockedRegions, LockedRegion{Title: artwork.Title, Region: artwork.Region})
+	}
+	return config
+}
+
+// Apply a moderation document to the room. Locked regions that fall outside the
+// canvas or overlap a region already locked there are skipped and returned.
+func applyModerationConfig(room string, config ModerationConfig) ([]LockedRegion, error) {
+	if config.Version > moderationConfigVersion {
+		return nil, fmt.Errorf("moderation config version %d is newer than the supported version %d", config.Version, moderationConfigVersion)
+	}
+	settings := loadRoomSettings(room)
+	settings.Moderation = config.Rules
+	if err := validateRoomSettings(settings); err != nil {
+		return nil, err
+	}
+	db, dbErr := getConfigDB()
+	if dbErr != 0 {
+		return nil, fmt.Errorf("database connection failed")
+	}
+	if config.WordList != nil {
+		if err := putJSON(db, roomWordListKey(room), config.WordList); err != nil {
+			return nil, err
+		}
+	}
+	if saveRoomSettings(room, settings) != 0 {
+		return nil, fmt.Errorf("failed to save settings")
+	}
+
+	settingsDB, dbErr := getSettingsDB()
+	if dbErr != 0 {
+		return nil, fmt.Errorf("database connection failed")
+	}
+	width, height := roomSize(room)
+	artworks := loadArtworks(room)
+	skipped := make([]LockedRegion, 0)
+	now := time.Now().UnixMilli()
+	for _, locked := range config.LockedRegions {
+		region := locked.Region
+		if region.X < 0 || region.Y < 0 || region.Width <= 0 || region.Height <= 0 ||
+			region.X+region.Width > width || region.Y+region.Height > height || overlapsArtwork(artworks, region) {
+			skipped = append(skipped, locked)
+			continue
+		}
+		artwork := Artwork{
+			ID:         readCounter(settingsDB, artworkSeqKey(room)) + 1,
+			Room:       room,
+			Title:      locked.Title,
+			Region:     region,
+			Credits:    make([]Contributor, 0),
+			FinishedBy: "import",
+			FinishedAt: now,
+		}
+		if err := writeCounter(settingsDB, artworkSeqKey(room), artwork.ID); err != nil {
+			return nil, err
+		}
+		if err := putJSON(settingsDB, fmt.Sprintf("%s%012d", artworkPrefix(room), artwork.ID), artwork); err != nil {
+			return nil, err
+		}
+		artworks = append(artworks, artwork)
+	}
+	return skipped, nil
+}
+
+//export exportModerationConfig
+func exportModerationConfig(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	h.Headers().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s-moderation.json\"", room))
+	return sendJSONResponse(h, buildModerationConfig(room))
+}
+
+//export importModerationConfig
+func importModerationConfig(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	var config ModerationConfig
+	if err := readJSONBody(h, &config); err != nil {
+		return handleHTTPError(h, err, 400)
+	}
+	skipped, err := applyModerationConfig(room, config)
+	if err != nil {
+		return handleHTTPError(h, err, 400)
+	}
+	logInfo("importModerationConfig", room, "imported moderation config of %s", config.Room)
+	return sendJSONResponse(h, map[string]interface{}{
+		"room":          room,
+		"source":        config.Room,
+		"words":         len(config.WordList),
+		"lockedRegions": len(config.LockedRegions) - len(skipped),
+		"skipped":       skipped,
+	})
+}
@@ -0,0 +1,73 @@
+package lib
+
+import (
+	"strings"
+
+	"github.com/taubyte/go-sdk/database"
+)
+
+// Keys that belong to no room (registries, indexes, deployment config) live
+// under this segment. Room IDs cannot contain '@', so a room's "/<room>/..."
+// keys never collide with them whatever the room is called.
+const globalKeyPrefix = "/@/"
+
+// Set in a database once its global keys sit under globalKeyPrefix
+const globalNamespaceMarker = globalKeyPrefix + "namespaced"
+
+// Global keys written before the namespace existed, by database path. Entries
+// ending in "/" are prefixes, the others single keys; each moves to
+// globalKeyPrefix followed by the key without its leading slash.
+var legacyGlobalKeys = map[string][]string{
+	"/canvas-history": {"/digests/", "/pixel-history/"},
+	"/chat":           {"/chat-seq/", "/reactions/"},
+	"/config":         {"/global", "/banners/", "/jobs/", "/link-reputation/", "/palettes/", "/wordlists/"},
+	"/intents":        {"/probe", "/pending/"},
+	"/keyusage":       {"/anonymous/", "/api-keys/", "/destructive/", "/keys/"},
+	"/moderation":     {"/audit/", "/audit-seq/"},
+	"/presence":       {"/idle-kicked/"},
+	"/rooms":          {"/admin/", "/meta/"},
+	"/stats":          {"/global-stats", "/active/", "/daily/", "/users/"},
+	"/usernames":      {"/current/", "/history/", "/names/"},
+}
+
+// Move the database's pre-namespace global keys under globalKeyPrefix. Runs
+// when the database is first opened in a process and does nothing once the
+// marker is set; keys already written under the namespace are kept.
+func migrateGlobalKeys(path string, db database.Database) {
+	legacy, ok := legacyGlobalKeys[path]
+	if !ok {
+		return
+	}
+	if data, err := db.Get(globalNamespaceMarker); err == nil && len(data) > 0 {
+		return
+	}
+	moved := 0
+	for _, entry := range legacy {
+		keys := []string{entry}
+		if strings.HasSuffix(entry, "/") {
+			keys, _ = db.List(entry)
+		}
+		for _, key := range keys {
+			data, err := db.Get(key)
+			if err != nil || len(data) == 0 {
+				continue
+			}
+			target := globalKeyPrefix + key[1:]
+			if current, err := db.Get(target); err != nil || len(current) == 0 {
+				if err := db.Put(target, data); err != nil {
+					logError("migrateGlobalKeys", "", "failed to move %s in %s: %v", key, path, err)
+					return
+				}
+			}
+			db.Delete(key)
+			moved++
+		}
+	}
+	if err := db.Put(globalNamespaceMarker, []byte("1")); err != nil {
+		logError("migrateGlobalKeys", "", "failed to mark %s: %v", path, err)
+		return
+	}
+	if moved > 0 {
+		logInfo("migrateGlobalKeys", "", "moved %d global keys of %s under %s", moved, path, globalKeyPrefix)
+	}
+}
@@ -0,0 +1,184 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+	http "github.com/taubyte/go-sdk/http/event"
+	pubsub "github.com/taubyte/go-sdk/pubsub/node"
+)
+
+const (
+	defaultNotificationsLimit = 50
+	maxNotificationsLimit     = 200
+)
+
+func notificationSeqKey(userID string) string {
+	return fmt.Sprintf("/%s/seq", userID)
+}
+
+func notificationPrefix(userID string) string {
+	return fmt.Sprintf("/%s/inbox/", userID)
+}
+
+func notificationKey(userID string, seq int64) string {
+	return fmt.Sprintf("%s%012d", notificationPrefix(userID), seq)
+}
+
+// Inbox channels are named after a user rather than a room, so "inbox" cannot be a room
+const inboxChannelPrefix = "inbox-"
+
+// Channel a user's clients subscribe to for live inbox updates
+func inboxChannelName(userID string) string {
+	return inboxChannelPrefix + userID
+}
+
+// Inboxes span every room, so only the shared admin secret or the user's own
+// session may open one. Sessions are room-scoped: the caller names the room
+// their token was issued for.
+func requireInboxOwner(h http.Event, userID string) uint32 {
+	if hasAdminToken(h, "") {
+		return 0
+	}
+	room, _ := h.Query().Get("room")
+	if room == "" {
+		return handleHTTPError(h, fmt.Errorf("room parameter required with a session token"), 400)
+	}
+	return requireOwnSession(h, room, userID)
+}
+
+// Store a notification in the user's inbox and push it to their inbox channel
+func notifyUser(userID string, notification Notification) uint32 {
+	db, dbErr := getNotificationsDB()
+	if dbErr != 0 {
+		logError("notifyUser", "", "database connection failed")
+		return dbErr
+	}
+	notification.Seq = readCounter(db, notificationSeqKey(userID)) + 1
+	notification.CreatedAt = time.Now().UnixMilli()
+	if err := writeCounter(db, notificationSeqKey(userID), notification.Seq); err != nil {
+		logError("notifyUser", "", "failed to save sequence for user %s: %v", userID, err)
+		return 1
+	}
+	data, err := json.Marshal(notification)
+	if err != nil {
+		return 1
+	}
+	if err := db.Put(notificationKey(userID, notification.Seq), data); err != nil {
+		logError("notifyUser", "", "failed to save notification for user %s: %v", userID, err)
+		return 1
+	}
+	channel, err := pubsub.Channel(inboxChannelName(userID))
+	if err == nil {
+		err = channel.Publish(data)
+	}
+	if err != nil {
+		logError("notifyUser", "", "failed to publish notification for user %s: %v", userID, err)
+	}
+	return 0
+}
+
+//export getNotifications
+func getNotifications(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	userID, err := h.Query().Get("userId")
+	if err != nil || userID == "" {
+		return handleHTTPError(h, fmt.Errorf("userId parameter required"), 400)
+	}
+	if code := requireInboxOwner(h, userID); code != 0 {
+		return code
+	}
+	limit := getIntParam(h, "limit", defaultNotificationsLimit)
+	if limit <= 0 || limit > maxNotificationsLimit {
+		limit = defaultNotificationsLimit
+	}
+	unreadOnly, _ := h.Query().Get("unread")
+
+	db, dbErr := getNotificationsDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	keys, _ := db.List(notificationPrefix(userID))
+	// Newest first
+	sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+	notifications := make([]Notification, 0, limit)
+	unread := 0
+	for _, key := range keys {
+		data, err := db.Get(key)
+		if err != nil {
+			continue
+		}
+		var notification Notification
+		if json.Unmarshal(data, &notification) != nil {
+			continue
+		}
+		if !notification.Read {
+			unread++
+		}
+		if len(notifications) < limit && (unreadOnly != "true" || !notification.Read) {
+			notifications = append(notifications, notification)
+		}
+	}
+	return sendJSONResponse(h, map[string]interface{}{
+		"notifications": notifications,
+		"unread":        unread,
+	})
+}
+
+//export markNotificationsRead
+func markNotificationsRead(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	userID, err := h.Query().Get("userId")
+	if err != nil || userID == "" {
+		return handleHTTPError(h, fmt.Errorf("userId parameter required"), 400)
+	}
+	if code := requireInboxOwner(h, userID); code != 0 {
+		return code
+	}
+	db, dbErr := getNotificationsDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	// Without upTo every notification is marked read
+	upTo := int64(getIntParam(h, "upTo", 0))
+	prefix := notificationPrefix(userID)
+	keys, _ := db.List(prefix)
+	marked := 0
+	for _, key := range keys {
+		seq, err := strconv.ParseInt(key[len(prefix):], 10, 64)
+		if err != nil || (upTo > 0 && seq > upTo) {
+			continue
+		}
+		data, err := db.Get(key)
+		if err != nil {
+			continue
+		}
+		var notification Notification
+		if json.Unmarshal(data, &notification) != nil || notification.Read {
+			continue
+		}
+		notification.Read = true
+		if putJSON(db, key, notification) == nil {
+			marked++
+		}
+	}
+	return sendJSONResponse(h, map[string]int{"marked": marked})
+}
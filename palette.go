@@ -0,0 +1,95 @@
+package lib
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+const maxPaletteColors = 256
+
+// labColor is a color in CIELAB space
+type labColor struct {
+	L, A, B float64
+}
+
+// Convert a #rrggbb color from sRGB to CIELAB under the D65 white point
+func hexToLab(value string) labColor {
+	rgb := parseHexColor(value)
+	linear := func(channel uint8) float64 {
+		c := float64(channel) / 255
+		if c <= 0.04045 {
+			return c / 12.92
+		}
+		return math.Pow((c+0.055)/1.055, 2.4)
+	}
+	r, g, b := linear(rgb.R), linear(rgb.G), linear(rgb.B)
+	x := (0.4124*r + 0.3576*g + 0.1805*b) / 0.95047
+	y := 0.2126*r + 0.7152*g + 0.0722*b
+	z := (0.0193*r + 0.1192*g + 0.9505*b) / 1.08883
+	f := func(t float64) float64 {
+		if t > 216.0/24389 {
+			return math.Cbrt(t)
+		}
+		return (24389.0/27*t + 16) / 116
+	}
+	fx, fy, fz := f(x), f(y), f(z)
+	return labColor{L: 116*fy - 16, A: 500 * (fx - fy), B: 200 * (fy - fz)}
+}
+
+// CIE76 color difference: Euclidean distance in CIELAB
+func cie76(a, b labColor) float64 {
+	return math.Sqrt((a.L-b.L)*(a.L-b.L) + (a.A-b.A)*(a.A-b.A) + (a.B-b.B)*(a.B-b.B))
+}
+
+// The palette color perceptually closest to the given color
+func nearestPaletteColor(value string, palette []string) string {
+	target := hexToLab(value)
+	nearest, best := value, math.Inf(1)
+	for _, candidate := range palette {
+		if distance := cie76(target, hexToLab(candidate)); distance < best {
+			nearest, best = strings.ToLower(candidate), distance
+		}
+	}
+	return nearest
+}
+
+func validatePaletteSettings(settings RoomSettings) error {
+	switch settings.PaletteMode {
+	case "", PaletteReject, PaletteSnap:
+	default:
+		return fmt.Errorf("paletteMode must be '%s' or '%s'", PaletteReject, PaletteSnap)
+	}
+	if len(settings.Palette) > maxPaletteColors {
+		return fmt.Errorf("palette may have at most %d colors", maxPaletteColors)
+	}
+	for _, color := range settings.Palette {
+		if !isValidHexColor(color) {
+			return fmt.Errorf("palette color %q must be a #rrggbb color", color)
+		}
+	}
+	return nil
+}
+
+// Reject colors outside the room palette, or snap them to the nearest one
+func validatePalette(ctx *PlacementContext) error {
+	settings := loadRoomSettings(ctx.Room)
+	if len(settings.Palette) == 0 {
+		return nil
+	}
+	allowed := make(map[string]bool, len(settings.Palette))
+	for _, color := range settings.Palette {
+		allowed[strings.ToLower(color)] = true
+	}
+	for i, pixel := range ctx.Pixels {
+		if ctx.Verdicts[i] != "" || allowed[strings.ToLower(pixel.Color)] {
+			continue
+		}
+		if settings.PaletteMode == PaletteSnap {
+			ctx.Pixels[i].Color = nearestPaletteColor(pixel.Color, settings.Palette)
+			continue
+		}
+		ctx.reject(i, "color not in palette")
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+// Placements kept per coordinate; older entries are trimmed on append
+const maxPixelHistoryEntries = 20
+
+func pixelHistoryPrefix(room string, x, y int) string {
+	return fmt.Sprintf(globalKeyPrefix+"pixel-history/%s/%d:%d/", room, x, y)
+}
+
+// Append saved pixels to their coordinate's placement log, keeping the newest entries
+func appendPixelHistory(room string, changes []PixelChange) {
+	db, dbErr := getSnapshotsDB()
+	if dbErr != 0 {
+		return
+	}
+	for _, change := range changes {
+		pixel := change.Pixel
+		prefix := pixelHistoryPrefix(room, pixel.X, pixel.Y)
+		if err := putJSON(db, fmt.Sprintf("%s%013d", prefix, pixel.Timestamp), pixel); err != nil {
+			logError("appendPixelHistory", room, "failed for pixel (%d,%d): %v", pixel.X, pixel.Y, err)
+			continue
+		}
+		keys, _ := db.List(prefix)
+		if len(keys) <= maxPixelHistoryEntries {
+			continue
+		}
+		sort.Strings(keys)
+		for _, key := range keys[:len(keys)-maxPixelHistoryEntries] {
+			db.Delete(key)
+		}
+	}
+}
+
+// Logged placements at the coordinate, newest first
+func loadPixelHistory(room string, x, y int) []Pixel {
+	history := make([]Pixel, 0)
+	db, dbErr := getSnapshotsDB()
+	if dbErr != 0 {
+		return history
+	}
+	keys, _ := db.List(pixelHistoryPrefix(room, x, y))
+	sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+	for _, key := range keys {
+		data, err := db.Get(key)
+		if err != nil {
+			continue
+		}
+		var pixel Pixel
+		if json.Unmarshal(data, &pixel) == nil {
+			history = append(history, pixel)
+		}
+	}
+	return history
+}
+
+func deletePixelHistory(room string) {
+	db, dbErr := getSnapshotsDB()
+	if dbErr != 0 {
+		return
+	}
+	keys, _ := db.List(fmt.Sprintf(globalKeyPrefix+"pixel-history/%s/", room))
+	for _, key := range keys {
+		db.Delete(key)
+	}
+}
+
+//export getPixelInfo
+func getPixelInfo(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	anonymous, code := checkAnonymousRead(h, room)
+	if code != 0 {
+		return code
+	}
+	setMaintenanceBanner(h, room)
+	x, y := getIntParam(h, "x", -1), getIntParam(h, "y", -1)
+	if !inRoomBounds(room, x, y) {
+		return handleHTTPError(h, fmt.Errorf("x and y must be inside the canvas"), 400)
+	}
+	history := loadPixelHistory(room, x, y)
+	current, placed := loadPixel(room, x, y)
+	names := usernameResolver{}
+	names.pixels(history)
+	current.Username = names.name(current.UserID, current.Username)
+	if anonymous || loadRoomSettings(room).AnonymizeContributors {
+		history = anonymizePixels(history)
+		current = anonymizePixels([]Pixel{current})[0]
+	}
+	response := map[string]interface{}{
+		"room":    room,
+		"x":       x,
+		"y":       y,
+		"history": history,
+	}
+	if placed {
+		response["current"] = current
+	}
+	return sendJSONResponse(h, response)
+}
@@ -0,0 +1,44 @@
+package lib
+
+import (
+	"fmt"
+	"time"
+)
+
+// Upper bound on the per-pixel overwrite tax a room may configure
+const maxOverwriteTax = time.Hour
+
+// Tax owed for one change: painting over someone else's pixel costs up to
+// OverwriteTaxMs, scaled down linearly with how long that pixel has stood.
+// Blank cells, the user's own pixels and pixels without a recorded author
+// (system resets, anonymized rooms) are free.
+func overwriteTax(settings RoomSettings, change PixelChange) int64 {
+	if settings.OverwriteTaxMs <= 0 || settings.OverwriteTaxWindowMs <= 0 || !change.HadPrevious {
+		return 0
+	}
+	previous := change.Previous.UserID
+	if previous == "" || previous == "system" || previous == change.Pixel.UserID {
+		return 0
+	}
+	age := change.Pixel.Timestamp - change.Previous.Timestamp
+	if age < 0 {
+		age = 0
+	}
+	if age >= settings.OverwriteTaxWindowMs {
+		return 0
+	}
+	return settings.OverwriteTaxMs * (settings.OverwriteTaxWindowMs - age) / settings.OverwriteTaxWindowMs
+}
+
+// Hold the user's next batch until the cooldown plus the tax from their last one has passed
+func validateOverwriteTax(ctx *PlacementContext) error {
+	window := loadRateWindow(ctx.Room, ctx.UserID)
+	if window.TaxMs <= 0 {
+		return nil
+	}
+	if wait := window.LastPlacement + tierCooldownMs(ctx.Room, ctx.Tier) + window.TaxMs - ctx.Now; wait > 0 {
+		ctx.RateLimited = true
+		return fmt.Errorf("overwrite tax cooldown active for %d more ms", wait)
+	}
+	return nil
+}
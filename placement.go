@@ -0,0 +1,225 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+// Update the state derived from pixels (counters, history, scores) after a batch is persisted
+func afterPixelsSaved(room string, changes []PixelChange) {
+	if len(changes) == 0 {
+		return
+	}
+	colorDeltas := make(map[string]int64)
+	for _, change := range changes {
+		colorDeltas[change.Pixel.Color]++
+		if change.HadPrevious {
+			colorDeltas[change.Previous.Color]--
+		}
+	}
+	updateColorCounts(room, colorDeltas)
+	appendPlacementHistory(room, changes)
+	appendPixelHistory(room, changes)
+	updateTeamScores(room, changes)
+	updateZones(room, changes)
+	updateTemplateProgress(room, changes)
+	updateUserStats(room, changes)
+	updateRoomStats(room, changes)
+	updatePeriodLeaderboards(room, changes)
+	updateAbuseSignals(room, changes)
+	recordLastPlacements(room, changes)
+	recordDailyUsage(room, changes)
+	recordSignatures(room, changes)
+	recordGlobalPixels(changes)
+	recordPresenceActivity(room, changes)
+	updateCanvasChecksum(room, changes)
+	maybeCaptureSnapshot(room)
+}
+
+// PlacementContext is the batch state passed through the placement validators
+type PlacementContext struct {
+	Room   string
+	UserID string
+	Tier   ReputationTier
+	Now    int64
+	Pixels []Pixel
+	// Rejection reason per pixel, empty while the pixel is still accepted
+	Verdicts []string
+	// Set when the cooldown or rate limit turned pixels away
+	RateLimited bool
+}
+
+func newPlacementContext(batch PixelBatch, now int64) *PlacementContext {
+	return &PlacementContext{
+		Room:     batch.Room,
+		UserID:   batch.UserID,
+		Tier:     userTier(batch.UserID),
+		Now:      now,
+		Pixels:   batch.Pixels,
+		Verdicts: make([]string, len(batch.Pixels)),
+	}
+}
+
+// Reject a single pixel; the first reason given is kept
+func (ctx *PlacementContext) reject(i int, reason string) {
+	if ctx.Verdicts[i] == "" {
+		ctx.Verdicts[i] = reason
+	}
+}
+
+// Pixels no validator rejected
+func (ctx *PlacementContext) Accepted() []Pixel {
+	accepted := make([]Pixel, 0, len(ctx.Pixels))
+	for i, pixel := range ctx.Pixels {
+		if ctx.Verdicts[i] == "" {
+			accepted = append(accepted, pixel)
+		}
+	}
+	return accepted
+}
+
+// A placement validator rejects individual pixels through the context, or
+// returns an error to reject the whole batch
+type placementValidator func(ctx *PlacementContext) error
+
+var placementValidators = []placementValidator{
+	validateSanctions,
+	validatePixelBounds,
+	validateFinishedRegions,
+	validatePixelColors,
+	validatePalette,
+	validateTierBatchSize,
+	validateCooldown,
+	validateOverwriteTax,
+	validateRateLimit,
+	validateDailyQuota,
+}
+
+// Signature walls take whole text stamps in one batch and confine each user to
+// their own region instead of limiting batch sizes and overwrites
+var signatureValidators = []placementValidator{
+	validateSanctions,
+	validatePixelBounds,
+	validateFinishedRegions,
+	validatePixelColors,
+	validatePalette,
+	validateSignatureRegion,
+	validateCooldown,
+	validateDailyQuota,
+}
+
+// Run every validator for the room's mode in order, stopping at the first batch rejection
+func runPlacementValidators(ctx *PlacementContext) error {
+	validators := placementValidators
+	if isSignatureRoom(ctx.Room) {
+		validators = signatureValidators
+	}
+	for _, validator := range validators {
+		if err := validator(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateSanctions(ctx *PlacementContext) error {
+	if isBanned(ctx.Room, ctx.UserID) {
+		return fmt.Errorf("user %s is banned from room %s", ctx.UserID, ctx.Room)
+	}
+	return nil
+}
+
+func validatePixelBounds(ctx *PlacementContext) error {
+	width, height := roomSize(ctx.Room)
+	for i, pixel := range ctx.Pixels {
+		if pixel.X < 0 || pixel.X >= width || pixel.Y < 0 || pixel.Y >= height {
+			ctx.reject(i, "out of bounds")
+		}
+	}
+	return nil
+}
+
+func validatePixelColors(ctx *PlacementContext) error {
+	for i, pixel := range ctx.Pixels {
+		if !isValidHexColor(pixel.Color) {
+			ctx.reject(i, "invalid color")
+		}
+	}
+	return nil
+}
+
+func validateTierBatchSize(ctx *PlacementContext) error {
+	if len(ctx.Pixels) > ctx.Tier.MaxBatchSize {
+		return fmt.Errorf("batch of %d pixels exceeds the %s tier limit of %d", len(ctx.Pixels), ctx.Tier.Name, ctx.Tier.MaxBatchSize)
+	}
+	return nil
+}
+
+// PixelVerdict is the dry-run outcome for one proposed pixel
+type PixelVerdict struct {
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+	Color  string `json:"color"`
+	OK     bool   `json:"ok"`
+	Reason string `json:"reason,omitempty"`
+}
+
+//export validatePlacement
+func validatePlacement(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	body, err := io.ReadAll(h.Body())
+	if err != nil {
+		return handleHTTPError(h, fmt.Errorf("failed to read request body: %v", err), 400)
+	}
+	batch, err := decodeJSONPixelBatch(body)
+	if err != nil {
+		return handleHTTPError(h, err, 400)
+	}
+	batch.Room = room
+	if ensureRoomSchema(room) != 0 {
+		return handleHTTPError(h, fmt.Errorf("room migration failed"), 500)
+	}
+
+	placement := newPlacementContext(batch, time.Now().UnixMilli())
+	batchErr := runPlacementValidators(placement)
+	if _, active := maintenanceStatus(room); active && batchErr == nil {
+		batchErr = fmt.Errorf("room %s is in maintenance", room)
+	}
+	verdicts := make([]PixelVerdict, len(placement.Pixels))
+	accepted := 0
+	for i, pixel := range placement.Pixels {
+		verdicts[i] = PixelVerdict{X: pixel.X, Y: pixel.Y, Color: pixel.Color, Reason: placement.Verdicts[i]}
+		if batchErr != nil && verdicts[i].Reason == "" {
+			verdicts[i].Reason = batchErr.Error()
+		}
+		verdicts[i].OK = verdicts[i].Reason == ""
+		if verdicts[i].OK {
+			accepted++
+		}
+	}
+	response := map[string]interface{}{
+		"room":     room,
+		"tier":     placement.Tier.Name,
+		"accepted": accepted,
+		"rejected": len(verdicts) - accepted,
+		"verdicts": verdicts,
+	}
+	if batchErr != nil {
+		response["batchError"] = batchErr.Error()
+	}
+	return sendJSONResponse(h, response)
+}
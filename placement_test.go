@@ -0,0 +1,176 @@
+package lib
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func testPlacement(t *testing.T, room string, pixels ...Pixel) *PlacementContext {
+	t.Helper()
+	if saveRoomMetadata(RoomMetadata{Room: room, Width: 10, Height: 10, Visibility: VisibilityPublic}) != 0 {
+		t.Fatal("saveRoomMetadata failed")
+	}
+	return newPlacementContext(PixelBatch{Room: room, UserID: "user-1", Pixels: pixels}, time.Now().UnixMilli())
+}
+
+func testPixel(x, y int, color string) Pixel {
+	return Pixel{X: x, Y: y, Color: color, UserID: "user-1", Username: "alice"}
+}
+
+func expectVerdicts(t *testing.T, ctx *PlacementContext, want ...string) {
+	t.Helper()
+	if len(ctx.Verdicts) != len(want) {
+		t.Fatalf("got %d verdicts, want %d", len(ctx.Verdicts), len(want))
+	}
+	for i, verdict := range ctx.Verdicts {
+		if verdict != want[i] {
+			t.Errorf("pixel %d: got verdict %q, want %q", i, verdict, want[i])
+		}
+	}
+}
+
+func TestValidatePixelBounds(t *testing.T) {
+	mockDatabases(t)
+	ctx := testPlacement(t, "bounds",
+		testPixel(0, 0, "#000000"),
+		testPixel(9, 9, "#000000"),
+		testPixel(10, 0, "#000000"),
+		testPixel(-1, 5, "#000000"),
+	)
+	if err := validatePixelBounds(ctx); err != nil {
+		t.Fatalf("validatePixelBounds: %v", err)
+	}
+	expectVerdicts(t, ctx, "", "", "out of bounds", "out of bounds")
+}
+
+func TestValidatePixelColors(t *testing.T) {
+	mockDatabases(t)
+	ctx := testPlacement(t, "colors",
+		testPixel(0, 0, "#a1b2c3"),
+		testPixel(1, 0, "red"),
+		testPixel(2, 0, "#12345"),
+	)
+	if err := validatePixelColors(ctx); err != nil {
+		t.Fatalf("validatePixelColors: %v", err)
+	}
+	expectVerdicts(t, ctx, "", "invalid color", "invalid color")
+}
+
+func TestValidateTierBatchSize(t *testing.T) {
+	mockDatabases(t)
+	ctx := testPlacement(t, "batch")
+	if ctx.Tier.Name != reputationTiers[0].Name {
+		t.Fatalf("new user got tier %s", ctx.Tier.Name)
+	}
+	ctx.Pixels = make([]Pixel, ctx.Tier.MaxBatchSize)
+	if err := validateTierBatchSize(ctx); err != nil {
+		t.Errorf("batch at the tier limit rejected: %v", err)
+	}
+	ctx.Pixels = append(ctx.Pixels, testPixel(0, 0, "#000000"))
+	if err := validateTierBatchSize(ctx); err == nil {
+		t.Error("batch over the tier limit accepted")
+	}
+}
+
+func TestValidateSanctions(t *testing.T) {
+	mockDatabases(t)
+	ctx := testPlacement(t, "sanctions", testPixel(0, 0, "#000000"))
+	if err := validateSanctions(ctx); err != nil {
+		t.Fatalf("user without sanctions rejected: %v", err)
+	}
+	db, _ := getModerationDB()
+	if err := putJSON(db, sanctionKey("sanctions", "user-1", SanctionBan), Sanction{UserID: "user-1", Kind: SanctionBan}); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateSanctions(ctx); err == nil {
+		t.Error("banned user accepted")
+	}
+}
+
+func TestValidatePalette(t *testing.T) {
+	mockDatabases(t)
+	ctx := testPlacement(t, "palette",
+		testPixel(0, 0, "#FF0000"),
+		testPixel(1, 0, "#fe0101"),
+	)
+	saveRoomSettings("palette", RoomSettings{Palette: []string{"#ff0000", "#0000ff"}, PaletteMode: PaletteReject})
+	if err := validatePalette(ctx); err != nil {
+		t.Fatalf("validatePalette: %v", err)
+	}
+	expectVerdicts(t, ctx, "", "color not in palette")
+
+	ctx = testPlacement(t, "palette", testPixel(1, 0, "#fe0101"))
+	saveRoomSettings("palette", RoomSettings{Palette: []string{"#ff0000", "#0000ff"}, PaletteMode: PaletteSnap})
+	if err := validatePalette(ctx); err != nil {
+		t.Fatalf("validatePalette: %v", err)
+	}
+	expectVerdicts(t, ctx, "")
+	if ctx.Pixels[0].Color != "#ff0000" {
+		t.Errorf("snapped to %s, want #ff0000", ctx.Pixels[0].Color)
+	}
+}
+
+func TestValidateCooldown(t *testing.T) {
+	mockDatabases(t)
+	ctx := testPlacement(t, "cooldown", testPixel(0, 0, "#000000"))
+	saveRoomSettings("cooldown", RoomSettings{CooldownMs: 1000})
+	db, _ := getRateLimitDB()
+	putJSON(db, rateWindowKey("cooldown", "user-1"), RateWindow{LastPlacement: ctx.Now - 100})
+	if err := validateCooldown(ctx); err == nil || !ctx.RateLimited {
+		t.Errorf("placement inside the cooldown accepted: %v", err)
+	}
+
+	putJSON(db, rateWindowKey("cooldown", "user-1"), RateWindow{LastPlacement: ctx.Now - 1000})
+	ctx.RateLimited = false
+	if err := validateCooldown(ctx); err != nil || ctx.RateLimited {
+		t.Errorf("placement after the cooldown rejected: %v", err)
+	}
+}
+
+func TestValidateRateLimit(t *testing.T) {
+	mockDatabases(t)
+	ctx := testPlacement(t, "rate",
+		testPixel(0, 0, "red"),
+		testPixel(1, 0, "#000000"),
+		testPixel(2, 0, "#000000"),
+	)
+	saveRoomSettings("rate", RoomSettings{PixelsPerInterval: 2, RateIntervalMs: 60000})
+	db, _ := getRateLimitDB()
+	putJSON(db, rateWindowKey("rate", "user-1"), RateWindow{WindowStart: ctx.Now - 10, Pixels: 1})
+	// Pixels already rejected do not use up the allowance
+	ctx.reject(0, "invalid color")
+	if err := validateRateLimit(ctx); err != nil {
+		t.Fatalf("validateRateLimit: %v", err)
+	}
+	expectVerdicts(t, ctx, "invalid color", "", "rate limited")
+	if !ctx.RateLimited {
+		t.Error("RateLimited not set")
+	}
+}
+
+// The chain keeps the first reason for each pixel and stops at a batch rejection
+func TestRunPlacementValidators(t *testing.T) {
+	mockDatabases(t)
+	ctx := testPlacement(t, "chain",
+		testPixel(20, 0, "nope"),
+		testPixel(1, 1, "nope"),
+		testPixel(2, 2, "#00ff00"),
+	)
+	if err := runPlacementValidators(ctx); err != nil {
+		t.Fatalf("runPlacementValidators: %v", err)
+	}
+	expectVerdicts(t, ctx, "out of bounds", "invalid color", "")
+	if accepted := ctx.Accepted(); len(accepted) != 1 || accepted[0].X != 2 {
+		t.Errorf("accepted %+v", accepted)
+	}
+
+	db, _ := getModerationDB()
+	putJSON(db, sanctionKey("chain", "user-1", SanctionBan), Sanction{UserID: "user-1", Kind: SanctionBan})
+	ctx = testPlacement(t, "chain", testPixel(20, 0, "nope"))
+	err := runPlacementValidators(ctx)
+	if err == nil || !strings.Contains(err.Error(), "banned") {
+		t.Errorf("got %v, want a ban rejection", err)
+	}
+	expectVerdicts(t, ctx, "")
+}
@@ -0,0 +1,254 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+// Users count as online until this long after their last heartbeat, unless
+// the room sets its own presenceTimeoutSeconds
+const presenceTTL = 60 * time.Second
+
+// Departures are announced by this job even when nobody reads the room's presence
+func init() {
+	registerJob(ScheduledJob{
+		Name:     "presenceExpiry",
+		Interval: time.Minute,
+		Run:      expirePresence,
+	})
+}
+
+type presenceMessage struct {
+	Room      string `json:"room"`
+	UserID    string `json:"userId"`
+	Username  string `json:"username"`
+	Timestamp int64  `json:"timestamp"`
+	// Sent by clients on a clean disconnect so they drop off immediately
+	Leave bool `json:"leave"`
+}
+
+func presenceKey(room, userID string) string {
+	return fmt.Sprintf("/%s/%s", room, userID)
+}
+
+// Kicked users stay offline until they act again or take a new session token;
+// the key lives outside the room's presence prefix
+func idleKickKey(room, userID string) string {
+	return fmt.Sprintf(globalKeyPrefix+"idle-kicked/%s/%s", room, userID)
+}
+
+func clearIdleKick(room, userID string) {
+	if db, dbErr := getPresenceDB(); dbErr == 0 {
+		db.Delete(idleKickKey(room, userID))
+	}
+}
+
+func loadPresence(room, userID string) (PresenceEntry, bool) {
+	var entry PresenceEntry
+	db, dbErr := getPresenceDB()
+	if dbErr != 0 {
+		return entry, false
+	}
+	data, err := db.Get(presenceKey(room, userID))
+	if err != nil || len(data) == 0 || json.Unmarshal(data, &entry) != nil {
+		return entry, false
+	}
+	return entry, entry.ExpiresAt > time.Now().UnixMilli()
+}
+
+func presenceTimeout(settings RoomSettings) time.Duration {
+	if settings.PresenceTimeoutSeconds > 0 {
+		return time.Duration(settings.PresenceTimeoutSeconds) * time.Second
+	}
+	return presenceTTL
+}
+
+// Users with a live heartbeat, most recently seen first. Entries whose
+// heartbeat expired, or that stayed idle past the room's idle timeout, are
+// deleted and announced as they are found; idle users also lose their session tokens.
+func loadOnlineUsers(room string) []PresenceEntry {
+	users := make([]PresenceEntry, 0)
+	db, dbErr := getPresenceDB()
+	if dbErr != 0 {
+		return users
+	}
+	keys, err := db.List(fmt.Sprintf("/%s/", room))
+	if err != nil {
+		return users
+	}
+	idleTimeout := int64(loadRoomSettings(room).IdleTimeoutMinutes) * time.Minute.Milliseconds()
+	now := time.Now().UnixMilli()
+	for _, key := range keys {
+		data, err := db.Get(key)
+		if err != nil {
+			continue
+		}
+		var entry PresenceEntry
+		if json.Unmarshal(data, &entry) != nil {
+			db.Delete(key)
+			continue
+		}
+		if entry.ExpiresAt <= now {
+			db.Delete(key)
+			publishRoomEvent(room, "presence", "userLeft", map[string]string{"userId": entry.UserID, "reason": "timeout"})
+			continue
+		}
+		if idleTimeout > 0 && entry.LastActive > 0 && now-entry.LastActive >= idleTimeout {
+			db.Delete(key)
+			db.Put(idleKickKey(room, entry.UserID), []byte("1"))
+			revoked := revokeUserSessions(room, entry.UserID)
+			logInfo("loadOnlineUsers", room, "kicked idle user %s, revoked %d session tokens", entry.UserID, revoked)
+			publishRoomEvent(room, "presence", "userLeft", map[string]string{"userId": entry.UserID, "reason": "idle"})
+			continue
+		}
+		users = append(users, entry)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].LastSeen > users[j].LastSeen
+	})
+	return users
+}
+
+// Sweep the presence of every room
+func expirePresence(now time.Time) error {
+	db, dbErr := getRoomsDB()
+	if dbErr != 0 {
+		return fmt.Errorf("rooms database connection failed")
+	}
+	keys, err := db.List(roomMetaPrefix)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		loadOnlineUsers(key[len(roomMetaPrefix):])
+	}
+	return nil
+}
+
+// Reset the idle clock of online users who just placed pixels or chatted
+func touchPresence(room string, userIDs map[string]bool) {
+	db, dbErr := getPresenceDB()
+	if dbErr != 0 {
+		return
+	}
+	now := time.Now().UnixMilli()
+	for userID := range userIDs {
+		db.Delete(idleKickKey(room, userID))
+		entry, online := loadPresence(room, userID)
+		if !online {
+			continue
+		}
+		entry.LastActive = now
+		if err := putJSON(db, presenceKey(room, userID), entry); err != nil {
+			logError("touchPresence", room, "failed for user %s: %v", userID, err)
+		}
+	}
+}
+
+func recordPresenceActivity(room string, changes []PixelChange) {
+	users := make(map[string]bool)
+	for _, change := range changes {
+		users[change.Pixel.UserID] = true
+	}
+	touchPresence(room, users)
+}
+
+//export onPresence
+func onPresence(e event.Event) uint32 {
+	channel, err := e.PubSub()
+	if err != nil {
+		return 1
+	}
+	data, err := channel.Data()
+	if err != nil {
+		return 1
+	}
+	var message presenceMessage
+	if err := json.Unmarshal(data, &message); err != nil {
+		logError("onPresence", "", "invalid JSON: %v", err)
+		return 1
+	}
+	if message.Room == "" || message.UserID == "" || strings.Contains(message.UserID, "/") {
+		logError("onPresence", "", "room and userId required")
+		return 1
+	}
+	if !roomExists(message.Room) {
+		return 0
+	}
+	db, dbErr := getPresenceDB()
+	if dbErr != 0 {
+		return dbErr
+	}
+	previous, online := loadPresence(message.Room, message.UserID)
+	if message.Leave {
+		db.Delete(presenceKey(message.Room, message.UserID))
+		if online {
+			publishRoomEvent(message.Room, "presence", "userLeft", map[string]string{"userId": message.UserID, "reason": "leave"})
+		}
+		return 0
+	}
+	if data, err := db.Get(idleKickKey(message.Room, message.UserID)); err == nil && len(data) > 0 {
+		return 0
+	}
+	// The server clock decides expiry; the client timestamp is only a hint.
+	// Heartbeats keep a user online but do not count as activity.
+	now := time.Now().UnixMilli()
+	entry := PresenceEntry{
+		UserID:     message.UserID,
+		Username:   message.Username,
+		LastSeen:   now,
+		LastActive: now,
+		ExpiresAt:  now + presenceTimeout(loadRoomSettings(message.Room)).Milliseconds(),
+	}
+	if online {
+		entry.LastActive = previous.LastActive
+	}
+	if err := putJSON(db, presenceKey(message.Room, message.UserID), entry); err != nil {
+		logError("onPresence", "", "failed to save heartbeat for user %s: %v", message.UserID, err)
+		return 1
+	}
+	if !online {
+		publishRoomEvent(message.Room, "presence", "userJoined", entry)
+	}
+	return 0
+}
+
+//export getOnlineUsers
+func getOnlineUsers(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	anonymous, code := checkAnonymousRead(h, room)
+	if code != 0 {
+		return code
+	}
+	users := loadOnlineUsers(room)
+	if anonymous {
+		for i := range users {
+			users[i].UserID = ""
+		}
+	}
+	return sendJSONResponse(h, map[string]interface{}{
+		"room":       room,
+		"count":      len(users),
+		"users":      users,
+		"serverTime": time.Now().UnixMilli(),
+	})
+}
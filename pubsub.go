@@ -3,11 +3,47 @@ package lib
 import (
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/taubyte/go-sdk/event"
 	pubsub "github.com/taubyte/go-sdk/pubsub/node"
 )
 
+type RoomEvent struct {
+	Type      string      `json:"type"`
+	Room      string      `json:"room"`
+	Timestamp int64       `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+func roomChannelName(room, kind string) string {
+	return fmt.Sprintf("%s-%s", room, kind)
+}
+
+// Publish a server-generated JSON event on one of the room's channels
+func publishRoomEvent(room, kind, eventType string, data interface{}) uint32 {
+	payload, err := json.Marshal(RoomEvent{
+		Type:      eventType,
+		Room:      room,
+		Timestamp: time.Now().UnixMilli(),
+		Data:      data,
+	})
+	if err != nil {
+		logError("publishRoomEvent", "", "failed to marshal %s event: %v", eventType, err)
+		return 1
+	}
+	channel, err := pubsub.Channel(roomChannelName(room, kind))
+	if err != nil {
+		logError("publishRoomEvent", "", "failed to open channel %s: %v", roomChannelName(room, kind), err)
+		return 1
+	}
+	if err := channel.Publish(payload); err != nil {
+		logError("publishRoomEvent", "", "failed to publish %s event: %v", eventType, err)
+		return 1
+	}
+	return 0
+}
+
 //export getChannelURL
 func getChannelURL(e event.Event) uint32 {
 	h, err := e.HTTP()
@@ -15,12 +51,18 @@ func getChannelURL(e event.Event) uint32 {
 		return 1
 	}
 	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
 	channelName, err := h.Query().Get("channel")
 	if err != nil {
 		h.Write([]byte("channel parameter required"))
 		h.Return(400)
 		return 1
 	}
+	if code := checkChannelSession(h, channelName); code != 0 {
+		return code
+	}
 	channel, err := pubsub.Channel(channelName)
 	if err != nil {
 		h.Write([]byte(err.Error()))
@@ -34,230 +76,416 @@ func getChannelURL(e event.Event) uint32 {
 		h.Return(500)
 		return 1
 	}
+	recordShardSubscription(channelName)
 	h.Headers().Set("Content-Type", "text/plain")
 	h.Write([]byte(url.Path))
 	h.Return(200)
 	return 0
 }
 
-//export onPixelUpdate
-func onPixelUpdate(e event.Event) uint32 {
-	fmt.Printf("[DEBUG] onPixelUpdate called\n")
-	channel, err := e.PubSub()
-	if err != nil {
-		fmt.Printf("[ERROR] onPixelUpdate PubSub error: %v\n", err)
+// Validate and persist a decoded pixel batch, then update derived state
+func applyPixelBatch(batch PixelBatch) uint32 {
+	logDebug("applyPixelBatch", batch.Room, "processing %d pixels", len(batch.Pixels))
+	if ensureRoomSchema(batch.Room) != 0 {
 		return 1
 	}
-	data, err := channel.Data()
-	if err != nil {
-		fmt.Printf("[ERROR] onPixelUpdate channel data error: %v\n", err)
-		return 1
+	prepared := preparePixelBatch(batch)
+	if prepared == nil {
+		return 0
 	}
-	fmt.Printf("[DEBUG] onPixelUpdate received %d bytes of data\n", len(data))
-
-	var pixels []Pixel
-	var room = "default"
-
-	// Parse binary data
-	if len(data) >= 4 {
-		// Read batch ID length and content (first 4 bytes, little-endian)
-		batchIdLength := int(uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16 | uint32(data[3])<<24)
-		offset := 4
-		
-		// Skip batch ID (we don't need it for saving to database)
-		if offset+batchIdLength <= len(data) {
-			offset += batchIdLength
-		} else {
-			fmt.Printf("[ERROR] onPixelUpdate invalid batch ID length: %d\n", batchIdLength)
-			return 1
-		}
-		
-		// Read pixel count (next 4 bytes, little-endian)
-		if offset+4 <= len(data) {
-			pixelCount := int(uint32(data[offset]) | uint32(data[offset+1])<<8 | uint32(data[offset+2])<<16 | uint32(data[offset+3])<<24)
-			offset += 4
-			fmt.Printf("[DEBUG] onPixelUpdate received binary data with %d pixels\n", pixelCount)
-			
-			pixels = make([]Pixel, 0, pixelCount)
-			
-			for i := 0; i < pixelCount && offset+8 <= len(data); i++ {
-			// Read x (2 bytes, little-endian)
-			x := int(uint16(data[offset]) | uint16(data[offset+1])<<8)
-			offset += 2
-			
-			// Read y (2 bytes, little-endian)
-			y := int(uint16(data[offset]) | uint16(data[offset+1])<<8)
-			offset += 2
-			
-			// Read color (4 bytes, little-endian)
-			colorValue := uint32(data[offset]) | uint32(data[offset+1])<<8 | uint32(data[offset+2])<<16 | uint32(data[offset+3])<<24
-			offset += 4
-			
-			// Convert to hex color string (ensure 6 digits)
-			color := fmt.Sprintf("#%06x", colorValue&0xFFFFFF)
-			
-			pixels = append(pixels, Pixel{
-				X:        x,
-				Y:        y,
-				Color:    color,
-				UserID:   "unknown", // Not included in binary format
-				Username: "unknown", // Not included in binary format
-			})
-		}
-		} else {
-			fmt.Printf("[ERROR] onPixelUpdate insufficient data for pixel count\n")
-			return 1
-		}
-	} else {
-		fmt.Printf("[ERROR] onPixelUpdate insufficient binary data: %d bytes\n", len(data))
-		return 1
+	return commitPixelBatches(batch.Room, []*preparedBatch{prepared})[0]
+}
+
+// preparedBatch is a validated batch ready to be persisted
+type preparedBatch struct {
+	batch PixelBatch
+	// Accepted pixels with their authors, and the same pixels as stored
+	valid      []Pixel
+	stored     []Pixel
+	anonymized bool
+}
+
+// Run the placement validators on a batch; nil means it was rejected and reported
+func preparePixelBatch(batch PixelBatch) *preparedBatch {
+	room := batch.Room
+	now := time.Now().UnixMilli()
+	placement := newPlacementContext(batch, now)
+	err := runPlacementValidators(placement)
+	if placement.RateLimited {
+		recordRateLimitHit(room, batch.UserID)
+	}
+	if err != nil {
+		// Rejected batches are final, so they are reported rather than retried
+		logDebug("applyPixelBatch", room, "rejected batch %s: %v", batch.BatchID, err)
+		publishRoomEvent(room, "acks", "pixelRejected", map[string]interface{}{
+			"batchId": batch.BatchID,
+			"userId":  batch.UserID,
+			"reason":  err.Error(),
+		})
+		return nil
 	}
+	validPixels := placement.Accepted()
+	logDebug("applyPixelBatch", room, "validated %d pixels", len(validPixels))
 
-	fmt.Printf("[DEBUG] onPixelUpdate processing %d pixels for room %s\n", len(pixels), room)
+	for i := range validPixels {
+		validPixels[i].Timestamp = now
+		validPixels[i].Team = getUserTeam(room, validPixels[i].UserID)
+	}
+	prepared := &preparedBatch{
+		batch:      batch,
+		valid:      validPixels,
+		stored:     validPixels,
+		anonymized: loadRoomSettings(room).AnonymizeContributors,
+	}
+	if prepared.anonymized {
+		prepared.stored = anonymizePixels(validPixels)
+	}
+	return prepared
+}
 
-	// Validate pixels (but don't save to database here - that should be separate)
-	validPixels := make([]Pixel, 0, len(pixels))
-	for _, pixel := range pixels {
-		// Validate coordinates before processing
-		if pixel.X >= 0 && pixel.X < CanvasWidth && pixel.Y >= 0 && pixel.Y < CanvasHeight {
-			validPixels = append(validPixels, pixel)
+// Persist prepared batches of one room with a single save. Where batches write
+// the same cell only the last write is stored. Returns a code per batch.
+func commitPixelBatches(room string, batches []*preparedBatch) []uint32 {
+	codes := make([]uint32, len(batches))
+	owner := make(map[[2]int]int)
+	position := make(map[[2]int]int)
+	var merged []Pixel
+	for i, prepared := range batches {
+		for _, pixel := range prepared.stored {
+			cell := [2]int{pixel.X, pixel.Y}
+			if at, ok := position[cell]; ok {
+				merged[at] = pixel
+			} else {
+				position[cell] = len(merged)
+				merged = append(merged, pixel)
+			}
+			owner[cell] = i
 		}
 	}
-	fmt.Printf("[DEBUG] onPixelUpdate validated %d pixels\n", len(validPixels))
 
 	// Save pixels to database
-	db, dbErr := getCanvasDB()
+	synchronous := isSynchronousRoom(room)
+	changes, dbErr := savePixels(room, merged, synchronous)
 	if dbErr != 0 {
-		fmt.Printf("[ERROR] onPixelUpdate database connection failed\n")
-		return 1
+		logError("applyPixelBatch", room, "database connection failed")
+		for i := range codes {
+			codes[i] = 1
+		}
+		return codes
+	}
+	perBatch := make([][]PixelChange, len(batches))
+	for _, change := range changes {
+		i := owner[[2]int{change.Pixel.X, change.Pixel.Y}]
+		if prepared := batches[i]; prepared.anonymized {
+			// Derived state and the history log still need to know who placed the batch
+			change.Pixel.UserID = prepared.batch.UserID
+			change.Pixel.Username = prepared.valid[0].Username
+		}
+		perBatch[i] = append(perBatch[i], change)
 	}
+	owned := make([]int, len(batches))
+	for _, i := range owner {
+		owned[i]++
+	}
+	all := make([]PixelChange, 0, len(changes))
+	for _, batchChanges := range perBatch {
+		all = append(all, batchChanges...)
+	}
+	logDebug("applyPixelBatch", room, "saved %d/%d pixels from %d batches to database", len(changes), len(merged), len(batches))
+	afterPixelsSaved(room, all)
 
-	
-	successCount := 0
-	for _, pixel := range validPixels {
-		pixelData, err := json.Marshal(pixel)
-		if err != nil {
-			fmt.Printf("[ERROR] Failed to marshal pixel (%d,%d): %v\n", pixel.X, pixel.Y, err)
-			continue
+	for i, prepared := range batches {
+		broadcastPixelBatch(prepared.batch, perBatch[i], prepared.anonymized)
+		if synchronous {
+			ack := map[string]interface{}{
+				"batchId": prepared.batch.BatchID,
+				"saved":   len(perBatch[i]),
+				"failed":  owned[i] - len(perBatch[i]),
+			}
+			if superseded := len(prepared.valid) - owned[i]; superseded > 0 {
+				ack["superseded"] = superseded
+			}
+			publishRoomEvent(room, "acks", "pixelAck", ack)
 		}
-		
-		key := fmt.Sprintf("/%s/%d:%d", room, pixel.X, pixel.Y)
-		err = db.Put(key, pixelData)
-		if err != nil {
-			fmt.Printf("[ERROR] Failed to save pixel (%d,%d) to database: %v\n", pixel.X, pixel.Y, err)
-		} else {
-			successCount++
+		if len(perBatch[i]) < owned[i] {
+			codes[i] = 1
 		}
 	}
-	fmt.Printf("[DEBUG] onPixelUpdate saved %d/%d pixels to database\n", successCount, len(validPixels))
+	return codes
+}
 
-	return 0
+// AuthoritativePixel is a persisted pixel as rebroadcast to the room
+type AuthoritativePixel struct {
+	X     int    `json:"x"`
+	Y     int    `json:"y"`
+	Color string `json:"color"`
 }
 
-//export onChatMessages
-func onChatMessages(e event.Event) uint32 {
+// Publish the persisted part of a batch on the room's broadcast channel, stamped
+// by the server. Clients render these instead of peers' raw pubsub messages and
+// skip batches carrying their own sourceId.
+func broadcastPixelBatch(batch PixelBatch, changes []PixelChange, anonymized bool) {
+	if len(changes) == 0 {
+		return
+	}
+	pixels := make([]AuthoritativePixel, len(changes))
+	for i, change := range changes {
+		pixels[i] = AuthoritativePixel{X: change.Pixel.X, Y: change.Pixel.Y, Color: change.Pixel.Color}
+	}
+	data := map[string]interface{}{
+		"batchId":   batch.BatchID,
+		"sourceId":  batch.SourceID,
+		"timestamp": changes[0].Pixel.Timestamp,
+		"pixels":    pixels,
+		"rejected":  len(batch.Pixels) - len(changes),
+	}
+	if isDegradedRoom(batch.Room) {
+		// Not persisted yet; the batch is replayed once the database recovers
+		data["degraded"] = true
+	}
+	if !anonymized {
+		data["userId"] = batch.UserID
+		data["username"] = changes[0].Pixel.Username
+		data["team"] = changes[0].Pixel.Team
+	}
+	publishRoomEvent(batch.Room, "broadcast", "pixels", data)
+	publishShardPixels(batch.Room, data, pixels)
+}
+
+//export onPixelUpdate
+func onPixelUpdate(e event.Event) uint32 {
+	logDebug("onPixelUpdate", "", "called")
 	channel, err := e.PubSub()
 	if err != nil {
+		logError("onPixelUpdate", "", "PubSub error: %v", err)
 		return 1
 	}
 	data, err := channel.Data()
 	if err != nil {
+		logError("onPixelUpdate", "", "channel data error: %v", err)
 		return 1
 	}
+	logDebug("onPixelUpdate", "", "received %d bytes of data", len(data))
 
-	var chatMessage ChatMessage
-	room := "default"
-
-	// Parse binary data
-	offset := 0
-	if len(data) < 4 {
-		fmt.Printf("[ERROR] onChatMessages insufficient binary data: %d bytes\n", len(data))
+	batch, err := decodePixelBatch(data)
+	if err != nil {
+		logError("onPixelUpdate", "", "%v", err)
 		return 1
 	}
+	return handlePixelBatch(batch, data)
+}
 
-	// Read messageId length and content
-	messageIdLength := int(uint32(data[offset]) | uint32(data[offset+1])<<8 | uint32(data[offset+2])<<16 | uint32(data[offset+3])<<24)
-	offset += 4
-	if offset+messageIdLength > len(data) {
-		fmt.Printf("[ERROR] onChatMessages invalid messageId length: %d\n", messageIdLength)
-		return 1
+// Whether a decoded batch may be written at all: the room is open and the
+// sender holds a valid session and key quota. Shared by every write path.
+func admitPixelBatch(batch PixelBatch) bool {
+	if _, active := maintenanceStatus(batch.Room); active {
+		logDebug("admitPixelBatch", batch.Room, "dropping batch during maintenance")
+		return false
 	}
-	chatMessage.ID = string(data[offset : offset+messageIdLength])
-	offset += messageIdLength
-
-	// Read userId length and content
-	if offset+4 > len(data) {
-		fmt.Printf("[ERROR] onChatMessages insufficient data for userId length\n")
-		return 1
+	if !roomExists(batch.Room) {
+		logDebug("admitPixelBatch", batch.Room, "dropping batch for unknown room")
+		return false
 	}
-	userIdLength := int(uint32(data[offset]) | uint32(data[offset+1])<<8 | uint32(data[offset+2])<<16 | uint32(data[offset+3])<<24)
-	offset += 4
-	if offset+userIdLength > len(data) {
-		fmt.Printf("[ERROR] onChatMessages invalid userId length: %d\n", userIdLength)
-		return 1
+	if isArchivedRoom(batch.Room) {
+		logDebug("admitPixelBatch", batch.Room, "dropping batch for archived room")
+		return false
+	}
+	if !sessionWriteAllowed(batch.Room, batch.UserID, batch.SessionToken) {
+		logDebug("admitPixelBatch", "", "dropping batch %s without a valid session token", batch.BatchID)
+		return false
 	}
-	chatMessage.UserID = string(data[offset : offset+userIdLength])
-	offset += userIdLength
+	if !trackKeyEvent(batch.APIKey, "pixelUpdate") {
+		logDebug("admitPixelBatch", "", "dropping batch %s: API key quota exceeded", batch.BatchID)
+		return false
+	}
+	return true
+}
 
-	// Read username length and content
-	if offset+4 > len(data) {
-		fmt.Printf("[ERROR] onChatMessages insufficient data for username length\n")
-		return 1
+// Gate a decoded batch, log its raw payload as an intent and apply it
+func handlePixelBatch(batch PixelBatch, data []byte) uint32 {
+	if !admitPixelBatch(batch) {
+		return 0
 	}
-	usernameLength := int(uint32(data[offset]) | uint32(data[offset+1])<<8 | uint32(data[offset+2])<<16 | uint32(data[offset+3])<<24)
-	offset += 4
-	if offset+usernameLength > len(data) {
-		fmt.Printf("[ERROR] onChatMessages invalid username length: %d\n", usernameLength)
-		return 1
+
+	if !recoverDegradedRoom(batch.Room) {
+		return applyDegradedPixelBatch(batch, data)
 	}
-	chatMessage.Username = string(data[offset : offset+usernameLength])
-	offset += usernameLength
 
-	// Read message length and content
-	if offset+4 > len(data) {
-		fmt.Printf("[ERROR] onChatMessages insufficient data for message length\n")
+	receivedAt := time.Now()
+	intentID, logged := appendIntent(IntentPixels, batch.Room, data, receivedAt)
+	if aggregatePixelBatch(batch) != 0 {
+		recordWriteFailure(batch.Room)
+		if !logged {
+			// Without an intent the batch would be lost, so it waits in memory
+			queueDegradedIntent(IntentPixels, batch.Room, data, receivedAt)
+		}
+		// The intent stays pending so recoverIntents can finish the batch
 		return 1
 	}
-	messageLength := int(uint32(data[offset]) | uint32(data[offset+1])<<8 | uint32(data[offset+2])<<16 | uint32(data[offset+3])<<24)
-	offset += 4
-	if offset+messageLength > len(data) {
-		fmt.Printf("[ERROR] onChatMessages invalid message length: %d\n", messageLength)
-		return 1
+	recordWriteSuccess(batch.Room)
+	replicateIntent(IntentPixels, batch.Room, data)
+	if logged {
+		completeIntent(intentKey(intentID))
 	}
-	chatMessage.Message = string(data[offset : offset+messageLength])
-	offset += messageLength
+	return 0
+}
 
-	// Read timestamp
-	if offset+4 > len(data) {
-		fmt.Printf("[ERROR] onChatMessages insufficient data for timestamp\n")
-		return 1
+// Tell the sender whether their message was persisted; reason explains a drop
+func publishChatReceipt(room string, chatMessage ChatMessage, stored bool, reason string) {
+	receipt := map[string]interface{}{
+		"messageId": chatMessage.ID,
+		"userId":    chatMessage.UserID,
+		"stored":    stored,
+	}
+	if reason != "" {
+		receipt["reason"] = reason
 	}
-	chatMessage.Timestamp = int64(uint32(data[offset]) | uint32(data[offset+1])<<8 | uint32(data[offset+2])<<16 | uint32(data[offset+3])<<24)
+	if stored {
+		receipt["seq"] = chatMessage.Seq
+	}
+	publishRoomEvent(room, "acks", "chatAck", receipt)
+}
 
-	fmt.Printf("[DEBUG] onChatMessages received binary message: %s from %s\n", chatMessage.ID, chatMessage.Username)
+// Persist a decoded chat message under the time the server received it. The
+// sender's own timestamp is kept as ClientTimestamp; keys, paging and pruning
+// only ever see the server's clock.
+func applyChatMessage(room string, chatMessage ChatMessage, receivedAt int64) uint32 {
+	if chatMessage.Timestamp != receivedAt {
+		chatMessage.ClientTimestamp = chatMessage.Timestamp
+	}
+	chatMessage.Timestamp = receivedAt
+	chatMessage.Message = maskProfanity(chatMessage.Message, roomWordList(room))
+	chatMessage.Anchors = parseAnchors(room, chatMessage.Message)
 
 	// Save message to database
 	db, dbErr := getChatDB()
 	if dbErr != 0 {
-		fmt.Printf("[ERROR] onChatMessages database connection failed: %d\n", dbErr)
+		logError("applyChatMessage", room, "database connection failed: %d", dbErr)
 		return 1
 	}
 
+	if ensureRoomSchema(room) != 0 {
+		return 1
+	}
+	key := chatMessageKey(room, chatMessage)
+	chatMessage.Seq = assignChatSeq(db, room, key)
 	messageData, err := json.Marshal(chatMessage)
 	if err != nil {
-		fmt.Printf("[ERROR] onChatMessages failed to marshal message %s: %v\n", chatMessage.ID, err)
+		logError("applyChatMessage", room, "failed to marshal message %s: %v", chatMessage.ID, err)
 		return 1
 	}
 
-	key := fmt.Sprintf("/%s/%s", room, chatMessage.ID)
-	err = db.Put(key, messageData)
+	queue := newWriteQueue(isSynchronousRoom(room))
+	queue.Put(db, key, messageData)
+	err = queue.Flush(writeFlushTimeout)[0]
 	if err != nil {
-		fmt.Printf("[ERROR] onChatMessages failed to save message %s to database: %v\n", chatMessage.ID, err)
+		publishChatReceipt(room, chatMessage, false, "storage failed")
+		logError("applyChatMessage", room, "failed to save message %s to database: %v", chatMessage.ID, err)
 		return 1
 	}
 
-	fmt.Printf("[DEBUG] onChatMessages saved message %s to database\n", chatMessage.ID)
-
+	indexChatSeq(db, room, chatMessage)
+	publishChatReceipt(room, chatMessage, true, "")
+	logDebug("applyChatMessage", room, "saved message %s to database", chatMessage.ID)
+	recordStorageUsage(room, NamespaceChat, 1, int64(len(messageData)))
+	recordGlobalActivity("messages", 1, map[string]bool{chatMessage.UserID: true})
+	recordAnchorMentions(room, chatMessage.Anchors)
+	touchPresence(room, map[string]bool{chatMessage.UserID: true})
+	enforceChatQuota(room)
 	return 0
 }
 
+// Whether a decoded message may be stored: the room is open, the sender holds a
+// valid session and is not muted, and the reply target and links pass. Drops are
+// reported to the sender; flagged links are marked on the message.
+func admitChatMessage(room string, chatMessage *ChatMessage, sessionToken string) bool {
+	if _, active := maintenanceStatus(room); active {
+		logDebug("admitChatMessage", room, "dropping message %s during maintenance", chatMessage.ID)
+		publishChatReceipt(room, *chatMessage, false, "maintenance")
+		return false
+	}
+	if !roomExists(room) {
+		logDebug("admitChatMessage", room, "dropping message %s for unknown room", chatMessage.ID)
+		return false
+	}
+	if isArchivedRoom(room) {
+		logDebug("admitChatMessage", room, "dropping message %s for archived room", chatMessage.ID)
+		publishChatReceipt(room, *chatMessage, false, "archived")
+		return false
+	}
+	if !sessionWriteAllowed(room, chatMessage.UserID, sessionToken) {
+		logDebug("admitChatMessage", room, "dropping message %s without a valid session token", chatMessage.ID)
+		publishChatReceipt(room, *chatMessage, false, "invalid session")
+		return false
+	}
+	if isMuted(room, chatMessage.UserID) {
+		logDebug("admitChatMessage", room, "dropping message %s from muted user %s", chatMessage.ID, chatMessage.UserID)
+		publishChatReceipt(room, *chatMessage, false, "muted")
+		return false
+	}
+
+	if !validateReplyTo(room, *chatMessage) {
+		logDebug("admitChatMessage", room, "rejecting message %s replying to unknown message %s", chatMessage.ID, chatMessage.ReplyTo)
+		publishChatReceipt(room, *chatMessage, false, "unknown reply target")
+		return false
+	}
+
+	if !screenChatLinks(room, chatMessage) {
+		logDebug("admitChatMessage", room, "rejecting message %s with disallowed links", chatMessage.ID)
+		publishChatReceipt(room, *chatMessage, false, "disallowed links")
+		return false
+	}
+	return true
+}
+
+//export onChatMessages
+func onChatMessages(e event.Event) uint32 {
+	channel, err := e.PubSub()
+	if err != nil {
+		return 1
+	}
+	data, err := channel.Data()
+	if err != nil {
+		return 1
+	}
+
+	chatMessage, room, sessionToken, err := decodeChatMessage(data)
+	if err != nil {
+		logError("onChatMessages", "", "%v", err)
+		return 1
+	}
+	receivedAt := time.Now()
+	logDebug("onChatMessages", room, "received binary message: %s from %s", chatMessage.ID, chatMessage.Username)
+
+	if !admitChatMessage(room, &chatMessage, sessionToken) {
+		return 0
+	}
+
+	if !recoverDegradedRoom(room) {
+		queued := queueDegradedIntent(IntentChat, room, data, receivedAt)
+		publishRoomEvent(room, "acks", "chatAck", map[string]interface{}{
+			"messageId": chatMessage.ID,
+			"userId":    chatMessage.UserID,
+			"stored":    false,
+			"queued":    queued,
+			"degraded":  true,
+		})
+		return 0
+	}
+
+	intentID, logged := appendIntent(IntentChat, room, data, receivedAt)
+	if applyChatMessage(room, chatMessage, receivedAt.UnixMilli()) != 0 {
+		recordWriteFailure(room)
+		if !logged {
+			queueDegradedIntent(IntentChat, room, data, receivedAt)
+		}
+		// The intent stays pending so recoverIntents can finish the message
+		return 1
+	}
+	recordWriteSuccess(room)
+	replicateIntent(IntentChat, room, data)
+	if logged {
+		completeIntent(intentKey(intentID))
+	}
+	return 0
+}
@@ -0,0 +1,142 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/taubyte/go-sdk/database"
+)
+
+// Number of placement records currently retained for the room
+func historyEntryCount(room string) int64 {
+	db, dbErr := getHistoryDB()
+	if dbErr != 0 {
+		return 0
+	}
+	seq := readCounter(db, historySeqKey(room))
+	first := readCounter(db, historyFirstKey(room))
+	if first == 0 {
+		first = 1
+	}
+	if seq < first {
+		return 0
+	}
+	return seq - first + 1
+}
+
+func roomQuotaStatus(room string) QuotaStatus {
+	quotas := loadRoomSettings(room).Quotas
+	retention := roomRetention(room)
+	return QuotaStatus{
+		History:       QuotaUsage{Used: historyEntryCount(room), Limit: retention.MaxHistoryEntries},
+		Chat:          QuotaUsage{Used: loadStorageUsage(room)[NamespaceChat].Keys, Limit: quotas.MaxChatMessages},
+		RetentionTier: retention.Name,
+	}
+}
+
+// Drop the oldest placement records beyond the room's history quota or older
+// than its retention tier allows
+func enforceHistoryQuota(room string) {
+	retention := roomRetention(room)
+	limit := retention.MaxHistoryEntries
+	if limit <= 0 && retention.HistoryDays <= 0 {
+		return
+	}
+	db, dbErr := getHistoryDB()
+	if dbErr != 0 {
+		return
+	}
+	seq := readCounter(db, historySeqKey(room))
+	first := readCounter(db, historyFirstKey(room))
+	if first == 0 {
+		first = 1
+	}
+	// Records up to and including last are removed
+	last := first - 1
+	if limit > 0 && seq-first+1 > limit {
+		last = seq - limit
+	}
+	if retention.HistoryDays > 0 {
+		cutoff := time.Now().AddDate(0, 0, -retention.HistoryDays).UnixMilli()
+		for last < seq {
+			var record PlacementRecord
+			data, err := db.Get(historyLogKey(room, last+1))
+			if err == nil && json.Unmarshal(data, &record) == nil && record.Timestamp >= cutoff {
+				break
+			}
+			last++
+		}
+	}
+	if last < first {
+		return
+	}
+
+	removed := deleteHistoryRange(db, room, first, last)
+	logDebug("enforceHistoryQuota", room, "pruned %d history keys", removed)
+}
+
+// Delete placement records first through last with their per-user index
+// entries and advance the log's first sequence; returns how many keys were removed
+func deleteHistoryRange(db database.Database, room string, first, last int64) int64 {
+	var removedKeys, removedBytes int64
+	for current := first; current <= last; current++ {
+		key := historyLogKey(room, current)
+		data, err := db.Get(key)
+		if err != nil {
+			continue
+		}
+		var record PlacementRecord
+		if json.Unmarshal(data, &record) == nil {
+			if db.Delete(fmt.Sprintf("%s%012d", historyUserPrefix(room, record.UserID), current)) == nil {
+				removedKeys++
+				removedBytes += int64(len(data))
+			}
+		}
+		if db.Delete(key) == nil {
+			removedKeys++
+			removedBytes += int64(len(data))
+		}
+	}
+	if err := writeCounter(db, historyFirstKey(room), last+1); err != nil {
+		logError("deleteHistoryRange", room, "failed to save first sequence: %v", err)
+	}
+	recordStorageUsage(room, NamespaceHistory, -removedKeys, -removedBytes)
+	return removedKeys
+}
+
+// Drop the oldest chat messages beyond the room's chat quota. Keys sort by
+// timestamp, so only the pruned messages are read.
+func enforceChatQuota(room string) {
+	limit := loadRoomSettings(room).Quotas.MaxChatMessages
+	if limit <= 0 || loadStorageUsage(room)[NamespaceChat].Keys <= limit {
+		return
+	}
+	db, dbErr := getChatDB()
+	if dbErr != 0 {
+		return
+	}
+	keys := sortedChatKeys(db, room)
+	if int64(len(keys)) <= limit {
+		return
+	}
+
+	var removedKeys, removedBytes int64
+	for _, key := range keys[:int64(len(keys))-limit] {
+		data, err := db.Get(key)
+		if err != nil {
+			continue
+		}
+		var message ChatMessage
+		json.Unmarshal(data, &message)
+		if db.Delete(key) == nil {
+			removedKeys++
+			removedBytes += int64(len(data))
+		}
+		if message.Seq > 0 {
+			db.Delete(chatSeqIndexKey(room, message.Seq))
+		}
+	}
+	recordStorageUsage(room, NamespaceChat, -removedKeys, -removedBytes)
+	logDebug("enforceChatQuota", room, "pruned %d messages", removedKeys)
+}
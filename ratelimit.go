@@ -0,0 +1,167 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+func rateWindowKey(room, userID string) string {
+	return fmt.Sprintf("/%s/%s", room, userID)
+}
+
+func loadRateWindow(room, userID string) RateWindow {
+	var window RateWindow
+	db, dbErr := getRateLimitDB()
+	if dbErr != 0 {
+		return window
+	}
+	data, err := db.Get(rateWindowKey(room, userID))
+	if err != nil || len(data) == 0 {
+		return window
+	}
+	if err := json.Unmarshal(data, &window); err != nil {
+		logError("loadRateWindow", room, "failed to unmarshal window for user %s: %v", userID, err)
+	}
+	return window
+}
+
+// Pixels the user may still place in the current window, or -1 when unlimited
+func rateRemaining(settings RoomSettings, window RateWindow, now int64) int {
+	if settings.PixelsPerInterval <= 0 || settings.RateIntervalMs <= 0 {
+		return -1
+	}
+	if now-window.WindowStart >= settings.RateIntervalMs {
+		return settings.PixelsPerInterval
+	}
+	if remaining := settings.PixelsPerInterval - window.Pixels; remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// Room cooldown scaled by the user's tier
+func tierCooldownMs(room string, tier ReputationTier) int64 {
+	return loadRoomSettings(room).CooldownMs * int64(tier.CooldownFactor) / 100
+}
+
+func validateCooldown(ctx *PlacementContext) error {
+	cooldown := tierCooldownMs(ctx.Room, ctx.Tier)
+	if cooldown <= 0 {
+		return nil
+	}
+	if wait := loadRateWindow(ctx.Room, ctx.UserID).LastPlacement + cooldown - ctx.Now; wait > 0 {
+		ctx.RateLimited = true
+		return fmt.Errorf("cooldown active for %d more ms", wait)
+	}
+	return nil
+}
+
+// Drop the pixels past the user's remaining allowance for the window
+func validateRateLimit(ctx *PlacementContext) error {
+	remaining := rateRemaining(loadRoomSettings(ctx.Room), loadRateWindow(ctx.Room, ctx.UserID), ctx.Now)
+	if remaining < 0 {
+		return nil
+	}
+	for i := range ctx.Pixels {
+		if ctx.Verdicts[i] != "" {
+			continue
+		}
+		if remaining == 0 {
+			ctx.RateLimited = true
+			ctx.reject(i, "rate limited")
+			continue
+		}
+		remaining--
+	}
+	return nil
+}
+
+// Record each author's placement time and count their pixels against the window
+func recordLastPlacements(room string, changes []PixelChange) {
+	db, dbErr := getRateLimitDB()
+	if dbErr != 0 {
+		return
+	}
+	settings := loadRoomSettings(room)
+	placed := make(map[string]int)
+	last := make(map[string]int64)
+	tax := make(map[string]int64)
+	for _, change := range changes {
+		placed[change.Pixel.UserID]++
+		tax[change.Pixel.UserID] += overwriteTax(settings, change)
+		if change.Pixel.Timestamp > last[change.Pixel.UserID] {
+			last[change.Pixel.UserID] = change.Pixel.Timestamp
+		}
+	}
+	for userID, count := range placed {
+		window := loadRateWindow(room, userID)
+		window.LastPlacement = last[userID]
+		window.TaxMs = tax[userID]
+		if settings.RateIntervalMs <= 0 || window.LastPlacement-window.WindowStart >= settings.RateIntervalMs {
+			window.WindowStart = window.LastPlacement
+			window.Pixels = 0
+		}
+		window.Pixels += count
+		if err := putJSON(db, rateWindowKey(room, userID), window); err != nil {
+			logError("recordLastPlacements", room, "failed for user %s: %v", userID, err)
+		}
+	}
+}
+
+//export getCooldown
+func getCooldown(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	userID, _ := h.Query().Get("userId")
+	if userID == "" {
+		return handleHTTPError(h, fmt.Errorf("userId parameter required"), 400)
+	}
+	now := time.Now().UnixMilli()
+	settings := loadRoomSettings(room)
+	window := loadRateWindow(room, userID)
+	cooldown := tierCooldownMs(room, userTier(userID))
+	remainingMs := window.LastPlacement + cooldown + window.TaxMs - now
+	if remainingMs < 0 {
+		remainingMs = 0
+	}
+	response := map[string]interface{}{
+		"room":              room,
+		"userId":            userID,
+		"cooldownMs":        cooldown,
+		"overwriteTaxMs":    window.TaxMs,
+		"remainingMs":       remainingMs,
+		"nextPlacementAt":   now + remainingMs,
+		"pixelsPerInterval": settings.PixelsPerInterval,
+		"rateIntervalMs":    settings.RateIntervalMs,
+		"serverTime":        now,
+	}
+	if remaining := rateRemaining(settings, window, now); remaining >= 0 {
+		response["pixelsRemaining"] = remaining
+		if remaining < settings.PixelsPerInterval {
+			resetAt := window.WindowStart + settings.RateIntervalMs
+			response["windowResetsAt"] = resetAt
+			// An exhausted window can outlast the cooldown
+			if remaining == 0 && resetAt > now+remainingMs {
+				response["remainingMs"] = resetAt - now
+				response["nextPlacementAt"] = resetAt
+			}
+		}
+	}
+	return sendJSONResponse(h, response)
+}
@@ -0,0 +1,218 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/taubyte/go-sdk/database"
+	"github.com/taubyte/go-sdk/event"
+)
+
+// Emoji sequences with modifiers and joiners run to several code points
+const maxReactionBytes = 32
+
+type reactionMessage struct {
+	Room         string `json:"room"`
+	MessageID    string `json:"messageId"`
+	UserID       string `json:"userId"`
+	Emoji        string `json:"emoji"`
+	Remove       bool   `json:"remove"`
+	SessionToken string `json:"sessionToken"`
+}
+
+// Reactions live outside the room's message prefix so message listings stay unchanged
+func reactionPrefix(room, messageID string) string {
+	return fmt.Sprintf(globalKeyPrefix+"reactions/%s/%s/", room, messageID)
+}
+
+func reactionKey(room, messageID, emoji, userID string) string {
+	return fmt.Sprintf("%s%s/%s", reactionPrefix(room, messageID), emoji, userID)
+}
+
+// Emoji reactions are short and carry no letters, whitespace or key separators
+func isValidReaction(emoji string) bool {
+	if emoji == "" || len(emoji) > maxReactionBytes || !utf8.ValidString(emoji) {
+		return false
+	}
+	for _, r := range emoji {
+		if r == '/' || unicode.IsLetter(r) || unicode.IsSpace(r) || unicode.IsControl(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// Count of users per emoji on the message; nil when it has no reactions
+func loadReactionCounts(db database.Database, room, messageID string) map[string]int {
+	prefix := reactionPrefix(room, messageID)
+	keys, err := db.List(prefix)
+	if err != nil || len(keys) == 0 {
+		return nil
+	}
+	counts := make(map[string]int)
+	for _, key := range keys {
+		if separator := strings.LastIndex(key, "/"); separator > len(prefix) {
+			counts[key[len(prefix):separator]]++
+		}
+	}
+	return counts
+}
+
+func clearMessageReactions(db database.Database, room, messageID string) {
+	keys, _ := db.List(reactionPrefix(room, messageID))
+	for _, key := range keys {
+		db.Delete(key)
+	}
+}
+
+// Drop every reaction in the room, e.g. after its chat is cleared
+func clearReactions(room string) {
+	db, dbErr := getChatDB()
+	if dbErr != 0 {
+		return
+	}
+	keys, _ := db.List(fmt.Sprintf(globalKeyPrefix+"reactions/%s/", room))
+	for _, key := range keys {
+		db.Delete(key)
+	}
+}
+
+// Fill in reaction counts and the parent of each reply. Parents outside the
+// page are looked up by message ID and left out once deleted.
+func attachThreads(db database.Database, room string, messages []ChatMessage) {
+	byID := make(map[string]*ChatMessage, len(messages))
+	for i := range messages {
+		byID[messages[i].ID] = &messages[i]
+	}
+	var keysByID map[string]string
+	for i := range messages {
+		messages[i].Reactions = loadReactionCounts(db, room, messages[i].ID)
+		if messages[i].ReplyTo == "" {
+			continue
+		}
+		parent, ok := byID[messages[i].ReplyTo]
+		if !ok {
+			if keysByID == nil {
+				keysByID = make(map[string]string)
+				for _, key := range sortedChatKeys(db, room) {
+					if _, ok := chatKeyTimestamp(room, key); ok {
+						keysByID[chatKeyID(room, key)] = key
+					}
+				}
+			}
+			key, found := keysByID[messages[i].ReplyTo]
+			if !found {
+				continue
+			}
+			data, err := db.Get(key)
+			var loaded ChatMessage
+			if err != nil || json.Unmarshal(data, &loaded) != nil {
+				continue
+			}
+			parent = &loaded
+		}
+		messages[i].Parent = &ChatParent{
+			ID:        parent.ID,
+			UserID:    parent.UserID,
+			Username:  parent.Username,
+			Message:   parent.Message,
+			Timestamp: parent.Timestamp,
+		}
+	}
+}
+
+// A reply must point at another message that is still stored in the room
+func validateReplyTo(room string, chatMessage ChatMessage) bool {
+	if chatMessage.ReplyTo == "" {
+		return true
+	}
+	if chatMessage.ReplyTo == chatMessage.ID {
+		return false
+	}
+	db, dbErr := getChatDB()
+	if dbErr != 0 {
+		return false
+	}
+	_, found := findChatMessageKey(db, room, chatMessage.ReplyTo)
+	return found
+}
+
+//export onReaction
+func onReaction(e event.Event) uint32 {
+	channel, err := e.PubSub()
+	if err != nil {
+		return 1
+	}
+	data, err := channel.Data()
+	if err != nil {
+		return 1
+	}
+	var message reactionMessage
+	if err := json.Unmarshal(data, &message); err != nil {
+		logError("onReaction", "", "invalid JSON: %v", err)
+		return 1
+	}
+	if message.MessageID == "" || message.UserID == "" || strings.Contains(message.UserID, "/") {
+		logError("onReaction", message.Room, "messageId and userId required")
+		return 1
+	}
+	if !isValidReaction(message.Emoji) {
+		logError("onReaction", message.Room, "invalid emoji %q", message.Emoji)
+		return 1
+	}
+	room := message.Room
+	if room == "" {
+		if room, err = fallbackRoom(); err != nil {
+			logError("onReaction", "", "%v", err)
+			return 1
+		}
+	}
+	if _, active := maintenanceStatus(room); active {
+		logDebug("onReaction", room, "dropping reaction during maintenance")
+		return 0
+	}
+	if !roomExists(room) || isArchivedRoom(room) {
+		logDebug("onReaction", room, "dropping reaction for unknown or archived room")
+		return 0
+	}
+	if !sessionWriteAllowed(room, message.UserID, message.SessionToken) {
+		logDebug("onReaction", room, "dropping reaction from %s without a valid session token", message.UserID)
+		return 0
+	}
+	if isMuted(room, message.UserID) {
+		logDebug("onReaction", room, "dropping reaction from muted user %s", message.UserID)
+		return 0
+	}
+	if ensureRoomSchema(room) != 0 {
+		return 1
+	}
+	db, dbErr := getChatDB()
+	if dbErr != 0 {
+		logError("onReaction", room, "database connection failed")
+		return 1
+	}
+	if _, found := findChatMessageKey(db, room, message.MessageID); !found {
+		logDebug("onReaction", room, "dropping reaction to unknown message %s", message.MessageID)
+		return 0
+	}
+	key := reactionKey(room, message.MessageID, message.Emoji, message.UserID)
+	if message.Remove {
+		err = db.Delete(key)
+	} else {
+		err = db.Put(key, []byte{1})
+	}
+	if err != nil {
+		logError("onReaction", room, "failed to save reaction to message %s: %v", message.MessageID, err)
+		return 1
+	}
+	return publishRoomEvent(room, "events", "reaction", map[string]interface{}{
+		"messageId": message.MessageID,
+		"userId":    message.UserID,
+		"emoji":     message.Emoji,
+		"removed":   message.Remove,
+		"reactions": loadReactionCounts(db, room, message.MessageID),
+	})
+}
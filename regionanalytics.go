@@ -0,0 +1,137 @@
+package lib
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+// Region reads are counted per square tile of this many cells a side
+const analyticsTileSize = 64
+
+const (
+	usageRequests      = "requests"
+	usageSubscriptions = "subscriptions"
+)
+
+func regionUsagePrefix(room, kind string) string {
+	return fmt.Sprintf("/%s/region-usage/%s/", room, kind)
+}
+
+func regionUsageKey(room, kind string, tx, ty int) string {
+	return fmt.Sprintf("%s%d:%d", regionUsagePrefix(room, kind), tx, ty)
+}
+
+func incrementRegionUsage(room, kind string, tx, ty int) {
+	db, dbErr := getStatsDB()
+	if dbErr != 0 {
+		return
+	}
+	key := regionUsageKey(room, kind, tx, ty)
+	if err := writeCounter(db, key, readCounter(db, key)+1); err != nil {
+		logError("incrementRegionUsage", room, "failed to save %s: %v", kind, err)
+	}
+}
+
+// Count a read of the region against every tile it overlaps
+func recordRegionRequest(room string, region Region) {
+	for ty := region.Y / analyticsTileSize; ty <= (region.Y+region.Height-1)/analyticsTileSize; ty++ {
+		for tx := region.X / analyticsTileSize; tx <= (region.X+region.Width-1)/analyticsTileSize; tx++ {
+			incrementRegionUsage(room, usageRequests, tx, ty)
+		}
+	}
+}
+
+// Count a channel URL request when the channel is a shard channel (<room>-shard<sx>x<sy>)
+func recordShardSubscription(channelName string) {
+	separator := strings.LastIndex(channelName, "-")
+	if separator <= 0 {
+		return
+	}
+	var sx, sy int
+	if _, err := fmt.Sscanf(channelName[separator+1:], "shard%dx%d", &sx, &sy); err != nil {
+		return
+	}
+	room := channelName[:separator]
+	if _, ok := shardRegion(room, sx, sy); ok {
+		incrementRegionUsage(room, usageSubscriptions, sx, sy)
+	}
+}
+
+// Tiles ranked by count, busiest first; size is the tile side used when recording
+func rankRegionUsage(room, kind string, size, limit int) []RegionCount {
+	counts := make([]RegionCount, 0)
+	db, dbErr := getStatsDB()
+	if dbErr != 0 {
+		return counts
+	}
+	width, height := roomSize(room)
+	prefix := regionUsagePrefix(room, kind)
+	keys, _ := db.List(prefix)
+	for _, key := range keys {
+		var tx, ty int
+		if _, err := fmt.Sscanf(strings.TrimPrefix(key, prefix), "%d:%d", &tx, &ty); err != nil {
+			continue
+		}
+		region := Region{X: tx * size, Y: ty * size, Width: size, Height: size}
+		if region.X >= width || region.Y >= height {
+			continue
+		}
+		if region.X+region.Width > width {
+			region.Width = width - region.X
+		}
+		if region.Y+region.Height > height {
+			region.Height = height - region.Y
+		}
+		counts = append(counts, RegionCount{Region: region, Count: readCounter(db, key)})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		if counts[i].Y != counts[j].Y {
+			return counts[i].Y < counts[j].Y
+		}
+		return counts[i].X < counts[j].X
+	})
+	if len(counts) > limit {
+		counts = counts[:limit]
+	}
+	return counts
+}
+
+//export getRegionAnalytics
+func getRegionAnalytics(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	limit := getIntParam(h, "limit", defaultLeaderboardLimit)
+	if limit < 1 || limit > maxLeaderboardLimit {
+		return handleHTTPError(h, fmt.Errorf("limit must be between 1 and %d", maxLeaderboardLimit), 400)
+	}
+	return sendJSONResponse(h, map[string]interface{}{
+		"room":           room,
+		"tileSize":       analyticsTileSize,
+		"shardSize":      shardSize,
+		"mostRequested":  rankRegionUsage(room, usageRequests, analyticsTileSize, limit),
+		"mostSubscribed": rankRegionUsage(room, usageSubscriptions, shardSize, limit),
+		"mostDiscussed":  discussedRegions(room, limit),
+	})
+}
@@ -0,0 +1,332 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+const (
+	maxReminderBytes    = 500
+	maxRemindersPerRoom = 20
+)
+
+// Missed minutes further back than this are not caught up on
+const reminderCatchUp = 24 * time.Hour
+
+// Reminders are checked every minute, the finest step a cron expression has
+func init() {
+	registerJob(ScheduledJob{
+		Name:     "chatReminders",
+		Interval: time.Minute,
+		Run:      runChatReminders,
+	})
+}
+
+// cronSchedule holds the allowed values of each field of a five-field cron
+// expression: minute, hour, day of month, month and day of week
+type cronSchedule struct {
+	minutes, hours, days, months, weekdays map[int]bool
+	// Standard cron matches either day field when both are restricted
+	anyDay, anyWeekday bool
+}
+
+// Parse one cron field: "*", numbers, "a-b" ranges and "/n" steps, comma separated
+func parseCronField(field string, min, max int) (map[int]bool, error) {
+	values := make(map[int]bool)
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if base, stepText, found := strings.Cut(part, "/"); found {
+			n, err := strconv.Atoi(stepText)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid step in %q", part)
+			}
+			part, step = base, n
+		}
+		low, high := min, max
+		if part != "*" {
+			lowText, highText, isRange := strings.Cut(part, "-")
+			var err error
+			if low, err = strconv.Atoi(lowText); err != nil {
+				return nil, fmt.Errorf("invalid value %q", part)
+			}
+			high = low
+			if isRange {
+				if high, err = strconv.Atoi(highText); err != nil {
+					return nil, fmt.Errorf("invalid range %q", part)
+				}
+			} else if step > 1 {
+				high = max
+			}
+		}
+		if low < min || high > max || low > high {
+			return nil, fmt.Errorf("%q is outside %d-%d", part, min, max)
+		}
+		for value := low; value <= high; value += step {
+			values[value] = true
+		}
+	}
+	return values, nil
+}
+
+func parseCron(expression string) (cronSchedule, error) {
+	var schedule cronSchedule
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return schedule, fmt.Errorf("cron expression must have 5 fields: minute hour day month weekday")
+	}
+	var err error
+	if schedule.minutes, err = parseCronField(fields[0], 0, 59); err != nil {
+		return schedule, fmt.Errorf("minute: %v", err)
+	}
+	if schedule.hours, err = parseCronField(fields[1], 0, 23); err != nil {
+		return schedule, fmt.Errorf("hour: %v", err)
+	}
+	if schedule.days, err = parseCronField(fields[2], 1, 31); err != nil {
+		return schedule, fmt.Errorf("day: %v", err)
+	}
+	if schedule.months, err = parseCronField(fields[3], 1, 12); err != nil {
+		return schedule, fmt.Errorf("month: %v", err)
+	}
+	if schedule.weekdays, err = parseCronField(fields[4], 0, 7); err != nil {
+		return schedule, fmt.Errorf("weekday: %v", err)
+	}
+	// Sunday is both 0 and 7
+	if schedule.weekdays[7] {
+		schedule.weekdays[0] = true
+	}
+	schedule.anyDay = strings.HasPrefix(fields[2], "*")
+	schedule.anyWeekday = strings.HasPrefix(fields[4], "*")
+	return schedule, nil
+}
+
+// Whether the schedule fires in the minute of t, in UTC
+func (s cronSchedule) matches(t time.Time) bool {
+	t = t.UTC()
+	if !s.minutes[t.Minute()] || !s.hours[t.Hour()] || !s.months[int(t.Month())] {
+		return false
+	}
+	day, weekday := s.days[t.Day()], s.weekdays[int(t.Weekday())]
+	if !s.anyDay && !s.anyWeekday {
+		return day || weekday
+	}
+	return day && weekday
+}
+
+// Whether the schedule fires in any minute after since, up to and including now
+func (s cronSchedule) dueBetween(since, now time.Time) bool {
+	if earliest := now.Add(-reminderCatchUp); since.Before(earliest) {
+		since = earliest
+	}
+	for t := since.Truncate(time.Minute).Add(time.Minute); !t.After(now); t = t.Add(time.Minute) {
+		if s.matches(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func reminderPrefix(room string) string {
+	return fmt.Sprintf("/%s/reminders/", room)
+}
+
+func reminderKey(room string, id int64) string {
+	return fmt.Sprintf("%s%012d", reminderPrefix(room), id)
+}
+
+func reminderSeqKey(room string) string {
+	return fmt.Sprintf("/%s/reminder-seq", room)
+}
+
+func loadReminders(room string) []ChatReminder {
+	reminders := make([]ChatReminder, 0)
+	db, dbErr := getModerationDB()
+	if dbErr != 0 {
+		return reminders
+	}
+	keys, _ := db.List(reminderPrefix(room))
+	sort.Strings(keys)
+	for _, key := range keys {
+		data, err := db.Get(key)
+		if err != nil {
+			continue
+		}
+		var reminder ChatReminder
+		if json.Unmarshal(data, &reminder) == nil {
+			reminders = append(reminders, reminder)
+		}
+	}
+	return reminders
+}
+
+// Store and announce a message from the server in the room's chat
+func postSystemMessage(room, text string, now time.Time) uint32 {
+	message := ChatMessage{
+		ID:        fmt.Sprintf("system-%d", now.UnixNano()),
+		UserID:    "system",
+		Username:  "system",
+		Message:   text,
+		Timestamp: now.UnixMilli(),
+	}
+	if code := applyChatMessage(room, message, message.Timestamp); code != 0 {
+		return code
+	}
+	return publishRoomEvent(room, "events", "systemMessage", message)
+}
+
+// Post every reminder whose schedule came due since it last ran
+func runChatReminders(now time.Time) error {
+	roomsDB, dbErr := getRoomsDB()
+	if dbErr != 0 {
+		return fmt.Errorf("database connection failed")
+	}
+	db, dbErr := getModerationDB()
+	if dbErr != 0 {
+		return fmt.Errorf("database connection failed")
+	}
+	keys, err := roomsDB.List(roomMetaPrefix)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		room := key[len(roomMetaPrefix):]
+		if isArchivedRoom(room) {
+			continue
+		}
+		if _, active := maintenanceStatus(room); active {
+			continue
+		}
+		for _, reminder := range loadReminders(room) {
+			schedule, err := parseCron(reminder.Cron)
+			if err != nil {
+				continue
+			}
+			since := reminder.LastRunAt
+			if since == 0 {
+				since = reminder.CreatedAt
+			}
+			if !schedule.dueBetween(time.UnixMilli(since), now) {
+				continue
+			}
+			if postSystemMessage(room, reminder.Message, now) != 0 {
+				logError("runChatReminders", room, "failed to post reminder %d", reminder.ID)
+				continue
+			}
+			reminder.LastRunAt = now.UnixMilli()
+			if err := putJSON(db, reminderKey(room, reminder.ID), reminder); err != nil {
+				logError("runChatReminders", room, "failed to save reminder %d: %v", reminder.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+//export scheduleReminder
+func scheduleReminder(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	var reminder ChatReminder
+	if err := readJSONBody(h, &reminder); err != nil {
+		return handleHTTPError(h, err, 400)
+	}
+	reminder.Message = strings.TrimSpace(reminder.Message)
+	if reminder.Message == "" || len(reminder.Message) > maxReminderBytes {
+		return handleHTTPError(h, fmt.Errorf("message must be 1-%d bytes", maxReminderBytes), 400)
+	}
+	if _, err := parseCron(reminder.Cron); err != nil {
+		return handleHTTPError(h, err, 400)
+	}
+	if len(loadReminders(room)) >= maxRemindersPerRoom {
+		return handleHTTPError(h, fmt.Errorf("rooms can have at most %d reminders", maxRemindersPerRoom), 409)
+	}
+	db, dbErr := getModerationDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	reminder.CreatedBy, _ = h.Query().Get("moderator")
+	reminder.ID = readCounter(db, reminderSeqKey(room)) + 1
+	reminder.CreatedAt = time.Now().UnixMilli()
+	reminder.LastRunAt = 0
+	if err := writeCounter(db, reminderSeqKey(room), reminder.ID); err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	if err := putJSON(db, reminderKey(room, reminder.ID), reminder); err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	logInfo("scheduleReminder", room, "scheduled reminder %d at %q", reminder.ID, reminder.Cron)
+	return sendJSONResponse(h, reminder)
+}
+
+//export getReminders
+func getReminders(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	return sendJSONResponse(h, loadReminders(room))
+}
+
+//export deleteReminder
+func deleteReminder(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	id := int64(getIntParam(h, "id", 0))
+	db, dbErr := getModerationDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	key := reminderKey(room, id)
+	if data, err := db.Get(key); err != nil || len(data) == 0 {
+		return handleHTTPError(h, fmt.Errorf("reminder %d not found", id), 404)
+	}
+	if err := db.Delete(key); err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	logInfo("deleteReminder", room, "deleted reminder %d", id)
+	return sendJSONResponse(h, map[string]interface{}{"room": room, "id": id, "deleted": true})
+}
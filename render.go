@@ -0,0 +1,104 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strconv"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+// Exported images are capped at this many pixels per side
+const maxExportSide = 4096
+
+// Parse a #rrggbb color; invalid values render as white
+func parseHexColor(value string) color.RGBA {
+	if !isValidHexColor(value) {
+		return color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	}
+	rgb, _ := strconv.ParseUint(value[1:], 16, 32)
+	return color.RGBA{R: uint8(rgb >> 16), G: uint8(rgb >> 8), B: uint8(rgb), A: 0xff}
+}
+
+// Render a color grid to PNG with each cell drawn as a scale x scale block
+func renderGridPNG(grid [][]string, scale int) ([]byte, error) {
+	if scale < 1 {
+		scale = 1
+	}
+	width := 0
+	for _, row := range grid {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+	img := image.NewRGBA(image.Rect(0, 0, width*scale, len(grid)*scale))
+	for y, row := range grid {
+		for x, value := range row {
+			c := parseHexColor(value)
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetRGBA(x*scale+dx, y*scale+dy, c)
+				}
+			}
+		}
+	}
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, img); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+//export exportCanvas
+func exportCanvas(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	if _, code := checkAnonymousRead(h, room); code != 0 {
+		return code
+	}
+	remap, err := getColorRemapParam(h)
+	if err != nil {
+		return handleHTTPError(h, err, 404)
+	}
+	if ensureRoomSchema(room) != 0 {
+		return handleHTTPError(h, fmt.Errorf("room migration failed"), 500)
+	}
+	width, height := roomSize(room)
+	side := width
+	if height > side {
+		side = height
+	}
+	scale := getIntParam(h, "scale", 1)
+	if scale < 1 || side*scale > maxExportSide {
+		return handleHTTPError(h, fmt.Errorf("scale must be between 1 and %d", maxExportSide/side), 400)
+	}
+	grid, dbErr := loadCanvasGrid(room)
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("failed to load canvas"), 500)
+	}
+	pngData, err := renderGridPNG(remapCanvas(grid, remap), scale)
+	if err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	h.Headers().Set("Content-Type", "image/png")
+	h.Headers().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"%s.png\"", room))
+	h.Write(pngData)
+	h.Return(200)
+	return 0
+}
@@ -0,0 +1,209 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/taubyte/go-sdk/database"
+	"github.com/taubyte/go-sdk/event"
+)
+
+type RepairReport struct {
+	Room                 string   `json:"room"`
+	DryRun               bool     `json:"dryRun"`
+	Scanned              int      `json:"scanned"`
+	RemovedInvalidKeys   []string `json:"removedInvalidKeys"`
+	Rewritten            []string `json:"rewritten"`
+	RemovedUnrecoverable []string `json:"removedUnrecoverable"`
+}
+
+func (r *RepairReport) remove(db database.Database, key string, list *[]string) {
+	*list = append(*list, key)
+	if !r.DryRun {
+		db.Delete(key)
+	}
+}
+
+func (r *RepairReport) rewrite(db database.Database, key string, v interface{}) {
+	r.Rewritten = append(r.Rewritten, key)
+	if !r.DryRun {
+		if err := putJSON(db, key, v); err != nil {
+			logError("rewrite", "", "repair failed to rewrite key %s: %v", key, err)
+		}
+	}
+}
+
+// Try to recover a JSON value: strip padding bytes, then accept a bare color for pixels
+func recoverJSON(data []byte, v interface{}) bool {
+	trimmed := bytes.Trim(data, " \t\r\n\x00")
+	if json.Unmarshal(trimmed, v) == nil {
+		return true
+	}
+	// Truncated objects sometimes only lose their closing brace
+	if len(trimmed) > 0 && trimmed[0] == '{' && trimmed[len(trimmed)-1] != '}' {
+		if json.Unmarshal(append(trimmed, '}'), v) == nil {
+			return true
+		}
+	}
+	if pixel, ok := v.(*Pixel); ok {
+		color := strings.Trim(string(trimmed), "\"")
+		if isValidHexColor(color) {
+			*pixel = Pixel{Color: strings.ToLower(color), UserID: "unknown", Username: "unknown"}
+			return true
+		}
+	}
+	return false
+}
+
+func repairLegacyCanvas(room string, report *RepairReport) {
+	db, dbErr := getCanvasDB()
+	if dbErr != 0 {
+		return
+	}
+	width, height := roomSize(room)
+	prefix := fmt.Sprintf("/%s/", room)
+	keys, _ := db.List(prefix)
+	for _, key := range keys {
+		if len(key) <= len(prefix) {
+			continue
+		}
+		report.Scanned++
+		var x, y int
+		if n, err := fmt.Sscanf(key[len(prefix):], "%d:%d", &x, &y); n != 2 || err != nil ||
+			x < 0 || x >= width || y < 0 || y >= height {
+			report.remove(db, key, &report.RemovedInvalidKeys)
+			continue
+		}
+		data, err := db.Get(key)
+		if err != nil {
+			continue
+		}
+		var pixel Pixel
+		if json.Unmarshal(data, &pixel) == nil && isValidHexColor(pixel.Color) && pixel.X == x && pixel.Y == y {
+			continue
+		}
+		pixel = Pixel{}
+		if !recoverJSON(data, &pixel) || !isValidHexColor(pixel.Color) {
+			report.remove(db, key, &report.RemovedUnrecoverable)
+			continue
+		}
+		pixel.X, pixel.Y = x, y
+		report.rewrite(db, key, pixel)
+	}
+}
+
+func repairChunkedCanvas(room string, report *RepairReport) {
+	db, dbErr := getChunksDB()
+	if dbErr != 0 {
+		return
+	}
+	width, height := roomSize(room)
+	prefix := fmt.Sprintf("/%s/", room)
+	keys, _ := db.List(prefix)
+	for _, key := range keys {
+		if len(key) <= len(prefix) {
+			continue
+		}
+		report.Scanned++
+		var cx, cy int
+		if n, err := fmt.Sscanf(key[len(prefix):], "%d:%d", &cx, &cy); n != 2 || err != nil ||
+			cx < 0 || cx*chunkSize >= width || cy < 0 || cy*chunkSize >= height {
+			report.remove(db, key, &report.RemovedInvalidKeys)
+			continue
+		}
+		data, err := db.Get(key)
+		if err != nil {
+			continue
+		}
+		var chunk CanvasChunk
+		if !recoverJSON(data, &chunk) {
+			report.remove(db, key, &report.RemovedUnrecoverable)
+			continue
+		}
+		changed := json.Unmarshal(data, &CanvasChunk{}) != nil
+		if len(chunk.Cells) != chunkSize*chunkSize {
+			cells := make([]*Pixel, chunkSize*chunkSize)
+			copy(cells, chunk.Cells)
+			chunk.Cells = cells
+			changed = true
+		}
+		for i, cell := range chunk.Cells {
+			if cell != nil && !isValidHexColor(cell.Color) {
+				chunk.Cells[i] = nil
+				changed = true
+			}
+		}
+		if changed {
+			report.rewrite(db, key, chunk)
+		}
+	}
+}
+
+func repairChat(room string, report *RepairReport) {
+	db, dbErr := getChatDB()
+	if dbErr != 0 {
+		return
+	}
+	prefix := fmt.Sprintf("/%s/", room)
+	keys, _ := db.List(prefix)
+	for _, key := range keys {
+		if len(key) <= len(prefix) {
+			continue
+		}
+		report.Scanned++
+		data, err := db.Get(key)
+		if err != nil {
+			continue
+		}
+		var message ChatMessage
+		if json.Unmarshal(data, &message) == nil {
+			continue
+		}
+		if !recoverJSON(data, &message) || message.ID == "" {
+			report.remove(db, key, &report.RemovedUnrecoverable)
+			continue
+		}
+		report.rewrite(db, key, message)
+	}
+}
+
+//export repairRoom
+func repairRoom(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	dryRun, _ := h.Query().Get("dryRun")
+	report := RepairReport{
+		Room:                 room,
+		DryRun:               dryRun == "true",
+		RemovedInvalidKeys:   []string{},
+		Rewritten:            []string{},
+		RemovedUnrecoverable: []string{},
+	}
+	// Rewrites race with pixel writers, so the canvas is repaired under their lock
+	lock := roomWriteLock(room)
+	lock.Lock()
+	repairLegacyCanvas(room, &report)
+	repairChunkedCanvas(room, &report)
+	lock.Unlock()
+	repairChat(room, &report)
+	if !report.DryRun {
+		invalidateCanvasChecksum(room)
+	}
+	logInfo("repairRoom", room, "scanned %d keys, removed %d invalid, rewrote %d, removed %d unrecoverable", report.Scanned, len(report.RemovedInvalidKeys), len(report.Rewritten), len(report.RemovedUnrecoverable))
+	return sendJSONResponse(h, report)
+}
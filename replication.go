@@ -0,0 +1,273 @@
+package lib
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+	"github.com/taubyte/go-sdk/http/client"
+	pubsub "github.com/taubyte/go-sdk/pubsub/node"
+)
+
+// Last sequence sent for a room on the primary
+func replicationSeqKey(room string) string {
+	return fmt.Sprintf("/%s/seq", room)
+}
+
+// Last sequence applied for a room on the mirror
+func replicationAppliedKey(room string) string {
+	return fmt.Sprintf("/%s/applied", room)
+}
+
+// Number of sequences the mirror never received
+func replicationGapsKey(room string) string {
+	return fmt.Sprintf("/%s/gaps", room)
+}
+
+// Forward an accepted payload to the configured relay channel and HTTP sink
+func replicateIntent(kind, room string, payload []byte) {
+	config := loadGlobalConfig()
+	if config.ReplicationChannel == "" && config.ReplicationSinkURL == "" {
+		return
+	}
+	if !loadRoomSettings(room).Replicate {
+		return
+	}
+	db, dbErr := getReplicationDB()
+	if dbErr != 0 {
+		logError("replicateIntent", room, "database connection failed")
+		return
+	}
+	seq := readCounter(db, replicationSeqKey(room)) + 1
+	if err := writeCounter(db, replicationSeqKey(room), seq); err != nil {
+		logError("replicateIntent", room, "failed to save sequence: %v", err)
+		return
+	}
+	if config.ReplicationSecret == "" {
+		logError("replicateIntent", room, "replicationSecret is not configured, mirrors would drop event %d", seq)
+	}
+	replicated := ReplicationEvent{
+		Room:      room,
+		Seq:       seq,
+		Kind:      kind,
+		Payload:   payload,
+		Timestamp: time.Now().UnixMilli(),
+	}
+	if config.ReplicationSecret != "" {
+		replicated.Signature = replicationSignature(config.ReplicationSecret, replicated)
+	}
+	data, err := json.Marshal(replicated)
+	if err != nil {
+		logError("replicateIntent", room, "failed to marshal event %d: %v", seq, err)
+		return
+	}
+
+	// A failed delivery leaves a sequence gap the mirror can detect
+	if config.ReplicationChannel != "" {
+		channel, err := pubsub.Channel(config.ReplicationChannel)
+		if err == nil {
+			err = channel.Publish(data)
+		}
+		if err != nil {
+			logError("replicateIntent", room, "failed to publish event %d: %v", seq, err)
+		}
+	}
+	if config.ReplicationSinkURL != "" {
+		if err := postReplicationEvent(config.ReplicationSinkURL, data); err != nil {
+			logError("replicateIntent", room, "failed to post event %d: %v", seq, err)
+		}
+	}
+}
+
+func postReplicationEvent(sinkURL string, data []byte) error {
+	httpClient, err := client.New()
+	if err != nil {
+		return err
+	}
+	request, err := httpClient.Request(sinkURL,
+		client.Method("POST"),
+		client.Headers(map[string][]string{"Content-Type": {"application/json"}}),
+		client.Body(data),
+	)
+	if err != nil {
+		return err
+	}
+	_, err = request.Do()
+	return err
+}
+
+// HMAC over every field of the event except the signature itself
+func replicationSignature(secret string, replicated ReplicationEvent) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%d\n%s\n%d\n", replicated.Room, replicated.Seq, replicated.Kind, replicated.Timestamp)
+	mac.Write(replicated.Payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Whether the event was signed with this deployment's replication secret
+func replicationSignatureValid(replicated ReplicationEvent) bool {
+	secret := loadGlobalConfig().ReplicationSecret
+	if secret == "" || replicated.Signature == "" {
+		return false
+	}
+	return hmac.Equal([]byte(replicated.Signature), []byte(replicationSignature(secret, replicated)))
+}
+
+// Replay a replicated payload through the same gates live traffic passes, so
+// a mirror never stores what its own clients could not write. The payload must
+// name the room the event is sequenced under. Returns whether it was admitted.
+func replayReplicatedEvent(replicated ReplicationEvent) (bool, error) {
+	switch replicated.Kind {
+	case IntentPixels:
+		batch, err := decodePixelBatch(replicated.Payload)
+		if err != nil {
+			return false, fmt.Errorf("invalid pixel payload: %v", err)
+		}
+		if batch.Room != replicated.Room {
+			return false, fmt.Errorf("payload room %s does not match event room %s", batch.Room, replicated.Room)
+		}
+		if !admitPixelBatch(batch) {
+			return false, nil
+		}
+		if applyPixelBatch(batch) != 0 {
+			return false, fmt.Errorf("failed to apply event %d", replicated.Seq)
+		}
+		return true, nil
+	case IntentChat:
+		chatMessage, room, sessionToken, err := decodeChatMessage(replicated.Payload)
+		if err != nil {
+			return false, fmt.Errorf("invalid chat payload: %v", err)
+		}
+		if room != replicated.Room {
+			return false, fmt.Errorf("payload room %s does not match event room %s", room, replicated.Room)
+		}
+		if !admitChatMessage(room, &chatMessage, sessionToken) {
+			return false, nil
+		}
+		if applyChatMessage(room, chatMessage, replicated.Timestamp) != 0 {
+			return false, fmt.Errorf("failed to apply event %d", replicated.Seq)
+		}
+		return true, nil
+	}
+	return false, fmt.Errorf("unknown event kind %s", replicated.Kind)
+}
+
+// Apply a replicated event on the mirror, skipping duplicates and counting gaps.
+// Returns whether the event was applied.
+func applyReplicationEvent(replicated ReplicationEvent) (bool, error) {
+	db, dbErr := getReplicationDB()
+	if dbErr != 0 {
+		return false, fmt.Errorf("replication database connection failed")
+	}
+	applied := readCounter(db, replicationAppliedKey(replicated.Room))
+	if replicated.Seq <= applied {
+		logDebug("applyReplicationEvent", replicated.Room, "skipping duplicate event %d", replicated.Seq)
+		return false, nil
+	}
+	if replicated.Seq > applied+1 {
+		missing := replicated.Seq - applied - 1
+		logError("applyReplicationEvent", "", "room %s missed %d events before %d", replicated.Room, missing, replicated.Seq)
+		writeCounter(db, replicationGapsKey(replicated.Room), readCounter(db, replicationGapsKey(replicated.Room))+missing)
+	}
+	// Events the gates drop still advance the sequence, so they never count as gaps
+	admitted, err := replayReplicatedEvent(replicated)
+	if err != nil {
+		return false, err
+	}
+	if err := writeCounter(db, replicationAppliedKey(replicated.Room), replicated.Seq); err != nil {
+		return admitted, fmt.Errorf("failed to save applied sequence: %v", err)
+	}
+	return admitted, nil
+}
+
+//export onReplicationEvent
+func onReplicationEvent(e event.Event) uint32 {
+	channel, err := e.PubSub()
+	if err != nil {
+		return 1
+	}
+	data, err := channel.Data()
+	if err != nil {
+		return 1
+	}
+	var replicated ReplicationEvent
+	if err := json.Unmarshal(data, &replicated); err != nil {
+		logError("onReplicationEvent", "", "invalid event: %v", err)
+		return 1
+	}
+	if !replicationSignatureValid(replicated) {
+		logError("onReplicationEvent", "", "dropping unsigned event %d for room %s", replicated.Seq, replicated.Room)
+		return 1
+	}
+	if _, err := applyReplicationEvent(replicated); err != nil {
+		logError("onReplicationEvent", "", "room %s: %v", replicated.Room, err)
+		return 1
+	}
+	return 0
+}
+
+//export receiveReplication
+func receiveReplication(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	body, err := io.ReadAll(h.Body())
+	if err != nil {
+		return handleHTTPError(h, fmt.Errorf("failed to read request body: %v", err), 400)
+	}
+	var replicated ReplicationEvent
+	if err := json.Unmarshal(body, &replicated); err != nil || replicated.Room == "" {
+		return handleHTTPError(h, fmt.Errorf("invalid replication event"), 400)
+	}
+	// Sinks are posted to by the primary with a signature; operators may push
+	// events by hand with the shared admin secret
+	if !replicationSignatureValid(replicated) && !hasAdminToken(h, "") {
+		return handleHTTPError(h, fmt.Errorf("replication signature or admin token required"), 401)
+	}
+	applied, err := applyReplicationEvent(replicated)
+	if err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	return sendJSONResponse(h, map[string]interface{}{
+		"room":    replicated.Room,
+		"seq":     replicated.Seq,
+		"applied": applied,
+	})
+}
+
+//export getReplicationStatus
+func getReplicationStatus(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	db, dbErr := getReplicationDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	return sendJSONResponse(h, map[string]interface{}{
+		"room":      room,
+		"replicate": loadRoomSettings(room).Replicate,
+		"sent":      readCounter(db, replicationSeqKey(room)),
+		"applied":   readCounter(db, replicationAppliedKey(room)),
+		"gaps":      readCounter(db, replicationGapsKey(room)),
+	})
+}
@@ -0,0 +1,117 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+// Tiers from lowest to highest; a user holds the highest tier whose requirements they meet
+var reputationTiers = []ReputationTier{
+	{Name: "newcomer", MaxBatchSize: 512, CooldownFactor: 100},
+	{Name: "regular", MinAgeDays: 1, MinPlacements: 100, MaxBatchSize: 1024, CooldownFactor: 75},
+	{Name: "trusted", MinAgeDays: 7, MinPlacements: 1000, MaxBatchSize: 2048, CooldownFactor: 50},
+	{Name: "veteran", MinAgeDays: 30, MinPlacements: 10000, MaxBatchSize: maxPixelBatchSize, CooldownFactor: 25},
+}
+
+func userStatsKey(userID string) string {
+	return fmt.Sprintf(globalKeyPrefix+"users/%s", userID)
+}
+
+func loadUserStats(userID string) UserStats {
+	stats := UserStats{UserID: userID}
+	db, dbErr := getStatsDB()
+	if dbErr != 0 {
+		return stats
+	}
+	data, err := db.Get(userStatsKey(userID))
+	if err != nil || len(data) == 0 {
+		return stats
+	}
+	if err := json.Unmarshal(data, &stats); err != nil {
+		logError("loadUserStats", "", "failed to unmarshal stats for user %s: %v", userID, err)
+	}
+	return stats
+}
+
+// Add saved placements to each author's activity stats and streaks
+func updateUserStats(room string, changes []PixelChange) uint32 {
+	counts := make(map[string]int64)
+	for _, change := range changes {
+		counts[change.Pixel.UserID]++
+	}
+	db, dbErr := getStatsDB()
+	if dbErr != 0 {
+		return dbErr
+	}
+	now := time.Now()
+	for userID, count := range counts {
+		if userID == "" || userID == "unknown" {
+			continue
+		}
+		stats := loadUserStats(userID)
+		if stats.FirstSeen == 0 {
+			stats.FirstSeen = now.UnixMilli()
+		}
+		stats.LastSeen = now.UnixMilli()
+		stats.Placements += count
+		milestone := advanceStreak(&stats, now)
+		if err := putJSON(db, userStatsKey(userID), stats); err != nil {
+			logError("updateUserStats", room, "failed to save stats for user %s: %v", userID, err)
+			continue
+		}
+		if milestone > 0 {
+			announceStreakMilestone(room, userID, milestone)
+		}
+	}
+	return 0
+}
+
+func tierForStats(stats UserStats) ReputationTier {
+	ageDays := 0
+	if stats.FirstSeen > 0 {
+		ageDays = int(time.Since(time.UnixMilli(stats.FirstSeen)).Hours() / 24)
+	}
+	tier := reputationTiers[0]
+	for _, candidate := range reputationTiers[1:] {
+		if ageDays >= candidate.MinAgeDays && stats.Placements >= candidate.MinPlacements {
+			tier = candidate
+		}
+	}
+	return tier
+}
+
+func userTier(userID string) ReputationTier {
+	return tierForStats(loadUserStats(userID))
+}
+
+//export getUserTier
+func getUserTier(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	userID, err := h.Query().Get("userId")
+	if err != nil || userID == "" {
+		return handleHTTPError(h, fmt.Errorf("userId parameter required"), 400)
+	}
+	stats := loadUserStats(userID)
+	tier := tierForStats(stats)
+	response := map[string]interface{}{
+		"userId": userID,
+		"tier":   tier,
+		"stats":  stats,
+	}
+	for i, candidate := range reputationTiers {
+		if candidate.Name == tier.Name && i+1 < len(reputationTiers) {
+			response["nextTier"] = reputationTiers[i+1]
+		}
+	}
+	return sendJSONResponse(h, response)
+}
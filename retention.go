@@ -0,0 +1,83 @@
+package lib
+
+import (
+	"fmt"
+	"time"
+)
+
+// Retention is enforced for idle rooms by this job as well as after each batch
+func init() {
+	registerJob(ScheduledJob{
+		Name:     "retention",
+		Interval: time.Hour,
+		Run:      enforceRetention,
+	})
+}
+
+// The room's retention policy: its tier (or the deployment default tier),
+// with the room's own non-zero history quota and snapshot retention on top
+func roomRetention(room string) RetentionTier {
+	settings := loadRoomSettings(room)
+	config := loadGlobalConfig()
+	name := settings.RetentionTier
+	if name == "" {
+		name = config.DefaultRetentionTier
+	}
+	retention := config.RetentionTiers[name]
+	retention.Name = name
+	if settings.Quotas.MaxHistoryEntries > 0 {
+		retention.MaxHistoryEntries = settings.Quotas.MaxHistoryEntries
+	}
+	if settings.SnapshotRetentionHours > 0 {
+		retention.SnapshotRetentionHours = settings.SnapshotRetentionHours
+	}
+	return retention
+}
+
+// Time between snapshot frames under the policy
+func (retention RetentionTier) snapshotInterval() time.Duration {
+	if retention.SnapshotIntervalMinutes > 0 {
+		return time.Duration(retention.SnapshotIntervalMinutes) * time.Minute
+	}
+	return snapshotInterval
+}
+
+func validateRetentionTiers(config GlobalConfig) error {
+	for name, tier := range config.RetentionTiers {
+		if !roomIDPattern.MatchString(name) {
+			return fmt.Errorf("retention tier name %q is invalid", name)
+		}
+		if tier.HistoryDays < 0 || tier.MaxHistoryEntries < 0 || tier.SnapshotRetentionHours < 0 || tier.SnapshotIntervalMinutes < 0 ||
+			tier.CheckpointEvery < 0 || tier.RecentHistoryHours < 0 {
+			return fmt.Errorf("retention tier %s must not have negative limits", name)
+		}
+	}
+	if config.DefaultRetentionTier != "" {
+		if _, ok := config.RetentionTiers[config.DefaultRetentionTier]; !ok {
+			return fmt.Errorf("defaultRetentionTier %s is not a configured tier", config.DefaultRetentionTier)
+		}
+	}
+	return nil
+}
+
+// Prune history and snapshots of every room according to its policy, and
+// checkpoint and compact its placement log
+func enforceRetention(now time.Time) error {
+	db, dbErr := getRoomsDB()
+	if dbErr != 0 {
+		return fmt.Errorf("rooms database connection failed")
+	}
+	keys, err := db.List(roomMetaPrefix)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		room := key[len(roomMetaPrefix):]
+		enforceHistoryQuota(room)
+		checkpointHistory(room, now)
+		if hours := roomRetention(room).SnapshotRetentionHours; hours > 0 {
+			pruneSnapshots(room, now.Add(-time.Duration(hours)*time.Hour).UnixMilli())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,332 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/taubyte/go-sdk/database"
+	"github.com/taubyte/go-sdk/event"
+	http "github.com/taubyte/go-sdk/http/event"
+)
+
+// Largest width or height served as a single canvas; bigger rooms are sharded
+const maxCanvasDimension = 256
+
+// Largest width or height a room may be created with, keeping per-room keys bounded
+const maxShardedDimension = 1024
+
+// Room used by clients that do not name one; it never needs to be created
+const defaultRoomName = "default"
+
+const roomMetaPrefix = globalKeyPrefix + "meta/"
+
+// Room IDs end up in database keys and channel names. The pattern keeps them
+// out of globalKeyPrefix, so no room name can reach a global key.
+var roomIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Whether the name would make the room's <room>-<kind> channels read as a
+// user's inbox channel
+func reservedRoomName(room string) bool {
+	return room == "inbox" || strings.HasPrefix(room, inboxChannelPrefix)
+}
+
+// Whether the name can be used as a room ID
+func validRoomID(room string) bool {
+	return roomIDPattern.MatchString(room) && !reservedRoomName(room)
+}
+
+func roomMetaKey(room string) string {
+	return roomMetaPrefix + room
+}
+
+func loadRoomMetadata(room string) (RoomMetadata, bool) {
+	var metadata RoomMetadata
+	db, dbErr := getRoomsDB()
+	if dbErr != 0 {
+		return metadata, false
+	}
+	data, err := db.Get(roomMetaKey(room))
+	if err != nil || len(data) == 0 {
+		return metadata, false
+	}
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		logError("loadRoomMetadata", room, "failed to unmarshal metadata: %v", err)
+		return metadata, false
+	}
+	return metadata, true
+}
+
+func saveRoomMetadata(metadata RoomMetadata) uint32 {
+	db, dbErr := getRoomsDB()
+	if dbErr != 0 {
+		return dbErr
+	}
+	if err := putJSON(db, roomMetaKey(metadata.Room), metadata); err != nil {
+		logError("saveRoomMetadata", metadata.Room, "failed: %v", err)
+		return 1
+	}
+	return 0
+}
+
+// Room that payloads and requests naming none are placed in, per the
+// deployment's default room mode
+func fallbackRoom() (string, error) {
+	config := loadGlobalConfig()
+	switch config.DefaultRoomMode {
+	case DefaultRoomDeny:
+		return "", fmt.Errorf("room is required")
+	case DefaultRoomMap:
+		return config.DefaultRoomTarget, nil
+	}
+	return defaultRoomName, nil
+}
+
+// Whether the room is one unnamed traffic can land in
+func isFallbackRoom(room string) bool {
+	if room == defaultRoomName {
+		return true
+	}
+	config := loadGlobalConfig()
+	return config.DefaultRoomMode == DefaultRoomMap && room == config.DefaultRoomTarget
+}
+
+// Whether the room is registered. Fallback rooms and rooms created implicitly
+// before the registry (they have a schema record) count as registered; the
+// room-metadata migration gives them a registry entry.
+func roomExists(room string) bool {
+	if !validRoomID(room) {
+		return false
+	}
+	if _, found := loadRoomMetadata(room); found {
+		return true
+	}
+	if isFallbackRoom(room) {
+		return true
+	}
+	db, dbErr := getSchemaDB()
+	if dbErr != 0 {
+		return false
+	}
+	data, err := db.Get(schemaKey(room))
+	return err == nil && len(data) > 0
+}
+
+// Schema migration registering rooms that predate the registry with the
+// default size and public visibility
+func backfillRoomMetadata(room string) error {
+	if _, found := loadRoomMetadata(room); found {
+		return nil
+	}
+	metadata := RoomMetadata{
+		Room:       room,
+		Name:       room,
+		CreatedAt:  time.Now().UnixMilli(),
+		Width:      CanvasWidth,
+		Height:     CanvasHeight,
+		Visibility: VisibilityPublic,
+		Seed:       newRoomSeed(),
+	}
+	if saveRoomMetadata(metadata) != 0 {
+		return fmt.Errorf("failed to save room metadata")
+	}
+	return nil
+}
+
+// Canvas width and height of the room, the defaults for unregistered rooms
+func roomSize(room string) (int, int) {
+	if metadata, found := loadRoomMetadata(room); found && metadata.Width > 0 && metadata.Height > 0 {
+		return metadata.Width, metadata.Height
+	}
+	return CanvasWidth, CanvasHeight
+}
+
+func inRoomBounds(room string, x, y int) bool {
+	width, height := roomSize(room)
+	return x >= 0 && x < width && y >= 0 && y < height
+}
+
+// Respond 404 for rooms that were never created
+func requireRoom(h http.Event, room string) uint32 {
+	if !roomExists(room) {
+		return handleHTTPError(h, fmt.Errorf("room %s not found", room), 404)
+	}
+	return 0
+}
+
+// Remove everything stored under the room's prefix in its per-room databases
+func deleteRoomData(room string) {
+	pruneHotStorage(room)
+	deletePixelHistory(room)
+	invalidateScrubCache(room)
+	prefix := fmt.Sprintf("/%s/", room)
+	for _, open := range []func() (database.Database, uint32){
+		getStatsDB, getSettingsDB, getTeamsDB, getTemplatesDB, getModerationDB, getSnapshotsDB, getSessionsDB, getRateLimitDB, getPresenceDB,
+	} {
+		db, dbErr := open()
+		if dbErr != 0 {
+			continue
+		}
+		keys, _ := db.List(prefix)
+		for _, key := range keys {
+			db.Delete(key)
+		}
+	}
+	if db, dbErr := getSettingsDB(); dbErr == 0 {
+		db.Delete(settingsKey(room))
+	}
+	if db, dbErr := getSchemaDB(); dbErr == 0 {
+		db.Delete(schemaKey(room))
+	}
+	if db, dbErr := getConfigDB(); dbErr == 0 {
+		db.Delete(roomWordListKey(room))
+	}
+	migrationMutex.Lock()
+	delete(migratedRooms, room)
+	migrationMutex.Unlock()
+}
+
+//export createRoom
+func createRoom(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if !validRoomID(room) {
+		return handleHTTPError(h, fmt.Errorf("room must be 1-64 letters, digits, '-' or '_' and not a reserved name"), 400)
+	}
+	if roomExists(room) {
+		return handleHTTPError(h, fmt.Errorf("room %s already exists", room), 409)
+	}
+	metadata := RoomMetadata{
+		Room:       room,
+		CreatedAt:  time.Now().UnixMilli(),
+		Width:      getIntParam(h, "width", CanvasWidth),
+		Height:     getIntParam(h, "height", CanvasHeight),
+		Visibility: VisibilityPublic,
+		Seed:       newRoomSeed(),
+	}
+	metadata.Name, _ = h.Query().Get("name")
+	if metadata.Name == "" {
+		metadata.Name = room
+	}
+	metadata.Creator, _ = h.Query().Get("userId")
+	if visibility, _ := h.Query().Get("visibility"); visibility != "" {
+		if visibility != VisibilityPublic && visibility != VisibilityPrivate {
+			return handleHTTPError(h, fmt.Errorf("visibility must be '%s' or '%s'", VisibilityPublic, VisibilityPrivate), 400)
+		}
+		metadata.Visibility = visibility
+	}
+	if metadata.Width < 1 || metadata.Width > maxShardedDimension || metadata.Height < 1 || metadata.Height > maxShardedDimension {
+		return handleHTTPError(h, fmt.Errorf("width and height must be between 1 and %d", maxShardedDimension), 400)
+	}
+
+	if saveRoomMetadata(metadata) != 0 {
+		return handleHTTPError(h, fmt.Errorf("failed to save room"), 500)
+	}
+	if metadata.Visibility == VisibilityPrivate {
+		settings := loadRoomSettings(room)
+		settings.Private = true
+		saveRoomSettings(room, settings)
+	}
+	// Runs the schema setup and announces roomCreated
+	if ensureRoomSchema(room) != 0 {
+		return handleHTTPError(h, fmt.Errorf("room migration failed"), 500)
+	}
+	return sendJSONResponse(h, metadata)
+}
+
+//export listRooms
+func listRooms(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	db, dbErr := getRoomsDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	visibility, _ := h.Query().Get("visibility")
+	keys, _ := db.List(roomMetaPrefix)
+	type roomListing struct {
+		RoomMetadata
+		Custom map[string]string `json:"custom,omitempty"`
+	}
+	rooms := make([]roomListing, 0, len(keys))
+	for _, key := range keys {
+		data, err := db.Get(key)
+		if err != nil {
+			continue
+		}
+		var metadata RoomMetadata
+		if json.Unmarshal(data, &metadata) != nil {
+			continue
+		}
+		// Private rooms are only listed to an admin of the deployment or the room
+		if metadata.Visibility == VisibilityPrivate && !hasAdminToken(h, metadata.Room) {
+			continue
+		}
+		if visibility == "" || metadata.Visibility == visibility {
+			rooms = append(rooms, roomListing{metadata, loadRoomSettings(metadata.Room).Custom})
+		}
+	}
+	sort.Slice(rooms, func(i, j int) bool {
+		return rooms[i].CreatedAt < rooms[j].CreatedAt
+	})
+	return sendJSONResponse(h, rooms)
+}
+
+//export deleteRoom
+func deleteRoom(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	metadata, found := loadRoomMetadata(room)
+	if !found {
+		return handleHTTPError(h, fmt.Errorf("room %s not found", room), 404)
+	}
+	audit, code := guardDestructive(h, room, "deleteRoom", "")
+	if code != 0 {
+		return code
+	}
+	deleteRoomData(room)
+	deleteAdminToken(room)
+	db, dbErr := getRoomsDB()
+	if dbErr != 0 {
+		return failAudited(h, room, audit, fmt.Errorf("database connection failed"), 500)
+	}
+	if err := db.Delete(roomMetaKey(room)); err != nil {
+		return failAudited(h, room, audit, err, 500)
+	}
+	completeAudit(room, audit, nil)
+	publishLifecycleEvent(room, LifecycleDeleted, nil)
+	logInfo("deleteRoom", room, "deleted")
+	return sendJSONResponse(h, metadata)
+}
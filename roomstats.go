@@ -0,0 +1,205 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+// Cells tracked in RoomStats.MostEdited
+const maxMostEditedCells = 50
+
+func roomStatsKey(room string) string {
+	return fmt.Sprintf("/%s/summary", room)
+}
+
+func coordinateEditsKey(room string, x, y int) string {
+	return fmt.Sprintf("/%s/edits/%d:%d", room, x, y)
+}
+
+func loadRoomStats(room string) RoomStats {
+	stats := RoomStats{Users: make(map[string]Contributor)}
+	db, dbErr := getStatsDB()
+	if dbErr != 0 {
+		return stats
+	}
+	data, err := db.Get(roomStatsKey(room))
+	if err != nil || len(data) == 0 {
+		return stats
+	}
+	if err := json.Unmarshal(data, &stats); err != nil {
+		logError("loadRoomStats", room, "failed to unmarshal stats: %v", err)
+	}
+	if stats.Users == nil {
+		stats.Users = make(map[string]Contributor)
+	}
+	return stats
+}
+
+// Fold a cell's new edit count into the sorted most-edited list
+func rankEditedCell(cells []CoordinateEdits, cell CoordinateEdits) []CoordinateEdits {
+	for i := range cells {
+		if cells[i].X == cell.X && cells[i].Y == cell.Y {
+			cells = append(cells[:i], cells[i+1:]...)
+			break
+		}
+	}
+	if len(cells) >= maxMostEditedCells && cell.Edits <= cells[len(cells)-1].Edits {
+		return cells
+	}
+	i := sort.Search(len(cells), func(i int) bool { return cells[i].Edits < cell.Edits })
+	cells = append(cells, CoordinateEdits{})
+	copy(cells[i+1:], cells[i:])
+	cells[i] = cell
+	if len(cells) > maxMostEditedCells {
+		cells = cells[:maxMostEditedCells]
+	}
+	return cells
+}
+
+// Add saved placements to the room's totals, per-user counts and cell edit counts
+func updateRoomStats(room string, changes []PixelChange) uint32 {
+	db, dbErr := getStatsDB()
+	if dbErr != 0 {
+		return dbErr
+	}
+	stats := loadRoomStats(room)
+	edits := make(map[[2]int]int64)
+	for _, change := range changes {
+		pixel := change.Pixel
+		stats.TotalPixels++
+		user := stats.Users[pixel.UserID]
+		user.UserID = pixel.UserID
+		user.Username = pixel.Username
+		user.Pixels++
+		stats.Users[pixel.UserID] = user
+		edits[[2]int{pixel.X, pixel.Y}]++
+	}
+	for cell, count := range edits {
+		key := coordinateEditsKey(room, cell[0], cell[1])
+		total := readCounter(db, key) + count
+		if err := writeCounter(db, key, total); err != nil {
+			logError("updateRoomStats", room, "failed to save edits for %d:%d: %v", cell[0], cell[1], err)
+			continue
+		}
+		stats.MostEdited = rankEditedCell(stats.MostEdited, CoordinateEdits{X: cell[0], Y: cell[1], Edits: total})
+	}
+	if err := putJSON(db, roomStatsKey(room), stats); err != nil {
+		logError("updateRoomStats", room, "failed to save stats: %v", err)
+		return 1
+	}
+	return 0
+}
+
+// Schema migration recomputing the room's stats from its placement history
+func rebuildRoomStats(room string) error {
+	db, dbErr := getStatsDB()
+	if dbErr != 0 {
+		return fmt.Errorf("stats database connection failed")
+	}
+	keys, _ := db.List(fmt.Sprintf("/%s/edits/", room))
+	for _, key := range keys {
+		db.Delete(key)
+	}
+	db.Delete(roomStatsKey(room))
+	history := loadRoomHistory(room)
+	changes := make([]PixelChange, len(history))
+	for i, record := range history {
+		changes[i] = PixelChange{Pixel: Pixel{X: record.X, Y: record.Y, Color: record.Color, UserID: record.UserID, Username: record.Username, Timestamp: record.Timestamp}}
+	}
+	if updateRoomStats(room, changes) != 0 {
+		return fmt.Errorf("failed to save room stats")
+	}
+	return nil
+}
+
+// Users ranked by pixels placed, at most limit of them
+func roomLeaderboard(users map[string]Contributor, limit int) []Contributor {
+	leaders := make([]Contributor, 0, len(users))
+	for _, user := range users {
+		leaders = append(leaders, user)
+	}
+	sort.Slice(leaders, func(i, j int) bool {
+		if leaders[i].Pixels == leaders[j].Pixels {
+			return leaders[i].UserID < leaders[j].UserID
+		}
+		return leaders[i].Pixels > leaders[j].Pixels
+	})
+	if len(leaders) > limit {
+		leaders = leaders[:limit]
+	}
+	usernameResolver{}.contributors(leaders)
+	return leaders
+}
+
+//export getStats
+func getStats(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	if _, code := checkAnonymousRead(h, room); code != 0 {
+		return code
+	}
+	setMaintenanceBanner(h, room)
+	if ensureRoomSchema(room) != 0 {
+		return handleHTTPError(h, fmt.Errorf("room migration failed"), 500)
+	}
+	limit := getIntParam(h, "limit", defaultLeaderboardLimit)
+	if limit <= 0 || limit > maxLeaderboardLimit {
+		limit = defaultLeaderboardLimit
+	}
+	period, _ := h.Query().Get("period")
+	if period == "" {
+		period = PeriodAll
+	}
+	if _, ok := periodBuckets[period]; !ok && period != PeriodAll {
+		return handleHTTPError(h, fmt.Errorf("period must be day, week, month or all"), 400)
+	}
+	statsDB, dbErr := getStatsDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	stats := loadRoomStats(room)
+	colors, _ := loadColorCounts(room)
+	leaderboard := roomLeaderboard(stats.Users, limit)
+	if period != PeriodAll {
+		leaderboard = roomLeaderboard(loadPeriodCounts(room, period, time.Now()), limit)
+	}
+	if loadRoomSettings(room).AnonymizeContributors {
+		leaderboard = make([]Contributor, 0)
+	}
+	mostEdited := stats.MostEdited
+	if mostEdited == nil {
+		mostEdited = make([]CoordinateEdits, 0)
+	}
+	if len(mostEdited) > limit {
+		mostEdited = mostEdited[:limit]
+	}
+	return sendJSONResponse(h, map[string]interface{}{
+		"room":           room,
+		"period":         period,
+		"totalPixels":    stats.TotalPixels,
+		"contributors":   len(stats.Users),
+		"leaderboard":    leaderboard,
+		"distinctColors": len(colors),
+		"mostEdited":     mostEdited,
+		// Every stored message takes the next chat seq, so the counter doubles as the message count
+		"chatMessages":       readCounter(statsDB, chatSeqKey(room)),
+		"storedChatMessages": loadStorageUsage(room)[NamespaceChat].Keys,
+	})
+}
@@ -0,0 +1,64 @@
+package lib
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+// ScheduledJob is periodic work run by runScheduler once its interval has elapsed
+type ScheduledJob struct {
+	Name     string
+	Interval time.Duration
+	Run      func(now time.Time) error
+}
+
+var scheduledJobs []ScheduledJob
+
+// Add a job to the scheduler; called from init functions
+func registerJob(job ScheduledJob) {
+	scheduledJobs = append(scheduledJobs, job)
+}
+
+func jobLastRunKey(name string) string {
+	return fmt.Sprintf(globalKeyPrefix+"jobs/%s", name)
+}
+
+//export runScheduler
+func runScheduler(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	db, dbErr := getConfigDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	now := time.Now()
+	results := make(map[string]string, len(scheduledJobs))
+	for _, job := range scheduledJobs {
+		lastRun := readCounter(db, jobLastRunKey(job.Name))
+		if now.UnixMilli()-lastRun < job.Interval.Milliseconds() {
+			results[job.Name] = "skipped"
+			continue
+		}
+		if err := job.Run(now); err != nil {
+			logError("runScheduler", "", "job %s failed: %v", job.Name, err)
+			results[job.Name] = err.Error()
+			continue
+		}
+		if err := writeCounter(db, jobLastRunKey(job.Name), now.UnixMilli()); err != nil {
+			logError("runScheduler", "", "failed to save last run of job %s: %v", job.Name, err)
+		}
+		results[job.Name] = "ok"
+	}
+	return sendJSONResponse(h, results)
+}
@@ -0,0 +1,191 @@
+package lib
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+// Rooms without a stored version predate versioning and use the original per-pixel layout
+const baseSchemaVersion = 1
+
+// Migration upgrades one room from Version-1 to Version
+type Migration struct {
+	Version int
+	Name    string
+	Apply   func(room string) error
+}
+
+var (
+	migrations     []Migration
+	migratedRooms  = make(map[string]bool)
+	migrationMutex sync.Mutex
+)
+
+// Add a migration to the registry; versions must be registered in increasing order
+func registerMigration(migration Migration) {
+	migrations = append(migrations, migration)
+}
+
+func latestSchemaVersion() int {
+	if len(migrations) == 0 {
+		return baseSchemaVersion
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+func schemaKey(room string) string {
+	return fmt.Sprintf("/%s", room)
+}
+
+func loadRoomSchemaVersion(room string) int {
+	db, dbErr := getSchemaDB()
+	if dbErr != 0 {
+		return baseSchemaVersion
+	}
+	version := int(readCounter(db, schemaKey(room)))
+	if version < baseSchemaVersion {
+		return baseSchemaVersion
+	}
+	return version
+}
+
+func saveRoomSchemaVersion(room string, version int) uint32 {
+	db, dbErr := getSchemaDB()
+	if dbErr != 0 {
+		return dbErr
+	}
+	if err := writeCounter(db, schemaKey(room), int64(version)); err != nil {
+		logError("saveRoomSchemaVersion", room, "failed: %v", err)
+		return 1
+	}
+	return 0
+}
+
+// Run the room's pending migrations; called lazily on first access to a room
+func ensureRoomSchema(room string) uint32 {
+	migrationMutex.Lock()
+	defer migrationMutex.Unlock()
+	if migratedRooms[room] {
+		return 0
+	}
+
+	created := isNewRoom(room)
+	version := loadRoomSchemaVersion(room)
+	for _, migration := range migrations {
+		if migration.Version <= version {
+			continue
+		}
+		logInfo("ensureRoomSchema", room, "migrating to version %d (%s)", migration.Version, migration.Name)
+		if err := migration.Apply(room); err != nil {
+			logError("ensureRoomSchema", room, "migration %s failed: %v", migration.Name, err)
+			return 1
+		}
+		version = migration.Version
+		if saveRoomSchemaVersion(room, version) != 0 {
+			return 1
+		}
+	}
+	migratedRooms[room] = true
+	if created {
+		publishLifecycleEvent(room, LifecycleCreated, map[string]int{"schemaVersion": version})
+	}
+	return 0
+}
+
+// A room is new when it has neither a schema record nor canvas data
+func isNewRoom(room string) bool {
+	db, dbErr := getSchemaDB()
+	if dbErr != 0 {
+		return false
+	}
+	if data, err := db.Get(schemaKey(room)); err == nil && len(data) > 0 {
+		return false
+	}
+	pixels, dbErr := loadRoomPixels(room)
+	return dbErr == 0 && len(pixels) == 0
+}
+
+func init() {
+	registerMigration(Migration{
+		Version: 2,
+		Name:    "rebuild-derived-counters",
+		Apply:   rebuildDerivedCounters,
+	})
+	registerMigration(Migration{
+		Version: 3,
+		Name:    "chunked-layout",
+		Apply:   migrateLegacyLayout,
+	})
+	registerMigration(Migration{
+		Version: 4,
+		Name:    "timestamp-chat-keys",
+		Apply:   migrateChatKeys,
+	})
+	registerMigration(Migration{
+		Version: 5,
+		Name:    "room-stats",
+		Apply:   rebuildRoomStats,
+	})
+	registerMigration(Migration{
+		Version: 6,
+		Name:    "room-metadata",
+		Apply:   backfillRoomMetadata,
+	})
+}
+
+// Recompute color counters and team scores from the stored canvas,
+// for rooms that were painted before those counters existed
+func rebuildDerivedCounters(room string) error {
+	pixels, dbErr := loadRoomPixels(room)
+	if dbErr != 0 {
+		return fmt.Errorf("failed to load canvas")
+	}
+	colors := make(map[string]int64)
+	teams := make(map[string]int64)
+	for _, pixel := range pixels {
+		colors[pixel.Color]++
+		if pixel.Team != "" {
+			teams[pixel.Team]++
+		}
+	}
+
+	statsDB, dbErr := getStatsDB()
+	if dbErr != 0 {
+		return fmt.Errorf("stats database connection failed")
+	}
+	if err := putJSON(statsDB, colorCountsKey(room), colors); err != nil {
+		return err
+	}
+	teamsDB, dbErr := getTeamsDB()
+	if dbErr != 0 {
+		return fmt.Errorf("teams database connection failed")
+	}
+	return putJSON(teamsDB, teamScoresKey(room), teams)
+}
+
+//export getRoomSchema
+func getRoomSchema(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	response := map[string]interface{}{
+		"version": loadRoomSchemaVersion(room),
+		"latest":  latestSchemaVersion(),
+		"layout":  loadRoomLayout(room),
+	}
+	if status, ok := loadMigrationStatus(room); ok {
+		response["migration"] = status
+	}
+	return sendJSONResponse(h, response)
+}
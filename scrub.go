@@ -0,0 +1,139 @@
+package lib
+
+import (
+	"container/list"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+// Timeline positions are rounded down to buckets of this size so nearby scrub
+// steps share one reconstruction
+const defaultScrubBucket = 10 * time.Second
+
+// Reconstructed canvases kept in memory across requests
+const scrubCacheCapacity = 64
+
+type scrubCacheEntry struct {
+	key  string
+	grid [][]string
+}
+
+// LRU of reconstructed canvases keyed by room and bucket timestamp
+var (
+	scrubCache      = list.New()
+	scrubCacheIndex = make(map[string]*list.Element)
+	scrubMutex      sync.Mutex
+)
+
+func scrubCacheKey(room string, timestamp int64) string {
+	return fmt.Sprintf("%s/%d", room, timestamp)
+}
+
+func scrubCacheGet(key string) ([][]string, bool) {
+	scrubMutex.Lock()
+	defer scrubMutex.Unlock()
+	element, ok := scrubCacheIndex[key]
+	if !ok {
+		return nil, false
+	}
+	scrubCache.MoveToFront(element)
+	return element.Value.(*scrubCacheEntry).grid, true
+}
+
+func scrubCachePut(key string, grid [][]string) {
+	scrubMutex.Lock()
+	defer scrubMutex.Unlock()
+	if element, ok := scrubCacheIndex[key]; ok {
+		scrubCache.MoveToFront(element)
+		return
+	}
+	scrubCacheIndex[key] = scrubCache.PushFront(&scrubCacheEntry{key: key, grid: grid})
+	for scrubCache.Len() > scrubCacheCapacity {
+		oldest := scrubCache.Back()
+		scrubCache.Remove(oldest)
+		delete(scrubCacheIndex, oldest.Value.(*scrubCacheEntry).key)
+	}
+}
+
+// Drop the room's cached reconstructions once its history is gone
+func invalidateScrubCache(room string) {
+	scrubMutex.Lock()
+	defer scrubMutex.Unlock()
+	for key, element := range scrubCacheIndex {
+		if strings.HasPrefix(key, room+"/") {
+			scrubCache.Remove(element)
+			delete(scrubCacheIndex, key)
+		}
+	}
+}
+
+// Copy a cached grid so callers can remap it without touching the cache
+func copyGrid(grid [][]string) [][]string {
+	copied := make([][]string, len(grid))
+	for y, row := range grid {
+		copied[y] = append([]string(nil), row...)
+	}
+	return copied
+}
+
+//export getCanvasAt
+func getCanvasAt(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	if _, code := checkAnonymousRead(h, room); code != 0 {
+		return code
+	}
+	remap, err := getColorRemapParam(h)
+	if err != nil {
+		return handleHTTPError(h, err, 404)
+	}
+	at := int64(getIntParam(h, "at", 0))
+	if at <= 0 {
+		return handleHTTPError(h, fmt.Errorf("at parameter required"), 400)
+	}
+	bucket := int64(getIntParam(h, "bucketMs", int(defaultScrubBucket.Milliseconds())))
+	if bucket < 1 {
+		return handleHTTPError(h, fmt.Errorf("bucketMs must be positive"), 400)
+	}
+	timestamp := at - at%bucket
+	now := time.Now().UnixMilli()
+	if timestamp > now {
+		timestamp = now
+	}
+
+	key := scrubCacheKey(room, timestamp)
+	grid, cached := scrubCacheGet(key)
+	if !cached {
+		grid, err = canvasAtSeq(room, seqAtTimestamp(room, timestamp), timestamp)
+		if err != nil {
+			return handleHTTPError(h, err, 410)
+		}
+		// Buckets still open can gain placements, so only settled ones are cached
+		if timestamp+bucket <= now {
+			scrubCachePut(key, grid)
+		}
+	}
+	return sendJSONResponse(h, map[string]interface{}{
+		"room":      room,
+		"timestamp": timestamp,
+		"cached":    cached,
+		"canvas":    remapCanvas(copyGrid(grid), remap),
+	})
+}
@@ -0,0 +1,175 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+	http "github.com/taubyte/go-sdk/http/event"
+)
+
+// How long after posting or placing users may take it back themselves
+const defaultSelfServeWindow = 15 * time.Minute
+
+// The room's self-serve window; zero means self-serve deletion is disabled
+func selfServeWindow(room string) time.Duration {
+	minutes := loadRoomSettings(room).SelfServeWindowMinutes
+	if minutes < 0 {
+		return 0
+	}
+	if minutes == 0 {
+		return defaultSelfServeWindow
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// Identify the caller by their session token; self-serve deletion always
+// needs one, whatever the room's session rules. Only tokens an API key or
+// admin vouched for count, so tokens minted without credentials are refused.
+func selfServeCaller(h http.Event, room string) (string, uint32) {
+	token := requestSessionToken(h)
+	if token == "" {
+		return "", handleHTTPError(h, fmt.Errorf("session token required"), 401)
+	}
+	session, err := validateSessionToken(room, token)
+	if err != nil {
+		return "", handleHTTPError(h, err, 401)
+	}
+	if session.IssuedBy == "" {
+		return "", handleHTTPError(h, fmt.Errorf("session token was not issued against a credential"), 401)
+	}
+	return session.UserID, 0
+}
+
+// Refuse content the caller did not author or that is past the room's window.
+// receivedAt is the server's receipt time; a time in the future can only come
+// from a client-stamped record, so it is treated as outside the window.
+func checkSelfServe(h http.Event, room, userID, author string, receivedAt int64) uint32 {
+	if author == "" || author != userID {
+		return handleHTTPError(h, fmt.Errorf("only the author can delete this"), 403)
+	}
+	window := selfServeWindow(room)
+	if window == 0 {
+		return handleHTTPError(h, fmt.Errorf("self-serve deletion is disabled in room %s", room), 403)
+	}
+	if age := time.Since(time.UnixMilli(receivedAt)); age < 0 || age > window {
+		return handleHTTPError(h, fmt.Errorf("can only be deleted within %d minutes", int(window.Minutes())), 403)
+	}
+	return 0
+}
+
+//export deleteOwnMessage
+func deleteOwnMessage(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	if code := rejectDuringMaintenance(h, room); code != 0 {
+		return code
+	}
+	userID, code := selfServeCaller(h, room)
+	if code != 0 {
+		return code
+	}
+	messageID, _ := h.Query().Get("messageId")
+	if messageID == "" {
+		return handleHTTPError(h, fmt.Errorf("messageId parameter required"), 400)
+	}
+	if ensureRoomSchema(room) != 0 {
+		return handleHTTPError(h, fmt.Errorf("room migration failed"), 500)
+	}
+	db, dbErr := getChatDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	key, found := findChatMessageKey(db, room, messageID)
+	if !found {
+		return handleHTTPError(h, fmt.Errorf("message %s not found", messageID), 404)
+	}
+	data, err := db.Get(key)
+	if err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	var message ChatMessage
+	if err := json.Unmarshal(data, &message); err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	// The key carries the receipt time the server stamped when it stored the message
+	receivedAt, _ := chatKeyTimestamp(room, key)
+	if code := checkSelfServe(h, room, userID, message.UserID, receivedAt); code != 0 {
+		return code
+	}
+	if _, err := removeChatMessage(db, room, key); err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	logInfo("deleteOwnMessage", room, "user %s deleted message %s", userID, messageID)
+	return sendJSONResponse(h, map[string]interface{}{"room": room, "messageId": messageID, "deleted": true})
+}
+
+//export revertOwnPixel
+func revertOwnPixel(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	if code := rejectDuringMaintenance(h, room); code != 0 {
+		return code
+	}
+	userID, code := selfServeCaller(h, room)
+	if code != 0 {
+		return code
+	}
+	x, y := getIntParam(h, "x", -1), getIntParam(h, "y", -1)
+	if !inRoomBounds(room, x, y) {
+		return handleHTTPError(h, fmt.Errorf("x and y must be inside the canvas"), 400)
+	}
+	if ensureRoomSchema(room) != 0 {
+		return handleHTTPError(h, fmt.Errorf("room migration failed"), 500)
+	}
+	// The coordinate's log keeps the author even in rooms that anonymize
+	// stored pixels; its newest entry must be the pixel still on the canvas
+	current, placed := loadPixel(room, x, y)
+	history := loadPixelHistory(room, x, y)
+	if !placed || len(history) == 0 || history[0].Timestamp != current.Timestamp {
+		return handleHTTPError(h, fmt.Errorf("no pixel of yours at (%d,%d)", x, y), 404)
+	}
+	if code := checkSelfServe(h, room, userID, history[0].UserID, history[0].Timestamp); code != 0 {
+		return code
+	}
+	color := newBaseRegion(room, Region{X: x, Y: y, Width: 1, Height: 1})[0][0]
+	if len(history) > 1 {
+		color = history[1].Color
+	}
+	pixels := []Pixel{{X: x, Y: y, Color: color, UserID: "system", Username: "system", Timestamp: time.Now().UnixMilli()}}
+	changes, dbErr := savePixels(room, pixels, true)
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("failed to revert pixel"), 500)
+	}
+	afterPixelsSaved(room, changes)
+	broadcastPixelBatch(PixelBatch{Room: room, UserID: "system", Pixels: pixels}, changes, false)
+	logInfo("revertOwnPixel", room, "user %s reverted pixel (%d,%d)", userID, x, y)
+	return sendJSONResponse(h, map[string]interface{}{"room": room, "x": x, "y": y, "color": color, "reverted": true})
+}
@@ -0,0 +1,370 @@
+package lib
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+	http "github.com/taubyte/go-sdk/http/event"
+)
+
+const defaultSessionTTLHours = 24
+
+// Tokens are only stored by hash so a database dump cannot be replayed
+func sessionTokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func sessionTokenKey(room, hash string) string {
+	return fmt.Sprintf("/%s/tokens/%s", room, hash)
+}
+
+func sessionUserKey(room, userID, hash string) string {
+	return fmt.Sprintf("/%s/users/%s/%s", room, userID, hash)
+}
+
+func newSessionToken() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func loadSessionToken(room, hash string) (SessionToken, bool) {
+	var session SessionToken
+	db, dbErr := getSessionsDB()
+	if dbErr != 0 {
+		return session, false
+	}
+	data, err := db.Get(sessionTokenKey(room, hash))
+	if err != nil || len(data) == 0 {
+		return session, false
+	}
+	if err := json.Unmarshal(data, &session); err != nil {
+		logError("loadSessionToken", room, "failed to unmarshal token: %v", err)
+		return session, false
+	}
+	return session, true
+}
+
+// Who vouches for a token request: a provisioned API key, or the shared or room
+// admin token. Empty when the request carries neither.
+func sessionIssuer(h http.Event, room string) string {
+	if apiKey := requestAPIKey(h); validAPIKey(apiKey) {
+		return apiKeyID(apiKey)
+	}
+	if hasAdminToken(h, room) {
+		return "admin"
+	}
+	return ""
+}
+
+// Issue and store a token for the user, returning the raw token
+func issueToken(room, userID, issuer string, ttl time.Duration) (string, SessionToken, error) {
+	token, err := newSessionToken()
+	if err != nil {
+		return "", SessionToken{}, err
+	}
+	now := time.Now()
+	session := SessionToken{
+		Room:      room,
+		UserID:    userID,
+		IssuedAt:  now.UnixMilli(),
+		ExpiresAt: now.Add(ttl).UnixMilli(),
+		IssuedBy:  issuer,
+	}
+	db, dbErr := getSessionsDB()
+	if dbErr != 0 {
+		return "", session, fmt.Errorf("database connection failed")
+	}
+	hash := sessionTokenHash(token)
+	if err := putJSON(db, sessionTokenKey(room, hash), session); err != nil {
+		return "", session, err
+	}
+	db.Put(sessionUserKey(room, userID, hash), []byte{1})
+	return token, session, nil
+}
+
+// Mark a stored token revoked; replacedBy links a rotation to its successor
+func revokeTokenHash(room, hash, replacedBy string) bool {
+	session, found := loadSessionToken(room, hash)
+	if !found || session.RevokedAt != 0 {
+		return false
+	}
+	db, dbErr := getSessionsDB()
+	if dbErr != 0 {
+		return false
+	}
+	session.RevokedAt = time.Now().UnixMilli()
+	session.ReplacedBy = replacedBy
+	if err := putJSON(db, sessionTokenKey(room, hash), session); err != nil {
+		logError("revokeTokenHash", room, "failed: %v", err)
+		return false
+	}
+	return true
+}
+
+// Check a raw token against the room; any error means the holder is cut off
+func validateSessionToken(room, token string) (SessionToken, error) {
+	session, found := loadSessionToken(room, sessionTokenHash(token))
+	if !found {
+		return session, fmt.Errorf("unknown session token")
+	}
+	if session.RevokedAt != 0 {
+		return session, fmt.Errorf("session token revoked")
+	}
+	if time.Now().UnixMilli() >= session.ExpiresAt {
+		return session, fmt.Errorf("session token expired")
+	}
+	return session, nil
+}
+
+// Whether a write carrying the token may proceed. Presented tokens are always
+// checked; a missing token is only refused in rooms that require sessions.
+func sessionWriteAllowed(room, userID, token string) bool {
+	if token == "" {
+		return !loadRoomSettings(room).RequireSession
+	}
+	session, err := validateSessionToken(room, token)
+	if err != nil {
+		logDebug("sessionWriteAllowed", room, "rejecting write: %v", err)
+		return false
+	}
+	return session.UserID == userID
+}
+
+// Let an admin act for any user, and anyone else only for themselves with a
+// live session token that was issued against a credential
+func requireSelfOrAdmin(h http.Event, room, userID string) uint32 {
+	if hasAdminToken(h, room) {
+		return 0
+	}
+	return requireOwnSession(h, room, userID)
+}
+
+// Refuse the request unless it carries the user's live session token for the
+// room, issued against a credential
+func requireOwnSession(h http.Event, room, userID string) uint32 {
+	token := requestSessionToken(h)
+	if token == "" {
+		return handleHTTPError(h, fmt.Errorf("session token or admin token required"), 401)
+	}
+	session, err := validateSessionToken(room, token)
+	if err != nil {
+		return handleHTTPError(h, err, 401)
+	}
+	if session.IssuedBy == "" {
+		return handleHTTPError(h, fmt.Errorf("session token was not issued against a credential"), 401)
+	}
+	if session.UserID != userID {
+		return handleHTTPError(h, fmt.Errorf("session token does not belong to user %s", userID), 403)
+	}
+	return 0
+}
+
+// Read the caller's session token from X-Session-Token or the token query parameter
+func requestSessionToken(h http.Event) string {
+	if token, err := h.Headers().Get("X-Session-Token"); err == nil && token != "" {
+		return token
+	}
+	token, _ := h.Query().Get("token")
+	return token
+}
+
+// Gate channel URL issuance: a presented token must be live and belong to the
+// channel's room, and rooms requiring sessions refuse callers without one
+func checkChannelSession(h http.Event, channelName string) uint32 {
+	if strings.HasPrefix(channelName, inboxChannelPrefix) {
+		return requireInboxOwner(h, strings.TrimPrefix(channelName, inboxChannelPrefix))
+	}
+	// Channel names are <room>-<kind> and kinds contain no dashes; the room is
+	// always taken from the channel so a room parameter cannot pick the rules
+	room := ""
+	if i := strings.LastIndex(channelName, "-"); i > 0 {
+		room = channelName[:i]
+	}
+	if param, _ := h.Query().Get("room"); param != "" && param != room {
+		return handleHTTPError(h, fmt.Errorf("channel %s does not belong to room %s", channelName, param), 403)
+	}
+	token := requestSessionToken(h)
+	if token == "" {
+		if room != "" && loadRoomSettings(room).RequireSession {
+			return handleHTTPError(h, fmt.Errorf("session token required"), 401)
+		}
+		return 0
+	}
+	if _, err := validateSessionToken(room, token); err != nil {
+		return handleHTTPError(h, err, 401)
+	}
+	return 0
+}
+
+func getSessionTTL(h http.Event) (time.Duration, error) {
+	hours := getIntParam(h, "ttlHours", defaultSessionTTLHours)
+	if hours < 1 || hours > 24*30 {
+		return 0, fmt.Errorf("ttlHours must be between 1 and %d", 24*30)
+	}
+	return time.Duration(hours) * time.Hour, nil
+}
+
+func sessionResponse(h http.Event, token string, session SessionToken) uint32 {
+	return sendJSONResponse(h, struct {
+		Token string `json:"token"`
+		SessionToken
+	}{token, session})
+}
+
+// Hashes of every token issued to the user in the room
+func userTokenHashes(room, userID string) []string {
+	hashes := make([]string, 0)
+	db, dbErr := getSessionsDB()
+	if dbErr != 0 {
+		return hashes
+	}
+	prefix := fmt.Sprintf("/%s/users/%s/", room, userID)
+	keys, _ := db.List(prefix)
+	for _, key := range keys {
+		hashes = append(hashes, strings.TrimPrefix(key, prefix))
+	}
+	return hashes
+}
+
+// Revoke every live token the user holds in the room; returns how many were revoked
+func revokeUserSessions(room, userID string) int {
+	revoked := 0
+	for _, hash := range userTokenHashes(room, userID) {
+		if revokeTokenHash(room, hash, "") {
+			revoked++
+		}
+	}
+	return revoked
+}
+
+//export issueSessionToken
+func issueSessionToken(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	// Tokens are only worth checking if someone accountable vouched for the user
+	issuer := sessionIssuer(h, room)
+	if issuer == "" {
+		h.Headers().Set("WWW-Authenticate", "Bearer")
+		return handleHTTPError(h, fmt.Errorf("an API key or admin token is required to issue session tokens"), 401)
+	}
+	userID, _ := h.Query().Get("userId")
+	if userID == "" {
+		return handleHTTPError(h, fmt.Errorf("userId parameter required"), 400)
+	}
+	ttl, err := getSessionTTL(h)
+	if err != nil {
+		return handleHTTPError(h, err, 400)
+	}
+	token, session, err := issueToken(room, userID, issuer, ttl)
+	if err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	clearIdleKick(room, userID)
+	logInfo("issueSessionToken", room, "issued session token for user %s", userID)
+	return sessionResponse(h, token, session)
+}
+
+//export rotateSessionToken
+func rotateSessionToken(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	token := requestSessionToken(h)
+	if token == "" {
+		return handleHTTPError(h, fmt.Errorf("token parameter required"), 400)
+	}
+	// Revoked and expired tokens cannot be rotated, so a stolen token stays dead
+	previous, err := validateSessionToken(room, token)
+	if err != nil {
+		return handleHTTPError(h, err, 401)
+	}
+	ttl, err := getSessionTTL(h)
+	if err != nil {
+		return handleHTTPError(h, err, 400)
+	}
+	issuer := previous.IssuedBy
+	if issuer == "" {
+		issuer = "admin"
+	}
+	replacement, session, err := issueToken(room, previous.UserID, issuer, ttl)
+	if err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	revokeTokenHash(room, sessionTokenHash(token), sessionTokenHash(replacement))
+	logInfo("rotateSessionToken", room, "rotated session token for user %s", previous.UserID)
+	return sessionResponse(h, replacement, session)
+}
+
+//export revokeSessionToken
+func revokeSessionToken(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	// Either a single token, or every token the user holds in the room
+	var hashes []string
+	if token := requestSessionToken(h); token != "" {
+		hashes = append(hashes, sessionTokenHash(token))
+	} else if userID, _ := h.Query().Get("userId"); userID != "" {
+		hashes = userTokenHashes(room, userID)
+	} else {
+		return handleHTTPError(h, fmt.Errorf("token or userId parameter required"), 400)
+	}
+	revoked := 0
+	for _, hash := range hashes {
+		if revokeTokenHash(room, hash, "") {
+			revoked++
+		}
+	}
+	logInfo("revokeSessionToken", room, "revoked %d session tokens", revoked)
+	return sendJSONResponse(h, map[string]interface{}{
+		"room":    room,
+		"revoked": revoked,
+	})
+}
@@ -0,0 +1,221 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+func settingsKey(room string) string {
+	return fmt.Sprintf("/%s", room)
+}
+
+func loadRoomSettings(room string) RoomSettings {
+	var settings RoomSettings
+	db, dbErr := getSettingsDB()
+	if dbErr != 0 {
+		return settings
+	}
+	data, err := db.Get(settingsKey(room))
+	if err != nil || len(data) == 0 {
+		return settings
+	}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		logError("loadRoomSettings", room, "failed to unmarshal settings: %v", err)
+	}
+	return settings
+}
+
+func saveRoomSettings(room string, settings RoomSettings) uint32 {
+	db, dbErr := getSettingsDB()
+	if dbErr != 0 {
+		return dbErr
+	}
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return 1
+	}
+	if err := db.Put(settingsKey(room), data); err != nil {
+		logError("saveRoomSettings", room, "failed to save settings: %v", err)
+		return 1
+	}
+	return 0
+}
+
+// Limits on the custom fields a room may carry
+const (
+	maxCustomFields     = 20
+	maxCustomKeyLength  = 64
+	maxCustomValueBytes = 1024
+)
+
+func validateCustomFields(custom map[string]string) error {
+	if len(custom) > maxCustomFields {
+		return fmt.Errorf("at most %d custom fields", maxCustomFields)
+	}
+	for key, value := range custom {
+		if key == "" || len(key) > maxCustomKeyLength {
+			return fmt.Errorf("custom field names must be 1-%d characters", maxCustomKeyLength)
+		}
+		if len(value) > maxCustomValueBytes {
+			return fmt.Errorf("custom field %s exceeds %d bytes", key, maxCustomValueBytes)
+		}
+	}
+	return nil
+}
+
+func validateRoomSettings(settings RoomSettings) error {
+	switch settings.Durability {
+	case "", DurabilityAsync, DurabilitySync:
+	default:
+		return fmt.Errorf("durability must be '%s' or '%s'", DurabilityAsync, DurabilitySync)
+	}
+	if settings.DefaultColor != "" && !isValidHexColor(settings.DefaultColor) {
+		return fmt.Errorf("defaultColor must be a #rrggbb color")
+	}
+	if settings.Locale != "" && !isValidLocale(settings.Locale) {
+		return fmt.Errorf("locale must be a language tag like 'fr' or 'pt-BR'")
+	}
+	if err := validateCustomFields(settings.Custom); err != nil {
+		return err
+	}
+	if err := validatePaletteSettings(settings); err != nil {
+		return err
+	}
+	if err := validateBackgroundFill(settings); err != nil {
+		return err
+	}
+	if settings.Mode != "" && settings.Mode != RoomModeSignature {
+		return fmt.Errorf("mode must be empty or '%s'", RoomModeSignature)
+	}
+	if settings.SignatureWidth < 0 || settings.SignatureHeight < 0 {
+		return fmt.Errorf("signatureWidth and signatureHeight must not be negative")
+	}
+	if settings.SelfServeWindowMinutes > 24*60 {
+		return fmt.Errorf("selfServeWindowMinutes must be at most %d", 24*60)
+	}
+	if settings.Quotas.MaxHistoryEntries < 0 || settings.Quotas.MaxChatMessages < 0 {
+		return fmt.Errorf("quotas must not be negative")
+	}
+	if settings.DailyPixelQuota < 0 {
+		return fmt.Errorf("dailyPixelQuota must not be negative")
+	}
+	if settings.RetentionTier != "" {
+		if _, ok := loadGlobalConfig().RetentionTiers[settings.RetentionTier]; !ok {
+			return fmt.Errorf("retentionTier %s is not a configured tier", settings.RetentionTier)
+		}
+	}
+	if settings.PresenceTimeoutSeconds < 0 || settings.IdleTimeoutMinutes < 0 {
+		return fmt.Errorf("presenceTimeoutSeconds and idleTimeoutMinutes must not be negative")
+	}
+	if settings.SnapshotRetentionHours < 0 {
+		return fmt.Errorf("snapshotRetentionHours must not be negative")
+	}
+	if settings.CooldownMs < 0 {
+		return fmt.Errorf("cooldownMs must not be negative")
+	}
+	if settings.PixelsPerInterval < 0 || settings.RateIntervalMs < 0 {
+		return fmt.Errorf("pixelsPerInterval and rateIntervalMs must not be negative")
+	}
+	if settings.PixelsPerInterval > 0 && settings.RateIntervalMs == 0 {
+		return fmt.Errorf("rateIntervalMs is required with pixelsPerInterval")
+	}
+	if settings.OverwriteTaxMs < 0 || settings.OverwriteTaxMs > maxOverwriteTax.Milliseconds() {
+		return fmt.Errorf("overwriteTaxMs must be between 0 and %d", maxOverwriteTax.Milliseconds())
+	}
+	if settings.OverwriteTaxMs > 0 && settings.OverwriteTaxWindowMs <= 0 {
+		return fmt.Errorf("overwriteTaxWindowMs is required with overwriteTaxMs")
+	}
+	if settings.Moderation.MuteAfterWarnings < 0 || settings.Moderation.BanAfterWarnings < 0 {
+		return fmt.Errorf("moderation thresholds must not be negative")
+	}
+	if settings.Moderation.AbuseScoreThreshold < 0 || settings.Moderation.AbuseScoreThreshold > maxAbuseScore {
+		return fmt.Errorf("abuseScoreThreshold must be between 0 and %d", maxAbuseScore)
+	}
+	switch settings.Moderation.AbuseAction {
+	case "", SanctionMute, SanctionBan:
+	default:
+		return fmt.Errorf("abuseAction must be '%s' or '%s'", SanctionMute, SanctionBan)
+	}
+	return nil
+}
+
+// Whether writes for the room must be persisted synchronously and acknowledged
+func isSynchronousRoom(room string) bool {
+	switch loadRoomSettings(room).Durability {
+	case DurabilitySync:
+		return true
+	case DurabilityAsync:
+		return false
+	}
+	return loadGlobalConfig().SynchronousWrites
+}
+
+//export getRoomSettings
+func getRoomSettings(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	setMaintenanceBanner(h, room)
+	return sendJSONResponse(h, struct {
+		RoomSettings
+		QuotaStatus QuotaStatus `json:"quotaStatus"`
+		Banner      *Banner     `json:"banner,omitempty"`
+	}{loadRoomSettings(room), roomQuotaStatus(room), activeBanner(room)})
+}
+
+//export setRoomSettings
+func setRoomSettings(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	// Fields missing from the body keep their stored values
+	previous := loadRoomSettings(room)
+	settings := previous
+	settings.Custom = make(map[string]string, len(previous.Custom))
+	for key, value := range previous.Custom {
+		settings.Custom[key] = value
+	}
+	if err := readJSONBody(h, &settings); err != nil {
+		return handleHTTPError(h, err, 400)
+	}
+	// Custom fields merge into the stored ones; an empty value removes a field
+	for key, value := range settings.Custom {
+		if value == "" {
+			delete(settings.Custom, key)
+		}
+	}
+	if err := validateRoomSettings(settings); err != nil {
+		return handleHTTPError(h, err, 400)
+	}
+	if saveRoomSettings(room, settings) != 0 {
+		return handleHTTPError(h, fmt.Errorf("failed to save room settings"), 500)
+	}
+	if settings.DefaultColor != previous.DefaultColor || fillChanged(previous, settings) {
+		invalidateCanvasChecksum(room)
+	}
+	publishSettingsChanged(room, previous, settings)
+	return sendJSONResponse(h, settings)
+}
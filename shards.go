@@ -0,0 +1,156 @@
+package lib
+
+import (
+	"fmt"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+// Width and height of a served shard in pixels, a whole number of chunks
+const shardSize = 8 * chunkSize
+
+// Rooms bigger than a single canvas response are served shard by shard
+func isShardedRoom(room string) bool {
+	width, height := roomSize(room)
+	return width > maxCanvasDimension || height > maxCanvasDimension
+}
+
+func shardCounts(room string) (int, int) {
+	width, height := roomSize(room)
+	return (width + shardSize - 1) / shardSize, (height + shardSize - 1) / shardSize
+}
+
+// Canvas area covered by a shard, clipped to the room bounds
+func shardRegion(room string, sx, sy int) (Region, bool) {
+	columns, rows := shardCounts(room)
+	if sx < 0 || sy < 0 || sx >= columns || sy >= rows {
+		return Region{}, false
+	}
+	width, height := roomSize(room)
+	region := Region{X: sx * shardSize, Y: sy * shardSize, Width: shardSize, Height: shardSize}
+	if region.X+region.Width > width {
+		region.Width = width - region.X
+	}
+	if region.Y+region.Height > height {
+		region.Height = height - region.Y
+	}
+	return region, true
+}
+
+// Channel kind carrying a shard's pixel broadcasts; kinds contain no dashes
+func shardChannelKind(sx, sy int) string {
+	return fmt.Sprintf("shard%dx%d", sx, sy)
+}
+
+// Re-publish a broadcast on the channel of each shard it touches, so clients
+// of sharded rooms only subscribe to the area they show
+func publishShardPixels(room string, data map[string]interface{}, pixels []AuthoritativePixel) {
+	if !isShardedRoom(room) {
+		return
+	}
+	byShard := make(map[[2]int][]AuthoritativePixel)
+	var order [][2]int
+	for _, pixel := range pixels {
+		id := [2]int{pixel.X / shardSize, pixel.Y / shardSize}
+		if _, ok := byShard[id]; !ok {
+			order = append(order, id)
+		}
+		byShard[id] = append(byShard[id], pixel)
+	}
+	for _, id := range order {
+		shardData := make(map[string]interface{}, len(data)+1)
+		for key, value := range data {
+			shardData[key] = value
+		}
+		shardData["pixels"] = byShard[id]
+		shardData["shard"] = map[string]int{"sx": id[0], "sy": id[1]}
+		publishRoomEvent(room, shardChannelKind(id[0], id[1]), "pixels", shardData)
+	}
+}
+
+//export getShardManifest
+func getShardManifest(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	if _, code := checkAnonymousRead(h, room); code != 0 {
+		return code
+	}
+	width, height := roomSize(room)
+	columns, rows := shardCounts(room)
+	shards := make([]map[string]interface{}, 0, columns*rows)
+	for sy := 0; sy < rows; sy++ {
+		for sx := 0; sx < columns; sx++ {
+			region, _ := shardRegion(room, sx, sy)
+			shards = append(shards, map[string]interface{}{
+				"sx":      sx,
+				"sy":      sy,
+				"region":  region,
+				"channel": roomChannelName(room, shardChannelKind(sx, sy)),
+			})
+		}
+	}
+	return sendJSONResponse(h, map[string]interface{}{
+		"room":      room,
+		"width":     width,
+		"height":    height,
+		"sharded":   isShardedRoom(room),
+		"shardSize": shardSize,
+		"columns":   columns,
+		"rows":      rows,
+		"shards":    shards,
+	})
+}
+
+//export getShard
+func getShard(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	if _, code := checkAnonymousRead(h, room); code != 0 {
+		return code
+	}
+	setMaintenanceBanner(h, room)
+	remap, err := getColorRemapParam(h)
+	if err != nil {
+		return handleHTTPError(h, err, 404)
+	}
+	region, ok := shardRegion(room, getIntParam(h, "sx", -1), getIntParam(h, "sy", -1))
+	if !ok {
+		columns, rows := shardCounts(room)
+		return handleHTTPError(h, fmt.Errorf("sx and sy must address one of the %dx%d shards", columns, rows), 400)
+	}
+	if ensureRoomSchema(room) != 0 {
+		return handleHTTPError(h, fmt.Errorf("room migration failed"), 500)
+	}
+	grid, dbErr := loadRegionGrid(room, region)
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("failed to load shard"), 500)
+	}
+	recordRegionRequest(room, region)
+	return sendCanvasResponse(h, remapCanvas(grid, remap))
+}
@@ -0,0 +1,362 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+// Largest signature region when the room sets none
+const (
+	defaultSignatureWidth  = 64
+	defaultSignatureHeight = 24
+)
+
+const (
+	maxStampText  = 24
+	maxStampScale = 4
+)
+
+// 3x5 glyphs, one row per entry with the leftmost column in the highest bit
+var stampGlyphs = map[rune][5]uint8{
+	'A': {2, 5, 7, 5, 5}, 'B': {6, 5, 6, 5, 6}, 'C': {3, 4, 4, 4, 3}, 'D': {6, 5, 5, 5, 6},
+	'E': {7, 4, 6, 4, 7}, 'F': {7, 4, 6, 4, 4}, 'G': {3, 4, 5, 5, 3}, 'H': {5, 5, 7, 5, 5},
+	'I': {7, 2, 2, 2, 7}, 'J': {1, 1, 1, 5, 2}, 'K': {5, 5, 6, 5, 5}, 'L': {4, 4, 4, 4, 7},
+	'M': {5, 7, 7, 5, 5}, 'N': {6, 5, 5, 5, 5}, 'O': {2, 5, 5, 5, 2}, 'P': {6, 5, 6, 4, 4},
+	'Q': {2, 5, 5, 6, 3}, 'R': {6, 5, 6, 5, 5}, 'S': {3, 4, 2, 1, 6}, 'T': {7, 2, 2, 2, 2},
+	'U': {5, 5, 5, 5, 7}, 'V': {5, 5, 5, 5, 2}, 'W': {5, 5, 7, 7, 5}, 'X': {5, 5, 2, 5, 5},
+	'Y': {5, 5, 2, 2, 2}, 'Z': {7, 1, 2, 4, 7},
+	'0': {7, 5, 5, 5, 7}, '1': {2, 6, 2, 2, 7}, '2': {6, 1, 2, 4, 7}, '3': {6, 1, 2, 1, 6},
+	'4': {5, 5, 7, 1, 1}, '5': {7, 4, 6, 1, 6}, '6': {3, 4, 7, 5, 7}, '7': {7, 1, 2, 2, 2},
+	'8': {7, 5, 7, 5, 7}, '9': {7, 5, 7, 1, 6},
+	' ': {0, 0, 0, 0, 0}, '.': {0, 0, 0, 0, 2}, '-': {0, 0, 7, 0, 0}, '!': {2, 2, 2, 0, 2},
+	'?': {6, 1, 2, 0, 2}, '\'': {2, 2, 0, 0, 0}, '_': {0, 0, 0, 0, 7},
+}
+
+type stampMessage struct {
+	BatchID      string `json:"batchId"`
+	Room         string `json:"room"`
+	UserID       string `json:"userId"`
+	Username     string `json:"username"`
+	APIKey       string `json:"apiKey"`
+	SessionToken string `json:"sessionToken"`
+	SourceID     string `json:"sourceId"`
+	X            int    `json:"x"`
+	Y            int    `json:"y"`
+	Text         string `json:"text"`
+	Color        string `json:"color"`
+	Scale        int    `json:"scale"`
+}
+
+func isSignatureRoom(room string) bool {
+	return loadRoomSettings(room).Mode == RoomModeSignature
+}
+
+// Largest region a user may sign in the room
+func signatureSize(settings RoomSettings) (int, int) {
+	width, height := settings.SignatureWidth, settings.SignatureHeight
+	if width <= 0 {
+		width = defaultSignatureWidth
+	}
+	if height <= 0 {
+		height = defaultSignatureHeight
+	}
+	return width, height
+}
+
+func signaturePrefix(room string) string {
+	return fmt.Sprintf("/%s/signatures/", room)
+}
+
+func signatureKey(room, userID string) string {
+	return signaturePrefix(room) + userID
+}
+
+func loadSignature(room, userID string) (Signature, bool) {
+	var signature Signature
+	db, dbErr := getStatsDB()
+	if dbErr != 0 {
+		return signature, false
+	}
+	data, err := db.Get(signatureKey(room, userID))
+	if err != nil || len(data) == 0 {
+		return signature, false
+	}
+	return signature, json.Unmarshal(data, &signature) == nil
+}
+
+// Every signature in the room, top to bottom and left to right
+func loadSignatures(room string) []Signature {
+	signatures := make([]Signature, 0)
+	db, dbErr := getStatsDB()
+	if dbErr != 0 {
+		return signatures
+	}
+	keys, _ := db.List(signaturePrefix(room))
+	for _, key := range keys {
+		data, err := db.Get(key)
+		if err != nil {
+			continue
+		}
+		var signature Signature
+		if json.Unmarshal(data, &signature) == nil {
+			signatures = append(signatures, signature)
+		}
+	}
+	sort.Slice(signatures, func(i, j int) bool {
+		if signatures[i].Region.Y != signatures[j].Region.Y {
+			return signatures[i].Region.Y < signatures[j].Region.Y
+		}
+		return signatures[i].Region.X < signatures[j].Region.X
+	})
+	return signatures
+}
+
+func clearSignatures(room string) {
+	db, dbErr := getStatsDB()
+	if dbErr != 0 {
+		return
+	}
+	keys, _ := db.List(signaturePrefix(room))
+	for _, key := range keys {
+		db.Delete(key)
+	}
+}
+
+// Smallest region holding every pixel
+func boundingRegion(pixels []Pixel) Region {
+	if len(pixels) == 0 {
+		return Region{}
+	}
+	minX, minY, maxX, maxY := pixels[0].X, pixels[0].Y, pixels[0].X, pixels[0].Y
+	for _, pixel := range pixels[1:] {
+		if pixel.X < minX {
+			minX = pixel.X
+		}
+		if pixel.Y < minY {
+			minY = pixel.Y
+		}
+		if pixel.X > maxX {
+			maxX = pixel.X
+		}
+		if pixel.Y > maxY {
+			maxY = pixel.Y
+		}
+	}
+	return Region{X: minX, Y: minY, Width: maxX - minX + 1, Height: maxY - minY + 1}
+}
+
+// Pixels of the text drawn with the stamp font, its top-left corner at (x, y)
+func rasterizeStamp(text string, x, y, scale int, color string) ([]Pixel, error) {
+	pixels := make([]Pixel, 0)
+	for i, r := range strings.ToUpper(text) {
+		glyph, ok := stampGlyphs[r]
+		if !ok {
+			return nil, fmt.Errorf("character %q cannot be stamped", r)
+		}
+		left := x + i*4*scale
+		for row, bits := range glyph {
+			for col := 0; col < 3; col++ {
+				if bits&(4>>col) == 0 {
+					continue
+				}
+				for dy := 0; dy < scale; dy++ {
+					for dx := 0; dx < scale; dx++ {
+						pixels = append(pixels, Pixel{X: left + col*scale + dx, Y: y + row*scale + dy, Color: color})
+					}
+				}
+			}
+		}
+	}
+	return pixels, nil
+}
+
+// In signature rooms each user signs one region: their first batch claims its
+// bounding box, which must fit the room's signature size and stay clear of
+// other signatures, and later pixels must stay inside it
+func validateSignatureRegion(ctx *PlacementContext) error {
+	if signature, found := loadSignature(ctx.Room, ctx.UserID); found {
+		for i, pixel := range ctx.Pixels {
+			if !signature.Region.Contains(pixel.X, pixel.Y) {
+				ctx.reject(i, "outside signature region")
+			}
+		}
+		return nil
+	}
+	claim := boundingRegion(ctx.Accepted())
+	if claim.Width == 0 {
+		return nil
+	}
+	width, height := signatureSize(loadRoomSettings(ctx.Room))
+	if claim.Width > width || claim.Height > height {
+		return fmt.Errorf("signature of %dx%d exceeds the room limit of %dx%d", claim.Width, claim.Height, width, height)
+	}
+	for _, other := range loadSignatures(ctx.Room) {
+		if other.Region.Overlaps(claim) {
+			return fmt.Errorf("signature overlaps the one by %s", other.UserID)
+		}
+	}
+	return nil
+}
+
+// Claim the region of each first-time signer once their pixels are saved
+func recordSignatures(room string, changes []PixelChange) {
+	if !isSignatureRoom(room) {
+		return
+	}
+	db, dbErr := getStatsDB()
+	if dbErr != 0 {
+		return
+	}
+	byUser := make(map[string][]Pixel)
+	for _, change := range changes {
+		byUser[change.Pixel.UserID] = append(byUser[change.Pixel.UserID], change.Pixel)
+	}
+	for userID, pixels := range byUser {
+		if _, found := loadSignature(room, userID); found {
+			continue
+		}
+		signature := Signature{
+			UserID:   userID,
+			Username: pixels[0].Username,
+			Region:   boundingRegion(pixels),
+			SignedAt: pixels[0].Timestamp,
+		}
+		if err := putJSON(db, signatureKey(room, userID), signature); err != nil {
+			logError("recordSignatures", room, "failed for user %s: %v", userID, err)
+		}
+	}
+}
+
+//export onSignature
+func onSignature(e event.Event) uint32 {
+	channel, err := e.PubSub()
+	if err != nil {
+		return 1
+	}
+	data, err := channel.Data()
+	if err != nil {
+		return 1
+	}
+	var stamp stampMessage
+	if err := json.Unmarshal(data, &stamp); err != nil {
+		logError("onSignature", "", "invalid JSON: %v", err)
+		return 1
+	}
+	if stamp.Room == "" {
+		if stamp.Room, err = fallbackRoom(); err != nil {
+			logError("onSignature", "", "%v", err)
+			return 1
+		}
+	}
+	if !isSignatureRoom(stamp.Room) {
+		logDebug("onSignature", stamp.Room, "dropping stamp for a room that is not a signature board")
+		return 0
+	}
+	text := strings.TrimSpace(stamp.Text)
+	if text == "" || len(text) > maxStampText || stamp.UserID == "" || strings.Contains(stamp.UserID, "/") {
+		logError("onSignature", stamp.Room, "stamps need a userId and 1-%d characters of text", maxStampText)
+		return 1
+	}
+	if stamp.Scale == 0 {
+		stamp.Scale = 1
+	}
+	if stamp.Scale < 1 || stamp.Scale > maxStampScale {
+		logError("onSignature", stamp.Room, "scale must be between 1 and %d", maxStampScale)
+		return 1
+	}
+	pixels, err := rasterizeStamp(text, stamp.X, stamp.Y, stamp.Scale, strings.ToLower(stamp.Color))
+	if err != nil {
+		logError("onSignature", stamp.Room, "%v", err)
+		return 1
+	}
+	// The stamp enters the pixel pipeline as a regular JSON batch, so intents,
+	// replication and validation treat it like any other placement
+	payload := jsonPixelBatch{
+		BatchID:      stamp.BatchID,
+		Room:         stamp.Room,
+		UserID:       stamp.UserID,
+		Username:     stamp.Username,
+		APIKey:       stamp.APIKey,
+		SessionToken: stamp.SessionToken,
+		SourceID:     stamp.SourceID,
+	}
+	for _, pixel := range pixels {
+		payload.Pixels = append(payload.Pixels, jsonPixel{X: pixel.X, Y: pixel.Y, Color: pixel.Color})
+	}
+	batchData, err := json.Marshal(payload)
+	if err != nil {
+		return 1
+	}
+	batch, err := decodePixelBatch(batchData)
+	if err != nil {
+		logError("onSignature", stamp.Room, "%v", err)
+		return 1
+	}
+	if code := handlePixelBatch(batch, batchData); code != 0 {
+		return code
+	}
+	// Keep the text with a signature the stamp created
+	if signature, found := loadSignature(stamp.Room, stamp.UserID); found && signature.Text == "" && signature.SignedAt >= time.Now().Add(-time.Minute).UnixMilli() {
+		signature.Text = text
+		if db, dbErr := getStatsDB(); dbErr == 0 {
+			putJSON(db, signatureKey(stamp.Room, stamp.UserID), signature)
+		}
+	}
+	return 0
+}
+
+//export getSignatures
+func getSignatures(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	anonymous, code := checkAnonymousRead(h, room)
+	if code != 0 {
+		return code
+	}
+	setMaintenanceBanner(h, room)
+	signatures := loadSignatures(room)
+	// With x and y, only the signature covering that cell
+	if x, y := getIntParam(h, "x", -1), getIntParam(h, "y", -1); x >= 0 && y >= 0 {
+		matching := make([]Signature, 0, 1)
+		for _, signature := range signatures {
+			if signature.Region.Contains(x, y) {
+				matching = append(matching, signature)
+			}
+		}
+		signatures = matching
+	}
+	names := usernameResolver{}
+	hide := anonymous || loadRoomSettings(room).AnonymizeContributors
+	for i := range signatures {
+		if hide {
+			signatures[i].UserID, signatures[i].Username = "", ""
+		} else {
+			signatures[i].Username = names.name(signatures[i].UserID, signatures[i].Username)
+		}
+	}
+	width, height := signatureSize(loadRoomSettings(room))
+	return sendJSONResponse(h, map[string]interface{}{
+		"room":            room,
+		"signatureWidth":  width,
+		"signatureHeight": height,
+		"signatures":      signatures,
+	})
+}
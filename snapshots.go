@@ -0,0 +1,321 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+// Rooms being painted are captured at most this often
+const snapshotInterval = time.Hour
+
+const (
+	defaultHistoryFramesLimit = 100
+	maxHistoryFramesLimit     = 1000
+)
+
+func snapshotPrefix(room string) string {
+	return fmt.Sprintf("/%s/", room)
+}
+
+func snapshotKey(room string, timestamp int64) string {
+	return fmt.Sprintf("%s%013d", snapshotPrefix(room), timestamp)
+}
+
+func lastSnapshotKey(room string) string {
+	return fmt.Sprintf("/%s/last-snapshot", room)
+}
+
+func activeRoomsPrefix(day string) string {
+	return fmt.Sprintf(globalKeyPrefix+"active/%s/", day)
+}
+
+// Replace the frame's grid with a palette and run-length pairs
+func compactSnapshot(snapshot *CanvasSnapshot) {
+	indexes := make(map[string]int)
+	snapshot.Height = len(snapshot.Grid)
+	snapshot.Palette, snapshot.Runs = nil, nil
+	for _, row := range snapshot.Grid {
+		snapshot.Width = len(row)
+		for _, color := range row {
+			index, ok := indexes[color]
+			if !ok {
+				index = len(snapshot.Palette)
+				indexes[color] = index
+				snapshot.Palette = append(snapshot.Palette, color)
+			}
+			if last := len(snapshot.Runs) - 2; last >= 0 && snapshot.Runs[last] == index {
+				snapshot.Runs[last+1]++
+			} else {
+				snapshot.Runs = append(snapshot.Runs, index, 1)
+			}
+		}
+	}
+	snapshot.Grid = nil
+}
+
+// Rebuild the grid of a compacted frame; frames stored with a grid are left as is
+func expandSnapshot(snapshot *CanvasSnapshot) {
+	if snapshot.Grid != nil || snapshot.Width <= 0 {
+		return
+	}
+	cells := make([]string, 0, snapshot.Width*snapshot.Height)
+	for i := 0; i+1 < len(snapshot.Runs); i += 2 {
+		color := ""
+		if index := snapshot.Runs[i]; index >= 0 && index < len(snapshot.Palette) {
+			color = snapshot.Palette[index]
+		}
+		for n := 0; n < snapshot.Runs[i+1] && len(cells) < cap(cells); n++ {
+			cells = append(cells, color)
+		}
+	}
+	snapshot.Grid = make([][]string, snapshot.Height)
+	for y := range snapshot.Grid {
+		row := make([]string, snapshot.Width)
+		for x := range row {
+			if i := y*snapshot.Width + x; i < len(cells) {
+				row[x] = cells[i]
+			}
+		}
+		snapshot.Grid[y] = row
+	}
+	snapshot.Palette, snapshot.Runs = nil, nil
+}
+
+// Store the room's current canvas as a frame
+func captureSnapshot(room string, now time.Time) (CanvasSnapshot, uint32) {
+	snapshot := CanvasSnapshot{Room: room, Timestamp: now.UnixMilli()}
+	grid, dbErr := loadCanvasGrid(room)
+	if dbErr != 0 {
+		return snapshot, dbErr
+	}
+	snapshot.Grid = grid
+	db, dbErr := getSnapshotsDB()
+	if dbErr != 0 {
+		return snapshot, dbErr
+	}
+	stored := snapshot
+	compactSnapshot(&stored)
+	if err := putJSON(db, snapshotKey(room, snapshot.Timestamp), stored); err != nil {
+		logError("captureSnapshot", room, "failed: %v", err)
+		return snapshot, 1
+	}
+	if statsDB, dbErr := getStatsDB(); dbErr == 0 {
+		writeCounter(statsDB, lastSnapshotKey(room), snapshot.Timestamp)
+	}
+	if hours := roomRetention(room).SnapshotRetentionHours; hours > 0 {
+		pruneSnapshots(room, now.Add(-time.Duration(hours)*time.Hour).UnixMilli())
+	}
+	return snapshot, 0
+}
+
+// Delete the room's frames captured before the cutoff; returns how many were removed
+func pruneSnapshots(room string, cutoff int64) int {
+	db, dbErr := getSnapshotsDB()
+	if dbErr != 0 {
+		return 0
+	}
+	removed := 0
+	for _, timestamp := range snapshotTimestamps(room, 0, cutoff) {
+		if db.Delete(snapshotKey(room, timestamp)) == nil {
+			removed++
+		}
+	}
+	return removed
+}
+
+// Capture a frame after a batch when the previous one is older than the room's snapshot interval,
+// and record the room as active for the day
+func maybeCaptureSnapshot(room string) {
+	now := time.Now()
+	statsDB, dbErr := getStatsDB()
+	if dbErr != 0 {
+		return
+	}
+	statsDB.Put(activeRoomsPrefix(now.UTC().Format(dayLayout))+room, []byte("1"))
+	if now.UnixMilli()-readCounter(statsDB, lastSnapshotKey(room)) < roomRetention(room).snapshotInterval().Milliseconds() {
+		return
+	}
+	captureSnapshot(room, now)
+}
+
+// Rooms that received placements on the given UTC day
+func activeRooms(day string) []string {
+	rooms := make([]string, 0)
+	db, dbErr := getStatsDB()
+	if dbErr != 0 {
+		return rooms
+	}
+	prefix := activeRoomsPrefix(day)
+	keys, _ := db.List(prefix)
+	for _, key := range keys {
+		if len(key) > len(prefix) {
+			rooms = append(rooms, key[len(prefix):])
+		}
+	}
+	sort.Strings(rooms)
+	return rooms
+}
+
+// Timestamps of the room's frames within [from, to), oldest first
+func snapshotTimestamps(room string, from, to int64) []int64 {
+	timestamps := make([]int64, 0)
+	db, dbErr := getSnapshotsDB()
+	if dbErr != 0 {
+		return timestamps
+	}
+	prefix := snapshotPrefix(room)
+	keys, _ := db.List(prefix)
+	for _, key := range keys {
+		timestamp, err := strconv.ParseInt(key[len(prefix):], 10, 64)
+		if err == nil && timestamp >= from && timestamp < to {
+			timestamps = append(timestamps, timestamp)
+		}
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+	return timestamps
+}
+
+func loadSnapshot(room string, timestamp int64) (CanvasSnapshot, bool) {
+	var snapshot CanvasSnapshot
+	db, dbErr := getSnapshotsDB()
+	if dbErr != 0 {
+		return snapshot, false
+	}
+	data, err := db.Get(snapshotKey(room, timestamp))
+	if err != nil || len(data) == 0 {
+		return snapshot, false
+	}
+	if json.Unmarshal(data, &snapshot) != nil {
+		return snapshot, false
+	}
+	expandSnapshot(&snapshot)
+	return snapshot, true
+}
+
+//export snapshotCanvas
+func snapshotCanvas(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	if ensureRoomSchema(room) != 0 {
+		return handleHTTPError(h, fmt.Errorf("room migration failed"), 500)
+	}
+	now := time.Now()
+	snapshot, dbErr := captureSnapshot(room, now)
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("failed to capture snapshot"), 500)
+	}
+	// retentionHours prunes older frames right away, on top of the room's retention setting
+	pruned := 0
+	if hours := getIntParam(h, "retentionHours", 0); hours > 0 {
+		pruned = pruneSnapshots(room, now.Add(-time.Duration(hours)*time.Hour).UnixMilli())
+	}
+	return sendJSONResponse(h, map[string]interface{}{
+		"room":      room,
+		"timestamp": snapshot.Timestamp,
+		"pruned":    pruned,
+	})
+}
+
+//export getHistory
+func getHistory(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	if _, code := checkAnonymousRead(h, room); code != 0 {
+		return code
+	}
+	setMaintenanceBanner(h, room)
+	from := int64(getIntParam(h, "from", 0))
+	to := int64(getIntParam(h, "to", 0))
+	if to <= 0 {
+		to = time.Now().UnixMilli() + 1
+	}
+	limit := getIntParam(h, "limit", defaultHistoryFramesLimit)
+	if limit <= 0 || limit > maxHistoryFramesLimit {
+		limit = defaultHistoryFramesLimit
+	}
+	timestamps := snapshotTimestamps(room, from, to)
+	total := len(timestamps)
+	if len(timestamps) > limit {
+		timestamps = timestamps[:limit]
+	}
+	return sendJSONResponse(h, map[string]interface{}{
+		"room":   room,
+		"frames": timestamps,
+		"total":  total,
+	})
+}
+
+//export getSnapshot
+func getSnapshot(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	if _, code := checkAnonymousRead(h, room); code != 0 {
+		return code
+	}
+	setMaintenanceBanner(h, room)
+	// timestamp fetches an exact frame; at picks the latest frame captured at or before it
+	timestamp := int64(getIntParam(h, "timestamp", 0))
+	if at := int64(getIntParam(h, "at", 0)); timestamp <= 0 && at > 0 {
+		if timestamps := snapshotTimestamps(room, 0, at+1); len(timestamps) > 0 {
+			timestamp = timestamps[len(timestamps)-1]
+		}
+	}
+	if timestamp <= 0 {
+		return handleHTTPError(h, fmt.Errorf("timestamp or at parameter required"), 400)
+	}
+	snapshot, found := loadSnapshot(room, timestamp)
+	if !found {
+		return handleHTTPError(h, fmt.Errorf("no snapshot at %d", timestamp), 404)
+	}
+	if compact, _ := h.Query().Get("compact"); compact == "true" {
+		compactSnapshot(&snapshot)
+	}
+	return sendJSONResponse(h, snapshot)
+}
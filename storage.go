@@ -0,0 +1,150 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/taubyte/go-sdk/database"
+	"github.com/taubyte/go-sdk/event"
+)
+
+// Storage namespaces reported by getStorageStats
+const (
+	NamespaceCanvas  = "canvas"
+	NamespaceChat    = "chat"
+	NamespaceHistory = "history"
+)
+
+type StorageUsage struct {
+	Keys  int64 `json:"keys"`
+	Bytes int64 `json:"bytes"`
+}
+
+func storageUsageKey(room string) string {
+	return fmt.Sprintf("/%s/storage", room)
+}
+
+func loadStorageUsage(room string) map[string]StorageUsage {
+	usage := make(map[string]StorageUsage)
+	db, dbErr := getStatsDB()
+	if dbErr != 0 {
+		return usage
+	}
+	data, err := db.Get(storageUsageKey(room))
+	if err != nil || len(data) == 0 {
+		return usage
+	}
+	if err := json.Unmarshal(data, &usage); err != nil {
+		logError("loadStorageUsage", room, "failed to unmarshal usage: %v", err)
+	}
+	return usage
+}
+
+func saveStorageUsage(room string, usage map[string]StorageUsage) uint32 {
+	db, dbErr := getStatsDB()
+	if dbErr != 0 {
+		return dbErr
+	}
+	if err := putJSON(db, storageUsageKey(room), usage); err != nil {
+		logError("saveStorageUsage", room, "failed: %v", err)
+		return 1
+	}
+	return 0
+}
+
+// Adjust the estimated key count and size of one namespace
+func recordStorageUsage(room, namespace string, keys, bytes int64) {
+	if keys == 0 && bytes == 0 {
+		return
+	}
+	usage := loadStorageUsage(room)
+	current := usage[namespace]
+	current.Keys += keys
+	current.Bytes += bytes
+	if current.Keys < 0 {
+		current.Keys = 0
+	}
+	if current.Bytes < 0 {
+		current.Bytes = 0
+	}
+	usage[namespace] = current
+	saveStorageUsage(room, usage)
+}
+
+// Forget the usage of a namespace after its keys were removed
+func resetStorageUsage(room, namespace string) {
+	usage := loadStorageUsage(room)
+	delete(usage, namespace)
+	saveStorageUsage(room, usage)
+}
+
+func measurePrefix(db database.Database, prefix string) StorageUsage {
+	var usage StorageUsage
+	keys, err := db.List(prefix)
+	if err != nil {
+		return usage
+	}
+	for _, key := range keys {
+		usage.Keys++
+		if data, err := db.Get(key); err == nil {
+			usage.Bytes += int64(len(data))
+		}
+	}
+	return usage
+}
+
+// Rebuild the counters by scanning every namespace of the room
+func recountStorageUsage(room string) map[string]StorageUsage {
+	usage := make(map[string]StorageUsage)
+	prefix := fmt.Sprintf("/%s/", room)
+	if db, dbErr := getCanvasDB(); dbErr == 0 {
+		usage[NamespaceCanvas] = measurePrefix(db, prefix)
+	}
+	if db, dbErr := getChunksDB(); dbErr == 0 {
+		chunks := measurePrefix(db, prefix)
+		canvas := usage[NamespaceCanvas]
+		canvas.Keys += chunks.Keys
+		canvas.Bytes += chunks.Bytes
+		usage[NamespaceCanvas] = canvas
+	}
+	if db, dbErr := getChatDB(); dbErr == 0 {
+		usage[NamespaceChat] = measurePrefix(db, prefix)
+	}
+	if db, dbErr := getHistoryDB(); dbErr == 0 {
+		usage[NamespaceHistory] = measurePrefix(db, prefix)
+	}
+	saveStorageUsage(room, usage)
+	return usage
+}
+
+//export getStorageStats
+func getStorageStats(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	var usage map[string]StorageUsage
+	if recount, _ := h.Query().Get("recount"); recount == "true" {
+		usage = recountStorageUsage(room)
+	} else {
+		usage = loadStorageUsage(room)
+	}
+	var total StorageUsage
+	for _, namespace := range usage {
+		total.Keys += namespace.Keys
+		total.Bytes += namespace.Bytes
+	}
+	return sendJSONResponse(h, map[string]interface{}{
+		"room":       room,
+		"namespaces": usage,
+		"total":      total,
+	})
+}
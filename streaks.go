@@ -0,0 +1,128 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+const (
+	dayLayout               = "2006-01-02"
+	defaultLeaderboardLimit = 10
+	maxLeaderboardLimit     = 100
+)
+
+// Streak lengths in days that trigger an achievement event
+var streakMilestones = []int{3, 7, 30, 100, 365}
+
+// Advance the user's streak for a placement on the given time; returns a
+// milestone reached by this placement, or 0
+func advanceStreak(stats *UserStats, now time.Time) int {
+	today := now.UTC().Format(dayLayout)
+	if stats.LastActiveDay == today {
+		return 0
+	}
+	if stats.LastActiveDay == now.UTC().AddDate(0, 0, -1).Format(dayLayout) {
+		stats.CurrentStreak++
+	} else {
+		stats.CurrentStreak = 1
+	}
+	stats.LastActiveDay = today
+	if stats.CurrentStreak > stats.LongestStreak {
+		stats.LongestStreak = stats.CurrentStreak
+	}
+	for _, milestone := range streakMilestones {
+		if stats.CurrentStreak == milestone {
+			return milestone
+		}
+	}
+	return 0
+}
+
+// A streak only counts as current while the user placed today or yesterday
+func activeStreak(stats UserStats, now time.Time) int {
+	switch stats.LastActiveDay {
+	case now.UTC().Format(dayLayout), now.UTC().AddDate(0, 0, -1).Format(dayLayout):
+		return stats.CurrentStreak
+	}
+	return 0
+}
+
+func announceStreakMilestone(room, userID string, milestone int) {
+	data := map[string]interface{}{"userId": userID, "streakDays": milestone}
+	publishRoomEvent(room, "events", "streakMilestone", data)
+	notifyUser(userID, Notification{
+		Type:    "achievement",
+		Room:    room,
+		Message: localizedMessage(room, "streakMilestone", milestone),
+		Data:    data,
+	})
+}
+
+//export getUserStats
+func getUserStats(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	userID, err := h.Query().Get("userId")
+	if err != nil || userID == "" {
+		return handleHTTPError(h, fmt.Errorf("userId parameter required"), 400)
+	}
+	stats := loadUserStats(userID)
+	stats.CurrentStreak = activeStreak(stats, time.Now())
+	return sendJSONResponse(h, stats)
+}
+
+//export getStreakLeaderboard
+func getStreakLeaderboard(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	limit := getIntParam(h, "limit", defaultLeaderboardLimit)
+	if limit <= 0 || limit > maxLeaderboardLimit {
+		limit = defaultLeaderboardLimit
+	}
+	db, dbErr := getStatsDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	keys, _ := db.List(userStatsKey(""))
+	now := time.Now()
+	entries := make([]UserStats, 0, len(keys))
+	for _, key := range keys {
+		data, err := db.Get(key)
+		if err != nil {
+			continue
+		}
+		var stats UserStats
+		if json.Unmarshal(data, &stats) != nil {
+			continue
+		}
+		if stats.CurrentStreak = activeStreak(stats, now); stats.CurrentStreak > 0 {
+			entries = append(entries, stats)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].CurrentStreak != entries[j].CurrentStreak {
+			return entries[i].CurrentStreak > entries[j].CurrentStreak
+		}
+		return entries[i].LongestStreak > entries[j].LongestStreak
+	})
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return sendJSONResponse(h, entries)
+}
@@ -0,0 +1,502 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+	http "github.com/taubyte/go-sdk/http/event"
+)
+
+// Minimum time between two score broadcasts for the same room
+const teamScoreBroadcastInterval = 5 * time.Second
+
+var defaultTeams = []Team{
+	{Name: "red", Color: "#ff4500"},
+	{Name: "blue", Color: "#2450a4"},
+}
+
+func teamsKey(room string) string {
+	return fmt.Sprintf("/%s/teams", room)
+}
+
+func teamMemberKey(room, userID string) string {
+	return fmt.Sprintf("/%s/members/%s", room, userID)
+}
+
+func teamScoresKey(room string) string {
+	return fmt.Sprintf("/%s/scores", room)
+}
+
+func teamScoresBroadcastKey(room string) string {
+	return fmt.Sprintf("/%s/scores-broadcast", room)
+}
+
+func loadTeams(room string) []Team {
+	db, dbErr := getTeamsDB()
+	if dbErr != 0 {
+		return defaultTeams
+	}
+	data, err := db.Get(teamsKey(room))
+	if err != nil || len(data) == 0 {
+		return defaultTeams
+	}
+	var teams []Team
+	if err := json.Unmarshal(data, &teams); err != nil {
+		logError("loadTeams", room, "failed to unmarshal teams: %v", err)
+		return defaultTeams
+	}
+	return teams
+}
+
+func saveTeams(room string, teams []Team) uint32 {
+	db, dbErr := getTeamsDB()
+	if dbErr != 0 {
+		return dbErr
+	}
+	data, err := json.Marshal(teams)
+	if err != nil {
+		return 1
+	}
+	if err := db.Put(teamsKey(room), data); err != nil {
+		logError("saveTeams", room, "failed to save teams: %v", err)
+		return 1
+	}
+	return 0
+}
+
+func findTeam(teams []Team, name string) (Team, bool) {
+	for _, team := range teams {
+		if team.Name == name {
+			return team, true
+		}
+	}
+	return Team{}, false
+}
+
+// Team the user currently belongs to, or "" when the room is not in team mode
+func getUserTeam(room, userID string) string {
+	if userID == "" || !loadRoomSettings(room).TeamMode {
+		return ""
+	}
+	db, dbErr := getTeamsDB()
+	if dbErr != 0 {
+		return ""
+	}
+	data, err := db.Get(teamMemberKey(room, userID))
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func loadTeamScores(room string) map[string]int64 {
+	scores := make(map[string]int64)
+	db, dbErr := getTeamsDB()
+	if dbErr != 0 {
+		return scores
+	}
+	data, err := db.Get(teamScoresKey(room))
+	if err != nil || len(data) == 0 {
+		return scores
+	}
+	if err := json.Unmarshal(data, &scores); err != nil {
+		logError("loadTeamScores", room, "failed to unmarshal scores: %v", err)
+	}
+	return scores
+}
+
+// Drop the room's territory once its canvas is cleared
+func resetTeamScores(room string) {
+	db, dbErr := getTeamsDB()
+	if dbErr != 0 {
+		return
+	}
+	db.Delete(teamScoresKey(room))
+	maybeBroadcastTeamScores(room)
+}
+
+// Ranked territory counts for every team of the room, including empty ones
+func rankedTeamScores(room string) []TeamScore {
+	scores := loadTeamScores(room)
+	ranked := make([]TeamScore, 0, len(scores))
+	seen := make(map[string]bool)
+	for _, team := range loadTeams(room) {
+		ranked = append(ranked, TeamScore{Team: team.Name, Pixels: scores[team.Name]})
+		seen[team.Name] = true
+	}
+	for team, pixels := range scores {
+		if !seen[team] {
+			ranked = append(ranked, TeamScore{Team: team, Pixels: pixels})
+		}
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Pixels == ranked[j].Pixels {
+			return ranked[i].Team < ranked[j].Team
+		}
+		return ranked[i].Pixels > ranked[j].Pixels
+	})
+	return ranked
+}
+
+// Move territory between teams as pixels change owner
+func updateTeamScores(room string, changes []PixelChange) uint32 {
+	deltas := make(map[string]int64)
+	for _, change := range changes {
+		if change.Pixel.Team != "" {
+			deltas[change.Pixel.Team]++
+		}
+		if change.HadPrevious && change.Previous.Team != "" {
+			deltas[change.Previous.Team]--
+		}
+	}
+	changed := false
+	for _, delta := range deltas {
+		if delta != 0 {
+			changed = true
+		}
+	}
+	if !changed {
+		return 0
+	}
+
+	db, dbErr := getTeamsDB()
+	if dbErr != 0 {
+		return dbErr
+	}
+	scores := loadTeamScores(room)
+	for team, delta := range deltas {
+		scores[team] += delta
+		if scores[team] <= 0 {
+			delete(scores, team)
+		}
+	}
+	data, err := json.Marshal(scores)
+	if err != nil {
+		return 1
+	}
+	if err := db.Put(teamScoresKey(room), data); err != nil {
+		logError("updateTeamScores", room, "failed to save scores: %v", err)
+		return 1
+	}
+	maybeBroadcastTeamScores(room)
+	return 0
+}
+
+// Publish the current scores on the room's teams channel, at most once per interval
+func maybeBroadcastTeamScores(room string) {
+	db, dbErr := getTeamsDB()
+	if dbErr != 0 {
+		return
+	}
+	now := time.Now().UnixMilli()
+	if data, err := db.Get(teamScoresBroadcastKey(room)); err == nil {
+		last, _ := strconv.ParseInt(string(data), 10, 64)
+		if now-last < teamScoreBroadcastInterval.Milliseconds() {
+			return
+		}
+	}
+	if publishRoomEvent(room, "teams", "scores", rankedTeamScores(room)) == 0 {
+		db.Put(teamScoresBroadcastKey(room), []byte(strconv.FormatInt(now, 10)))
+	}
+}
+
+//export getTeamScores
+func getTeamScores(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	if _, code := checkAnonymousRead(h, room); code != 0 {
+		return code
+	}
+	setMaintenanceBanner(h, room)
+	if !loadRoomSettings(room).TeamMode {
+		return handleHTTPError(h, fmt.Errorf("team mode is not enabled for this room"), 400)
+	}
+	return sendJSONResponse(h, rankedTeamScores(room))
+}
+
+//export joinTeam
+func joinTeam(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := rejectDuringMaintenance(h, room); code != 0 {
+		return code
+	}
+	userID, err := h.Query().Get("userId")
+	if err != nil || userID == "" {
+		return handleHTTPError(h, fmt.Errorf("userId parameter required"), 400)
+	}
+	if code := requireSelfOrAdmin(h, room, userID); code != 0 {
+		return code
+	}
+	teamName, err := h.Query().Get("team")
+	if err != nil || teamName == "" {
+		return handleHTTPError(h, fmt.Errorf("team parameter required"), 400)
+	}
+	if !loadRoomSettings(room).TeamMode {
+		return handleHTTPError(h, fmt.Errorf("team mode is not enabled for this room"), 400)
+	}
+	team, ok := findTeam(loadTeams(room), teamName)
+	if !ok {
+		return handleHTTPError(h, fmt.Errorf("unknown team: %s", teamName), 404)
+	}
+	db, dbErr := getTeamsDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	if err := db.Put(teamMemberKey(room, userID), []byte(team.Name)); err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	return sendJSONResponse(h, team)
+}
+
+// Read the team name and color parameters shared by the team management endpoints
+func getTeamParams(h http.Event) (string, string, error) {
+	name, err := h.Query().Get("team")
+	if err != nil || name == "" || strings.Contains(name, "/") {
+		return "", "", fmt.Errorf("valid team parameter required")
+	}
+	color, err := h.Query().Get("color")
+	if err != nil {
+		return name, "", nil
+	}
+	if !isValidHexColor(color) {
+		return "", "", fmt.Errorf("color must be a #rrggbb hex value")
+	}
+	return name, strings.ToLower(color), nil
+}
+
+//export createTeam
+func createTeam(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := rejectDuringMaintenance(h, room); code != 0 {
+		return code
+	}
+	name, color, err := getTeamParams(h)
+	if err != nil {
+		return handleHTTPError(h, err, 400)
+	}
+	if color == "" {
+		return handleHTTPError(h, fmt.Errorf("color parameter required"), 400)
+	}
+	teams := loadTeams(room)
+	if _, exists := findTeam(teams, name); exists {
+		return handleHTTPError(h, fmt.Errorf("team already exists: %s", name), 409)
+	}
+	team := Team{Name: name, Color: color}
+	teams = append(append([]Team{}, teams...), team)
+	if saveTeams(room, teams) != 0 {
+		return handleHTTPError(h, fmt.Errorf("failed to save teams"), 500)
+	}
+	return sendJSONResponse(h, team)
+}
+
+//export setTeamColor
+func setTeamColor(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := rejectDuringMaintenance(h, room); code != 0 {
+		return code
+	}
+	name, color, err := getTeamParams(h)
+	if err != nil {
+		return handleHTTPError(h, err, 400)
+	}
+	if color == "" {
+		return handleHTTPError(h, fmt.Errorf("color parameter required"), 400)
+	}
+	teams := append([]Team{}, loadTeams(room)...)
+	found := false
+	for i := range teams {
+		if teams[i].Name == name {
+			teams[i].Color = color
+			found = true
+		}
+	}
+	if !found {
+		return handleHTTPError(h, fmt.Errorf("unknown team: %s", name), 404)
+	}
+	if saveTeams(room, teams) != 0 {
+		return handleHTTPError(h, fmt.Errorf("failed to save teams"), 500)
+	}
+	return sendJSONResponse(h, Team{Name: name, Color: color})
+}
+
+//export leaveTeam
+func leaveTeam(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := rejectDuringMaintenance(h, room); code != 0 {
+		return code
+	}
+	userID, err := h.Query().Get("userId")
+	if err != nil || userID == "" {
+		return handleHTTPError(h, fmt.Errorf("userId parameter required"), 400)
+	}
+	if code := requireSelfOrAdmin(h, room, userID); code != 0 {
+		return code
+	}
+	db, dbErr := getTeamsDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	if err := db.Delete(teamMemberKey(room, userID)); err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	h.Write([]byte("Left team"))
+	h.Return(200)
+	return 0
+}
+
+//export getTeams
+func getTeams(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	setMaintenanceBanner(h, room)
+	db, dbErr := getTeamsDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	rosters := make(map[string][]string)
+	for _, team := range loadTeams(room) {
+		rosters[team.Name] = []string{}
+	}
+	prefix := fmt.Sprintf("/%s/members/", room)
+	keys, err := db.List(prefix)
+	if err != nil {
+		logError("getTeams", room, "failed to list members: %v", err)
+	}
+	for _, key := range keys {
+		if len(key) <= len(prefix) {
+			continue
+		}
+		teamName, err := db.Get(key)
+		if err != nil {
+			continue
+		}
+		rosters[string(teamName)] = append(rosters[string(teamName)], key[len(prefix):])
+	}
+	teams := make([]TeamRoster, 0, len(rosters))
+	for _, team := range loadTeams(room) {
+		members := rosters[team.Name]
+		sort.Strings(members)
+		teams = append(teams, TeamRoster{Team: team, Members: members})
+	}
+	return sendJSONResponse(h, teams)
+}
+
+//export getOwnershipMap
+func getOwnershipMap(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	if _, code := checkAnonymousRead(h, room); code != 0 {
+		return code
+	}
+	setMaintenanceBanner(h, room)
+	if isShardedRoom(room) {
+		return handleHTTPError(h, fmt.Errorf("room %s is sharded and too large for a whole-canvas ownership map", room), 413)
+	}
+	pixels, dbErr := loadRoomPixels(room)
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	width, height := roomSize(room)
+	ownership := make([][]string, height)
+	for y := range ownership {
+		ownership[y] = make([]string, width)
+	}
+	for _, pixel := range pixels {
+		ownership[pixel.Y][pixel.X] = pixel.Team
+	}
+	return sendJSONResponse(h, map[string]interface{}{
+		"teams":     loadTeams(room),
+		"ownership": ownership,
+	})
+}
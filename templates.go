@@ -0,0 +1,255 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+const (
+	maskCorrect   = '1'
+	maskIncorrect = '0'
+	maskOutside   = '-'
+)
+
+func templateKey(room string) string {
+	return fmt.Sprintf("/%s/template", room)
+}
+
+func templateProgressKey(room string) string {
+	return fmt.Sprintf("/%s/progress", room)
+}
+
+func loadTemplate(room string) (Template, bool) {
+	var template Template
+	db, dbErr := getTemplatesDB()
+	if dbErr != 0 {
+		return template, false
+	}
+	data, err := db.Get(templateKey(room))
+	if err != nil || len(data) == 0 {
+		return template, false
+	}
+	if err := json.Unmarshal(data, &template); err != nil {
+		logError("loadTemplate", room, "failed to unmarshal template: %v", err)
+		return template, false
+	}
+	return template, true
+}
+
+func loadTemplateProgress(room string) (TemplateProgress, bool) {
+	var progress TemplateProgress
+	db, dbErr := getTemplatesDB()
+	if dbErr != 0 {
+		return progress, false
+	}
+	data, err := db.Get(templateProgressKey(room))
+	if err != nil || len(data) == 0 {
+		return progress, false
+	}
+	if err := json.Unmarshal(data, &progress); err != nil {
+		logError("loadTemplateProgress", room, "failed to unmarshal progress: %v", err)
+		return progress, false
+	}
+	return progress, true
+}
+
+func saveTemplateProgress(room string, progress TemplateProgress) uint32 {
+	db, dbErr := getTemplatesDB()
+	if dbErr != 0 {
+		return dbErr
+	}
+	data, err := json.Marshal(progress)
+	if err != nil {
+		return 1
+	}
+	if err := db.Put(templateProgressKey(room), data); err != nil {
+		logError("saveTemplateProgress", room, "failed to save progress: %v", err)
+		return 1
+	}
+	return 0
+}
+
+func (t Template) target(x, y int) string {
+	if y < 0 || y >= len(t.Grid) || x < 0 || x >= len(t.Grid[y]) {
+		return ""
+	}
+	return strings.ToLower(t.Grid[y][x])
+}
+
+// Build the full progress mask by comparing the template with the current canvas
+func computeTemplateProgress(room string, template Template) TemplateProgress {
+	canvas, dbErr := loadCanvasGrid(room)
+	if dbErr != 0 {
+		canvas = newBaseCanvas(room)
+	}
+
+	progress := TemplateProgress{Mask: make([]string, len(canvas))}
+	for y := range canvas {
+		row := make([]byte, len(canvas[y]))
+		for x := range canvas[y] {
+			target := template.target(x, y)
+			switch {
+			case target == "":
+				row[x] = maskOutside
+			case strings.ToLower(canvas[y][x]) == target:
+				row[x] = maskCorrect
+				progress.Total++
+				progress.Correct++
+			default:
+				row[x] = maskIncorrect
+				progress.Total++
+			}
+		}
+		progress.Mask[y] = string(row)
+	}
+	return progress
+}
+
+// Flip mask cells touched by a saved batch and keep the correct count in sync
+func updateTemplateProgress(room string, changes []PixelChange) uint32 {
+	template, ok := loadTemplate(room)
+	if !ok {
+		return 0
+	}
+	progress, ok := loadTemplateProgress(room)
+	if !ok {
+		progress = computeTemplateProgress(room, template)
+		return saveTemplateProgress(room, progress)
+	}
+	changed := false
+	for _, change := range changes {
+		x, y := change.Pixel.X, change.Pixel.Y
+		target := template.target(x, y)
+		if target == "" || y >= len(progress.Mask) || x >= len(progress.Mask[y]) {
+			continue
+		}
+		cell := byte(maskIncorrect)
+		if strings.ToLower(change.Pixel.Color) == target {
+			cell = maskCorrect
+		}
+		row := []byte(progress.Mask[y])
+		if row[x] == cell {
+			continue
+		}
+		if cell == maskCorrect {
+			progress.Correct++
+		} else {
+			progress.Correct--
+		}
+		row[x] = cell
+		progress.Mask[y] = string(row)
+		changed = true
+	}
+	if !changed {
+		return 0
+	}
+	return saveTemplateProgress(room, progress)
+}
+
+// Rebuild the progress mask against the cleared canvas
+func resetTemplateProgress(room string) {
+	if template, ok := loadTemplate(room); ok {
+		saveTemplateProgress(room, computeTemplateProgress(room, template))
+	}
+}
+
+//export setTemplate
+func setTemplate(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := rejectDuringMaintenance(h, room); code != 0 {
+		return code
+	}
+	var template Template
+	if err := readJSONBody(h, &template); err != nil {
+		return handleHTTPError(h, err, 400)
+	}
+	width, height := roomSize(room)
+	if len(template.Grid) > height {
+		return handleHTTPError(h, fmt.Errorf("template must fit inside the %dx%d canvas", width, height), 400)
+	}
+	for _, row := range template.Grid {
+		if len(row) > width {
+			return handleHTTPError(h, fmt.Errorf("template must fit inside the %dx%d canvas", width, height), 400)
+		}
+		for _, color := range row {
+			if color != "" && !isValidHexColor(color) {
+				return handleHTTPError(h, fmt.Errorf("invalid template color: %s", color), 400)
+			}
+		}
+	}
+	db, dbErr := getTemplatesDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	data, err := json.Marshal(template)
+	if err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	if err := db.Put(templateKey(room), data); err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	progress := computeTemplateProgress(room, template)
+	if saveTemplateProgress(room, progress) != 0 {
+		return handleHTTPError(h, fmt.Errorf("failed to save template progress"), 500)
+	}
+	return sendJSONResponse(h, progress)
+}
+
+//export getTemplateProgress
+func getTemplateProgress(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	if _, code := checkAnonymousRead(h, room); code != 0 {
+		return code
+	}
+	setMaintenanceBanner(h, room)
+	template, ok := loadTemplate(room)
+	if !ok {
+		return handleHTTPError(h, fmt.Errorf("room has no template"), 404)
+	}
+	progress, ok := loadTemplateProgress(room)
+	if !ok {
+		progress = computeTemplateProgress(room, template)
+		saveTemplateProgress(room, progress)
+	}
+	completion := 0.0
+	if progress.Total > 0 {
+		completion = float64(progress.Correct) * 100 / float64(progress.Total)
+	}
+	return sendJSONResponse(h, map[string]interface{}{
+		"completion": completion,
+		"total":      progress.Total,
+		"correct":    progress.Correct,
+		"mask":       progress.Mask,
+	})
+}
@@ -0,0 +1,98 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/taubyte/go-sdk/http/client"
+)
+
+func translationKey(room, messageID, language string) string {
+	return fmt.Sprintf("/%s/%s/%s", room, messageID, language)
+}
+
+// Post text to the translation service; it answers {"text": "..."}
+func requestTranslation(config GlobalConfig, text, source, target string) (string, error) {
+	body, err := json.Marshal(map[string]string{"text": text, "source": source, "target": target})
+	if err != nil {
+		return "", err
+	}
+	httpClient, err := client.New()
+	if err != nil {
+		return "", err
+	}
+	headers := map[string][]string{"Content-Type": {"application/json"}}
+	if config.TranslationAuthToken != "" {
+		headers["Authorization"] = []string{"Bearer " + config.TranslationAuthToken}
+	}
+	request, err := httpClient.Request(config.TranslationURL,
+		client.Method("POST"),
+		client.Headers(headers),
+		client.Body(body),
+	)
+	if err != nil {
+		return "", err
+	}
+	response, err := request.Do()
+	if err != nil {
+		return "", err
+	}
+	defer response.Body().Close()
+	data, err := io.ReadAll(response.Body())
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil || result.Text == "" {
+		return "", fmt.Errorf("unexpected translation response: %s", data)
+	}
+	return result.Text, nil
+}
+
+// Fill in each message's translation from the cache, asking the configured
+// service for missing ones; messages already in the room's language are left as is
+func translateMessages(room string, messages []ChatMessage, language string) {
+	source := localeLanguage(roomLocale(room))
+	if language == source {
+		return
+	}
+	db, dbErr := getTranslationsDB()
+	if dbErr != 0 {
+		return
+	}
+	config := loadGlobalConfig()
+	for i := range messages {
+		key := translationKey(room, messages[i].ID, language)
+		if data, err := db.Get(key); err == nil && len(data) > 0 {
+			messages[i].Translation = string(data)
+			continue
+		}
+		if config.TranslationURL == "" {
+			continue
+		}
+		translated, err := requestTranslation(config, messages[i].Message, source, language)
+		if err != nil {
+			logError("translateMessages", room, "failed for message %s: %v", messages[i].ID, err)
+			continue
+		}
+		if err := db.Put(key, []byte(translated)); err != nil {
+			logError("translateMessages", room, "failed to cache message %s: %v", messages[i].ID, err)
+		}
+		messages[i].Translation = translated
+	}
+}
+
+// Drop cached translations, e.g. after the room's chat is cleared
+func clearTranslations(room string) {
+	db, dbErr := getTranslationsDB()
+	if dbErr != 0 {
+		return
+	}
+	keys, _ := db.List(fmt.Sprintf("/%s/", room))
+	for _, key := range keys {
+		db.Delete(key)
+	}
+}
@@ -1,14 +1,78 @@
 package lib
 
+import "encoding/json"
+
 type Pixel struct {
-	X        int    `json:"x"`
-	Y        int    `json:"y"`
-	Color    string `json:"color"`
+	X         int    `json:"x"`
+	Y         int    `json:"y"`
+	Color     string `json:"color"`
+	UserID    string `json:"userId"`
+	Username  string `json:"username"`
+	Timestamp int64  `json:"timestamp,omitempty"`
+	Team      string `json:"team,omitempty"`
+}
+
+// CanvasCell is a pixel's position and color without its author
+type CanvasCell struct {
+	X     int    `json:"x"`
+	Y     int    `json:"y"`
+	Color string `json:"color"`
+}
+
+// PixelChange pairs a persisted pixel with the value it replaced
+type PixelChange struct {
+	Pixel       Pixel
+	Previous    Pixel
+	HadPrevious bool
+}
+
+type ChatMessage struct {
+	ID       string `json:"messageId"`
 	UserID   string `json:"userId"`
 	Username string `json:"username"`
+	Message  string `json:"message"`
+	// Milliseconds when the server received the message
+	Timestamp int64 `json:"timestamp"`
+	// Timestamp the sender put in the payload, when it differs; informational only
+	ClientTimestamp int64 `json:"clientTimestamp,omitempty"`
+	// Set on responses when a translation into the requested language was available
+	Translation string `json:"translation,omitempty"`
+	// Stored with the message when it contained a disallowed link and the link action is "flag"
+	Flagged bool `json:"flagged,omitempty"`
+	// Per-room order of persistence, used by getMessagesSinceSeq
+	Seq int64 `json:"seq,omitempty"`
+	// ID of the message this one replies to
+	ReplyTo string `json:"replyTo,omitempty"`
+	// Canvas coordinates referenced in the text, for clients to make clickable
+	Anchors []CoordinateAnchor `json:"anchors,omitempty"`
+	// Set on getMessages responses: users per reaction emoji and the replied-to message
+	Reactions map[string]int `json:"reactions,omitempty"`
+	Parent    *ChatParent    `json:"parent,omitempty"`
 }
 
-type ChatMessage struct {
+// CoordinateAnchor is a coordinate reference found in a chat message; Offset is
+// the byte offset of Text in the message
+type CoordinateAnchor struct {
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+	Text   string `json:"text"`
+	Offset int    `json:"offset"`
+}
+
+// DiscussedRegion is a canvas region with the number of chat messages referencing it
+type DiscussedRegion struct {
+	Region
+	Mentions int64 `json:"mentions"`
+}
+
+// RegionCount is a canvas region with how often it was read or subscribed to
+type RegionCount struct {
+	Region
+	Count int64 `json:"count"`
+}
+
+// Summary of the message a reply points at
+type ChatParent struct {
 	ID        string `json:"messageId"`
 	UserID    string `json:"userId"`
 	Username  string `json:"username"`
@@ -16,6 +80,757 @@ type ChatMessage struct {
 	Timestamp int64  `json:"timestamp"`
 }
 
+type PlacementRecord struct {
+	Seq       int64  `json:"seq"`
+	X         int    `json:"x"`
+	Y         int    `json:"y"`
+	Color     string `json:"color"`
+	UserID    string `json:"userId"`
+	Username  string `json:"username"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+type Team struct {
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+type TeamRoster struct {
+	Team
+	Members []string `json:"members"`
+}
+
+type TeamScore struct {
+	Team   string `json:"team"`
+	Pixels int64  `json:"pixels"`
+}
+
+type Region struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"w"`
+	Height int `json:"h"`
+}
+
+func (r Region) Contains(x, y int) bool {
+	return x >= r.X && x < r.X+r.Width && y >= r.Y && y < r.Y+r.Height
+}
+
+func (r Region) Overlaps(other Region) bool {
+	return r.X < other.X+other.Width && other.X < r.X+r.Width && r.Y < other.Y+other.Height && other.Y < r.Y+r.Height
+}
+
+type Contributor struct {
+	UserID   string `json:"userId"`
+	Username string `json:"username"`
+	Pixels   int64  `json:"pixels"`
+}
+
+// Credit is a contributor's line in a room's published credits
+type Credit struct {
+	Rank int `json:"rank"`
+	Contributor
+	FirstContribution int64 `json:"firstContribution"`
+	LastContribution  int64 `json:"lastContribution"`
+}
+
+// CoordinateEdits counts how often a cell has been painted
+type CoordinateEdits struct {
+	X     int   `json:"x"`
+	Y     int   `json:"y"`
+	Edits int64 `json:"edits"`
+}
+
+// RoomStats holds a room's running placement aggregates
+type RoomStats struct {
+	TotalPixels int64                  `json:"totalPixels"`
+	Users       map[string]Contributor `json:"users"`
+	// The most edited cells, kept sorted; per-cell counts live in their own keys
+	MostEdited []CoordinateEdits `json:"mostEdited"`
+}
+
+// PeriodWinners records the top contributors of a finished leaderboard period
+type PeriodWinners struct {
+	Period     string        `json:"period"`
+	Bucket     string        `json:"bucket"`
+	Winners    []Contributor `json:"winners"`
+	ArchivedAt int64         `json:"archivedAt"`
+}
+
+type CursorPosition struct {
+	UserID   string `json:"userId"`
+	Username string `json:"username"`
+	X        int    `json:"x"`
+	Y        int    `json:"y"`
+}
+
+// EphemeralState is short-lived per-user state such as a cursor, selection box or tool
+type EphemeralState struct {
+	UserID    string          `json:"userId"`
+	Username  string          `json:"username"`
+	Kind      string          `json:"kind"`
+	Value     json.RawMessage `json:"value"`
+	UpdatedAt int64           `json:"updatedAt"`
+	ExpiresAt int64           `json:"expiresAt"`
+}
+
+type Zone struct {
+	ID     string           `json:"id"`
+	Name   string           `json:"name"`
+	X      int              `json:"x"`
+	Y      int              `json:"y"`
+	Width  int              `json:"width"`
+	Height int              `json:"height"`
+	Owner  string           `json:"owner"`
+	Counts map[string]int64 `json:"counts"`
+}
+
+// Template is a target image; empty cells are not part of the template
+type Template struct {
+	Grid [][]string `json:"grid"`
+}
+
+// TemplateProgress mask rows use '1' for correct, '0' for incorrect and '-' for cells outside the template
+type TemplateProgress struct {
+	Total   int      `json:"total"`
+	Correct int      `json:"correct"`
+	Mask    []string `json:"mask"`
+}
+
+type RoomSettings struct {
+	TeamMode           bool          `json:"teamMode"`
+	Maintenance        bool          `json:"maintenance"`
+	MaintenanceMessage string        `json:"maintenanceMessage,omitempty"`
+	Durability         string        `json:"durability,omitempty"`
+	Quotas             StorageQuotas `json:"quotas"`
+	Replicate          bool          `json:"replicate"`
+	// Color shown for unset pixels when no background layer covers them
+	DefaultColor string             `json:"defaultColor,omitempty"`
+	Moderation   ModerationSettings `json:"moderation"`
+	// Minimum time between a user's batches; scaled down for higher reputation tiers
+	CooldownMs int64 `json:"cooldownMs"`
+	// At most PixelsPerInterval pixels per user in each RateIntervalMs window; zero disables the limit
+	PixelsPerInterval int   `json:"pixelsPerInterval"`
+	RateIntervalMs    int64 `json:"rateIntervalMs"`
+	// Extra cooldown for painting over another user's pixel: up to OverwriteTaxMs
+	// per pixel, shrinking to nothing once the pixel is OverwriteTaxWindowMs old
+	OverwriteTaxMs       int64 `json:"overwriteTaxMs"`
+	OverwriteTaxWindowMs int64 `json:"overwriteTaxWindowMs"`
+	// Pixels each user may place per UTC day; zero means unlimited
+	DailyPixelQuota int64 `json:"dailyPixelQuota"`
+	// Snapshot frames older than this are pruned after each capture; zero keeps them all
+	SnapshotRetentionHours int `json:"snapshotRetentionHours"`
+	// Seconds without a heartbeat before a user drops offline; zero uses the default of 60
+	PresenceTimeoutSeconds int `json:"presenceTimeoutSeconds,omitempty"`
+	// Minutes without placing or chatting before an online user is kicked and
+	// their session tokens revoked; zero disables idle kicks
+	IdleTimeoutMinutes int `json:"idleTimeoutMinutes,omitempty"`
+	// Retention tier from the global config driving history and snapshot pruning
+	RetentionTier string `json:"retentionTier,omitempty"`
+	// Language tag such as "fr" or "pt-BR"; picks the word list and system message templates
+	Locale string `json:"locale,omitempty"`
+	// Private rooms cannot be read without an API key
+	Private bool `json:"private"`
+	// Stored pixels omit who placed them; identities remain only in the history log
+	AnonymizeContributors bool `json:"anonymizeContributors"`
+	// Writes and channel URLs need a live session token from issueSessionToken
+	RequireSession bool `json:"requireSession"`
+	// Free-form fields shown by frontends, such as a theme, rules text or links
+	Custom map[string]string `json:"custom,omitempty"`
+	// Colors pixels are restricted to; empty allows any color
+	Palette []string `json:"palette,omitempty"`
+	// What happens to colors outside the palette: "reject" (default) or "snap"
+	// to the perceptually nearest palette color
+	PaletteMode string `json:"paletteMode,omitempty"`
+	// Generative pattern under the background layer: "noise", "gradient" or
+	// "checkerboard", drawn from the room's seed between up to two colors
+	BackgroundFill       string   `json:"backgroundFill,omitempty"`
+	BackgroundFillColors []string `json:"backgroundFillColors,omitempty"`
+	// "signature" turns the room into a signature wall where each user signs
+	// one region of at most SignatureWidth x SignatureHeight pixels
+	Mode            string `json:"mode,omitempty"`
+	SignatureWidth  int    `json:"signatureWidth,omitempty"`
+	SignatureHeight int    `json:"signatureHeight,omitempty"`
+	// Minutes during which users may delete their own messages and revert
+	// their own pixels; zero uses the default of 15 and negative disables it
+	SelfServeWindowMinutes int `json:"selfServeWindowMinutes,omitempty"`
+}
+
+// Room modes; the default is a shared canvas
+const RoomModeSignature = "signature"
+
+// Signature is the region a user signed on a signature wall
+type Signature struct {
+	UserID   string `json:"userId"`
+	Username string `json:"username"`
+	Region   Region `json:"region"`
+	Text     string `json:"text,omitempty"`
+	SignedAt int64  `json:"signedAt"`
+}
+
+// Generative background fills
+const (
+	FillNoise        = "noise"
+	FillGradient     = "gradient"
+	FillCheckerboard = "checkerboard"
+)
+
+// Palette modes
+const (
+	PaletteReject = "reject"
+	PaletteSnap   = "snap"
+)
+
+// ModerationSettings sets how many warnings escalate to a mute or a ban; zero disables the step
+type ModerationSettings struct {
+	MuteAfterWarnings int `json:"muteAfterWarnings"`
+	BanAfterWarnings  int `json:"banAfterWarnings"`
+	// Length of automatic sanctions; zero means they last until lifted
+	MuteDurationMinutes int `json:"muteDurationMinutes"`
+	BanDurationMinutes  int `json:"banDurationMinutes"`
+	// Users whose abuse score reaches the threshold get AbuseAction ("mute" or "ban"); zero disables it
+	AbuseScoreThreshold int    `json:"abuseScoreThreshold"`
+	AbuseAction         string `json:"abuseAction,omitempty"`
+}
+
+// ChatReminder is a system message posted to a room on a cron schedule (UTC)
+type ChatReminder struct {
+	ID        int64  `json:"id"`
+	Message   string `json:"message"`
+	Cron      string `json:"cron"`
+	CreatedBy string `json:"createdBy,omitempty"`
+	CreatedAt int64  `json:"createdAt"`
+	LastRunAt int64  `json:"lastRunAt,omitempty"`
+}
+
+// Warning is a moderator note recorded against a user
+type Warning struct {
+	Seq       int64  `json:"seq"`
+	UserID    string `json:"userId"`
+	Reason    string `json:"reason"`
+	Moderator string `json:"moderator,omitempty"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+// Sanction restricts a user in a room: a mute blocks chat, a ban blocks chat and pixels
+type Sanction struct {
+	UserID    string `json:"userId"`
+	Kind      string `json:"kind"`
+	Reason    string `json:"reason"`
+	Moderator string `json:"moderator,omitempty"`
+	CreatedAt int64  `json:"createdAt"`
+	// Zero means the sanction never expires
+	ExpiresAt int64 `json:"expiresAt,omitempty"`
+}
+
+// Appeal asks room owners to lift a sanction
+type Appeal struct {
+	ID         int64  `json:"id"`
+	Room       string `json:"room"`
+	UserID     string `json:"userId"`
+	Kind       string `json:"kind"`
+	Message    string `json:"message"`
+	State      string `json:"state"`
+	CreatedAt  int64  `json:"createdAt"`
+	Reviewer   string `json:"reviewer,omitempty"`
+	ReviewedAt int64  `json:"reviewedAt,omitempty"`
+}
+
+// Appeal states
+const (
+	AppealPending  = "pending"
+	AppealAccepted = "accepted"
+	AppealRejected = "rejected"
+)
+
+// Notification is an entry in a user's inbox
+type Notification struct {
+	Seq       int64       `json:"seq"`
+	Type      string      `json:"type"`
+	Room      string      `json:"room,omitempty"`
+	Message   string      `json:"message"`
+	Data      interface{} `json:"data,omitempty"`
+	CreatedAt int64       `json:"createdAt"`
+	Read      bool        `json:"read"`
+}
+
+// Outcomes recorded on audit entries
+const (
+	AuditPending   = "pending"
+	AuditSucceeded = "succeeded"
+	AuditFailed    = "failed"
+)
+
+// Sanction kinds
+const (
+	SanctionMute = "mute"
+	SanctionBan  = "ban"
+)
+
+// ModerationOperation is one step of a bulkModerate batch. Ban and mute use
+// UserID, Reason and DurationMinutes; deleteMessage uses MessageID; and
+// revertRegion repaints Region as it looked at the Before timestamp
+type ModerationOperation struct {
+	Type            string `json:"type"`
+	UserID          string `json:"userId,omitempty"`
+	Reason          string `json:"reason,omitempty"`
+	DurationMinutes int    `json:"durationMinutes,omitempty"`
+	MessageID       string `json:"messageId,omitempty"`
+	Region          Region `json:"region"`
+	Before          int64  `json:"before,omitempty"`
+}
+
+// Bulk moderation operation types besides the sanction kinds
+const (
+	OperationDeleteMessage = "deleteMessage"
+	OperationRevertRegion  = "revertRegion"
+)
+
+// BackgroundLayer is a baked image shown under unset pixels; empty cells fall back to the default color
+type BackgroundLayer struct {
+	Grid [][]string `json:"grid"`
+}
+
+// StorageQuotas bound per-room data; zero means unlimited
+type StorageQuotas struct {
+	MaxHistoryEntries int64 `json:"maxHistoryEntries"`
+	MaxChatMessages   int64 `json:"maxChatMessages"`
+}
+
+type QuotaUsage struct {
+	Used  int64 `json:"used"`
+	Limit int64 `json:"limit"`
+}
+
+type QuotaStatus struct {
+	History       QuotaUsage `json:"history"`
+	Chat          QuotaUsage `json:"chat"`
+	RetentionTier string     `json:"retentionTier,omitempty"`
+}
+
+// RetentionTier is an operator-defined history and snapshot policy; zero values keep everything
+type RetentionTier struct {
+	Name string `json:"name,omitempty"`
+	// Placement records older than this many days are pruned
+	HistoryDays       int   `json:"historyDays,omitempty"`
+	MaxHistoryEntries int64 `json:"maxHistoryEntries,omitempty"`
+	// Snapshot frames older than this are pruned; the interval defaults to hourly frames
+	SnapshotRetentionHours  int `json:"snapshotRetentionHours,omitempty"`
+	SnapshotIntervalMinutes int `json:"snapshotIntervalMinutes,omitempty"`
+	// Placements between log checkpoints; zero uses the default
+	CheckpointEvery int64 `json:"checkpointEvery,omitempty"`
+	// Placements older than this are folded into the latest checkpoint before
+	// them and dropped from the log; zero keeps the full log
+	RecentHistoryHours int `json:"recentHistoryHours,omitempty"`
+}
+
+// GlobalConfig holds deployment-wide switches managed through the admin config API
+type GlobalConfig struct {
+	Maintenance        bool   `json:"maintenance"`
+	MaintenanceMessage string `json:"maintenanceMessage,omitempty"`
+	SynchronousWrites  bool   `json:"synchronousWrites"`
+	// Requests plus events allowed per API key each hour; 0 means unlimited
+	KeyQuotaPerHour int64 `json:"keyQuotaPerHour,omitempty"`
+	// Per-key overrides of KeyQuotaPerHour, keyed by key ID
+	KeyQuotas map[string]int64 `json:"keyQuotas,omitempty"`
+	// Base URL that archived room blobs are PUT to and fetched back from
+	ArchiveEndpoint string `json:"archiveEndpoint,omitempty"`
+	// Optional bearer token sent with archive storage requests
+	ArchiveAuthToken string `json:"archiveAuthToken,omitempty"`
+	// Relay channel and HTTP sink that replicated rooms forward accepted events to
+	ReplicationChannel string `json:"replicationChannel,omitempty"`
+	ReplicationSinkURL string `json:"replicationSinkUrl,omitempty"`
+	// Shared by the primary and its mirrors; events are signed with it and
+	// mirrors drop events without a valid signature
+	ReplicationSecret string `json:"replicationSecret,omitempty"`
+	// Receives JSON posts for server events such as daily digests
+	WebhookURL string `json:"webhookUrl,omitempty"`
+	// External service chat messages are posted to for translation, with an optional bearer token
+	TranslationURL       string `json:"translationUrl,omitempty"`
+	TranslationAuthToken string `json:"translationAuthToken,omitempty"`
+	// Domains (and their subdomains) not allowed in chat links
+	BlockedDomains []string `json:"blockedDomains,omitempty"`
+	// Optional service asked about link domains not on the blocklist
+	LinkReputationURL string `json:"linkReputationUrl,omitempty"`
+	// What happens to messages with disallowed links: "reject" (default) or "flag"
+	LinkAction string `json:"linkAction,omitempty"`
+	// Reads per minute allowed per IP without an API key; 0 uses the default, negative disables the limit
+	AnonymousReadsPerMinute int64 `json:"anonymousReadsPerMinute,omitempty"`
+	// Per-key limits on destructive endpoints; 0 uses the default, negative disables the limit
+	DestructiveCooldownSeconds int64 `json:"destructiveCooldownSeconds,omitempty"`
+	DestructiveDailyLimit      int64 `json:"destructiveDailyLimit,omitempty"`
+	// Window in which concurrent pixel batches of a room are merged into one save;
+	// 0 uses the default, negative disables aggregation
+	PixelAggregationWindowMs int64 `json:"pixelAggregationWindowMs,omitempty"`
+	// What happens to payloads and requests that name no room: "allow" (default)
+	// places them in the default room, "deny" rejects them and "map" places them
+	// in DefaultRoomTarget
+	DefaultRoomMode   string `json:"defaultRoomMode,omitempty"`
+	DefaultRoomTarget string `json:"defaultRoomTarget,omitempty"`
+	// Minimum level written to the logs: "DEBUG", "INFO" (default) or "ERROR"
+	LogLevel string `json:"logLevel,omitempty"`
+	// Named retention policies rooms can be assigned through their retentionTier
+	// setting; rooms without one use DefaultRetentionTier
+	RetentionTiers       map[string]RetentionTier `json:"retentionTiers,omitempty"`
+	DefaultRetentionTier string                   `json:"defaultRetentionTier,omitempty"`
+	// Milliseconds a handler may spend before returning a partial result with a
+	// continuation cursor, keyed by handler name; handlers without one are unbounded
+	HandlerBudgetsMs map[string]int64 `json:"handlerBudgetsMs,omitempty"`
+}
+
+// Default room modes
+const (
+	DefaultRoomAllow = "allow"
+	DefaultRoomDeny  = "deny"
+	DefaultRoomMap   = "map"
+)
+
+// Intent is a raw accepted payload logged before it is applied
+type Intent struct {
+	ID string `json:"id,omitempty"`
+	// Set on intents logged under the former global sequence
+	Seq       int64  `json:"seq,omitempty"`
+	Kind      string `json:"kind"`
+	Room      string `json:"room"`
+	Payload   []byte `json:"payload"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// ReplicationEvent carries an accepted payload to a mirroring deployment
+type ReplicationEvent struct {
+	Room      string `json:"room"`
+	Seq       int64  `json:"seq"`
+	Kind      string `json:"kind"`
+	Payload   []byte `json:"payload"`
+	Timestamp int64  `json:"timestamp"`
+	// Hex HMAC-SHA256 of the event under the deployment's replication secret
+	Signature string `json:"signature,omitempty"`
+}
+
+// Actions taken on chat messages containing disallowed links
+const (
+	LinkActionReject = "reject"
+	LinkActionFlag   = "flag"
+)
+
+// Intent kinds
+const (
+	IntentPixels = "pixels"
+	IntentChat   = "chat"
+)
+
+// CanvasChunk holds a chunkSize x chunkSize tile in row-major order; nil cells are unset
+type CanvasChunk struct {
+	Cells []*Pixel `json:"cells"`
+}
+
+// MigrationStatus reports the progress of a storage layout migration
+type MigrationStatus struct {
+	Room              string `json:"room"`
+	To                string `json:"to"`
+	State             string `json:"state"`
+	Pixels            int    `json:"pixels"`
+	TotalChunks       int    `json:"totalChunks"`
+	ChunksWritten     int    `json:"chunksWritten"`
+	ChunksVerified    int    `json:"chunksVerified"`
+	LegacyKeysDeleted int    `json:"legacyKeysDeleted"`
+	Error             string `json:"error,omitempty"`
+	UpdatedAt         int64  `json:"updatedAt"`
+}
+
+// KeyUsage counts the traffic attributed to one API key or bot token
+type KeyUsage struct {
+	KeyID       string           `json:"keyId"`
+	Requests    int64            `json:"requests"`
+	Events      int64            `json:"events"`
+	Endpoints   map[string]int64 `json:"endpoints"`
+	FirstSeen   int64            `json:"firstSeen"`
+	LastSeen    int64            `json:"lastSeen"`
+	WindowStart int64            `json:"windowStart"`
+	WindowCount int64            `json:"windowCount"`
+}
+
+// RoomArchive is the full hot-storage content of a room serialized for cold storage
+type RoomArchive struct {
+	// Format version; archives written before versioning have none
+	Version    int               `json:"version,omitempty"`
+	Room       string            `json:"room"`
+	ArchivedAt int64             `json:"archivedAt"`
+	Layout     string            `json:"layout"`
+	Pixels     []Pixel           `json:"pixels"`
+	Messages   []ChatMessage     `json:"messages"`
+	History    []PlacementRecord `json:"history"`
+	// Only full exports carry the room's registry entry, settings and stats
+	Metadata *RoomMetadata `json:"metadata,omitempty"`
+	Settings *RoomSettings `json:"settings,omitempty"`
+	Stats    *RoomStats    `json:"stats,omitempty"`
+}
+
+// ArchiveRecord marks a room whose data lives in cold storage
+type ArchiveRecord struct {
+	Room           string `json:"room"`
+	URL            string `json:"url"`
+	Checksum       string `json:"checksum"`
+	Bytes          int64  `json:"bytes"`
+	ArchivedAt     int64  `json:"archivedAt"`
+	Pixels         int    `json:"pixels"`
+	Messages       int    `json:"messages"`
+	HistoryEntries int    `json:"historyEntries"`
+}
+
+// ColorRemap maps canvas colors onto an accessibility-friendly palette
+type ColorRemap struct {
+	Name    string            `json:"name"`
+	Mapping map[string]string `json:"mapping"`
+}
+
+// UserStats tracks a user's activity across all rooms
+type UserStats struct {
+	UserID     string `json:"userId"`
+	FirstSeen  int64  `json:"firstSeen"`
+	LastSeen   int64  `json:"lastSeen"`
+	Placements int64  `json:"placements"`
+	// Consecutive UTC days with at least one placement
+	CurrentStreak int    `json:"currentStreak"`
+	LongestStreak int    `json:"longestStreak"`
+	LastActiveDay string `json:"lastActiveDay,omitempty"`
+}
+
+// UsernameChange records a user taking a new display name
+type UsernameChange struct {
+	UserID    string `json:"userId"`
+	Username  string `json:"username"`
+	Previous  string `json:"previous,omitempty"`
+	ChangedAt int64  `json:"changedAt"`
+}
+
+// UsernameClaim reserves a display name for a user; released names stay
+// reserved for a while after ReleasedAt
+type UsernameClaim struct {
+	UserID     string `json:"userId"`
+	ReleasedAt int64  `json:"releasedAt,omitempty"`
+}
+
+// ReputationTier relaxes placement limits for established users
+type ReputationTier struct {
+	Name           string `json:"name"`
+	MinAgeDays     int    `json:"minAgeDays"`
+	MinPlacements  int64  `json:"minPlacements"`
+	MaxBatchSize   int    `json:"maxBatchSize"`
+	CooldownFactor int    `json:"cooldownPercent"`
+}
+
+// CanvasSnapshot is a captured frame of a room's canvas. Frames are stored
+// compacted as a palette plus run-length pairs and expanded into Grid on load.
+type CanvasSnapshot struct {
+	Room      string     `json:"room"`
+	Timestamp int64      `json:"timestamp"`
+	Width     int        `json:"width,omitempty"`
+	Height    int        `json:"height,omitempty"`
+	Grid      [][]string `json:"grid,omitempty"`
+	Palette   []string   `json:"palette,omitempty"`
+	// Alternating palette index and run length over the cells in row-major order
+	Runs []int `json:"runs,omitempty"`
+}
+
+// HistoryCheckpoint is the canvas with every placement up to Seq applied
+type HistoryCheckpoint struct {
+	Seq int64 `json:"seq"`
+	CanvasSnapshot
+}
+
+// CanvasDigest summarizes how a room changed over one day
+type CanvasDigest struct {
+	Room          string `json:"room"`
+	Day           string `json:"day"`
+	From          int64  `json:"from"`
+	To            int64  `json:"to"`
+	ChangedPixels int    `json:"changedPixels"`
+	Bounds        Region `json:"bounds"`
+	// Before and after frames side by side, base64 PNG
+	PreviewPNG string `json:"previewPng"`
+}
+
+// Banner is an announcement shown to everyone in a room, optionally counting down to an event
+type Banner struct {
+	Message     string `json:"message"`
+	CountdownTo int64  `json:"countdownTo,omitempty"`
+	// The banner is cleared automatically once this passes; zero keeps it until replaced
+	ExpiresAt int64  `json:"expiresAt,omitempty"`
+	SetBy     string `json:"setBy,omitempty"`
+	SetAt     int64  `json:"setAt"`
+}
+
+// RoomMetadata is a room's registry entry
+type RoomMetadata struct {
+	Room       string `json:"room"`
+	Name       string `json:"name"`
+	Creator    string `json:"creator,omitempty"`
+	CreatedAt  int64  `json:"createdAt"`
+	Width      int    `json:"width"`
+	Height     int    `json:"height"`
+	Visibility string `json:"visibility"`
+	// Drawn at creation and on each canvas reset; seeds the generative fill
+	Seed int64 `json:"seed,omitempty"`
+}
+
+// Room visibility; private rooms cannot be read anonymously
+const (
+	VisibilityPublic  = "public"
+	VisibilityPrivate = "private"
+)
+
+// Bookmark names a moment of a room's timeline by placement sequence
+type Bookmark struct {
+	ID        int64  `json:"id"`
+	Room      string `json:"room"`
+	Name      string `json:"name"`
+	Seq       int64  `json:"seq"`
+	Timestamp int64  `json:"timestamp"`
+	CreatedBy string `json:"createdBy"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+// Canvas storage layouts
+const (
+	LayoutLegacy  = "legacy"
+	LayoutChunked = "chunked"
+)
+
+// Room durability modes; an empty value follows the global SynchronousWrites switch
+const (
+	DurabilityAsync = "async"
+	DurabilitySync  = "sync"
+)
+
+// Default canvas size for rooms created without explicit dimensions
 const CanvasWidth = 32
 const CanvasHeight = 32
 
+// SessionToken is an issued connection token; only its hash is stored
+type SessionToken struct {
+	Room      string `json:"room"`
+	UserID    string `json:"userId"`
+	IssuedAt  int64  `json:"issuedAt"`
+	ExpiresAt int64  `json:"expiresAt"`
+	RevokedAt int64  `json:"revokedAt,omitempty"`
+	// Hash of the token that replaced this one on rotation
+	ReplacedBy string `json:"replacedBy,omitempty"`
+	// ID of the API key that vouched for the user, or "admin"
+	IssuedBy string `json:"issuedBy,omitempty"`
+}
+
+// AdminToken is a provisioned admin credential; only its hash is stored.
+// An empty Room marks the deployment-wide shared secret.
+type AdminToken struct {
+	Room     string `json:"room,omitempty"`
+	Hash     string `json:"hash"`
+	IssuedAt int64  `json:"issuedAt"`
+}
+
+// APIKey is a provisioned integration key; only its hash is stored
+type APIKey struct {
+	KeyID     string `json:"keyId"`
+	Label     string `json:"label,omitempty"`
+	Hash      string `json:"hash"`
+	IssuedAt  int64  `json:"issuedAt"`
+	RevokedAt int64  `json:"revokedAt,omitempty"`
+}
+
+// RateWindow tracks a user's placements for the room cooldown and rate limit
+type RateWindow struct {
+	LastPlacement int64 `json:"lastPlacement"`
+	WindowStart   int64 `json:"windowStart"`
+	Pixels        int   `json:"pixels"`
+	// Overwrite tax owed by the last batch, added to the cooldown after it
+	TaxMs int64 `json:"taxMs,omitempty"`
+}
+
+// AbuseSignals are the per-room counters behind a user's abuse score
+type AbuseSignals struct {
+	UserID        string `json:"userId"`
+	RateLimitHits int64  `json:"rateLimitHits"`
+	Placements    int64  `json:"placements"`
+	// Placements that painted over another user's pixel
+	Overwrites int64 `json:"overwrites"`
+	Reports    int64 `json:"reports"`
+}
+
+// AbuseScore is a 0-100 rating of how suspicious a user's activity looks
+type AbuseScore struct {
+	AbuseSignals
+	AccountAgeHours int64          `json:"accountAgeHours"`
+	Score           int            `json:"score"`
+	Components      map[string]int `json:"components"`
+}
+
+// Artwork is a finished region of a room, locked against further placements
+type Artwork struct {
+	ID     int64  `json:"id"`
+	Room   string `json:"room"`
+	Title  string `json:"title"`
+	Region Region `json:"region"`
+	// Everyone who placed inside the region according to the retained history
+	Credits    []Contributor `json:"credits"`
+	Placements int64         `json:"placements"`
+	// Timestamp of the snapshot frame captured when the artwork was finished
+	SnapshotAt int64  `json:"snapshotAt"`
+	FinishedBy string `json:"finishedBy,omitempty"`
+	FinishedAt int64  `json:"finishedAt"`
+}
+
+// AuditEntry records a destructive action and who performed it
+type AuditEntry struct {
+	Seq       int64  `json:"seq"`
+	Room      string `json:"room"`
+	Action    string `json:"action"`
+	KeyID     string `json:"keyId,omitempty"`
+	IP        string `json:"ip"`
+	Details   string `json:"details,omitempty"`
+	CreatedAt int64  `json:"createdAt"`
+	// "pending" while the action runs, then "succeeded" or "failed"
+	Status      string `json:"status,omitempty"`
+	Error       string `json:"error,omitempty"`
+	CompletedAt int64  `json:"completedAt,omitempty"`
+}
+
+// PresenceEntry is a user's latest heartbeat in a room
+type PresenceEntry struct {
+	UserID   string `json:"userId"`
+	Username string `json:"username"`
+	LastSeen int64  `json:"lastSeen"`
+	// Last placement or chat message; drives the room's idle timeout
+	LastActive int64 `json:"lastActive,omitempty"`
+	ExpiresAt  int64 `json:"expiresAt"`
+}
+
+// GlobalStats is the deployment-wide summary served as stats.json
+type GlobalStats struct {
+	Day              string `json:"day"`
+	TotalRooms       int    `json:"totalRooms"`
+	ActiveRoomsToday int    `json:"activeRoomsToday"`
+	PixelsToday      int64  `json:"pixelsToday"`
+	MessagesToday    int64  `json:"messagesToday"`
+	// Distinct users who placed pixels or chatted today
+	ActiveUsersToday int `json:"activeUsersToday"`
+	// Users with a live presence heartbeat in any room
+	OnlineUsers int   `json:"onlineUsers"`
+	GeneratedAt int64 `json:"generatedAt"`
+}
+
+// ModerationConfig is a room's moderation setup as exported for reuse in other rooms
+type ModerationConfig struct {
+	Version    int    `json:"version"`
+	Room       string `json:"room"`
+	ExportedAt int64  `json:"exportedAt"`
+	// Effective word list of the room; imported as the target room's own list
+	WordList      []string           `json:"wordList"`
+	Rules         ModerationSettings `json:"rules"`
+	LockedRegions []LockedRegion     `json:"lockedRegions"`
+}
+
+// LockedRegion is a finished-artwork area where no more pixels may be placed
+type LockedRegion struct {
+	Title  string `json:"title,omitempty"`
+	Region Region `json:"region"`
+}
@@ -0,0 +1,276 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+// Minimum time between two changes of the same user's name
+const usernameChangeCooldown = 24 * time.Hour
+
+// A name given up stays reserved for its previous holder this long, so it
+// cannot be picked up right away to impersonate them
+const usernameReleaseHold = 30 * 24 * time.Hour
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{3,32}$`)
+
+// Names the server writes itself
+var reservedUsernames = map[string]bool{"system": true, "unknown": true, "anonymous": true}
+
+func currentUsernameKey(userID string) string {
+	return fmt.Sprintf(globalKeyPrefix+"current/%s", userID)
+}
+
+// Claims are keyed case-insensitively so names differing only in case collide
+func usernameClaimKey(username string) string {
+	return fmt.Sprintf(globalKeyPrefix+"names/%s", strings.ToLower(username))
+}
+
+func usernameHistoryKey(userID string, changedAt int64) string {
+	return fmt.Sprintf(globalKeyPrefix+"history/%s/%013d", userID, changedAt)
+}
+
+func loadCurrentUsername(userID string) (UsernameChange, bool) {
+	var current UsernameChange
+	db, dbErr := getUsernamesDB()
+	if dbErr != 0 {
+		return current, false
+	}
+	data, err := db.Get(currentUsernameKey(userID))
+	if err != nil || len(data) == 0 {
+		return current, false
+	}
+	if err := json.Unmarshal(data, &current); err != nil {
+		logError("loadCurrentUsername", "", "failed to unmarshal name of user %s: %v", userID, err)
+		return current, false
+	}
+	return current, true
+}
+
+func loadUsernameClaim(username string) (UsernameClaim, bool) {
+	var claim UsernameClaim
+	db, dbErr := getUsernamesDB()
+	if dbErr != 0 {
+		return claim, false
+	}
+	data, err := db.Get(usernameClaimKey(username))
+	if err != nil || len(data) == 0 {
+		return claim, false
+	}
+	return claim, json.Unmarshal(data, &claim) == nil
+}
+
+// Whether the user may take the name: it is free, already theirs, or was
+// released by someone else longer ago than the hold
+func usernameAvailable(username, userID string, now time.Time) bool {
+	claim, found := loadUsernameClaim(username)
+	if !found || claim.UserID == userID {
+		return true
+	}
+	return claim.ReleasedAt > 0 && now.Sub(time.UnixMilli(claim.ReleasedAt)) >= usernameReleaseHold
+}
+
+// Every recorded name change of the user, oldest first
+func loadUsernameHistory(userID string) []UsernameChange {
+	changes := make([]UsernameChange, 0)
+	db, dbErr := getUsernamesDB()
+	if dbErr != 0 {
+		return changes
+	}
+	keys, _ := db.List(fmt.Sprintf(globalKeyPrefix+"history/%s/", userID))
+	sort.Strings(keys)
+	for _, key := range keys {
+		data, err := db.Get(key)
+		if err != nil {
+			continue
+		}
+		var change UsernameChange
+		if json.Unmarshal(data, &change) == nil {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// Every change to or from the name across all users, oldest first
+func findUsernameHolders(username string) []UsernameChange {
+	changes := make([]UsernameChange, 0)
+	db, dbErr := getUsernamesDB()
+	if dbErr != 0 {
+		return changes
+	}
+	keys, _ := db.List(globalKeyPrefix + "history/")
+	for _, key := range keys {
+		data, err := db.Get(key)
+		if err != nil {
+			continue
+		}
+		var change UsernameChange
+		if json.Unmarshal(data, &change) != nil {
+			continue
+		}
+		if strings.EqualFold(change.Username, username) || strings.EqualFold(change.Previous, username) {
+			changes = append(changes, change)
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].ChangedAt < changes[j].ChangedAt
+	})
+	return changes
+}
+
+// Display names registered through changeUsername, looked up once per user.
+// Stored pixels and messages keep the name they were written with; readers
+// swap in the current one.
+type usernameResolver map[string]string
+
+func (r usernameResolver) name(userID, stored string) string {
+	if userID == "" {
+		return stored
+	}
+	current, ok := r[userID]
+	if !ok {
+		if change, found := loadCurrentUsername(userID); found {
+			current = change.Username
+		}
+		r[userID] = current
+	}
+	if current == "" {
+		return stored
+	}
+	return current
+}
+
+func (r usernameResolver) pixels(pixels []Pixel) {
+	for i := range pixels {
+		pixels[i].Username = r.name(pixels[i].UserID, pixels[i].Username)
+	}
+}
+
+func (r usernameResolver) messages(messages []ChatMessage) {
+	for i := range messages {
+		messages[i].Username = r.name(messages[i].UserID, messages[i].Username)
+		if parent := messages[i].Parent; parent != nil {
+			parent.Username = r.name(parent.UserID, parent.Username)
+		}
+	}
+}
+
+func (r usernameResolver) contributors(contributors []Contributor) {
+	for i := range contributors {
+		contributors[i].Username = r.name(contributors[i].UserID, contributors[i].Username)
+	}
+}
+
+//export changeUsername
+func changeUsername(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	// Usernames are global, but session tokens are scoped to the room they were issued for
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	userID, _ := h.Query().Get("userId")
+	username, _ := h.Query().Get("username")
+	if userID == "" || strings.Contains(userID, "/") {
+		return handleHTTPError(h, fmt.Errorf("userId parameter required"), 400)
+	}
+	if code := requireSelfOrAdmin(h, room, userID); code != 0 {
+		return code
+	}
+	if isBanned(room, userID) || isMuted(room, userID) {
+		return handleHTTPError(h, fmt.Errorf("sanctioned users cannot change their name"), 403)
+	}
+	if !usernamePattern.MatchString(username) {
+		return handleHTTPError(h, fmt.Errorf("username must be 3-32 letters, digits, '.', '-' or '_'"), 400)
+	}
+	if reservedUsernames[strings.ToLower(username)] || maskProfanity(username, roomWordList(room)) != username {
+		return handleHTTPError(h, fmt.Errorf("username %s is not allowed", username), 400)
+	}
+	now := time.Now()
+	previous, hasPrevious := loadCurrentUsername(userID)
+	if hasPrevious {
+		if previous.Username == username {
+			return sendJSONResponse(h, previous)
+		}
+		if wait := time.UnixMilli(previous.ChangedAt).Add(usernameChangeCooldown).Sub(now); wait > 0 {
+			h.Headers().Set("Retry-After", fmt.Sprintf("%d", int(wait.Seconds())+1))
+			return handleHTTPError(h, fmt.Errorf("username can be changed again in %d minutes", int(wait.Minutes())+1), 429)
+		}
+	}
+	if !usernameAvailable(username, userID, now) {
+		return handleHTTPError(h, fmt.Errorf("username %s is taken", username), 409)
+	}
+	db, dbErr := getUsernamesDB()
+	if dbErr != 0 {
+		return handleHTTPError(h, fmt.Errorf("database connection failed"), 500)
+	}
+	change := UsernameChange{UserID: userID, Username: username, ChangedAt: now.UnixMilli()}
+	if hasPrevious {
+		change.Previous = previous.Username
+	}
+	if err := putJSON(db, usernameClaimKey(username), UsernameClaim{UserID: userID}); err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	if err := putJSON(db, currentUsernameKey(userID), change); err != nil {
+		return handleHTTPError(h, err, 500)
+	}
+	if err := putJSON(db, usernameHistoryKey(userID, change.ChangedAt), change); err != nil {
+		logError("changeUsername", room, "failed to record history for user %s: %v", userID, err)
+	}
+	// A case-only change keeps the same claim
+	if hasPrevious && !strings.EqualFold(previous.Username, username) {
+		putJSON(db, usernameClaimKey(previous.Username), UsernameClaim{UserID: userID, ReleasedAt: change.ChangedAt})
+	}
+	logInfo("changeUsername", room, "user %s is now %s", userID, username)
+	publishRoomEvent(room, "events", "usernameChanged", change)
+	return sendJSONResponse(h, change)
+}
+
+//export getUsernameHistory
+func getUsernameHistory(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	if userID, _ := h.Query().Get("userId"); userID != "" {
+		response := map[string]interface{}{
+			"userId":  userID,
+			"history": loadUsernameHistory(userID),
+		}
+		if current, found := loadCurrentUsername(userID); found {
+			response["username"] = current.Username
+		}
+		return sendJSONResponse(h, response)
+	}
+	if username, _ := h.Query().Get("username"); username != "" {
+		return sendJSONResponse(h, map[string]interface{}{
+			"username": username,
+			"history":  findUsernameHolders(username),
+		})
+	}
+	return handleHTTPError(h, fmt.Errorf("userId or username parameter required"), 400)
+}
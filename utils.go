@@ -3,6 +3,8 @@ package lib
 import (
 	"encoding/json"
 	"fmt"
+	"io"
+	"strconv"
 
 	http "github.com/taubyte/go-sdk/http/event"
 )
@@ -10,21 +12,28 @@ import (
 func setCORSHeaders(h http.Event) {
 	h.Headers().Set("Access-Control-Allow-Origin", "*")
 	h.Headers().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	h.Headers().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	h.Headers().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, X-Session-Token")
+	h.Headers().Set("Access-Control-Expose-Headers", "X-Maintenance-Banner, X-Has-More, X-Degraded, X-Partial-Result, X-Continuation-Cursor")
 }
 
 func handleHTTPError(h http.Event, err error, code int) uint32 {
+	takeResponseNotice(h)
 	h.Write([]byte(err.Error()))
 	h.Return(code)
 	return 1
 }
 
-func getRoomParam(h http.Event) string {
+// Read the room parameter, falling back per the default room mode when it is missing
+func getRoomParam(h http.Event) (string, uint32) {
 	room, err := h.Query().Get("room")
+	if err == nil && room != "" {
+		return room, 0
+	}
+	room, err = fallbackRoom()
 	if err != nil {
-		return "default"
+		return "", handleHTTPError(h, err, 400)
 	}
-	return room
+	return room, 0
 }
 
 func getRoomParamRequired(h http.Event) (string, uint32) {
@@ -34,23 +43,79 @@ func getRoomParamRequired(h http.Event) (string, uint32) {
 		h.Return(400)
 		return "", 1
 	}
+	if reservedRoomName(room) {
+		return "", handleHTTPError(h, fmt.Errorf("room name %s is reserved", room), 400)
+	}
 	return room, 0
 }
 
 func sendJSONResponse(h http.Event, data interface{}) uint32 {
-	fmt.Printf("[DEBUG] sendJSONResponse called with data type: %T\n", data)
+	logDebug("sendJSONResponse", "", "called with data type: %T", data)
 	jsonData, err := json.Marshal(data)
 	if err != nil {
-		fmt.Printf("[ERROR] sendJSONResponse JSON marshal error: %v\n", err)
+		logError("sendJSONResponse", "", "JSON marshal error: %v", err)
+		takeResponseNotice(h)
 		h.Write([]byte("{\"error\":\"Failed to marshal JSON\"}"))
 		h.Return(500)
 		return 1
 	}
-	fmt.Printf("[DEBUG] sendJSONResponse marshaled %d bytes of JSON data\n", len(jsonData))
+	jsonData = withResponseNotice(h, jsonData)
+	logDebug("sendJSONResponse", "", "marshaled %d bytes of JSON data", len(jsonData))
 	h.Headers().Set("Content-Type", "application/json")
 	h.Write(jsonData)
-	fmt.Printf("[DEBUG] sendJSONResponse wrote JSON data successfully\n")
+	logDebug("sendJSONResponse", "", "wrote JSON data successfully")
 	h.Return(200)
 	return 0
 }
 
+func getIntParam(h http.Event, name string, defaultValue int) int {
+	value, err := h.Query().Get(name)
+	if err != nil || value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return defaultValue
+	}
+	return parsed
+}
+
+func readJSONBody(h http.Event, v interface{}) error {
+	body, err := io.ReadAll(h.Body())
+	if err != nil {
+		return fmt.Errorf("failed to read request body: %v", err)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("invalid JSON body: %v", err)
+	}
+	return nil
+}
+
+// Check for a #rrggbb hex color string
+func isValidHexColor(color string) bool {
+	if len(color) != 7 || color[0] != '#' {
+		return false
+	}
+	for _, c := range color[1:] {
+		if !(c >= '0' && c <= '9') && !(c >= 'a' && c <= 'f') && !(c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// Read the x, y, w and h query parameters of a rectangle inside the room's canvas
+func getRegionParams(h http.Event, room string) (Region, error) {
+	width, height := roomSize(room)
+	region := Region{
+		X:      getIntParam(h, "x", -1),
+		Y:      getIntParam(h, "y", -1),
+		Width:  getIntParam(h, "w", 0),
+		Height: getIntParam(h, "h", 0),
+	}
+	if region.X < 0 || region.Y < 0 || region.Width <= 0 || region.Height <= 0 ||
+		region.X+region.Width > width || region.Y+region.Height > height {
+		return region, fmt.Errorf("region must be inside the %dx%d canvas (x, y, w and h parameters)", width, height)
+	}
+	return region, nil
+}
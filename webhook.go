@@ -0,0 +1,41 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/taubyte/go-sdk/http/client"
+)
+
+// Post a server event to the configured webhook, if any
+func postWebhook(eventType string, data interface{}) error {
+	webhookURL := loadGlobalConfig().WebhookURL
+	if webhookURL == "" {
+		return nil
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"type":      eventType,
+		"timestamp": time.Now().UnixMilli(),
+		"data":      data,
+	})
+	if err != nil {
+		return err
+	}
+	httpClient, err := client.New()
+	if err != nil {
+		return err
+	}
+	request, err := httpClient.Request(webhookURL,
+		client.Method("POST"),
+		client.Headers(map[string][]string{"Content-Type": {"application/json"}}),
+		client.Body(body),
+	)
+	if err != nil {
+		return err
+	}
+	if _, err := request.Do(); err != nil {
+		return fmt.Errorf("webhook %s failed: %v", eventType, err)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package lib
+
+import (
+	"sync"
+	"time"
+
+	"github.com/taubyte/go-sdk/database"
+)
+
+// Upper bound on how long a handler waits for queued writes before finishing them itself
+const writeFlushTimeout = 200 * time.Millisecond
+
+type queuedWrite struct {
+	db   database.Database
+	key  string
+	data []byte
+	done bool
+	err  error
+}
+
+// WriteQueue runs database writes in the background and tracks their completion,
+// so a handler can flush them before returning instead of losing them with the instance
+type WriteQueue struct {
+	synchronous bool
+	mu          sync.Mutex
+	wg          sync.WaitGroup
+	writes      []*queuedWrite
+}
+
+func newWriteQueue(synchronous bool) *WriteQueue {
+	return &WriteQueue{synchronous: synchronous}
+}
+
+// Queue a write and return its index for looking up the result after Flush
+func (q *WriteQueue) Put(db database.Database, key string, data []byte) int {
+	write := &queuedWrite{db: db, key: key, data: data}
+	q.mu.Lock()
+	q.writes = append(q.writes, write)
+	index := len(q.writes) - 1
+	q.mu.Unlock()
+
+	if q.synchronous {
+		write.err = db.Put(key, data)
+		write.done = true
+		return index
+	}
+
+	q.wg.Add(1)
+	go func() {
+		defer q.wg.Done()
+		err := db.Put(key, data)
+		q.mu.Lock()
+		write.err = err
+		write.done = true
+		q.mu.Unlock()
+	}()
+	return index
+}
+
+// Wait up to timeout for queued writes, then complete stragglers and retry failures synchronously.
+// Returns the final error of every write, indexed like Put.
+func (q *WriteQueue) Flush(timeout time.Duration) []error {
+	finished := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(timeout):
+		logError("Flush", "", "WriteQueue flush timed out after %v, finishing pending writes synchronously", timeout)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	results := make([]error, len(q.writes))
+	for i, write := range q.writes {
+		if !write.done || write.err != nil {
+			// Puts are idempotent, so repeating one that is still in flight is safe
+			write.err = write.db.Put(write.key, write.data)
+			write.done = true
+			if write.err != nil {
+				logError("Flush", "", "WriteQueue failed to write key %s: %v", write.key, write.err)
+			}
+		}
+		results[i] = write.err
+	}
+	return results
+}
@@ -0,0 +1,264 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/taubyte/go-sdk/event"
+)
+
+func zonesKey(room string) string {
+	return fmt.Sprintf("/%s/zones", room)
+}
+
+func (z Zone) contains(x, y int) bool {
+	return x >= z.X && x < z.X+z.Width && y >= z.Y && y < z.Y+z.Height
+}
+
+// Team holding a strict majority of the zone's pixels, or ""
+func (z Zone) majorityOwner() string {
+	area := int64(z.Width * z.Height)
+	for team, count := range z.Counts {
+		if count*2 > area {
+			return team
+		}
+	}
+	return ""
+}
+
+func loadZones(room string) []Zone {
+	db, dbErr := getTeamsDB()
+	if dbErr != 0 {
+		return nil
+	}
+	data, err := db.Get(zonesKey(room))
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	var zones []Zone
+	if err := json.Unmarshal(data, &zones); err != nil {
+		logError("loadZones", room, "failed to unmarshal zones: %v", err)
+		return nil
+	}
+	return zones
+}
+
+func saveZones(room string, zones []Zone) uint32 {
+	db, dbErr := getTeamsDB()
+	if dbErr != 0 {
+		return dbErr
+	}
+	data, err := json.Marshal(zones)
+	if err != nil {
+		return 1
+	}
+	if err := db.Put(zonesKey(room), data); err != nil {
+		logError("saveZones", room, "failed to save zones: %v", err)
+		return 1
+	}
+	return 0
+}
+
+// Publish capture and loss events when a zone changes hands
+func publishZoneOwnerChange(room string, zone Zone, previousOwner string) {
+	if previousOwner != "" {
+		publishRoomEvent(room, "events", "zoneLost", map[string]string{"zone": zone.ID, "team": previousOwner})
+	}
+	if zone.Owner != "" {
+		publishRoomEvent(room, "events", "zoneCaptured", map[string]string{"zone": zone.ID, "team": zone.Owner})
+	}
+}
+
+// Track per-zone team counts for a saved batch and detect captures
+func updateZones(room string, changes []PixelChange) uint32 {
+	zones := loadZones(room)
+	if len(zones) == 0 {
+		return 0
+	}
+	changed := false
+	for i := range zones {
+		zone := &zones[i]
+		for _, change := range changes {
+			if !zone.contains(change.Pixel.X, change.Pixel.Y) {
+				continue
+			}
+			previousTeam := ""
+			if change.HadPrevious {
+				previousTeam = change.Previous.Team
+			}
+			if previousTeam == change.Pixel.Team {
+				continue
+			}
+			if zone.Counts == nil {
+				zone.Counts = make(map[string]int64)
+			}
+			if change.Pixel.Team != "" {
+				zone.Counts[change.Pixel.Team]++
+			}
+			if previousTeam != "" {
+				zone.Counts[previousTeam]--
+				if zone.Counts[previousTeam] <= 0 {
+					delete(zone.Counts, previousTeam)
+				}
+			}
+			changed = true
+		}
+		if owner := zone.majorityOwner(); owner != zone.Owner {
+			previousOwner := zone.Owner
+			zone.Owner = owner
+			publishZoneOwnerChange(room, *zone, previousOwner)
+		}
+	}
+	if !changed {
+		return 0
+	}
+	return saveZones(room, zones)
+}
+
+// Empty every zone's counts once the canvas is cleared, releasing held zones
+func resetZones(room string) {
+	zones := loadZones(room)
+	if len(zones) == 0 {
+		return
+	}
+	for i := range zones {
+		previousOwner := zones[i].Owner
+		zones[i].Counts = make(map[string]int64)
+		zones[i].Owner = ""
+		if previousOwner != "" {
+			publishZoneOwnerChange(room, zones[i], previousOwner)
+		}
+	}
+	saveZones(room, zones)
+}
+
+// Count team-owned pixels already inside a new zone
+func countZonePixels(room string, zone *Zone) {
+	zone.Counts = make(map[string]int64)
+	region := Region{X: zone.X, Y: zone.Y, Width: zone.Width, Height: zone.Height}
+	dbErr := forEachRegionPixel(room, region, func(pixel Pixel) {
+		if pixel.Team != "" {
+			zone.Counts[pixel.Team]++
+		}
+	})
+	if dbErr != 0 {
+		logError("countZonePixels", room, "failed to load zone %s pixels", zone.ID)
+	}
+	zone.Owner = zone.majorityOwner()
+}
+
+//export createZone
+func createZone(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := rejectDuringMaintenance(h, room); code != 0 {
+		return code
+	}
+	var zone Zone
+	if err := readJSONBody(h, &zone); err != nil {
+		return handleHTTPError(h, err, 400)
+	}
+	if zone.ID == "" {
+		return handleHTTPError(h, fmt.Errorf("zone id required"), 400)
+	}
+	width, height := roomSize(room)
+	if zone.Width <= 0 || zone.Height <= 0 || zone.X < 0 || zone.Y < 0 ||
+		zone.X+zone.Width > width || zone.Y+zone.Height > height {
+		return handleHTTPError(h, fmt.Errorf("zone must fit inside the %dx%d canvas", width, height), 400)
+	}
+	zones := loadZones(room)
+	for _, existing := range zones {
+		if existing.ID == zone.ID {
+			return handleHTTPError(h, fmt.Errorf("zone already exists: %s", zone.ID), 409)
+		}
+	}
+	countZonePixels(room, &zone)
+	zones = append(zones, zone)
+	if saveZones(room, zones) != 0 {
+		return handleHTTPError(h, fmt.Errorf("failed to save zones"), 500)
+	}
+	return sendJSONResponse(h, zone)
+}
+
+//export deleteZone
+func deleteZone(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	if code := requireAdmin(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := rejectDuringMaintenance(h, room); code != 0 {
+		return code
+	}
+	zoneID, err := h.Query().Get("zone")
+	if err != nil || zoneID == "" {
+		return handleHTTPError(h, fmt.Errorf("zone parameter required"), 400)
+	}
+	zones := loadZones(room)
+	remaining := make([]Zone, 0, len(zones))
+	for _, zone := range zones {
+		if zone.ID != zoneID {
+			remaining = append(remaining, zone)
+		}
+	}
+	if len(remaining) == len(zones) {
+		return handleHTTPError(h, fmt.Errorf("unknown zone: %s", zoneID), 404)
+	}
+	if saveZones(room, remaining) != 0 {
+		return handleHTTPError(h, fmt.Errorf("failed to save zones"), 500)
+	}
+	h.Write([]byte("Zone deleted"))
+	h.Return(200)
+	return 0
+}
+
+//export getZones
+func getZones(e event.Event) uint32 {
+	h, err := e.HTTP()
+	if err != nil {
+		return 1
+	}
+	setCORSHeaders(h)
+	if code := trackKeyUsage(h); code != 0 {
+		return code
+	}
+	room, code := getRoomParamRequired(h)
+	if code != 0 {
+		return code
+	}
+	if code := requireRoom(h, room); code != 0 {
+		return code
+	}
+	if _, code := checkAnonymousRead(h, room); code != 0 {
+		return code
+	}
+	setMaintenanceBanner(h, room)
+	zones := loadZones(room)
+	if zones == nil {
+		zones = []Zone{}
+	}
+	return sendJSONResponse(h, zones)
+}